@@ -0,0 +1,126 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// auth.go authenticates the requests HTTPPool peers send each other.
+
+package groupcache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A Signer attaches credentials to the requests an HTTPPool sends to
+// its peers.
+type Signer interface {
+	Sign(r *http.Request) error
+}
+
+// A Verifier checks the credentials of the requests an HTTPPool
+// receives. Requests for which Verify returns an error are rejected
+// with http.StatusUnauthorized.
+type Verifier interface {
+	Verify(r *http.Request) error
+}
+
+// ErrUnauthenticated is returned by Verifiers for requests that lack
+// valid credentials.
+var ErrUnauthenticated = errors.New("groupcache: unauthenticated peer request")
+
+// BearerToken returns a Signer and Verifier that authenticate requests
+// with token in a bearer Authorization header.
+func BearerToken(token string) interface {
+	Signer
+	Verifier
+} {
+	return bearerToken(token)
+}
+
+type bearerToken string
+
+func (t bearerToken) Sign(r *http.Request) error {
+	r.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+func (t bearerToken) Verify(r *http.Request) error {
+	want := "Bearer " + string(t)
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+const (
+	hmacTimestampHeader = "X-Groupcache-Timestamp"
+	hmacSignatureHeader = "X-Groupcache-Signature"
+)
+
+// HMACAuth returns a Signer and Verifier that authenticate requests
+// with an HMAC-SHA256, keyed by secret, of their method, path and
+// timestamp. Requests whose timestamp is more than maxSkew from the
+// verifier's clock are rejected, limiting replays; a maxSkew of zero
+// means one minute.
+func HMACAuth(secret []byte, maxSkew time.Duration) interface {
+	Signer
+	Verifier
+} {
+	if maxSkew <= 0 {
+		maxSkew = time.Minute
+	}
+	return &hmacAuth{secret: secret, maxSkew: maxSkew, now: time.Now}
+}
+
+type hmacAuth struct {
+	secret  []byte
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+func (a *hmacAuth) mac(r *http.Request, ts string) []byte {
+	m := hmac.New(sha256.New, a.secret)
+	m.Write([]byte(r.Method + "\n" + r.URL.EscapedPath() + "\n" + ts))
+	return m.Sum(nil)
+}
+
+func (a *hmacAuth) Sign(r *http.Request) error {
+	ts := strconv.FormatInt(a.now().Unix(), 10)
+	r.Header.Set(hmacTimestampHeader, ts)
+	r.Header.Set(hmacSignatureHeader, hex.EncodeToString(a.mac(r, ts)))
+	return nil
+}
+
+func (a *hmacAuth) Verify(r *http.Request) error {
+	ts := r.Header.Get(hmacTimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrUnauthenticated
+	}
+	if skew := a.now().Sub(time.Unix(sec, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return ErrUnauthenticated
+	}
+	sig, err := hex.DecodeString(r.Header.Get(hmacSignatureHeader))
+	if err != nil || !hmac.Equal(sig, a.mac(r, ts)) {
+		return ErrUnauthenticated
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	g := newGroup("TestHTTPAuth-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("a key/with slash")}
+
+	tests := []struct {
+		name     string
+		verifier Verifier
+		signer   Signer
+		wantErr  bool
+	}{
+		{"bearer", BearerToken("s3cret"), BearerToken("s3cret"), false},
+		{"wrong bearer", BearerToken("s3cret"), BearerToken("guess"), true},
+		{"hmac", HMACAuth([]byte("key"), 0), HMACAuth([]byte("key"), 0), false},
+		{"wrong hmac key", HMACAuth([]byte("key"), 0), HMACAuth([]byte("other"), 0), true},
+		{"unsigned", HMACAuth([]byte("key"), 0), nil, true},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, Verifier: tt.verifier}})
+		peer := &httpGetter{baseURL: srv.URL + defaultBasePath, signer: tt.signer}
+		err := peer.Get(context.TODO(), req, &pb.GetResponse{})
+		srv.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Get error = %v; want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHMACAuthSkew(t *testing.T) {
+	now := time.Now()
+	signer := &hmacAuth{secret: []byte("key"), maxSkew: time.Minute, now: func() time.Time { return now }}
+	verifier := &hmacAuth{secret: []byte("key"), maxSkew: time.Minute}
+	r := httptest.NewRequest("GET", "/_groupcache/group/key", nil)
+	if err := signer.Sign(r); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		offset  time.Duration
+		wantErr bool
+	}{
+		{0, false},
+		{50 * time.Second, false},
+		{2 * time.Minute, true},
+		{-2 * time.Minute, true},
+	} {
+		verifier.now = func() time.Time { return now.Add(tt.offset) }
+		if err := verifier.Verify(r); (err != nil) != tt.wantErr {
+			t.Errorf("Verify %v after signing = %v; want error: %v", tt.offset, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// maxBatchKeys is the most keys a GetMultiRequest may hold. GetMulti
+// splits larger batches for one peer into several requests.
+const maxBatchKeys = 1000
+
+// errTooManyKeys is returned for a GetMultiRequest of more than
+// maxBatchKeys keys.
+var errTooManyKeys = fmt.Errorf("groupcache: more than %d keys in a batch", maxBatchKeys)
+
+// A BatchSink receives the results of a GetMulti call. Its methods
+// are never called concurrently.
+type BatchSink interface {
+	// SetValue receives the value for key.
+	SetValue(key string, value ByteView) error
+
+	// SetError receives the error that kept key from loading.
+	SetError(key string, err error)
+}
+
+// MapBatchSink returns a BatchSink that stores values in values and
+// errors in errs. Either map may be nil to discard those results.
+func MapBatchSink(values map[string]ByteView, errs map[string]error) BatchSink {
+	return &mapBatchSink{values: values, errs: errs}
+}
+
+type mapBatchSink struct {
+	values map[string]ByteView
+	errs   map[string]error
+}
+
+func (s *mapBatchSink) SetValue(key string, value ByteView) error {
+	if s.values != nil {
+		s.values[key] = value
+	}
+	return nil
+}
+
+func (s *mapBatchSink) SetError(key string, err error) {
+	if s.errs != nil {
+		s.errs[key] = err
+	}
+}
+
+// GetMulti gets the values for keys, delivering each to dest. Keys
+// that are not cached are grouped by owner, and each peer that is a
+// BatchGetter is sent a single request for all of its keys; concurrent
+// identical requests are coalesced. Keys that cannot be fetched from
+// their peer are loaded locally, as by Get.
+//
+// GetMulti calls dest.SetValue or dest.SetError once for each distinct
+// key, and returns the first error passed to dest.SetError, if any.
+func (g *Group) GetMulti(ctx context.Context, keys []string, dest BatchSink) error {
+	if dest == nil {
+		return errors.New("groupcache: nil dest BatchSink")
+	}
+	ckeys := make([]string, len(keys))
+	for i, key := range keys {
+		ckeys[i] = cacheKey("", key)
+	}
+	return g.getMulti(ctx, ckeys, userKeySink{dest})
+}
+
+// userKeySink passes the results of getMulti to a BatchSink under the
+// keys passed to GetMulti.
+type userKeySink struct {
+	BatchSink
+}
+
+func (s userKeySink) SetValue(key string, value ByteView) error {
+	return s.BatchSink.SetValue(userKey("", key), value)
+}
+
+func (s userKeySink) SetError(key string, err error) {
+	s.BatchSink.SetError(userKey("", key), err)
+}
+
+// getMulti is GetMulti of keys made by cacheKey.
+func (g *Group) getMulti(ctx context.Context, keys []string, dest BatchSink) error {
+	g.peersOnce.Do(g.initPeers)
+	if g.isClosed() {
+		return ErrGroupClosed
+	}
+	b := &batch{dest: dest}
+	seen := make(map[string]bool, len(keys))
+	var local []string
+	byPeer := make(map[ProtoGetter][]string)
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		g.Stats.Gets.Add(1)
+		if value, ok := g.lookupCache(key); ok {
+			g.Stats.CacheHits.Add(1)
+			b.setValue(key, value)
+			continue
+		}
+		peer, ok := g.peers.PickPeer(key)
+		if _, batched := peer.(BatchGetter); !ok || !batched {
+			local = append(local, key)
+			continue
+		}
+		byPeer[peer] = append(byPeer[peer], key)
+	}
+
+	var wg sync.WaitGroup
+	for peer, keys := range byPeer {
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > maxBatchKeys {
+				n = maxBatchKeys
+			}
+			wg.Add(1)
+			go func(peer BatchGetter, keys []string) {
+				defer wg.Done()
+				g.getMultiFromPeer(ctx, peer, keys, b)
+			}(peer.(BatchGetter), keys[:n:n])
+			keys = keys[n:]
+		}
+	}
+	for _, key := range local {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			g.loadInto(ctx, key, b)
+		}(key)
+	}
+	wg.Wait()
+	return b.err
+}
+
+// getMultiFromPeer fetches keys from peer in one request and delivers
+// them to b. Keys the peer fails to return are loaded as by Get.
+func (g *Group) getMultiFromPeer(ctx context.Context, peer BatchGetter, keys []string, b *batch) {
+	sort.Strings(keys)
+	g.Stats.Loads.Add(int64(len(keys)))
+	flightKey := peerKey(peer) + "\x00" + strings.Join(keys, "\x00")
+	resi, err := g.batchGroup.Do(flightKey, func() (interface{}, error) {
+		req := &pb.GetMultiRequest{
+			Group: &g.name,
+			Key:   keys,
+		}
+		res := &pb.GetMultiResponse{}
+		if err := peer.GetMulti(ctx, req, res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+	var values []*pb.KeyValue
+	if err != nil {
+		g.countPeerLoads(peer, 0, err)
+	} else {
+		values = resi.(*pb.GetMultiResponse).GetValues()
+	}
+	done := make(map[string]bool, len(values))
+	for _, kv := range values {
+		key := kv.GetKey()
+		if kv.Error != nil || done[key] {
+			continue
+		}
+		done[key] = true
+		g.countPeerLoads(peer, 1, nil)
+		value := ByteView{b: kv.GetValue()}
+		if kv.Expire != nil {
+			value.e = time.Unix(0, kv.GetExpire())
+		}
+		if g.admitHot(key, value) {
+			g.populateCache(key, "", value, &g.hotCache)
+		}
+		b.setValue(key, value)
+	}
+	for _, key := range keys {
+		if !done[key] {
+			g.loadInto(ctx, key, b)
+		}
+	}
+}
+
+// loadInto loads key as Get does on a cache miss and delivers it to b.
+func (g *Group) loadInto(ctx context.Context, key string, b *batch) {
+	var value ByteView
+	value, _, err := g.load(ctx, key, ByteViewSink(&value), GetOptions{})
+	if err != nil {
+		b.setError(key, err)
+		return
+	}
+	b.setValue(key, value)
+}
+
+// peerKey identifies a peer in batch flight keys.
+func peerKey(peer interface{}) string {
+	return fmt.Sprintf("%p", peer)
+}
+
+// batch serializes the results of a GetMulti call.
+type batch struct {
+	mu   sync.Mutex
+	dest BatchSink
+	err  error
+}
+
+func (b *batch) setValue(key string, value ByteView) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.dest.SetValue(key, value); err != nil && b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *batch) setError(key string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dest.SetError(key, err)
+	if b.err == nil {
+		b.err = err
+	}
+}
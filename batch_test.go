@@ -0,0 +1,155 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// batchPeer is a fakePeer that also answers batched requests.
+type batchPeer struct {
+	fakePeer
+	mu      sync.Mutex
+	batches [][]string
+	missing string // key the peer fails to load
+}
+
+func (p *batchPeer) GetMulti(_ context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	p.mu.Lock()
+	p.batches = append(p.batches, in.GetKey())
+	p.mu.Unlock()
+	for _, key := range in.GetKey() {
+		kv := &pb.KeyValue{Key: &key}
+		if key == p.missing {
+			msg := "not found"
+			kv.Error = &msg
+		} else {
+			kv.Value = []byte("batch:" + key)
+		}
+		out.Values = append(out.Values, kv)
+	}
+	return nil
+}
+
+func TestGetMulti(t *testing.T) {
+	peer := &batchPeer{}
+	local := &fakePeer{}
+	g := newGroup("TestGetMulti-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if strings.HasPrefix(key, "bad") {
+			return errors.New("no such key")
+		}
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{peer, local, nil}), nil)
+
+	var keys, peerKeys []string
+	for i := 0; len(peerKeys) < 3 || len(keys) < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if p, _ := g.peers.PickPeer(key); p == peer {
+			peerKeys = append(peerKeys, key)
+		}
+		keys = append(keys, key)
+	}
+	peer.missing = peerKeys[0]
+	// A cached key is not fetched, and a duplicate is fetched once.
+	g.mainCache.add(keys[1], ByteView{s: "cached"})
+	keys = append(keys, keys[0])
+
+	values := make(map[string]ByteView)
+	errs := make(map[string]error)
+	if err := g.GetMulti(dummyCtx, keys, MapBatchSink(values, errs)); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("errors = %v; want none", errs)
+	}
+	for _, key := range keys {
+		want := "got:" + key // from the non-batching peer
+		switch p, _ := g.peers.PickPeer(key); {
+		case key == keys[1]:
+			want = "cached"
+		case key == peer.missing:
+			want = "got:" + key // retried with a plain Get
+		case p == peer:
+			want = "batch:" + key
+		case p == nil:
+			want = "local:" + key
+		}
+		if got := values[key].String(); got != want {
+			t.Errorf("value of %q = %q; want %q", key, got, want)
+		}
+	}
+	if len(peer.batches) != 1 {
+		t.Fatalf("peer got %d batches; want 1", len(peer.batches))
+	}
+	got := peer.batches[0]
+	want := append([]string(nil), peerKeys...)
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("batch = %v; want %v", got, want)
+	}
+
+	// Errors are reported per key.
+	errs = make(map[string]error)
+	err := g.GetMulti(dummyCtx, []string{"bad-1", keys[1]}, MapBatchSink(nil, errs))
+	if err == nil || len(errs) != 1 || errs["bad-1"] == nil {
+		t.Errorf("GetMulti error = %v, per-key errors = %v; want one for bad-1", err, errs)
+	}
+}
+
+func TestGetMultiSplit(t *testing.T) {
+	peer := &batchPeer{}
+	g := newGroup("TestGetMultiSplit-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{peer}), nil)
+
+	keys := make([]string, 2*maxBatchKeys+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	values := make(map[string]ByteView)
+	if err := g.GetMulti(dummyCtx, keys, MapBatchSink(values, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != len(keys) {
+		t.Errorf("got %d values; want %d", len(values), len(keys))
+	}
+	if len(peer.batches) != 3 {
+		t.Errorf("peer got %d batches; want 3", len(peer.batches))
+	}
+	for _, batch := range peer.batches {
+		if len(batch) > maxBatchKeys {
+			t.Errorf("batch of %d keys; want at most %d", len(batch), maxBatchKeys)
+		}
+	}
+
+	// A peer asking for too many keys at once is refused.
+	err := LocalPeer().(BatchGetter).GetMulti(dummyCtx, &pb.GetMultiRequest{Group: &g.name, Key: keys}, &pb.GetMultiResponse{})
+	if err != errTooManyKeys {
+		t.Errorf("GetMulti of %d keys = %v; want errTooManyKeys", len(keys), err)
+	}
+}
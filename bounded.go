@@ -0,0 +1,52 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// bounded.go spreads the keys of overloaded peers to their neighbors,
+// for HTTPPoolOptions.LoadFactor.
+
+package groupcache
+
+// countLoad adds delta to the requests in flight to peer, or served by
+// p itself if peer is p's own URL, as counted for bounded loads.
+func (p *HTTPPool) countLoad(peer string, delta int) {
+	if p.opts.LoadFactor <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	br, ok := p.peers.(BoundedRing)
+	if !ok {
+		return
+	}
+	if delta > 0 {
+		br.Inc(peer)
+	} else {
+		br.Done(peer)
+	}
+}
+
+// serveOptions returns the options of the load of key for a peer
+// request. With bounded loads, a peer may be sent keys that it does not
+// own because their owner is overloaded; it loads them itself instead
+// of passing them on.
+func (p *HTTPPool) serveOptions(key string) GetOptions {
+	if p.opts.LoadFactor <= 0 {
+		return GetOptions{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return GetOptions{LocalOnly: p.ownerLocked(key) != p.self}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPPoolBoundedLoads(t *testing.T) {
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas, LoadFactor: 1.25}}
+	p.Set(self, "http://a", "http://b")
+
+	// Find a key owned by a.
+	key := ""
+	for i := 0; key == ""; i++ {
+		k := string(rune('a' + i))
+		if p.peers.Get(k) == "http://a" {
+			key = k
+		}
+	}
+	peer, _ := p.PickPeer(key)
+	if peer != p.httpGetters["http://a"] {
+		t.Fatal("PickPeer without load did not pick the owner")
+	}
+
+	// Two requests in flight to a overload it; its keys spill.
+	peer.(*httpGetter).load(1)
+	peer.(*httpGetter).load(1)
+	spilled, remote := p.PickPeer(key)
+	if remote && spilled == peer {
+		t.Fatal("PickPeer picked an overloaded owner")
+	}
+	peer.(*httpGetter).load(-1)
+	peer.(*httpGetter).load(-1)
+	if again, _ := p.PickPeer(key); again != peer {
+		t.Error("PickPeer did not return to the owner once its requests ended")
+	}
+}
+
+func TestHTTPPoolBoundedServe(t *testing.T) {
+	var forwarded int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&forwarded, 1)
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+	}))
+	defer other.Close()
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas, LoadFactor: 1.25}}
+	p.Set(self, other.URL)
+	var loads int
+	g := newGroup("TestHTTPPoolBoundedServe-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("value")
+	}), p, nil)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	// A key spilled from its overloaded owner is loaded here rather
+	// than passed back to the owner.
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := string(rune('a' + i)); p.peers.Get(k) == other.URL {
+			key = k
+		}
+	}
+	res, err := http.Get(srv.URL + defaultBasePath + g.Name() + "/" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || loads != 1 {
+		t.Errorf("spilled key: status %d after %d loads; want 200 after a local load", res.StatusCode, loads)
+	}
+	if n := atomic.LoadInt32(&forwarded); n != 0 {
+		t.Errorf("spilled key passed on to its owner %d times", n)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// breaker.go stops sending requests to failing peers for a while.
+
+package groupcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerWindow   = 10 * time.Second
+	defaultBreakerCooldown = 5 * time.Second
+)
+
+// ErrCircuitOpen is returned for requests to a peer whose circuit
+// breaker is open. Get loads such keys locally.
+var ErrCircuitOpen = errors.New("groupcache: peer circuit open")
+
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // requests are sent
+	breakerOpen                         // requests fail with ErrCircuitOpen
+	breakerHalfOpen                     // one trial request is in flight
+)
+
+// breaker is the circuit breaker of one peer. It opens after failures
+// requests fail within window, and lets a trial request through every
+// cooldown until one succeeds. A nil breaker is always closed.
+type breaker struct {
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	state   breakerState
+	count   int       // failures since start
+	start   time.Time // start of the current window
+	openend time.Time // when an open breaker lets a trial through
+}
+
+// newBreaker returns the breaker configured by o, or nil if o disables
+// circuit breaking.
+func newBreaker(o *HTTPPoolOptions) *breaker {
+	if o.BreakerFailures <= 0 {
+		return nil
+	}
+	b := &breaker{
+		failures: o.BreakerFailures,
+		window:   o.BreakerWindow,
+		cooldown: o.BreakerCooldown,
+		now:      time.Now,
+	}
+	if b.window <= 0 {
+		b.window = defaultBreakerWindow
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+	return b
+}
+
+// allow reports whether a request may be sent. A true result from an
+// open breaker makes the request its trial; its outcome must be passed
+// to record.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Before(b.openend) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record records the outcome of a request: nil, or the error if the
+// peer failed it.
+func (b *breaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.state == breakerHalfOpen {
+		if err == nil {
+			b.state = breakerClosed
+			b.count = 0
+		} else {
+			b.openLocked(now)
+		}
+		return
+	}
+	if err == nil || b.state == breakerOpen {
+		return
+	}
+	if now.Sub(b.start) > b.window {
+		b.start = now
+		b.count = 0
+	}
+	b.count++
+	if b.count >= b.failures {
+		b.openLocked(now)
+	}
+}
+
+// abandon records that a request ended without an outcome, such as
+// when its context was canceled.
+func (b *breaker) abandon() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+func (b *breaker) openLocked(now time.Time) {
+	b.state = breakerOpen
+	b.openend = now.Add(b.cooldown)
+}
+
+// isOpen reports whether the breaker turns requests away.
+func (b *breaker) isOpen() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
+
+// OpenCircuits returns the peers whose circuit breakers are open.
+func (p *HTTPPool) OpenCircuits() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var open []string
+	for _, peer := range p.peerList {
+		if g := p.httpGetters[peer]; g != nil && g.breaker.isOpen() {
+			open = append(open, peer)
+		}
+	}
+	return open
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newBreaker(&HTTPPoolOptions{BreakerFailures: 2, BreakerWindow: time.Second, BreakerCooldown: time.Minute})
+	b.now = func() time.Time { return now }
+	fail := errors.New("fail")
+
+	// Failures in different windows do not open the circuit.
+	b.record(fail)
+	now = now.Add(2 * time.Second)
+	b.record(fail)
+	if !b.allow() {
+		t.Fatal("breaker opened on failures in different windows")
+	}
+	b.record(fail)
+	if b.allow() {
+		t.Fatal("breaker is closed after 2 failures in a window")
+	}
+
+	// After the cooldown one trial is let through; a failure reopens.
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("breaker let no trial through after its cooldown")
+	}
+	if b.allow() {
+		t.Fatal("breaker let a second request through while half-open")
+	}
+	b.record(fail)
+	if b.allow() {
+		t.Fatal("breaker closed after a failed trial")
+	}
+
+	// An abandoned trial lets another one through.
+	now = now.Add(time.Minute)
+	b.allow()
+	b.abandon()
+	if !b.allow() {
+		t.Fatal("breaker let no trial through after an abandoned one")
+	}
+	b.record(nil)
+	if !b.allow() || b.isOpen() {
+		t.Fatal("breaker is open after a successful trial")
+	}
+
+	var nilBreaker *breaker
+	if !nilBreaker.allow() {
+		t.Error("nil breaker is open")
+	}
+}
+
+func TestHTTPBreaker(t *testing.T) {
+	srv, reqs := flakyServer(1 << 30)
+	defer srv.Close()
+	peer := &httpGetter{
+		baseURL: srv.URL + defaultBasePath,
+		breaker: newBreaker(&HTTPPoolOptions{BreakerFailures: 2}),
+	}
+	var loads int
+	g := newGroup("TestHTTPBreaker-group", 0, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("value")
+	}), fakePeers([]ProtoGetter{peer}), nil)
+
+	for i := 0; i < 5; i++ {
+		var s string
+		if err := g.Get(context.TODO(), "key", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *reqs != 2 {
+		t.Errorf("peer requests = %d; want 2", *reqs)
+	}
+	if loads != 5 {
+		t.Errorf("local loads = %d; want 5", loads)
+	}
+}
+
+func TestHTTPPoolOpenCircuits(t *testing.T) {
+	p := &HTTPPool{
+		self: "http://a",
+		opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas, BreakerFailures: 1},
+	}
+	p.Set("http://a", "http://b")
+	p.httpGetters["http://b"].breaker.record(errors.New("fail"))
+	if got := p.OpenCircuits(); len(got) != 1 || got[0] != "http://b" {
+		t.Errorf("OpenCircuits = %v; want [http://b]", got)
+	}
+	// The breaker survives peer list updates.
+	p.Set("http://a", "http://b", "http://c")
+	if got := p.OpenCircuits(); len(got) != 1 || got[0] != "http://b" {
+		t.Errorf("OpenCircuits after Set = %v; want [http://b]", got)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"time"
 )
 
 // A ByteView holds an immutable view of bytes.
@@ -33,6 +34,34 @@ type ByteView struct {
 	// If b is non-nil, b is used, else s is used.
 	b []byte
 	s string
+	// e is when the value expires; zero means never.
+	e time.Time
+}
+
+// ByteViewOf returns a view of b without copying it. The caller must
+// not modify b afterwards, and b must stay valid for as long as the view
+// or any copy of it, including one in a cache, is in use. It suits
+// large read-only regions such as a file mapped with MapFile.
+func ByteViewOf(b []byte) ByteView {
+	return ByteView{b: b}
+}
+
+// SetView sets dest's value to v. Sinks that can hold a ByteView,
+// like ByteViewSink, keep v itself instead of copying its bytes, so a
+// Getter can hand a view from ByteViewOf to the cache without a copy.
+func SetView(dest Sink, v ByteView) error {
+	return setSinkView(dest, v)
+}
+
+// Expire returns the time at which the value expires, or the zero
+// time if it never does.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// expired reports whether v has expired at now.
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && !now.Before(v.e)
 }
 
 // Len returns the view's length.
@@ -94,6 +123,12 @@ func (v ByteView) Copy(dest []byte) int {
 // Equal returns whether the bytes in b are the same as the bytes in
 // b2.
 func (v ByteView) Equal(b2 ByteView) bool {
+	if v.b != nil && b2.b != nil && len(v.b) == len(b2.b) &&
+		(len(v.b) == 0 || &v.b[0] == &b2.b[0]) {
+		// Views of the same memory, such as two hits on one
+		// cached value.
+		return true
+	}
 	if b2.b == nil {
 		return v.EqualString(b2.s)
 	}
@@ -144,6 +179,11 @@ func (v ByteView) Reader() io.ReadSeeker {
 	return strings.NewReader(v.s)
 }
 
+var (
+	_ io.ReaderAt = ByteView{}
+	_ io.WriterTo = ByteView{}
+)
+
 // ReadAt implements io.ReaderAt on the bytes in v.
 func (v ByteView) ReadAt(p []byte, off int64) (n int, err error) {
 	if off < 0 {
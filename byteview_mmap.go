@@ -0,0 +1,49 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// MapFile maps the contents of f into memory read-only and returns a
+// ByteView of them, without copying. The view is valid until unmap is
+// called; the caller must make sure nothing, including a group's
+// caches, still uses it by then. f may be closed once MapFile returns.
+func MapFile(f *os.File) (v ByteView, unmap func() error, err error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return ByteView{}, nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return ByteView{}, func() error { return nil }, nil
+	}
+	if int64(int(size)) != size {
+		return ByteView{}, nil, errors.New("groupcache: file too large to map")
+	}
+	b, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return ByteView{}, nil, err
+	}
+	return ByteViewOf(b), func() error { return syscall.Munmap(b) }, nil
+}
@@ -0,0 +1,47 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMapFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "groupcache-mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	const want = "mapped contents"
+	if _, err := f.WriteString(want); err != nil {
+		t.Fatal(err)
+	}
+	v, unmap, err := MapFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unmap()
+	if got := v.String(); got != want {
+		t.Errorf("MapFile view = %q; want %q", got, want)
+	}
+}
@@ -145,3 +145,17 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+func TestByteViewOf(t *testing.T) {
+	b := []byte("shared")
+	var dst ByteView
+	if err := SetView(ByteViewSink(&dst), ByteViewOf(b)); err != nil {
+		t.Fatal(err)
+	}
+	if &dst.b[0] != &b[0] {
+		t.Error("SetView into ByteViewSink copied the bytes")
+	}
+	if !dst.Equal(ByteViewOf(b)) {
+		t.Error("view is not Equal to a view of the same memory")
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// compress.go compresses the responses HTTPPool peers send each other.
+
+package groupcache
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A Compressor implements an HTTP content coding for peer responses.
+// Gzip is built in; other codings, such as snappy or zstd, can be
+// provided by adapting their packages to this interface.
+type Compressor interface {
+	// Name returns the content coding, as used in the Accept-Encoding
+	// and Content-Encoding headers, e.g. "gzip".
+	Name() string
+
+	// NewWriter returns a writer that compresses to w. Closing it
+	// flushes the compressed data but does not close w.
+	NewWriter(w io.Writer) io.WriteCloser
+
+	// NewReader returns a reader that decompresses from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Gzip is the gzip Compressor.
+var Gzip Compressor = gzipCompressor{}
+
+// defaultCompressMinBytes is the default HTTPPoolOptions.CompressMinBytes.
+const defaultCompressMinBytes = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	zw := gzipWriters.Get().(*gzip.Writer)
+	zw.Reset(w)
+	return &pooledGzipWriter{zw}
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// pooledGzipWriter returns its gzip.Writer to gzipWriters when closed.
+type pooledGzipWriter struct {
+	*gzip.Writer
+}
+
+func (w *pooledGzipWriter) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+	err := w.Writer.Close()
+	gzipWriters.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+// acceptEncoding returns the Accept-Encoding header listing cs.
+func acceptEncoding(cs []Compressor) string {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = c.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// negotiateCompressor returns the first of cs, in order of preference,
+// that the request accepts, or nil.
+func negotiateCompressor(r *http.Request, cs []Compressor) Compressor {
+	if len(cs) == 0 {
+		return nil
+	}
+	accepted := make(map[string]bool)
+	for _, field := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(field, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		refused := false
+		for _, p := range params[1:] {
+			p = strings.Replace(p, " ", "", -1)
+			if p == "q=0" || strings.HasPrefix(p, "q=0.") && strings.Trim(p[len("q=0."):], "0") == "" {
+				refused = true
+			}
+		}
+		if name != "" && !refused {
+			accepted[name] = true
+		}
+	}
+	for _, c := range cs {
+		if accepted[c.Name()] {
+			return c
+		}
+	}
+	return nil
+}
+
+// compressorNamed returns the one of cs for the content coding name.
+func compressorNamed(cs []Compressor, name string) Compressor {
+	for _, c := range cs {
+		if strings.EqualFold(c.Name(), name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// decompressedBody reads a response body through a Compressor, closing
+// both when closed.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if cerr := b.body.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
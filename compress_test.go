@@ -0,0 +1,116 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestNegotiateCompressor(t *testing.T) {
+	other := namedCompressor{Gzip, "zstd"}
+	cs := []Compressor{other, Gzip}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, zstd", "zstd"},
+		{"GZIP;q=0.5, br", "gzip"},
+		{"zstd;q=0, gzip", "gzip"},
+		{"zstd; q=0.000", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		got := ""
+		if c := negotiateCompressor(r, cs); c != nil {
+			got = c.Name()
+		}
+		if got != tt.want {
+			t.Errorf("Accept-Encoding %q: negotiated %q; want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// namedCompressor renames a Compressor.
+type namedCompressor struct {
+	Compressor
+	name string
+}
+
+func (c namedCompressor) Name() string { return c.name }
+
+// encodingRecorder is an http.RoundTripper that records the
+// Content-Encoding of responses.
+type encodingRecorder struct {
+	encodings []string
+}
+
+func (r *encodingRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		r.encodings = append(r.encodings, res.Header.Get("Content-Encoding"))
+	}
+	return res, err
+}
+
+func TestHTTPCompression(t *testing.T) {
+	big := strings.Repeat("compressible ", 1000)
+	g := newGroup("TestHTTPCompression-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "small" {
+			return dest.SetString("tiny")
+		}
+		return dest.SetString(big)
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, Compressors: []Compressor{Gzip}}})
+	defer srv.Close()
+	rec := &encodingRecorder{}
+	peer := &httpGetter{
+		baseURL:     srv.URL + defaultBasePath,
+		compressors: []Compressor{Gzip},
+		transport:   func(context.Context) http.RoundTripper { return rec },
+	}
+
+	for _, key := range []string{"big", "small"} {
+		res := &pb.GetResponse{}
+		if err := peer.Get(context.TODO(), &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String(key)}, res); err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]string{"big": big, "small": "tiny"}[key]; string(res.GetValue()) != want {
+			t.Errorf("Get(%q) returned %d bytes; want %d", key, len(res.GetValue()), len(want))
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := peer.GetStream(context.TODO(), &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("big")}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != big {
+		t.Errorf("GetStream returned %d bytes; want %d", buf.Len(), len(big))
+	}
+	if want := []string{"gzip", "", "gzip"}; strings.Join(rec.encodings, ",") != strings.Join(want, ",") {
+		t.Errorf("response encodings = %q; want %q", rec.encodings, want)
+	}
+}
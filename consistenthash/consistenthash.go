@@ -19,33 +19,102 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"hash/fnv"
+	"math"
 	"sort"
-	"strconv"
 )
 
 type Hash func(data []byte) uint32
 
+// Hash64 is a 64-bit hash function for New64, such as xxhash.Sum64.
+// It must hash alike in every process, so hash/maphash, whose seeds
+// are random, can only be used with a seed all peers share.
+type Hash64 func(data []byte) uint64
+
 type Map struct {
 	// hash函数
-	hash     Hash
+	hash     func(data []byte) uint64
+	// 查找key时使用的hash函数
+	keyHash  func(data []byte) uint64
+	// hash值的最大值
+	mask     uint64
+	// 虚拟节点的命名方式
+	labels   Labels
+	// 迁移中按旧命名方式分配key的hash, 以及已迁移的key hash上限
+	old      *Map
+	migrated uint64
 	// ring hash算法中虚拟节点的个数
 	replicas int
 	// 所有虚拟节点对应的hash值
-	keys     []int // Sorted
+	keys     []uint64 // Sorted
 	// 存储hash值和真实节点名字的映射
-	hashMap  map[int]string
+	hashMap  map[uint64]string
+	// 所有真实节点及其权重
+	nodes    map[string]int
+	// 真实节点当前的负载
+	loads    map[string]int
+	load     int // sum of loads
 }
 
 func New(replicas int, fn Hash) *Map {
-	m := &Map{
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return newMap(replicas, func(data []byte) uint64 { return uint64(fn(data)) }, math.MaxUint32)
+}
+
+// New64 is like New, but with a 64-bit hash function, whose larger
+// ring makes the replicas of different keys much less likely to
+// collide. If fn is nil, it defaults to 64-bit FNV-1a with the
+// finalizer of MurmurHash3, since FNV alone barely changes the high
+// bits of its hash between similar short inputs.
+func New64(replicas int, fn Hash64) *Map {
+	if fn == nil {
+		fn = fnv64a
+	}
+	return newMap(replicas, fn, math.MaxUint64)
+}
+
+func newMap(replicas int, fn func(data []byte) uint64, mask uint64) *Map {
+	return &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		keyHash:  fn,
+		mask:     mask,
+		labels:   LabelsLegacy,
+		hashMap:  make(map[uint64]string),
+		nodes:    make(map[string]int),
+		loads:    make(map[string]int),
+	}
+}
+
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// SetKeyHash makes the hash place the keys looked up with Get and the
+// other lookups by fn instead of the hash function that places the
+// replicas of its items. fn's values are cut to the width of the
+// ring, the low 32 bits for a Map made by New. Calling SetKeyHash
+// with nil restores the ring's hash function.
+func (m *Map) SetKeyHash(fn Hash64) {
+	if m.old != nil {
+		m.old.SetKeyHash(fn)
 	}
-	if m.hash == nil {
-		m.hash = crc32.ChecksumIEEE
+	if fn == nil {
+		m.keyHash = m.hash
+		return
 	}
-	return m
+	mask := m.mask
+	m.keyHash = func(data []byte) uint64 { return fn(data) & mask }
 }
 
 // Returns true if there are no items available.
@@ -55,14 +124,159 @@ func (m *Map) IsEmpty() bool {
 
 // Adds some keys to the hash.
 func (m *Map) Add(keys ...string) {
+	var added []uint64
+	for _, key := range keys {
+		added = m.add(added, key, 1)
+	}
+	m.merge(added)
+	if m.old != nil {
+		m.old.Add(keys...)
+	}
+}
+
+// AddWeighted adds key to the hash with weight times as many replicas
+// as Add gives it, so that it owns about weight times as much of the
+// keyspace. A weight of 1 is the same as Add; a key with a weight
+// below 1 is not added.
+func (m *Map) AddWeighted(key string, weight int) {
+	m.merge(m.add(nil, key, weight))
+	if m.old != nil {
+		m.old.AddWeighted(key, weight)
+	}
+}
+
+// Weight returns the weight of key, or 0 if it is not in the hash.
+func (m *Map) Weight(key string) int {
+	return m.nodes[key]
+}
+
+// add records key with weight and appends the hashes of its replicas
+// to added. A key already in the hash is removed first.
+func (m *Map) add(added []uint64, key string, weight int) []uint64 {
+	if _, ok := m.nodes[key]; ok {
+		m.Remove(key)
+	}
+	if weight < 1 {
+		return added
+	}
+	m.nodes[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := m.hash([]byte(m.labels.label(key, i)))
+		added = append(added, hash)
+		m.hashMap[hash] = key
+	}
+	return added
+}
+
+// merge merges the hashes in added into the sorted keys, without
+// sorting the keys already there.
+func (m *Map) merge(added []uint64) {
+	if len(added) == 0 {
+		return
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i] < added[j] })
+	keys := make([]uint64, 0, len(m.keys)+len(added))
+	i, j := 0, 0
+	for i < len(m.keys) && j < len(added) {
+		if m.keys[i] <= added[j] {
+			keys = append(keys, m.keys[i])
+			i++
+		} else {
+			keys = append(keys, added[j])
+			j++
+		}
+	}
+	keys = append(keys, m.keys[i:]...)
+	keys = append(keys, added[j:]...)
+	m.keys = keys
+}
+
+// Remove removes keys from the hash. The other keys keep their share
+// of the keyspace; only that of the removed keys moves, to the keys
+// that follow them on the ring.
+func (m *Map) Remove(keys ...string) {
+	if m.old != nil {
+		m.old.Remove(keys...)
+	}
+	removed := make(map[uint64]int) // replica hashes to count of removals
+	for _, key := range keys {
+		weight, ok := m.nodes[key]
+		if !ok {
+			continue
+		}
+		delete(m.nodes, key)
+		m.load -= m.loads[key]
+		delete(m.loads, key)
+		for i := 0; i < m.replicas*weight; i++ {
+			hash := m.hash([]byte(m.labels.label(key, i)))
+			removed[hash]++
+			if m.hashMap[hash] == key {
+				delete(m.hashMap, hash)
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	kept := m.keys[:0]
+	for _, hash := range m.keys {
+		if removed[hash] > 0 {
+			removed[hash]--
+			continue
+		}
+		kept = append(kept, hash)
+	}
+	m.keys = kept
+	m.reclaim()
+}
+
+// reclaim gives the replica hashes that lost their owner to a removed
+// key colliding with them back to the remaining keys that share them.
+func (m *Map) reclaim() {
+	var orphans []uint64
+	for i, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; !ok && (i == 0 || m.keys[i-1] != hash) {
+			orphans = append(orphans, hash)
+		}
+	}
+	if len(orphans) == 0 {
+		return
+	}
+	for key, weight := range m.nodes {
+		for i := 0; i < m.replicas*weight; i++ {
+			hash := m.hash([]byte(m.labels.label(key, i)))
+			if _, ok := m.hashMap[hash]; !ok {
+				m.hashMap[hash] = key
+			}
+		}
+	}
+}
+
+// Set updates the hash to hold exactly keys, removing the keys not in
+// the list and adding the new ones. Keys already in the hash keep their
+// weight, and the keyspace moves only to and from the changed keys.
+func (m *Map) Set(keys ...string) {
+	want := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		want[key] = true
+	}
+	var gone []string
+	for key := range m.nodes {
+		if !want[key] {
+			gone = append(gone, key)
+		}
+	}
+	m.Remove(gone...)
+	var added []uint64
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		if _, ok := m.nodes[key]; !ok {
+			added = m.add(added, key, 1)
 		}
 	}
-	sort.Ints(m.keys)
+	m.merge(added)
+	if m.old != nil {
+		m.old.Set(keys...)
+	}
 }
 
 // Gets the closest item in the hash to the provided key.
@@ -71,8 +285,15 @@ func (m *Map) Get(key string) string {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key)))
+	hash := m.keyHash([]byte(key))
+	if m.old != nil && hash >= m.migrated {
+		return m.old.Get(key)
+	}
+	return m.owner(hash)
+}
 
+// owner returns the item whose replica is closest to hash.
+func (m *Map) owner(hash uint64) string {
 	// Binary search for appropriate replica.
 	idx := sort.Search(len(m.keys), func(i int) bool { return m.keys[i] >= hash })
 
@@ -83,3 +304,126 @@ func (m *Map) Get(key string) string {
 
 	return m.hashMap[m.keys[idx]]
 }
+
+// Distribution returns the fraction of the hash space that each item
+// owns. With a well-mixing hash function and enough replicas, each
+// fraction is close to the item's share of the total weight.
+func (m *Map) Distribution() map[string]float64 {
+	dist := make(map[string]float64, len(m.nodes))
+	if m.IsEmpty() {
+		return dist
+	}
+	// Each replica owns the hashes after the one before it, up to and
+	// including its own; the first wraps around past the last, and
+	// owns the whole ring if it is the only one.
+	space := float64(m.mask) + 1
+	prev := m.keys[len(m.keys)-1]
+	for i, k := range m.keys {
+		if i == 0 {
+			dist[m.hashMap[k]] += (float64((k-prev-1)&m.mask) + 1) / space
+		} else {
+			dist[m.hashMap[k]] += float64(k-prev) / space
+		}
+		prev = k
+	}
+	return dist
+}
+
+// SampleDistribution returns the fraction of keys that Get maps to
+// each item, to see how a sample of real keys would spread before the
+// hash is put to use.
+func (m *Map) SampleDistribution(keys []string) map[string]float64 {
+	dist := make(map[string]float64, len(m.nodes))
+	if m.IsEmpty() || len(keys) == 0 {
+		return dist
+	}
+	counts := make(map[string]int, len(m.nodes))
+	for _, key := range keys {
+		counts[m.Get(key)]++
+	}
+	for node, n := range counts {
+		dist[node] = float64(n) / float64(len(keys))
+	}
+	return dist
+}
+
+// GetN returns the first n distinct items in the hash clockwise from
+// the provided key, starting with the one Get returns, or all of them
+// if there are fewer than n.
+func (m *Map) GetN(key string, n int) []string {
+	if m.IsEmpty() || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	hash := m.keyHash([]byte(key))
+	if m.old != nil && hash >= m.migrated {
+		return m.old.GetN(key, n)
+	}
+	idx := sort.Search(len(m.keys), func(i int) bool { return m.keys[i] >= hash })
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// GetBounded is like Get, but for consistent hashing with bounded
+// loads: a key whose load would exceed factor times the average load,
+// rounded up, after one more is added is passed over for the next key
+// clockwise on the ring. factor should be above 1; 1.25 is typical.
+// Loads are recorded with Inc and Done.
+func (m *Map) GetBounded(key string, factor float64) string {
+	if m.IsEmpty() {
+		return ""
+	}
+	limit := int(math.Ceil(factor * float64(m.load+1) / float64(len(m.nodes))))
+
+	hash := m.keyHash([]byte(key))
+	if m.old != nil && hash >= m.migrated {
+		return m.old.GetBounded(key, factor)
+	}
+	idx := sort.Search(len(m.keys), func(i int) bool { return m.keys[i] >= hash })
+	for i := 0; i < len(m.keys); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if m.loads[node]+1 <= limit {
+			return node
+		}
+	}
+	return m.Get(key)
+}
+
+// Inc adds one to the load of key, such as when a request is sent to
+// it.
+func (m *Map) Inc(key string) {
+	if _, ok := m.nodes[key]; ok {
+		m.loads[key]++
+		m.load++
+	}
+	if m.old != nil {
+		m.old.Inc(key)
+	}
+}
+
+// Done subtracts one from the load of key, once what Inc counted is
+// done.
+func (m *Map) Done(key string) {
+	if m.loads[key] > 0 {
+		m.loads[key]--
+		m.load--
+	}
+	if m.old != nil {
+		m.old.Done(key)
+	}
+}
+
+// Load returns the load of key.
+func (m *Map) Load(key string) int {
+	return m.loads[key]
+}
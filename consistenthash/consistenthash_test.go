@@ -18,6 +18,7 @@ package consistenthash
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"testing"
 )
@@ -65,6 +66,147 @@ func TestHashing(t *testing.T) {
 
 }
 
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+		return uint32(i)
+	})
+	if got := hash.GetN("1", 2); got != nil {
+		t.Errorf("GetN on an empty map = %v; want none", got)
+	}
+
+	// Replicas with "hashes": 2, 4, 6, 12, 14, 16, 22, 24, 26.
+	hash.Add("6", "4", "2")
+	testCases := []struct {
+		key  string
+		n    int
+		want string
+	}{
+		{"2", 2, "[2 4]"},
+		{"5", 3, "[6 2 4]"},
+		{"25", 2, "[6 2]"},
+		{"27", 5, "[2 4 6]"},
+		{"11", 0, "[]"},
+	}
+	for _, tc := range testCases {
+		if got := fmt.Sprint(hash.GetN(tc.key, tc.n)); got != tc.want {
+			t.Errorf("GetN(%s, %d) = %s; want %s", tc.key, tc.n, got, tc.want)
+		}
+		if nodes := hash.GetN(tc.key, tc.n); len(nodes) > 0 && nodes[0] != hash.Get(tc.key) {
+			t.Errorf("GetN(%s, %d) starts with %s; Get returns %s", tc.key, tc.n, nodes[0], hash.Get(tc.key))
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+		return uint32(i)
+	})
+	if d := hash.Distribution(); len(d) != 0 {
+		t.Errorf("Distribution of an empty map = %v; want none", d)
+	}
+
+	// Replicas with "hashes": 2, 4, 6, 12, 14, 16, 22, 24, 26; "2"
+	// also owns the wrap from 26 around to 2.
+	hash.Add("6", "4", "2")
+	want := map[string]float64{
+		"2": (1<<32 - 26 + 2 + 6 + 6) / float64(1<<32),
+		"4": 6 / float64(1<<32),
+		"6": 6 / float64(1<<32),
+	}
+	d := hash.Distribution()
+	for node, w := range want {
+		if math.Abs(d[node]-w) > 1e-12 {
+			t.Errorf("Distribution()[%s] = %g; want %g", node, d[node], w)
+		}
+	}
+
+	sample := hash.SampleDistribution([]string{"1", "3", "5", "11", "27"})
+	if sample["2"] != 0.6 || sample["4"] != 0.2 || sample["6"] != 0.2 {
+		t.Errorf("SampleDistribution = %v; want 2: 0.6, 4: 0.2, 6: 0.2", sample)
+	}
+}
+
+func TestDistributionBalance(t *testing.T) {
+	hash := New(100, nil)
+	hash.Add("a", "b", "c")
+	hash.AddWeighted("d", 3)
+	var total float64
+	for node, f := range hash.Distribution() {
+		total += f
+		want := 1.0 / 6
+		if node == "d" {
+			want = 0.5
+		}
+		if math.Abs(f-want) > 0.1 {
+			t.Errorf("node %s owns %.3f of the hash space; want about %.3f", node, f, want)
+		}
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("Distribution sums to %g; want 1", total)
+	}
+}
+
+func TestNew64(t *testing.T) {
+	hash := New64(50, nil)
+	hash.Add("a", "b", "c")
+	counts := make(map[string]int)
+	for i := 0; i < 30000; i++ {
+		counts[hash.Get(strconv.Itoa(i))]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		if c := counts[node]; c < 7000 || c > 13000 {
+			t.Errorf("node %s owns %d of 30000 keys; want about 10000", node, c)
+		}
+	}
+	var total float64
+	for _, f := range hash.Distribution() {
+		total += f
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("Distribution sums to %g; want 1", total)
+	}
+
+	one := New64(1, nil)
+	one.Add("a")
+	if d := one.Distribution(); d["a"] != 1 {
+		t.Errorf("Distribution of a single replica = %v; want a: 1", d)
+	}
+}
+
+func TestSetKeyHash(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+		return uint32(i)
+	})
+
+	// Replicas with "hashes": 2, 4, 6, 12, 14, 16, 22, 24, 26.
+	hash.Add("6", "4", "2")
+
+	// Keys go by the key hash, cut to 32 bits, not the ring's.
+	hash.SetKeyHash(func(key []byte) uint64 { return 1<<32 + 13 })
+	if got := hash.Get("2"); got != "4" {
+		t.Errorf("Get(2) with key hash 13 = %s; want 4", got)
+	}
+	if got := hash.GetN("2", 2); fmt.Sprint(got) != "[4 6]" {
+		t.Errorf("GetN(2, 2) with key hash 13 = %v; want [4 6]", got)
+	}
+	hash.SetKeyHash(nil)
+	if got := hash.Get("2"); got != "2" {
+		t.Errorf("Get(2) with the ring hash = %s; want 2", got)
+	}
+}
+
 func TestConsistency(t *testing.T) {
 	hash1 := New(1, nil)
 	hash2 := New(1, nil)
@@ -86,6 +228,136 @@ func TestConsistency(t *testing.T) {
 
 }
 
+func TestAddWeighted(t *testing.T) {
+	hash := New(50, nil)
+	hash.AddWeighted("small", 1)
+	hash.AddWeighted("large", 3)
+	hash.AddWeighted("none", 0)
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Get(strconv.Itoa(i))]++
+	}
+	if counts["none"] != 0 {
+		t.Errorf("key with weight 0 owns %d keys", counts["none"])
+	}
+	if r := float64(counts["large"]) / float64(counts["small"]); r < 2 || r > 4.5 {
+		t.Errorf("large owns %.1f times the keys of small; want about 3", r)
+	}
+
+	// A weight of 1 is the same as Add.
+	added := New(50, nil)
+	added.Add("small")
+	added.AddWeighted("large", 3)
+	for i := 0; i < 1000; i++ {
+		if k := strconv.Itoa(i); hash.Get(k) != added.Get(k) {
+			t.Fatalf("Get(%s) differs between AddWeighted and Add", k)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c")
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		before[k] = hash.Get(k)
+	}
+
+	hash.Remove("b", "missing")
+	if hash.Weight("b") != 0 {
+		t.Error("removed key still has a weight")
+	}
+	for k, owner := range before {
+		got := hash.Get(k)
+		if got == "b" {
+			t.Fatalf("Get(%s) = removed key b", k)
+		}
+		if owner != "b" && got != owner {
+			t.Errorf("Get(%s) moved from %s to %s", k, owner, got)
+		}
+	}
+
+	// Removing and adding back restores the original assignments.
+	hash.Add("b")
+	for k, owner := range before {
+		if got := hash.Get(k); got != owner {
+			t.Errorf("after re-adding b, Get(%s) = %s; want %s", k, got, owner)
+		}
+	}
+
+	hash.Remove("a", "b", "c")
+	if !hash.IsEmpty() {
+		t.Error("hash not empty after removing all keys")
+	}
+}
+
+func TestRemoveCollision(t *testing.T) {
+	// Every replica of every key has the same hash.
+	hash := New(2, func([]byte) uint32 { return 7 })
+	hash.Add("a", "b")
+	hash.Remove("b")
+	if got := hash.Get("x"); got != "a" {
+		t.Errorf("Get after removing a colliding key = %q; want %q", got, "a")
+	}
+}
+
+func TestSet(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b")
+	hash.AddWeighted("c", 2)
+	hash.Set("b", "c", "d")
+
+	fresh := New(50, nil)
+	fresh.Add("b", "d")
+	fresh.AddWeighted("c", 2)
+	for i := 0; i < 1000; i++ {
+		if k := strconv.Itoa(i); hash.Get(k) != fresh.Get(k) {
+			t.Fatalf("Get(%s) = %s after Set; want %s as in a new hash", k, hash.Get(k), fresh.Get(k))
+		}
+	}
+	if hash.Weight("a") != 0 || hash.Weight("c") != 2 || hash.Weight("d") != 1 {
+		t.Errorf("weights after Set = %d, %d, %d; want 0, 2, 1", hash.Weight("a"), hash.Weight("c"), hash.Weight("d"))
+	}
+}
+
+func TestGetBounded(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c")
+	const key = "hot"
+	owner := hash.Get(key)
+	if got := hash.GetBounded(key, 1.25); got != owner {
+		t.Fatalf("GetBounded without load = %s; want the owner %s", got, owner)
+	}
+
+	// With 3 in flight over 3 keys the limit for one more is
+	// ceil(1.25*4/3) = 2, which the owner already has.
+	hash.Inc(owner)
+	hash.Inc(owner)
+	hash.Inc("missing")
+	other := hash.GetBounded(key, 1.25)
+	if other == owner || other == "" {
+		t.Fatalf("GetBounded with an overloaded owner = %q", other)
+	}
+	hash.Inc(other)
+	if n := hash.Load(owner); n != 2 {
+		t.Errorf("Load(%s) = %d; want 2", owner, n)
+	}
+
+	hash.Done(owner)
+	if got := hash.GetBounded(key, 1.25); got != owner {
+		t.Errorf("GetBounded after a request ended = %s; want the owner %s", got, owner)
+	}
+
+	// Removing a key drops its load.
+	hash.Remove(owner)
+	hash.Done(owner)
+	if n := hash.Load(owner); n != 0 {
+		t.Errorf("Load of a removed key = %d; want 0", n)
+	}
+}
+
 func BenchmarkGet8(b *testing.B)   { benchmarkGet(b, 8) }
 func BenchmarkGet32(b *testing.B)  { benchmarkGet(b, 32) }
 func BenchmarkGet128(b *testing.B) { benchmarkGet(b, 128) }
@@ -0,0 +1,127 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import (
+	"math"
+	"strconv"
+)
+
+// Labels is a scheme for naming the replicas of the items in a Map. A
+// replica is placed on the ring by the hash of its label, so peers
+// must use the same Labels to agree on which item owns a key. The zero
+// Labels is LabelsLegacy.
+type Labels int
+
+const (
+	// LabelsLegacy labels replica i of item strconv.Itoa(i)+item, as
+	// Maps always have. Its labels can be ambiguous: replica 1 of
+	// "2a" and replica 12 of "a" are both "12a".
+	LabelsLegacy Labels = iota + 1
+
+	// LabelsV1 labels replica i of item "v1:"+strconv.Itoa(i)+":"+item.
+	// The version tag keeps its labels apart from those of later
+	// schemes, and the separators make them unambiguous.
+	LabelsV1
+)
+
+// label returns the label of replica i of item.
+func (l Labels) label(item string, i int) string {
+	switch l {
+	case LabelsV1:
+		return "v1:" + strconv.Itoa(i) + ":" + item
+	}
+	return strconv.Itoa(i) + item
+}
+
+// SetLabels makes m label the replicas of its items with labels,
+// moving them on the ring. Changing the labels of running peers remaps
+// most keys; see Migrate for doing it in steps.
+func (m *Map) SetLabels(labels Labels) {
+	if labels == 0 {
+		labels = LabelsLegacy
+	}
+	if labels == m.labels {
+		return
+	}
+	m.labels = labels
+	m.rebuild()
+}
+
+// rebuild places the replicas of m's items on the ring again.
+func (m *Map) rebuild() {
+	nodes := m.nodes
+	m.keys = nil
+	m.hashMap = make(map[uint64]string)
+	m.nodes = make(map[string]int, len(nodes))
+	var added []uint64
+	for key, weight := range nodes {
+		added = m.add(added, key, weight)
+	}
+	m.merge(added)
+}
+
+// Migrate moves the keys of m from their owners under the labels from
+// to their owners under m's own labels, for a rolling upgrade between
+// label schemes. Keys whose hash falls below fraction of the hash space
+// go by m's labels; the others go by from. With a fraction of 0, m
+// agrees on every key with Maps still using from, so peers can be
+// upgraded one at a time; raising the fraction on every peer in steps
+// then moves only a slice of the keyspace at a time. At a fraction of
+// 1 the migration is over and m no longer keeps the assignments under
+// from. Items added, removed and loaded apply to both.
+func (m *Map) Migrate(from Labels, fraction float64) {
+	if from == 0 {
+		from = LabelsLegacy
+	}
+	if fraction >= 1 || from == m.labels {
+		m.old = nil
+		return
+	}
+	if m.old == nil || m.old.labels != from {
+		m.old = newMap(m.replicas, m.hash, m.mask)
+		m.old.keyHash = m.keyHash
+		m.old.labels = from
+		for key, weight := range m.nodes {
+			m.old.nodes[key] = weight
+		}
+		m.old.rebuild()
+		for key, load := range m.loads {
+			m.old.loads[key] = load
+		}
+		m.old.load = m.load
+	}
+	m.migrated = 0
+	if fraction > 0 {
+		m.migrated = uint64(math.Min(fraction*(float64(m.mask)+1), float64(m.mask)))
+	}
+}
+
+// GetMigration returns the owners of key under the labels m is
+// migrating from and under its own labels, such as to fetch a key
+// from its old owner while its new one warms up. Without a migration
+// both are Get(key).
+func (m *Map) GetMigration(key string) (from, to string) {
+	if m.old == nil {
+		owner := m.Get(key)
+		return owner, owner
+	}
+	if m.IsEmpty() {
+		return "", ""
+	}
+	return m.old.Get(key), m.owner(m.keyHash([]byte(key)))
+}
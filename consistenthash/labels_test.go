@@ -0,0 +1,94 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	labels := make(map[string]bool)
+	hash := New(2, func(data []byte) uint32 {
+		labels[string(data)] = true
+		return crc32.ChecksumIEEE(data)
+	})
+	hash.Add("a")
+	if !labels["0a"] || !labels["1a"] || len(labels) != 2 {
+		t.Errorf("legacy labels = %v; want 0a and 1a", labels)
+	}
+	labels = make(map[string]bool)
+	hash.SetLabels(LabelsV1)
+	if !labels["v1:0:a"] || !labels["v1:1:a"] || len(labels) != 2 {
+		t.Errorf("v1 labels = %v; want v1:0:a and v1:1:a", labels)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	legacy, v1 := New(50, nil), New(50, nil)
+	v1.SetLabels(LabelsV1)
+	m := New(50, nil)
+	m.SetLabels(LabelsV1)
+	m.Migrate(LabelsLegacy, 0)
+	for _, h := range []*Map{legacy, v1, m} {
+		h.Add("a", "b", "c", "d")
+		h.Remove("d")
+	}
+
+	const keys = 10000
+	for i := 0; i < keys; i++ {
+		k := strconv.Itoa(i)
+		if got, want := m.Get(k), legacy.Get(k); got != want {
+			t.Fatalf("at fraction 0, Get(%s) = %s; want the legacy owner %s", k, got, want)
+		}
+		if from, to := m.GetMigration(k); from != legacy.Get(k) || to != v1.Get(k) {
+			t.Fatalf("GetMigration(%s) = %s, %s; want %s, %s", k, from, to, legacy.Get(k), v1.Get(k))
+		}
+	}
+
+	// Raising the fraction only moves keys to their new owners, and
+	// each step a share of them.
+	moved := make(map[string]bool)
+	for _, fraction := range []float64{0.25, 0.5} {
+		m.Migrate(LabelsLegacy, fraction)
+		n := 0
+		for i := 0; i < keys; i++ {
+			k := strconv.Itoa(i)
+			got := m.Get(k)
+			switch {
+			case got == v1.Get(k) && got != legacy.Get(k):
+				moved[k] = true
+				n++
+			case got != legacy.Get(k):
+				t.Fatalf("at fraction %g, Get(%s) = %s; want %s or %s", fraction, k, got, legacy.Get(k), v1.Get(k))
+			case moved[k]:
+				t.Fatalf("at fraction %g, Get(%s) moved back to %s", fraction, k, got)
+			}
+		}
+		if max := int(fraction * keys); n > max {
+			t.Errorf("at fraction %g, %d keys moved; want at most %d", fraction, n, max)
+		}
+	}
+
+	m.Migrate(LabelsLegacy, 1)
+	for i := 0; i < keys; i++ {
+		if k := strconv.Itoa(i); m.Get(k) != v1.Get(k) {
+			t.Fatalf("after the migration, Get(%s) = %s; want the v1 owner %s", k, m.Get(k), v1.Get(k))
+		}
+	}
+}
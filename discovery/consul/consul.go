@@ -0,0 +1,227 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package consul discovers groupcache peers through the Consul service
+// catalog. Each peer registers itself as an instance of a service with
+// a TTL health check that it keeps passing, and watches the service's
+// healthy instances to keep its pool's peer list current, so instances
+// that fail their checks are dropped:
+//
+//	pool := groupcache.NewHTTPPool("http://10.0.0.1:8080")
+//	d := consul.New(client, "http://10.0.0.1:8080", pool, nil)
+//	go d.Run(ctx)
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/groupcache/discovery"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	defaultService         = "groupcache"
+	defaultScheme          = "http"
+	defaultTTL             = 10 * time.Second
+	defaultDeregisterAfter = time.Minute
+	retryInterval          = time.Second
+)
+
+// Options are the configurations of a Discovery.
+type Options struct {
+	// Service specifies the name of the Consul service.
+	// If blank, it defaults to "groupcache".
+	Service string
+
+	// ID specifies the service ID of this instance.
+	// If blank, it defaults to the service name and this peer's
+	// host and port.
+	ID string
+
+	// Tags optionally specifies tags of this instance.
+	Tags []string
+
+	// Scheme specifies the scheme of peer URLs.
+	// If blank, it defaults to "http".
+	Scheme string
+
+	// TTL specifies the TTL of the instance's health check, which
+	// Run passes twice per TTL. If blank, it defaults to 10 seconds.
+	TTL time.Duration
+
+	// DeregisterAfter specifies how long the instance's check may be
+	// critical before Consul deregisters the instance.
+	// If blank, it defaults to one minute.
+	DeregisterAfter time.Duration
+}
+
+// Discovery keeps a PeerSetter's peer list in sync with the healthy
+// instances of a Consul service.
+type Discovery struct {
+	client  *api.Client
+	self    string
+	updater discovery.Updater
+	opts    Options
+}
+
+// New returns a Discovery that registers self, unless it is empty,
+// and passes the healthy instances to set. Run starts it.
+func New(client *api.Client, self string, set discovery.PeerSetter, o *Options) *Discovery {
+	d := &Discovery{
+		client:  client,
+		self:    self,
+		updater: discovery.Updater{Setter: set},
+	}
+	if o != nil {
+		d.opts = *o
+	}
+	if d.opts.Service == "" {
+		d.opts.Service = defaultService
+	}
+	if d.opts.Scheme == "" {
+		d.opts.Scheme = defaultScheme
+	}
+	if d.opts.TTL <= 0 {
+		d.opts.TTL = defaultTTL
+	}
+	if d.opts.DeregisterAfter <= 0 {
+		d.opts.DeregisterAfter = defaultDeregisterAfter
+	}
+	return d
+}
+
+// Run registers the instance and watches the service's healthy
+// instances until ctx is done, and then deregisters the instance.
+// It returns the error that stopped it, which is ctx.Err() if ctx is
+// done.
+func (d *Discovery) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, 2)
+	n := 1
+	if d.self != "" {
+		id, err := d.register()
+		if err != nil {
+			return err
+		}
+		defer d.client.Agent().ServiceDeregister(id)
+		n++
+		go func() { errc <- d.heartbeat(ctx, "service:"+id) }()
+	}
+	go func() { errc <- d.watch(ctx) }()
+	err := <-errc
+	cancel()
+	for n--; n > 0; n-- {
+		<-errc
+	}
+	return err
+}
+
+// register registers self as an instance of the service and returns
+// its ID.
+func (d *Discovery) register() (string, error) {
+	u, err := url.Parse(d.self)
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", fmt.Errorf("consul: bad port in %q", d.self)
+	}
+	id := d.opts.ID
+	if id == "" {
+		id = d.opts.Service + "-" + net.JoinHostPort(u.Hostname(), port)
+	}
+	reg := &api.AgentServiceRegistration{
+		ID:      id,
+		Name:    d.opts.Service,
+		Tags:    d.opts.Tags,
+		Address: u.Hostname(),
+		Port:    p,
+		Check: &api.AgentServiceCheck{
+			CheckID:                        "service:" + id,
+			TTL:                            d.opts.TTL.String(),
+			DeregisterCriticalServiceAfter: d.opts.DeregisterAfter.String(),
+		},
+	}
+	if err := d.client.Agent().ServiceRegister(reg); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// heartbeat passes the instance's TTL check until ctx is done.
+func (d *Discovery) heartbeat(ctx context.Context, checkID string) error {
+	t := time.NewTicker(d.opts.TTL / 2)
+	defer t.Stop()
+	for {
+		// Failures are retried on the next tick; if they persist,
+		// the check turns critical and the instance is dropped.
+		d.client.Agent().UpdateTTL(checkID, "", api.HealthPassing)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watch follows the service's healthy instances with blocking queries
+// until ctx is done, retrying failed queries.
+func (d *Discovery) watch(ctx context.Context) error {
+	var index uint64
+	for {
+		q := (&api.QueryOptions{WaitIndex: index}).WithContext(ctx)
+		entries, meta, err := d.client.Health().Service(d.opts.Service, "", true, q)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			select {
+			case <-time.After(retryInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		// An index that goes backwards means the agent restarted;
+		// start over rather than waiting for it to catch up.
+		if index = meta.LastIndex; index < q.WaitIndex {
+			index = 0
+		}
+		peers := make([]string, 0, len(entries))
+		for _, e := range entries {
+			addr := e.Service.Address
+			if addr == "" {
+				addr = e.Node.Address
+			}
+			peers = append(peers, d.opts.Scheme+"://"+net.JoinHostPort(addr, strconv.Itoa(e.Service.Port)))
+		}
+		d.updater.Update(peers)
+	}
+}
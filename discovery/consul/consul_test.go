@@ -0,0 +1,179 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// fakeConsul serves the parts of the Consul agent API that Discovery
+// uses. Registered instances are healthy once their check has passed.
+type fakeConsul struct {
+	mu        sync.Mutex
+	changed   chan struct{} // closed and replaced on every change
+	index     uint64
+	services  map[string]*api.AgentServiceRegistration
+	passing   map[string]bool // by check ID
+	heartbeat int
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		changed:  make(chan struct{}),
+		services: make(map[string]*api.AgentServiceRegistration),
+		passing:  make(map[string]bool),
+	}
+}
+
+func (f *fakeConsul) changeLocked() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) add(reg *api.AgentServiceRegistration, passing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services[reg.ID] = reg
+	f.passing["service:"+reg.ID] = passing
+	f.changeLocked()
+}
+
+func (f *fakeConsul) setPassing(id string, passing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.passing["service:"+id] = passing
+	f.changeLocked()
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		reg := new(api.AgentServiceRegistration)
+		if err := json.NewDecoder(r.Body).Decode(reg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.services[reg.ID] = reg
+		f.changeLocked()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		delete(f.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+		f.changeLocked()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/")
+		f.heartbeat++
+		if !f.passing[id] {
+			f.passing[id] = true
+			f.changeLocked()
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+		for wait != 0 && wait >= f.index {
+			changed := f.changed
+			f.mu.Unlock()
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+			}
+			f.mu.Lock()
+			if r.Context().Err() != nil {
+				return
+			}
+		}
+		var entries []*api.ServiceEntry
+		for id, reg := range f.services {
+			if reg.Name == name && f.passing["service:"+id] {
+				entries = append(entries, &api.ServiceEntry{
+					Node:    &api.Node{Address: "10.9.9.9"},
+					Service: &api.AgentService{ID: id, Address: reg.Address, Port: reg.Port},
+				})
+			}
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		json.NewEncoder(w).Encode(entries)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// peerLists records the peer lists it is set to.
+type peerLists chan string
+
+func (c peerLists) Set(peers ...string) { c <- strings.Join(peers, ",") }
+
+func (c peerLists) expect(t *testing.T, want string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-c:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for peers %q", want)
+		}
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	f := newFakeConsul()
+	f.add(&api.AgentServiceRegistration{ID: "b", Name: "groupcache", Address: "10.0.0.2", Port: 8080}, true)
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	client, err := api.NewClient(&api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers := make(peerLists, 100)
+	d := New(client, "http://10.0.0.1:8080", peers, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	peers.expect(t, "http://10.0.0.1:8080,http://10.0.0.2:8080")
+
+	// A peer failing its health check is dropped.
+	f.setPassing("b", false)
+	peers.expect(t, "http://10.0.0.1:8080")
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v; want %v", err, context.Canceled)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.services["groupcache-10.0.0.1:8080"]; ok {
+		t.Error("instance still registered after Run returned")
+	}
+	if f.heartbeat == 0 {
+		t.Error("instance never passed its check")
+	}
+}
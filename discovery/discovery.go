@@ -0,0 +1,76 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package discovery holds what the peer discovery integrations in its
+// subdirectories share. Each integration watches a source of cluster
+// membership and passes the current peers to a PeerSetter.
+package discovery
+
+import (
+	"sort"
+	"sync"
+)
+
+// A PeerSetter receives the current list of peers. groupcache.HTTPPool
+// and grpcpool.Pool implement it.
+type PeerSetter interface {
+	Set(peers ...string)
+}
+
+// Updater passes peer lists to a PeerSetter, calling its Set only
+// when the set of peers changes. It is safe for concurrent use.
+type Updater struct {
+	Setter PeerSetter
+
+	mu   sync.Mutex
+	last []string
+}
+
+// Update sorts and deduplicates peers and passes them to the Setter if
+// they differ from those of the previous call. It reports whether the
+// Setter was called.
+func (u *Updater) Update(peers []string) bool {
+	sorted := make([]string, 0, len(peers))
+	seen := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			sorted = append(sorted, p)
+		}
+	}
+	sort.Strings(sorted)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.last != nil && equal(sorted, u.last) {
+		return false
+	}
+	u.last = sorted
+	u.Setter.Set(sorted...)
+	return true
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
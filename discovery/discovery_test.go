@@ -0,0 +1,48 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"strings"
+	"testing"
+)
+
+type recordingSetter struct {
+	sets []string
+}
+
+func (r *recordingSetter) Set(peers ...string) {
+	r.sets = append(r.sets, strings.Join(peers, ","))
+}
+
+func TestUpdater(t *testing.T) {
+	r := &recordingSetter{}
+	u := &Updater{Setter: r}
+	updates := [][]string{
+		{},
+		{"b", "a", "b", ""},
+		{"a", "b"},
+		{"b"},
+	}
+	for _, peers := range updates {
+		u.Update(peers)
+	}
+	want := []string{"", "a,b", "b"}
+	if strings.Join(r.sets, "|") != strings.Join(want, "|") {
+		t.Errorf("Set calls = %q; want %q", r.sets, want)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dns discovers groupcache peers by resolving a DNS name on an
+// interval, for clusters whose membership is published in DNS, such as
+// round-robin A records or SRV records:
+//
+//	pool := groupcache.NewHTTPPool("http://10.0.0.1:8080")
+//	d := dns.New("groupcache.internal", pool, &dns.Options{Port: 8080})
+//	go d.Run(ctx)
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/groupcache/discovery"
+)
+
+const (
+	defaultPort     = 8080
+	defaultScheme   = "http"
+	defaultInterval = 30 * time.Second
+)
+
+// Options are the configurations of a Discovery.
+type Options struct {
+	// SRV specifies that the name is looked up as SRV records, whose
+	// targets and ports give the peers. Otherwise its A and AAAA
+	// records are looked up and combined with Port.
+	SRV bool
+
+	// Port specifies the port of peers found by A and AAAA records.
+	// If blank, it defaults to 8080.
+	Port int
+
+	// Scheme specifies the scheme of peer URLs.
+	// If blank, it defaults to "http".
+	Scheme string
+
+	// Interval specifies how often the name is resolved.
+	// If blank, it defaults to 30 seconds.
+	Interval time.Duration
+
+	// Resolver optionally specifies the resolver to use.
+	// If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+
+	// OnError optionally receives the errors of failed lookups. The
+	// peer list is left unchanged when a lookup fails.
+	OnError func(error)
+}
+
+// resolver is the part of *net.Resolver a Discovery uses.
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Discovery keeps a PeerSetter's peer list in sync with the records of
+// a DNS name.
+type Discovery struct {
+	name     string
+	resolver resolver
+	updater  discovery.Updater
+	opts     Options
+}
+
+// New returns a Discovery that passes the peers name resolves to to
+// set. Run starts it.
+func New(name string, set discovery.PeerSetter, o *Options) *Discovery {
+	d := &Discovery{
+		name:    name,
+		updater: discovery.Updater{Setter: set},
+	}
+	if o != nil {
+		d.opts = *o
+	}
+	if d.opts.Port == 0 {
+		d.opts.Port = defaultPort
+	}
+	if d.opts.Scheme == "" {
+		d.opts.Scheme = defaultScheme
+	}
+	if d.opts.Interval <= 0 {
+		d.opts.Interval = defaultInterval
+	}
+	d.resolver = d.opts.Resolver
+	if d.opts.Resolver == nil {
+		d.resolver = net.DefaultResolver
+	}
+	return d
+}
+
+// Run resolves the name immediately and then on every interval,
+// passing the peers to the PeerSetter, until ctx is done. It returns
+// ctx.Err().
+func (d *Discovery) Run(ctx context.Context) error {
+	t := time.NewTicker(d.opts.Interval)
+	defer t.Stop()
+	for {
+		d.Resolve(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Resolve resolves the name once and passes the peers to the
+// PeerSetter if they changed.
+func (d *Discovery) Resolve(ctx context.Context) error {
+	peers, err := d.lookup(ctx)
+	if err == nil && len(peers) == 0 {
+		err = fmt.Errorf("dns: no records for %s", d.name)
+	}
+	if err != nil {
+		if d.opts.OnError != nil {
+			d.opts.OnError(err)
+		}
+		return err
+	}
+	d.updater.Update(peers)
+	return nil
+}
+
+func (d *Discovery) lookup(ctx context.Context) ([]string, error) {
+	var peers []string
+	if d.opts.SRV {
+		_, srvs, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range srvs {
+			peers = append(peers, d.url(strings.TrimSuffix(s.Target, "."), int(s.Port)))
+		}
+		return peers, nil
+	}
+	addrs, err := d.resolver.LookupIPAddr(ctx, d.name)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		peers = append(peers, d.url(a.IP.String(), d.opts.Port))
+	}
+	return peers, nil
+}
+
+func (d *Discovery) url(host string, port int) string {
+	return d.opts.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+type fakeResolver struct {
+	addrs []net.IPAddr
+	srvs  []*net.SRV
+	err   error
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r.addrs, r.err
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return name, r.srvs, r.err
+}
+
+type recordingSetter struct {
+	sets []string
+}
+
+func (s *recordingSetter) Set(peers ...string) {
+	s.sets = append(s.sets, strings.Join(peers, ","))
+}
+
+func TestResolveA(t *testing.T) {
+	r := &fakeResolver{addrs: []net.IPAddr{{IP: net.ParseIP("10.0.0.2")}, {IP: net.ParseIP("fd00::1")}}}
+	var errs []error
+	s := &recordingSetter{}
+	d := New("peers.example", s, &Options{Port: 9000, OnError: func(err error) { errs = append(errs, err) }})
+	d.resolver = r
+
+	ctx := context.Background()
+	if err := d.Resolve(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve(ctx) // unchanged
+	r.err = errors.New("lookup failed")
+	if err := d.Resolve(ctx); err == nil {
+		t.Error("Resolve succeeded despite a failed lookup")
+	}
+	r.err = nil
+	r.addrs = r.addrs[:1]
+	d.Resolve(ctx)
+
+	want := []string{"http://10.0.0.2:9000,http://[fd00::1]:9000", "http://10.0.0.2:9000"}
+	if strings.Join(s.sets, "|") != strings.Join(want, "|") {
+		t.Errorf("Set calls = %q; want %q", s.sets, want)
+	}
+	if len(errs) != 1 {
+		t.Errorf("OnError called %d times; want 1", len(errs))
+	}
+}
+
+func TestResolveSRV(t *testing.T) {
+	r := &fakeResolver{srvs: []*net.SRV{
+		{Target: "b.peers.example.", Port: 8001},
+		{Target: "a.peers.example.", Port: 8002},
+	}}
+	s := &recordingSetter{}
+	d := New("_groupcache._tcp.peers.example", s, &Options{SRV: true, Scheme: "https"})
+	d.resolver = r
+	if err := d.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := "https://a.peers.example:8002,https://b.peers.example:8001"
+	if len(s.sets) != 1 || s.sets[0] != want {
+		t.Errorf("Set calls = %q; want [%q]", s.sets, want)
+	}
+
+	// An empty answer is treated as a failure rather than emptying
+	// the peer list.
+	r.srvs = nil
+	if err := d.Resolve(context.Background()); err == nil {
+		t.Error("Resolve of no records succeeded")
+	}
+	if len(s.sets) != 1 {
+		t.Errorf("Set called after an empty answer: %q", s.sets)
+	}
+}
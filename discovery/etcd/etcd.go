@@ -0,0 +1,195 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package etcd discovers groupcache peers through etcd. Each peer
+// registers itself under a key prefix, with a lease that expires if
+// the peer dies, and watches the prefix to keep its pool's peer list
+// current:
+//
+//	pool := groupcache.NewHTTPPool("http://10.0.0.1:8080")
+//	d := etcd.New(client, "http://10.0.0.1:8080", pool, nil)
+//	go d.Run(ctx)
+package etcd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang/groupcache/discovery"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	defaultPrefix = "/groupcache/peers/"
+	defaultTTL    = 10 * time.Second
+)
+
+// errLeaseLost is returned by keepAlive when etcd stops renewing the
+// registration lease.
+var errLeaseLost = errors.New("etcd: registration lease lost")
+
+// Options are the configurations of a Discovery.
+type Options struct {
+	// Prefix specifies the key prefix peers register under.
+	// If blank, it defaults to "/groupcache/peers/".
+	Prefix string
+
+	// TTL specifies the lease time-to-live of the registration,
+	// after which a peer that stopped renewing it is dropped.
+	// If blank, it defaults to 10 seconds.
+	TTL time.Duration
+}
+
+// Discovery keeps a PeerSetter's peer list in sync with the peers
+// registered in etcd.
+type Discovery struct {
+	kv      clientv3.KV
+	watcher clientv3.Watcher
+	lease   clientv3.Lease
+
+	self    string
+	updater discovery.Updater
+	opts    Options
+}
+
+// New returns a Discovery that registers self, unless it is empty,
+// and passes the registered peers to set. Run starts it.
+func New(client *clientv3.Client, self string, set discovery.PeerSetter, o *Options) *Discovery {
+	return newDiscovery(client, client, client, self, set, o)
+}
+
+func newDiscovery(kv clientv3.KV, watcher clientv3.Watcher, lease clientv3.Lease, self string, set discovery.PeerSetter, o *Options) *Discovery {
+	d := &Discovery{
+		kv:      kv,
+		watcher: watcher,
+		lease:   lease,
+		self:    self,
+		updater: discovery.Updater{Setter: set},
+	}
+	if o != nil {
+		d.opts = *o
+	}
+	if d.opts.Prefix == "" {
+		d.opts.Prefix = defaultPrefix
+	}
+	if d.opts.TTL <= 0 {
+		d.opts.TTL = defaultTTL
+	}
+	return d
+}
+
+// Run registers the peer and watches the registered peers until ctx
+// is done or etcd fails, and then revokes the registration. A lost
+// lease is replaced by a new one. Run returns the error that stopped
+// it, which is ctx.Err() if ctx is done.
+func (d *Discovery) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, 2)
+	n := 1
+	if d.self != "" {
+		n++
+		go func() { errc <- d.register(ctx) }()
+	}
+	go func() { errc <- d.watch(ctx) }()
+	err := <-errc
+	cancel()
+	for n--; n > 0; n-- {
+		<-errc
+	}
+	return err
+}
+
+// register keeps self registered under a lease until ctx is done.
+func (d *Discovery) register(ctx context.Context) error {
+	for {
+		lease, err := d.lease.Grant(ctx, int64(d.opts.TTL/time.Second))
+		if err != nil {
+			return err
+		}
+		err = d.keepAlive(ctx, lease.ID)
+		if ctx.Err() != nil {
+			// Drop the registration now rather than when the
+			// lease expires.
+			rctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			d.lease.Revoke(rctx, lease.ID)
+			cancel()
+			return ctx.Err()
+		}
+		if err != errLeaseLost {
+			return err
+		}
+	}
+}
+
+// keepAlive puts self under the lease and renews the lease until ctx is
+// done or the lease is lost.
+func (d *Discovery) keepAlive(ctx context.Context, id clientv3.LeaseID) error {
+	if _, err := d.kv.Put(ctx, d.opts.Prefix+d.self, d.self, clientv3.WithLease(id)); err != nil {
+		return err
+	}
+	ch, err := d.lease.KeepAlive(ctx, id)
+	if err != nil {
+		return err
+	}
+	for range ch {
+	}
+	return errLeaseLost
+}
+
+// watch lists the registered peers and follows their changes until
+// ctx is done, listing them again when the watch is interrupted.
+func (d *Discovery) watch(ctx context.Context) error {
+	for {
+		res, err := d.kv.Get(ctx, d.opts.Prefix, clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		peers := make(map[string]string, len(res.Kvs))
+		for _, kv := range res.Kvs {
+			peers[string(kv.Key)] = string(kv.Value)
+		}
+		d.update(peers)
+
+		wc := d.watcher.Watch(ctx, d.opts.Prefix, clientv3.WithPrefix(), clientv3.WithRev(res.Header.Revision+1))
+		for wr := range wc {
+			if wr.Err() != nil {
+				break
+			}
+			for _, ev := range wr.Events {
+				switch ev.Type {
+				case clientv3.EventTypePut:
+					peers[string(ev.Kv.Key)] = string(ev.Kv.Value)
+				case clientv3.EventTypeDelete:
+					delete(peers, string(ev.Kv.Key))
+				}
+			}
+			d.update(peers)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *Discovery) update(peers map[string]string) {
+	list := make([]string, 0, len(peers))
+	for _, p := range peers {
+		list = append(list, p)
+	}
+	d.updater.Update(list)
+}
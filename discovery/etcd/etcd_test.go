@@ -0,0 +1,218 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd is an in-memory etcd with one watcher. The embedded
+// interfaces are nil; only the methods Discovery uses are implemented.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+	clientv3.Lease
+
+	mu        sync.Mutex
+	rev       int64
+	data      map[string]string
+	leaseKeys map[clientv3.LeaseID][]string
+	lastLease clientv3.LeaseID
+	keepAlive chan *clientv3.LeaseKeepAliveResponse
+	watch     chan clientv3.WatchResponse
+	revoked   []clientv3.LeaseID
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		data:      make(map[string]string),
+		leaseKeys: make(map[clientv3.LeaseID][]string),
+		watch:     make(chan clientv3.WatchResponse, 10),
+	}
+}
+
+func (f *fakeEtcd) set(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rev++
+	f.data[key] = value
+	ev := &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value)}}
+	f.watch <- clientv3.WatchResponse{Events: []*clientv3.Event{ev}}
+}
+
+func (f *fakeEtcd) delete(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rev++
+	delete(f.data, key)
+	ev := &clientv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(key)}}
+	f.watch <- clientv3.WatchResponse{Events: []*clientv3.Event{ev}}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := &clientv3.GetResponse{Header: &pb.ResponseHeader{Revision: f.rev}}
+	for k, v := range f.data {
+		if strings.HasPrefix(k, key) {
+			res.Kvs = append(res.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)})
+		}
+	}
+	return res, nil
+}
+
+// Put records key under the most recently granted lease.
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.set(key, val)
+	f.mu.Lock()
+	f.leaseKeys[f.lastLease] = append(f.leaseKeys[f.lastLease], key)
+	f.mu.Unlock()
+	return &clientv3.PutResponse{}, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case wr := <-f.watch:
+				select {
+				case out <- wr:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastLease++
+	return &clientv3.LeaseGrantResponse{ID: f.lastLease, TTL: ttl}, nil
+}
+
+func (f *fakeEtcd) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	f.mu.Lock()
+	f.keepAlive = ch
+	f.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.keepAlive == ch {
+			close(ch)
+			f.keepAlive = nil
+		}
+	}()
+	return ch, nil
+}
+
+// expireLease makes the current lease lose its keys and its keep-alive.
+func (f *fakeEtcd) expireLease() {
+	f.mu.Lock()
+	keys := f.leaseKeys[f.lastLease]
+	f.mu.Unlock()
+	for _, k := range keys {
+		f.delete(k)
+	}
+	f.mu.Lock()
+	if f.keepAlive != nil {
+		close(f.keepAlive)
+		f.keepAlive = nil
+	}
+	f.mu.Unlock()
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	f.revoked = append(f.revoked, id)
+	f.mu.Unlock()
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+// Close resolves the ambiguity between Watcher.Close and Lease.Close.
+func (f *fakeEtcd) Close() error { return nil }
+
+// peerLists records the peer lists it is set to.
+type peerLists chan string
+
+func (c peerLists) Set(peers ...string) { c <- strings.Join(peers, ",") }
+
+func (c peerLists) expect(t *testing.T, want string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-c:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for peers %q", want)
+		}
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	f := newFakeEtcd()
+	f.set(defaultPrefix+"http://b", "http://b")
+	<-f.watch // already in the initial listing
+	peers := make(peerLists, 100)
+	d := newDiscovery(f, f, f, "http://a", peers, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	peers.expect(t, "http://a,http://b")
+
+	f.delete(defaultPrefix + "http://b")
+	peers.expect(t, "http://a")
+
+	// A lost lease is replaced and the peer registered again.
+	f.expireLease()
+	peers.expect(t, "")
+	peers.expect(t, "http://a")
+	f.mu.Lock()
+	grants := f.lastLease
+	f.mu.Unlock()
+	if grants != 2 {
+		t.Errorf("granted %d leases; want 2", grants)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v; want %v", err, context.Canceled)
+	}
+	if len(f.revoked) != 1 || f.revoked[0] != 2 {
+		t.Errorf("revoked leases %v; want [2]", f.revoked)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gossip maintains groupcache peer membership with the SWIM
+// gossip protocol of hashicorp/memberlist, so that peers discover each
+// other and detect failures without external coordination. A process
+// joins the cluster through any of its members; each member advertises
+// its peer URL, and the URLs of the live members are passed to the
+// pool:
+//
+//	pool := groupcache.NewHTTPPool("http://10.0.0.1:8080")
+//	m, err := gossip.New("http://10.0.0.1:8080", pool, nil)
+//	...
+//	m.Join("10.0.0.2:7946")
+//	defer m.Leave(time.Second)
+package gossip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/discovery"
+	"github.com/hashicorp/memberlist"
+)
+
+// Options are the configurations of a Membership.
+type Options struct {
+	// Config optionally specifies the memberlist configuration, for
+	// its bind address, timeouts and encryption. Its Delegate and
+	// Events are replaced, and a blank Name is replaced by the peer
+	// URL. If nil, memberlist.DefaultLANConfig is used, with the peer
+	// URL as the node name.
+	Config *memberlist.Config
+}
+
+// Membership passes the peer URLs of a gossip cluster's live members,
+// including this one, to a PeerSetter.
+type Membership struct {
+	list    *memberlist.Memberlist
+	updater discovery.Updater
+
+	mu    sync.Mutex
+	peers map[string]string // peer URLs by node name
+}
+
+// New starts a cluster member advertising self as its peer URL and
+// passes the live members to set. Join connects it to other members.
+func New(self string, set discovery.PeerSetter, o *Options) (*Membership, error) {
+	var conf *memberlist.Config
+	if o != nil && o.Config != nil {
+		c := *o.Config
+		conf = &c
+	} else {
+		conf = memberlist.DefaultLANConfig()
+		conf.Name = ""
+	}
+	if conf.Name == "" {
+		conf.Name = self
+	}
+	m := &Membership{
+		updater: discovery.Updater{Setter: set},
+		peers:   make(map[string]string),
+	}
+	conf.Delegate = meta(self)
+	conf.Events = (*events)(m)
+	list, err := memberlist.Create(conf)
+	if err != nil {
+		return nil, err
+	}
+	m.list = list
+	return m, nil
+}
+
+// Join contacts the members at the given addresses, in "host:port"
+// form, to join their cluster. It returns the number of members
+// contacted, and an error if none could be.
+func (m *Membership) Join(addrs ...string) (int, error) {
+	return m.list.Join(addrs)
+}
+
+// Leave announces that the member leaves the cluster, waiting at most
+// timeout for the announcement to spread, and stops it.
+func (m *Membership) Leave(timeout time.Duration) error {
+	err := m.list.Leave(timeout)
+	if serr := m.list.Shutdown(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// Members returns the peer URLs of the live members.
+func (m *Membership) Members() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.membersLocked()
+}
+
+func (m *Membership) membersLocked() []string {
+	peers := make([]string, 0, len(m.peers))
+	for _, p := range m.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// set records whether node is alive and updates the PeerSetter. The
+// update is made under m.mu so that concurrent events cannot pass the
+// PeerSetter an outdated list last.
+func (m *Membership) set(node *memberlist.Node, alive bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if alive && len(node.Meta) > 0 {
+		m.peers[node.Name] = string(node.Meta)
+	} else {
+		delete(m.peers, node.Name)
+	}
+	m.updater.Update(m.membersLocked())
+}
+
+// events updates a Membership as members join, leave or fail.
+type events Membership
+
+func (e *events) NotifyJoin(n *memberlist.Node)   { (*Membership)(e).set(n, true) }
+func (e *events) NotifyLeave(n *memberlist.Node)  { (*Membership)(e).set(n, false) }
+func (e *events) NotifyUpdate(n *memberlist.Node) { (*Membership)(e).set(n, true) }
+
+// meta is a memberlist.Delegate advertising a peer URL as node
+// metadata.
+type meta string
+
+func (m meta) NodeMeta(limit int) []byte {
+	if len(m) > limit {
+		return nil
+	}
+	return []byte(m)
+}
+
+func (meta) NotifyMsg([]byte)                           {}
+func (meta) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (meta) LocalState(join bool) []byte                { return nil }
+func (meta) MergeRemoteState(buf []byte, join bool)     {}
@@ -0,0 +1,81 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gossip
+
+import (
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// peerLists records the peer lists it is set to.
+type peerLists chan string
+
+func (c peerLists) Set(peers ...string) { c <- strings.Join(peers, ",") }
+
+func (c peerLists) expect(t *testing.T, want string) {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case got := <-c:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for peers %q", want)
+		}
+	}
+}
+
+func newMember(t *testing.T, self string, set peerLists) (*Membership, string) {
+	conf := memberlist.DefaultLocalConfig()
+	conf.Name = ""
+	conf.BindAddr = "127.0.0.1"
+	conf.BindPort = 0
+	conf.Logger = log.New(ioutil.Discard, "", 0)
+	m, err := New(self, set, &Options{Config: conf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := m.list.LocalNode()
+	return m, node.Addr.String() + ":" + strconv.Itoa(int(node.Port))
+}
+
+func TestMembership(t *testing.T) {
+	aPeers, bPeers := make(peerLists, 100), make(peerLists, 100)
+	a, aAddr := newMember(t, "http://a", aPeers)
+	defer a.Leave(time.Second)
+	aPeers.expect(t, "http://a")
+
+	b, _ := newMember(t, "http://b", bPeers)
+	if _, err := b.Join(aAddr); err != nil {
+		t.Fatal(err)
+	}
+	aPeers.expect(t, "http://a,http://b")
+	bPeers.expect(t, "http://a,http://b")
+
+	if err := b.Leave(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	aPeers.expect(t, "http://a")
+}
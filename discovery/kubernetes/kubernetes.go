@@ -0,0 +1,210 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubernetes discovers groupcache peers from the EndpointSlices
+// of a headless Service selecting the peer pods, so that the peer list
+// follows a Deployment or StatefulSet as it scales:
+//
+//	self, _ := kubernetes.Self(nil)
+//	pool := groupcache.NewHTTPPool(self)
+//	d := kubernetes.New(clientset, "groupcache", pool, nil)
+//	go d.Run(ctx)
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/groupcache/discovery"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	defaultPort   = 8080
+	defaultScheme = "http"
+
+	// namespaceFile holds the pod's namespace in its service account.
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Options are the configurations of a Discovery.
+type Options struct {
+	// Namespace specifies the namespace of the Service.
+	// If blank, it defaults to the POD_NAMESPACE environment
+	// variable, then to the pod's service account namespace, then
+	// to "default".
+	Namespace string
+
+	// Port specifies the port peers serve groupcache requests on.
+	// If blank, it defaults to 8080.
+	Port int
+
+	// Scheme specifies the scheme of peer URLs.
+	// If blank, it defaults to "http".
+	Scheme string
+
+	// PodIP specifies the IP of the current pod, for Self.
+	// If blank, it defaults to the POD_IP environment variable,
+	// which the downward API can set from status.podIP, then to
+	// the first non-loopback address of the pod's interfaces.
+	PodIP string
+
+	// Resync specifies how often the peer list is recomputed even
+	// without changes. If blank, it is only recomputed on changes.
+	Resync time.Duration
+}
+
+// Discovery keeps a PeerSetter's peer list in sync with the ready
+// endpoints of a headless Service.
+type Discovery struct {
+	client  k8s.Interface
+	service string
+	updater discovery.Updater
+	opts    Options
+}
+
+// New returns a Discovery that passes the peers behind service to set.
+// Run starts it.
+func New(client k8s.Interface, service string, set discovery.PeerSetter, o *Options) *Discovery {
+	return &Discovery{
+		client:  client,
+		service: service,
+		updater: discovery.Updater{Setter: set},
+		opts:    withDefaults(o),
+	}
+}
+
+func withDefaults(o *Options) Options {
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = podNamespace()
+	}
+	if opts.Port == 0 {
+		opts.Port = defaultPort
+	}
+	if opts.Scheme == "" {
+		opts.Scheme = defaultScheme
+	}
+	return opts
+}
+
+func podNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if b, err := ioutil.ReadFile(namespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(b)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// Self returns the URL of the current pod, as it appears in the peer
+// lists a Discovery with the same options passes to its PeerSetter.
+func Self(o *Options) (string, error) {
+	opts := withDefaults(o)
+	ip := opts.PodIP
+	if ip == "" {
+		ip = os.Getenv("POD_IP")
+	}
+	if ip == "" {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return "", err
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && !n.IP.IsLinkLocalUnicast() {
+				ip = n.IP.String()
+				break
+			}
+		}
+	}
+	if ip == "" {
+		return "", errors.New("kubernetes: cannot determine the pod IP")
+	}
+	return peerURL(opts, ip), nil
+}
+
+func peerURL(opts Options, ip string) string {
+	return fmt.Sprintf("%s://%s", opts.Scheme, net.JoinHostPort(ip, strconv.Itoa(opts.Port)))
+}
+
+// Run watches the Service's EndpointSlices and passes the URLs of their
+// ready endpoints to the PeerSetter until ctx is done. It returns
+// ctx.Err().
+func (d *Discovery) Run(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(d.client, d.opts.Resync,
+		informers.WithNamespace(d.opts.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = discoveryv1.LabelServiceName + "=" + d.service
+		}))
+	slices := factory.Discovery().V1().EndpointSlices()
+	lister := slices.Lister().EndpointSlices(d.opts.Namespace)
+	sync := func() {
+		list, err := lister.List(labels.Everything())
+		if err != nil {
+			return
+		}
+		d.updater.Update(d.peers(list))
+	}
+	if _, err := slices.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { sync() },
+		UpdateFunc: func(interface{}, interface{}) { sync() },
+		DeleteFunc: func(interface{}) { sync() },
+	}); err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), slices.Informer().HasSynced) {
+		return ctx.Err()
+	}
+	sync()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// peers returns the URLs of the ready endpoints in slices.
+func (d *Discovery) peers(slices []*discoveryv1.EndpointSlice) []string {
+	var peers []string
+	for _, s := range slices {
+		for _, ep := range s.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				peers = append(peers, peerURL(d.opts, addr))
+			}
+		}
+	}
+	return peers
+}
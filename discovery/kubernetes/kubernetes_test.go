@@ -0,0 +1,107 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// peerLists records the peer lists it is set to.
+type peerLists chan string
+
+func (c peerLists) Set(peers ...string) { c <- strings.Join(peers, ",") }
+
+func (c peerLists) expect(t *testing.T, want string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-c:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for peers %q", want)
+		}
+	}
+}
+
+func endpointSlice(name, service string, ready map[string]bool) *discoveryv1.EndpointSlice {
+	s := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ns",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+	for ip, r := range ready {
+		r := r
+		s.Endpoints = append(s.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: discoveryv1.EndpointConditions{Ready: &r},
+		})
+	}
+	return s
+}
+
+func TestDiscovery(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		endpointSlice("gc-1", "gc", map[string]bool{"10.0.0.1": true, "10.0.0.2": false}),
+		endpointSlice("other-1", "other", map[string]bool{"10.0.9.9": true}),
+	)
+	peers := make(peerLists, 100)
+	d := New(client, "gc", peers, &Options{Namespace: "ns", Port: 9000})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	peers.expect(t, "http://10.0.0.1:9000")
+
+	slices := client.DiscoveryV1().EndpointSlices("ns")
+	s2 := endpointSlice("gc-2", "gc", map[string]bool{"10.0.0.3": true})
+	if _, err := slices.Create(ctx, s2, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	peers.expect(t, "http://10.0.0.1:9000,http://10.0.0.3:9000")
+
+	if err := slices.Delete(ctx, "gc-1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	peers.expect(t, "http://10.0.0.3:9000")
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestSelf(t *testing.T) {
+	self, err := Self(&Options{PodIP: "10.1.2.3", Port: 9000, Scheme: "https"})
+	if err != nil || self != "https://10.1.2.3:9000" {
+		t.Errorf("Self = %q, %v; want %q", self, err, "https://10.1.2.3:9000")
+	}
+	if self, err := Self(&Options{PodIP: "fd00::1"}); err != nil || self != "http://[fd00::1]:8080" {
+		t.Errorf("Self = %q, %v; want %q", self, err, "http://[fd00::1]:8080")
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// drain.go takes a peer out of a pool before it shuts down.
+
+package groupcache
+
+import (
+	"context"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+// serveStart registers a peer request, returning false if the pool is
+// draining and the request must be refused. A true result must be
+// followed by a call to serveDone.
+func (p *HTTPPool) serveStart() bool {
+	p.drainMu.RLock()
+	defer p.drainMu.RUnlock()
+	if p.draining {
+		return false
+	}
+	p.inflight.Add(1)
+	return true
+}
+
+func (p *HTTPPool) serveDone() {
+	p.inflight.Done()
+}
+
+// Drain takes p out of service before the process exits. It marks p
+// as leaving, so that peer requests, including health checks, are
+// refused with 503 Service Unavailable and peers stop sending them,
+// and so that p's own groups fetch every key from the peers that own
+// it once p is gone. Drain then waits for the peer requests in flight
+// to complete and, if the HandoffKeys option is set, pushes the
+// hottest values p owns to their next owners. It returns ctx.Err() if
+// ctx is done first, or else the first error of the handoff.
+func (p *HTTPPool) Drain(ctx context.Context) error {
+	p.drainMu.Lock()
+	p.draining = true
+	p.drainMu.Unlock()
+	p.mu.Lock()
+	p.rebuildLocked()
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if p.opts.HandoffKeys <= 0 {
+		return nil
+	}
+	mu.RLock()
+	var gs []*Group
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+	var firstErr error
+	for _, g := range gs {
+		g.peersOnce.Do(g.initPeers)
+		if g.peers != PeerPicker(p) {
+			continue
+		}
+		if err := p.handoff(ctx, g); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return firstErr
+}
+
+// isDraining reports whether Drain was called.
+func (p *HTTPPool) isDraining() bool {
+	p.drainMu.RLock()
+	defer p.drainMu.RUnlock()
+	return p.draining
+}
+
+// handoff pushes the values of g's hottest keys in its main cache to
+// the peers that own them now that p is draining.
+func (p *HTTPPool) handoff(ctx context.Context, g *Group) error {
+	var firstErr error
+	for _, hk := range g.HotKeys(p.opts.HandoffKeys) {
+		key := cacheKey(hk.Namespace, hk.Key)
+		value, ok := g.mainCache.get(key)
+		if !ok {
+			continue
+		}
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			continue
+		}
+		s, ok := peer.(Setter)
+		if !ok {
+			continue
+		}
+		req := &pb.SetRequest{
+			Group: &g.name,
+			Key:   proto.String(key),
+			Value: value.ByteSlice(),
+		}
+		if hk.Namespace != "" {
+			req.Namespace = proto.String(hk.Namespace)
+		}
+		if !value.e.IsZero() {
+			req.Expire = proto.Int64(value.e.UnixNano())
+		}
+		if err := s.Set(ctx, req); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
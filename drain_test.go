@@ -0,0 +1,142 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPPoolDrain(t *testing.T) {
+	// next records the keys pushed to it.
+	var (
+		mu     sync.Mutex
+		pushed []string
+	)
+	next := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if r.Method == "PUT" {
+			mu.Lock()
+			pushed = append(pushed, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+			mu.Unlock()
+		}
+	}))
+	defer next.Close()
+
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas, HandoffKeys: 1}}
+	p.Set(self, next.URL)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	g := newGroup("TestHTTPPoolDrain-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if strings.HasPrefix(key, "slow") {
+			close(started)
+			<-release
+		}
+		return dest.SetString("value")
+	}), p, &GroupOptions{HotKeyCapacity: 10})
+
+	// Find keys that p owns, making one of them the hottest.
+	var owned []string
+	for i := 0; len(owned) < 2; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, remote := p.PickPeer(key); !remote {
+			owned = append(owned, key)
+		}
+	}
+	slow := "slow"
+	for i := 0; ; i++ {
+		if _, remote := p.PickPeer(slow); !remote {
+			break
+		}
+		slow = fmt.Sprintf("slow-%d", i)
+	}
+	var s string
+	for _, key := range []string{owned[0], owned[0], owned[1]} {
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A peer request in flight holds up Drain.
+	slowDone := make(chan error)
+	go func() {
+		res, err := http.Get(srv.URL + defaultBasePath + g.Name() + "/" + slow)
+		if err == nil {
+			res.Body.Close()
+		}
+		slowDone <- err
+	}()
+	<-started
+	drained := make(chan error)
+	go func() { drained <- p.Drain(context.Background()) }()
+
+	// New requests are refused meanwhile.
+	for !p.isDraining() {
+		time.Sleep(time.Millisecond)
+	}
+	res, err := http.Get(srv.URL + defaultBasePath + healthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("health check while draining = %d; want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+	select {
+	case <-drained:
+		t.Fatal("Drain returned with a request in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("Drain = %v", err)
+	}
+	if _, remote := p.PickPeer(owned[1]); !remote {
+		t.Error("draining pool still owns keys")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushed) != 1 || pushed[0] != owned[0] {
+		t.Errorf("pushed %v; want [%s]", pushed, owned[0])
+	}
+}
+
+func TestHTTPPoolDrainContext(t *testing.T) {
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas}}
+	p.inflight.Add(1)
+	defer p.inflight.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build go1.18
+
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import "context"
+
+// ValueSink returns a sink that decodes values into dest with c. It
+// is CodecSink with the destination's type checked at compile time.
+func ValueSink[T any](c Codec, dest *T) Sink {
+	return CodecSink(c, dest)
+}
+
+// GetValue gets the value for key from g, decoded with c.
+func GetValue[T any](ctx context.Context, g *Group, key string, c Codec) (T, error) {
+	var v T
+	err := g.Get(ctx, key, ValueSink(c, &v))
+	return v, err
+}
+
+// A TypedCodec converts values of type T to and from the bytes stored
+// in a group. CodecOf adapts a Codec.
+type TypedCodec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// CodecOf returns a TypedCodec for T that uses c.
+func CodecOf[T any](c Codec) TypedCodec[T] {
+	return typedCodec[T]{c}
+}
+
+type typedCodec[T any] struct {
+	c Codec
+}
+
+func (tc typedCodec[T]) Marshal(v T) ([]byte, error) {
+	return tc.c.Marshal(v)
+}
+
+func (tc typedCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := tc.c.Unmarshal(data, &v)
+	return v, err
+}
+
+// A TypedGroup is a Group whose values are of type T, loaded by a
+// function that returns them directly and encoded with a TypedCodec,
+// so callers need no Sinks.
+type TypedGroup[T any] struct {
+	g     *Group
+	codec TypedCodec[T]
+}
+
+// NewTypedGroup creates a TypedGroup whose values are loaded by loader.
+// It is like NewGroup, and the group's name must be just as unique.
+func NewTypedGroup[T any](name string, cacheBytes int64, loader func(ctx context.Context, key string) (T, error), codec TypedCodec[T]) *TypedGroup[T] {
+	getter := GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		v, err := loader(ctx, key)
+		if err != nil {
+			return err
+		}
+		b, err := codec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return dest.SetBytes(b)
+	})
+	return &TypedGroup[T]{
+		g:     NewGroup(name, cacheBytes, getter),
+		codec: codec,
+	}
+}
+
+// Group returns the underlying Group, for its stats and other methods.
+func (tg *TypedGroup[T]) Group() *Group {
+	return tg.g
+}
+
+// Get returns the value for key.
+func (tg *TypedGroup[T]) Get(ctx context.Context, key string) (T, error) {
+	var v ByteView
+	if err := tg.g.Get(ctx, key, ByteViewSink(&v)); err != nil {
+		var zero T
+		return zero, err
+	}
+	return tg.codec.Unmarshal(v.ByteSlice())
+}
@@ -0,0 +1,66 @@
+//go:build go1.18
+
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValueSink(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	g := NewGroup("value-sink-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return SetCodec(dest, JSONCodec, user{Name: key, Age: 42})
+	}))
+	var u user
+	if err := g.Get(dummyCtx, "ann", ValueSink(JSONCodec, &u)); err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{"ann", 42}) {
+		t.Errorf("ValueSink decoded %+v; want {ann 42}", u)
+	}
+	u, err := GetValue[user](dummyCtx, g, "bob", JSONCodec)
+	if err != nil || u != (user{"bob", 42}) {
+		t.Errorf("GetValue = %+v, %v; want {bob 42}, nil", u, err)
+	}
+}
+
+func TestTypedGroup(t *testing.T) {
+	type point struct{ X, Y int }
+	var loads int
+	tg := NewTypedGroup("typed-group", 1<<20, func(_ context.Context, key string) (point, error) {
+		loads++
+		return point{len(key), 7}, nil
+	}, CodecOf[point](GobCodec))
+	for i := 0; i < 2; i++ {
+		p, err := tg.Get(dummyCtx, "abc")
+		if err != nil || p != (point{3, 7}) {
+			t.Fatalf("Get = %+v, %v; want {3 7}, nil", p, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d; want 1", loads)
+	}
+	if n := tg.Group().CacheStats(MainCache).Items; n != 1 {
+		t.Errorf("%d items cached; want 1", n)
+	}
+}
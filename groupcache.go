@@ -25,35 +25,48 @@ limitations under the License.
 package groupcache
 
 import (
+	"context"
 	"errors"
+	"io"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	pb "github.com/golang/groupcache/groupcachepb"
 	"github.com/golang/groupcache/lru"
 	"github.com/golang/groupcache/singleflight"
+	"github.com/golang/protobuf/proto"
 )
 
 // A Getter loads data for a key.
 type Getter interface {
 	// Get returns the value identified by key, populating dest.
+	// ctx is the context of the Group.Get call that caused the load,
+	// which may have come from a peer. Loads are shared by
+	// concurrent callers, so ctx is that of the first of them.
 	//
-	// The returned data must be unversioned. That is, key must
+	// The returned data should be unversioned. That is, key should
 	// uniquely describe the loaded data, without an implicit
-	// current time, and without relying on cache expiration
-	// mechanisms.
-	Get(ctx Context, key string, dest Sink) error
+	// current time. Data that does change may be given an
+	// expiration time with dest.SetExpire, after which no cache
+	// serves it.
+	Get(ctx context.Context, key string, dest Sink) error
 }
 
 // A GetterFunc implements Getter with a function.
-type GetterFunc func(ctx Context, key string, dest Sink) error
+type GetterFunc func(ctx context.Context, key string, dest Sink) error
 
-func (f GetterFunc) Get(ctx Context, key string, dest Sink) error {
+func (f GetterFunc) Get(ctx context.Context, key string, dest Sink) error {
 	return f(ctx, key, dest)
 }
 
+// A Middleware wraps a Getter to add behavior around every load, such
+// as tracing, metrics, timeouts or retries. See GroupOptions.Middleware.
+type Middleware func(Getter) Getter
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
@@ -79,13 +92,246 @@ func GetGroup(name string) *Group {
 // other processes receive copies of the answer once the original Get
 // completes.
 //
+// cacheBytes limits the combined size of the group's caches. Each
+// group has its own limit, which SetCacheBytes can change later.
+//
 // The group name must be unique for each getter.
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
-	return newGroup(name, cacheBytes, getter, nil)
+	return newGroup(name, cacheBytes, getter, nil, nil)
+}
+
+// GroupOptions are the configurations of a Group.
+type GroupOptions struct {
+	// CachePolicy specifies the eviction policy of the group's
+	// main cache, and of its hot cache unless HotCachePolicy is set.
+	// If nil, it defaults to LRUPolicy.
+	CachePolicy CachePolicy
+
+	// HotCachePolicy specifies the eviction policy of the group's
+	// hot cache. If nil, it defaults to CachePolicy.
+	HotCachePolicy CachePolicy
+
+	// HotCacheRatio is the size the hot cache may reach, as a
+	// fraction of the main cache's size, before it is evicted from
+	// first when the group is over its byte limit.
+	// If zero, it defaults to 1/8.
+	HotCacheRatio float64
+
+	// DisableHotCache turns off the mirroring of values fetched
+	// from peers, for groups whose loads should always reach the
+	// key's owner.
+	DisableHotCache bool
+
+	// HotCacheAdmission, if positive, enables a TinyLFU admission
+	// filter sized to track about that many distinct keys. Values
+	// fetched from peers are then mirrored in the hot cache while
+	// it has room, and once it is full only if their key has been
+	// requested more often recently than that of the entry they
+	// would evict, instead of for a random tenth of all fetches.
+	// If the hot cache's policy is not an lru.Victimer, as with
+	// ClockPolicy and SampledPolicy, a full hot cache admits keys
+	// fetched more than once recently.
+	HotCacheAdmission int
+
+	// CloneOnGet makes cache hits return a ByteView backed by a
+	// private copy of the cached bytes, so that code reaching into
+	// a ByteView's memory cannot corrupt the cached value. It
+	// costs an allocation and copy per hit.
+	CloneOnGet bool
+
+	// SoftTTL, if positive, is the age after which a cached value
+	// is reloaded in the background. Get keeps serving the old
+	// value until the reload finishes, so popular keys never make
+	// callers wait for a load once cached. A failed reload leaves
+	// the old value in place.
+	SoftTTL time.Duration
+
+	// NegativeTTL, if positive, is how long an error returned by
+	// the Getter is remembered. Until it elapses, Gets of the key
+	// fail with a *CachedError wrapping the error instead of
+	// calling the Getter again, so a missing key hammered by
+	// clients doesn't reach the backend on every request.
+	NegativeTTL time.Duration
+
+	// NamespaceQuotas optionally limits the combined size, in
+	// bytes, of the cached keys and values of namespaces used with
+	// GetNS. A namespace over its quota has its oldest entries
+	// evicted, whatever the group's cache policy.
+	NamespaceQuotas map[string]int64
+
+	// HotKeyCapacity, if positive, makes the group count its most
+	// requested keys, up to that many, for HotKeys. Keys beyond
+	// the capacity displace the least requested ones, so counts
+	// are approximate.
+	HotKeyCapacity int
+
+	// MaxConcurrentLoads, if positive, limits how many calls to the
+	// Getter may run at once, so that a storm of cache misses can't
+	// exhaust the backend. LoadOverflow says what happens to loads
+	// beyond the limit.
+	MaxConcurrentLoads int
+
+	// LoadOverflow is the policy for loads beyond
+	// MaxConcurrentLoads. The default is QueueLoads.
+	LoadOverflow LoadOverflow
+
+	// LoadQueueTimeout, if positive, is the longest a load waits
+	// for a slot under QueueLoads before failing with
+	// ErrTooManyLoads. If zero, it waits until its context is done.
+	LoadQueueTimeout time.Duration
+
+	// FlightShards, if greater than one, splits the bookkeeping that
+	// deduplicates concurrent loads of a key into that many
+	// independently locked shards, for groups with very many
+	// concurrent misses.
+	FlightShards int
+
+	// FlightResultTTL, if positive, keeps the result of a load for
+	// this long after it completes, typically 10 to 100
+	// milliseconds, so that a herd of Gets for the key arriving
+	// just after it share it too, such as an error that is not
+	// cached or a value too large to be.
+	FlightResultTTL time.Duration
+
+	// Middleware wraps the group's Getter. The first Middleware is
+	// outermost: it sees each load first and its result last.
+	Middleware []Middleware
+
+	// MaxValueBytes, if positive, is the size of the largest value
+	// the group caches, so that one enormous value can't evict a
+	// whole cache tier. OversizePolicy says what happens to larger
+	// values loaded by the Getter. Larger values fetched from
+	// peers or passed to Set are never cached.
+	MaxValueBytes int64
+
+	// OversizePolicy is the policy for values larger than
+	// MaxValueBytes. The default is PassOversize.
+	OversizePolicy OversizePolicy
+
+	// AdmitFunc, if non-nil, is asked before any value is added to
+	// the group's caches, whether loaded, fetched from a peer or
+	// passed to Set. Values it refuses are still returned to the
+	// caller, but not cached, so it can keep out error payloads,
+	// empty bodies or per-user data. It must be safe to call
+	// concurrently.
+	AdmitFunc func(key string, value ByteView) bool
+
+	// DefaultTTL, if positive, is the expiration given to values
+	// loaded by the Getter that don't set one with SetExpire.
+	DefaultTTL time.Duration
+
+	// TTLJitter spreads DefaultTTL by up to that fraction either
+	// way, at random, so that values loaded together across the
+	// fleet don't all expire at once. For example, 0.1 gives TTLs
+	// between 90% and 110% of DefaultTTL.
+	TTLJitter float64
+
+	// HedgeDelay, if positive, is how long a load waits for the
+	// peer that owns the key before also loading it with the
+	// Getter. The first value to arrive is used and the other
+	// request is canceled, trading some extra backend load for
+	// better tail latency when a peer is slow.
+	HedgeDelay time.Duration
+
+	// HedgePercentile, if between 0 and 1, hedges loads that take
+	// longer than that percentile of the group's recent peer
+	// fetch latencies, for example 0.95, instead of a fixed delay.
+	// HedgeDelay then bounds the delay from below, and is used
+	// alone until enough latencies are known.
+	HedgePercentile float64
+}
+
+// OversizePolicy is a policy for values loaded by a Getter that are
+// larger than GroupOptions.MaxValueBytes.
+type OversizePolicy int
+
+const (
+	// PassOversize returns oversized values to the caller without
+	// caching them.
+	PassOversize OversizePolicy = iota
+
+	// RejectOversize fails Gets of oversized values with
+	// ErrValueTooLarge.
+	RejectOversize
+
+	// StreamOversize is like PassOversize, but a Get into a
+	// WriterSink whose Getter calls SetReader also stops buffering
+	// the value once it outgrows MaxValueBytes, passing it straight
+	// through to the writer. Concurrent Gets of the key that share
+	// such a load fail with ErrValueTooLarge, as no copy is kept.
+	StreamOversize
+)
+
+// ErrValueTooLarge is returned by Get for values larger than
+// GroupOptions.MaxValueBytes under RejectOversize, and for values that
+// were streamed under StreamOversize to another caller.
+var ErrValueTooLarge = errors.New("groupcache: value too large")
+
+// errStreamedOversize is returned by a load whose value was streamed
+// to its WriterSink without being kept.
+var errStreamedOversize = errors.New("groupcache: oversized value streamed")
+
+// LoadOverflow is a policy for loads that would exceed
+// GroupOptions.MaxConcurrentLoads.
+type LoadOverflow int
+
+const (
+	// QueueLoads makes excess loads wait for a running one to
+	// finish, for up to GroupOptions.LoadQueueTimeout.
+	QueueLoads LoadOverflow = iota
+
+	// RejectLoads makes excess loads fail at once with
+	// ErrTooManyLoads.
+	RejectLoads
+)
+
+// ErrTooManyLoads is returned by Get when a load is shed because the
+// group is at GroupOptions.MaxConcurrentLoads.
+var ErrTooManyLoads = errors.New("groupcache: too many concurrent loads")
+
+// negativeCacheEntries bounds the number of errors a group remembers
+// when GroupOptions.NegativeTTL is set.
+const negativeCacheEntries = 1024
+
+// CachedError is returned by Get in place of a Getter error that was
+// remembered because of GroupOptions.NegativeTTL.
+type CachedError struct {
+	Err error // the error originally returned by the Getter
+}
+
+func (e *CachedError) Error() string {
+	return "groupcache: cached error: " + e.Err.Error()
+}
+
+// Unwrap returns the Getter's original error.
+func (e *CachedError) Unwrap() error {
+	return e.Err
+}
+
+// NoFallbackError is returned by a ProtoGetter for a failed request
+// after which the key should not be loaded locally. Get returns it
+// instead of calling the Getter.
+type NoFallbackError struct {
+	Err error // the error of the peer request
+}
+
+func (e *NoFallbackError) Error() string {
+	return "groupcache: peer failed: " + e.Err.Error()
+}
+
+// Unwrap returns the error of the peer request.
+func (e *NoFallbackError) Unwrap() error {
+	return e.Err
+}
+
+// NewGroupOpts creates a coordinated group-aware Getter from a Getter
+// with the given options. See NewGroup.
+func NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
+	return newGroup(name, cacheBytes, getter, nil, o)
 }
 
 // If peers is nil, the peerPicker is called via a sync.Once to initialize it.
-func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *Group {
+func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker, o *GroupOptions) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -101,6 +347,56 @@ func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *G
 		peers:      peers,
 		cacheBytes: cacheBytes,
 		loadGroup:  &singleflight.Group{},
+		batchGroup: &singleflight.Group{},
+	}
+	g.closed, g.close = context.WithCancelCause(context.Background())
+	if o != nil {
+		g.opts = *o
+	}
+	for i := len(g.opts.Middleware) - 1; i >= 0; i-- {
+		g.getter = g.opts.Middleware[i](g.getter)
+		if g.getter == nil {
+			panic("groupcache: Middleware returned nil Getter")
+		}
+	}
+	g.mainCache.policy = g.opts.CachePolicy
+	g.hotCache.policy = g.opts.CachePolicy
+	if g.opts.HotCachePolicy != nil {
+		g.hotCache.policy = g.opts.HotCachePolicy
+	}
+	g.mainCache.cloneOnGet = g.opts.CloneOnGet
+	g.hotCache.cloneOnGet = g.opts.CloneOnGet
+	for _, c := range []*cache{&g.mainCache, &g.hotCache} {
+		c := c
+		which := MainCache
+		if c == &g.hotCache {
+			which = HotCache
+		}
+		c.generation = &g.generation
+		c.onAdd = func(key, ns string, size int64) { g.nsAdded(c, key, ns, size) }
+		c.onRemove = func(key, ns string, size int64, reason lru.EvictReason) {
+			g.nsRemoved(c, key, ns, size)
+			g.notifyEvict(key, size, which, reason)
+		}
+	}
+	if n := g.opts.HotCacheAdmission; n > 0 {
+		g.hotAdmission = lru.NewTinyLFU(n)
+	}
+	if g.opts.NegativeTTL > 0 {
+		g.negCache = lru.New(negativeCacheEntries)
+	}
+	if n := g.opts.HotKeyCapacity; n > 0 {
+		g.hotKeys = lru.NewTopK(n)
+	}
+	if n := g.opts.MaxConcurrentLoads; n > 0 {
+		g.loadSlots = make(chan struct{}, n)
+	}
+	if n := g.opts.FlightShards; n > 1 {
+		sg := singleflight.NewShardedGroup(n)
+		sg.SetResultTTL(g.opts.FlightResultTTL)
+		g.loadGroup = sg
+	} else if ttl := g.opts.FlightResultTTL; ttl > 0 {
+		g.loadGroup = &singleflight.Group{ResultTTL: ttl}
 	}
 	if fn := newGroupHook; fn != nil {
 		fn(g)
@@ -109,6 +405,81 @@ func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *G
 	return g
 }
 
+// ErrGroupClosed is returned by the methods of a Group after Close.
+var ErrGroupClosed = errors.New("groupcache: group closed")
+
+// ErrNotSupported is returned when an operation needs a peer to
+// implement an optional interface, such as Remover or Setter, that it
+// does not.
+var ErrNotSupported = errors.New("groupcache: operation not supported by peer")
+
+// DeregisterGroup closes the named group, if there is one, so that a
+// new group may be created with its name. See Group.Close.
+func DeregisterGroup(name string) {
+	if g := GetGroup(name); g != nil {
+		g.Close()
+	}
+}
+
+// Close tears down the group: it is removed from the registry, so its
+// name may be reused and peers can no longer reach it, its caches are
+// flushed, and Get calls, including those waiting for a load, return
+// ErrGroupClosed. Loads already running are canceled once no Get waits
+// for them, and their values are not cached. Close always returns nil.
+func (g *Group) Close() error {
+	g.closeOnce.Do(func() {
+		mu.Lock()
+		if groups[g.name] == g {
+			delete(groups, g.name)
+		}
+		mu.Unlock()
+		g.close(ErrGroupClosed)
+		g.Flush()
+	})
+	return nil
+}
+
+// Flush drops every value from the group's caches in this process,
+// along with any remembered Getter errors. Peers are not affected.
+func (g *Group) Flush() {
+	g.mainCache.clear()
+	g.hotCache.clear()
+	if g.negCache != nil {
+		g.negMu.Lock()
+		g.negCache.Clear()
+		g.negMu.Unlock()
+	}
+}
+
+// PurgePrefix removes the values of all keys that start with prefix
+// from the group's caches in this process, along with any remembered
+// Getter errors for them, and returns the number of values removed.
+// It takes time proportional to the number of cached keys. Peers are
+// not affected.
+func (g *Group) PurgePrefix(prefix string) int {
+	prefix = cacheKey("", prefix)
+	n := g.mainCache.purgePrefix(prefix) + g.hotCache.purgePrefix(prefix)
+	if g.negCache != nil {
+		g.negMu.Lock()
+		for _, k := range g.negCache.Keys() {
+			if strings.HasPrefix(k.(string), prefix) {
+				g.negCache.Remove(k)
+			}
+		}
+		g.negMu.Unlock()
+	}
+	return n
+}
+
+func (g *Group) isClosed() bool {
+	select {
+	case <-g.closed.Done():
+		return true
+	default:
+		return false
+	}
+}
+
 // newGroupHook, if non-nil, is called right after a new group is created.
 var newGroupHook func(*Group)
 
@@ -139,11 +510,25 @@ func callInitPeerServer() {
 // A Group is a cache namespace and associated data loaded spread over
 // a group of 1 or more machines.
 type Group struct {
-	name       string
-	getter     Getter
-	peersOnce  sync.Once
-	peers      PeerPicker
-	cacheBytes int64 // limit for sum of mainCache and hotCache size
+	// Stats are statistics on the group. It is the first field so
+	// that its AtomicInts are 8-byte aligned on 32-bit platforms.
+	Stats Stats
+
+	// cacheBytes is the limit for the sum of the mainCache and
+	// hotCache sizes. It is accessed atomically and follows Stats
+	// so that it is 8-byte aligned on 32-bit platforms.
+	cacheBytes int64
+
+	// generation is the group's current generation; cached values
+	// of earlier generations are ignored. It is accessed
+	// atomically and, like cacheBytes, must stay 8-byte aligned.
+	generation uint64
+
+	name      string
+	getter    Getter
+	peersOnce sync.Once
+	peers     PeerPicker
+	opts      GroupOptions
 
 	// mainCache is a cache of the keys for which this process
 	// (amongst its peers) is authoritative. That is, this cache
@@ -161,15 +546,45 @@ type Group struct {
 	// of key/value pairs that can be stored globally.
 	hotCache cache
 
+	// hotAdmission, if non-nil, decides which values fetched from
+	// peers are popular enough to be added to hotCache.
+	hotAdmission *lru.TinyLFU
+	admissionMu  sync.Mutex // guards hotAdmission
+
+	refreshMu  sync.Mutex
+	refreshing map[string]bool // keys with a background reload in flight
+
+	negMu    sync.Mutex
+	negCache *lru.Cache // Getter errors, if opts.NegativeTTL > 0
+
+	nsMu       sync.Mutex
+	namespaces map[string]*namespace // keyed by name, for GetNS
+
+	hotKeysMu sync.Mutex
+	hotKeys   *lru.TopK // if opts.HotKeyCapacity > 0
+
+	loadSlots chan struct{} // if opts.MaxConcurrentLoads > 0
+
+	peerStatsMu sync.Mutex
+	peerStats   map[string]*peerCounters // keyed by peerName
+
+	peerLatency latencyWindow // of recent peer fetches, for opts.HedgePercentile
+
+	evictMu    sync.RWMutex
+	evictHooks []func(key string, size int64, which CacheType, reason lru.EvictReason)
+
 	// loadGroup ensures that each key is only fetched once
 	// (either locally or remotely), regardless of the number of
 	// concurrent callers.
 	loadGroup flightGroup
 
-	_ int32 // force Stats to be 8-byte aligned on 32-bit platforms
+	// batchGroup coalesces identical concurrent GetMulti requests
+	// to a peer.
+	batchGroup flightGroup
 
-	// Stats are statistics on the group.
-	Stats Stats
+	closeOnce sync.Once
+	closed    context.Context // done, with cause ErrGroupClosed, once Close is called
+	close     context.CancelCauseFunc
 }
 
 // flightGroup is defined as an interface which flightgroup.Group
@@ -180,6 +595,25 @@ type flightGroup interface {
 	Do(key string, fn func() (interface{}, error)) (interface{}, error)
 }
 
+// contextFlightGroup is implemented by flightGroups whose calls outlive
+// the caller that started them if it gives up, as those of
+// singleflight.Group's DoContext do.
+type contextFlightGroup interface {
+	DoContext(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error)
+}
+
+// chanFlightGroup is implemented by flightGroups that can hand the
+// results of a call to a channel, as singleflight.Group's DoChan does.
+type chanFlightGroup interface {
+	DoChan(key string, fn func() (interface{}, error)) <-chan singleflight.Result
+}
+
+// flightForgetter is implemented by flightGroups that can forget a
+// key in flight, as singleflight.Group does.
+type flightForgetter interface {
+	Forget(key string)
+}
+
 // Stats are per-group statistics.
 type Stats struct {
 	Gets           AtomicInt // any Get request, including from peers
@@ -191,6 +625,14 @@ type Stats struct {
 	LocalLoads     AtomicInt // total good local loads
 	LocalLoadErrs  AtomicInt // total bad local loads
 	ServerRequests AtomicInt // gets that came over the network from peers
+	Refreshes      AtomicInt // background reloads of values older than SoftTTL
+	NegativeHits   AtomicInt // loads answered from the negative cache
+	LoadsShed      AtomicInt // loads failed by MaxConcurrentLoads
+	OversizeLoads  AtomicInt // local loads larger than MaxValueBytes
+	NotAdmitted    AtomicInt // values AdmitFunc kept out of the caches
+	HedgedLoads    AtomicInt // peer fetches raced against a local load
+	HedgeWins      AtomicInt // hedged loads answered first by the local load
+	ReplicaLoads   AtomicInt // values fetched from a replica after the owner failed
 }
 
 // Name returns the name of the group.
@@ -204,25 +646,120 @@ func (g *Group) initPeers() {
 	}
 }
 
-func (g *Group) Get(ctx Context, key string, dest Sink) error {
+// GetOptions modify a single Get. See Group.GetWithOptions.
+type GetOptions struct {
+	// LocalOnly never contacts peers: on a cache miss the value is
+	// loaded by this process's Getter, even for keys owned by a
+	// peer.
+	LocalOnly bool
+
+	// SkipHotCache neither reads from nor adds to the hot cache,
+	// so values owned by peers are always fetched from the owner.
+	SkipHotCache bool
+
+	// ForceRefresh ignores and drops any cached value and reloads
+	// it, caching the result as usual. For a key owned by a peer,
+	// the owner is first asked to remove its cached value, so that
+	// it reloads too; if the owner is not a Remover, the key is
+	// loaded locally instead.
+	ForceRefresh bool
+
+	// namespace is the namespace of the key, as passed to GetNS.
+	namespace string
+}
+
+// flightKey returns the key under which loads of key, made by
+// cacheKey, with these options are deduplicated. Only loads with
+// identical options are shared, and key tells namespaces apart.
+func (o GetOptions) flightKey(key string) string {
+	if !o.LocalOnly && !o.SkipHotCache && !o.ForceRefresh {
+		return key
+	}
+	flags := []byte{'\x01', '0', '0', '0'}
+	for i, set := range []bool{o.LocalOnly, o.SkipHotCache, o.ForceRefresh} {
+		if set {
+			flags[i+1] = '1'
+		}
+	}
+	return key + string(flags)
+}
+
+// forgetFlights makes loads of key that start from now on run rather
+// than share the results of those in flight, whatever their options.
+func (g *Group) forgetFlights(key string) {
+	f, ok := g.loadGroup.(flightForgetter)
+	if !ok {
+		return
+	}
+	f.Forget(key)
+	for i := 0; i < 8; i++ {
+		f.Forget(GetOptions{LocalOnly: i&1 != 0, SkipHotCache: i&2 != 0, ForceRefresh: i&4 != 0}.flightKey(key))
+	}
+}
+
+func (g *Group) Get(ctx context.Context, key string, dest Sink) error {
+	return g.GetWithOptions(ctx, key, dest, GetOptions{})
+}
+
+// GetWithOptions is like Get, but with options for debugging and for
+// controlled refreshes.
+func (g *Group) GetWithOptions(ctx context.Context, key string, dest Sink, opts GetOptions) error {
+	return g.get(ctx, cacheKey(opts.namespace, key), dest, opts)
+}
+
+// get gets key, made by cacheKey, into dest.
+func (g *Group) get(ctx context.Context, key string, dest Sink, opts GetOptions) error {
 	g.peersOnce.Do(g.initPeers)
 	g.Stats.Gets.Add(1)
 	if dest == nil {
 		return errors.New("groupcache: nil dest Sink")
 	}
-	value, cacheHit := g.lookupCache(key)
+	if g.isClosed() {
+		return ErrGroupClosed
+	}
+	ns := g.namespaceOf(opts.namespace)
+	if ns != nil {
+		ns.gets.Add(1)
+	}
+	if g.hotKeys != nil {
+		g.hotKeysMu.Lock()
+		g.hotKeys.Add(key)
+		g.hotKeysMu.Unlock()
+	}
+	if opts.ForceRefresh {
+		g.mainCache.remove(key)
+		g.hotCache.remove(key)
+	}
+	value, c, added, cacheHit := g.lookupCacheEntry(key, opts)
 
 	if cacheHit {
 		g.Stats.CacheHits.Add(1)
+		if ns != nil {
+			ns.hits.Add(1)
+		}
+		if soft := g.opts.SoftTTL; soft > 0 && time.Since(added) >= soft {
+			g.refresh(key, c, opts.namespace)
+		}
 		return setSinkView(dest, value)
 	}
 
+	if ws, ok := dest.(*writerSink); ok {
+		if !opts.LocalOnly && !opts.ForceRefresh {
+			if streamed, err := g.streamFromPeer(ctx, key, opts.namespace, ws); streamed {
+				return err
+			}
+		}
+		if g.opts.OversizePolicy == StreamOversize {
+			ws.maxBuffer = g.opts.MaxValueBytes
+		}
+	}
+
 	// Optimization to avoid double unmarshalling or copying: keep
 	// track of whether the dest was already populated. One caller
 	// (if local) will set this; the losers will not. The common
 	// case will likely be one caller.
 	destPopulated := false
-	value, destPopulated, err := g.load(ctx, key, dest)
+	value, destPopulated, err := g.load(ctx, key, dest, opts)
 	if err != nil {
 		return err
 	}
@@ -232,10 +769,199 @@ func (g *Group) Get(ctx Context, key string, dest Sink) error {
 	return setSinkView(dest, value)
 }
 
+// Remove removes key from the group's caches, both in this process and
+// on key's owner. Loads of key already in flight may still cache the
+// value they load, but Gets that start after Remove do not share their
+// results. If the owner is not a Remover, key is removed in this
+// process only and Remove returns ErrNotSupported.
+func (g *Group) Remove(ctx context.Context, key string) error {
+	return g.RemoveWithOptions(ctx, key, RemoveOptions{})
+}
+
+// RemoveOptions modify a single Remove. See Group.RemoveWithOptions.
+type RemoveOptions struct {
+	// AllPeers also removes key from the hot caches of all other
+	// peers that are Removers, if the group's PeerPicker is a
+	// PeerLister.
+	AllPeers bool
+}
+
+// RemoveWithOptions is like Remove, but modified by opts.
+func (g *Group) RemoveWithOptions(ctx context.Context, key string, opts RemoveOptions) error {
+	g.peersOnce.Do(g.initPeers)
+	key = cacheKey("", key)
+	g.localRemove(key)
+	req := &pb.GetRequest{
+		Group: &g.name,
+		Key:   &key,
+	}
+	owner, remote := g.peers.PickPeer(key)
+	if remote {
+		r, ok := owner.(Remover)
+		if !ok {
+			return ErrNotSupported
+		}
+		if err := r.Remove(ctx, req); err != nil {
+			return err
+		}
+	}
+	if !opts.AllPeers {
+		return nil
+	}
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, peer := range lister.AllPeers() {
+		r, ok := peer.(Remover)
+		if !ok || (remote && peer == owner) {
+			continue
+		}
+		wg.Add(1)
+		go func(r Remover) {
+			defer wg.Done()
+			if err := r.Remove(ctx, req); err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+		}(r)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Set stores value for key in the cache of key's owner, replacing
+// any cached value, so that producers can publish fresh data instead
+// of waiting for a Get to load it. The value expires at expire, or
+// never if expire is zero. If the owner is not a Setter, Set returns
+// ErrNotSupported.
+// The caller retains ownership of value.
+func (g *Group) Set(ctx context.Context, key string, value []byte, expire time.Time) error {
+	return g.SetWithOptions(ctx, key, value, expire, SetOptions{})
+}
+
+// SetOptions modify a single Set. See Group.SetWithOptions.
+type SetOptions struct {
+	// HotCache also stores the value in this process's hot cache
+	// if the owner is another peer and the group's hot cache is
+	// enabled, so that this process's next Gets of the key don't
+	// have to fetch it.
+	HotCache bool
+}
+
+// SetWithOptions is like Set, but modified by opts.
+func (g *Group) SetWithOptions(ctx context.Context, key string, value []byte, expire time.Time, opts SetOptions) error {
+	g.peersOnce.Do(g.initPeers)
+	if g.isClosed() {
+		return ErrGroupClosed
+	}
+	key = cacheKey("", key)
+	owner, remote := g.peers.PickPeer(key)
+	if !remote {
+		g.localSet(key, "", value, expire, &g.mainCache)
+		return nil
+	}
+	req := &pb.SetRequest{
+		Group: &g.name,
+		Key:   &key,
+		Value: value,
+	}
+	if !expire.IsZero() {
+		req.Expire = proto.Int64(expire.UnixNano())
+	}
+	s, ok := owner.(Setter)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := s.Set(ctx, req); err != nil {
+		return err
+	}
+	if opts.HotCache && !g.opts.DisableHotCache {
+		g.localSet(key, "", value, expire, &g.hotCache)
+	}
+	return nil
+}
+
+// localSet stores a copy of value for key, in namespace ns, in cache,
+// in this process only.
+func (g *Group) localSet(key, ns string, value []byte, expire time.Time, cache *cache) {
+	g.forgetFlights(key)
+	g.removeNegative(key)
+	g.populateCache(key, ns, ByteView{b: cloneBytes(value), e: expire}, cache)
+}
+
+// localRemove removes key from this process's caches only.
+func (g *Group) localRemove(key string) {
+	g.forgetFlights(key)
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.removeNegative(key)
+}
+
+// lookupNegative returns the remembered Getter error for key, if any.
+func (g *Group) lookupNegative(key string) (error, bool) {
+	if g.negCache == nil {
+		return nil, false
+	}
+	g.negMu.Lock()
+	defer g.negMu.Unlock()
+	v, ok := g.negCache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(error), true
+}
+
+func (g *Group) addNegative(key string, err error) {
+	if g.negCache == nil || g.isClosed() {
+		return
+	}
+	g.negMu.Lock()
+	defer g.negMu.Unlock()
+	g.negCache.AddWithTTL(key, &CachedError{Err: err}, g.opts.NegativeTTL)
+}
+
+// negativeCacheable reports whether err, returned by a local load,
+// says something about the key that NegativeTTL should remember.
+// Canceled and shed loads don't.
+func negativeCacheable(err error) bool {
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, ErrTooManyLoads)
+}
+
+func (g *Group) removeNegative(key string) {
+	if g.negCache == nil {
+		return
+	}
+	g.negMu.Lock()
+	defer g.negMu.Unlock()
+	g.negCache.Remove(key)
+}
+
 // load loads key either by invoking the getter locally or by sending it to another machine.
-func (g *Group) load(ctx Context, key string, dest Sink) (value ByteView, destPopulated bool, err error) {
+func (g *Group) load(ctx context.Context, key string, dest Sink, opts GetOptions) (value ByteView, destPopulated bool, err error) {
 	g.Stats.Loads.Add(1)
-	viewi, err := g.loadGroup.Do(key, func() (interface{}, error) {
+	// A load that outlives its caller loads into a sink of its own,
+	// which every caller copies, rather than into dest. If dest is a
+	// writerSink, the value is still streamed to it, through cw.
+	detached := g.outlivesCaller()
+	ws, _ := dest.(*writerSink)
+	var cw *callerWriter
+	var cwdest *writerSink
+	if detached && ws != nil {
+		cw = &callerWriter{w: ws.w}
+		cwdest = &writerSink{w: cw, maxBuffer: ws.maxBuffer}
+	}
+	viewi, err := g.flight(ctx, opts.flightKey(key), func(ctx context.Context) (interface{}, error) {
 		// Check the cache again because singleflight can only dedup calls
 		// that overlap concurrently.  It's possible for 2 concurrent
 		// requests to miss the cache, resulting in 2 load() calls.  An
@@ -257,42 +983,208 @@ func (g *Group) load(ctx Context, key string, dest Sink) (value ByteView, destPo
 		// 1: fn()
 		// 2: loadGroup.Do("key", fn)
 		// 2: fn()
-		if value, cacheHit := g.lookupCache(key); cacheHit {
-			g.Stats.CacheHits.Add(1)
-			return value, nil
+		if !opts.ForceRefresh {
+			if value, _, _, cacheHit := g.lookupCacheEntry(key, opts); cacheHit {
+				g.Stats.CacheHits.Add(1)
+				return value, nil
+			}
+			if err, ok := g.lookupNegative(key); ok {
+				g.Stats.NegativeHits.Add(1)
+				return nil, err
+			}
 		}
 		g.Stats.LoadsDeduped.Add(1)
+		if ns := g.namespaceOf(opts.namespace); ns != nil {
+			ns.loads.Add(1)
+		}
 		var value ByteView
 		var err error
-		if peer, ok := g.peers.PickPeer(key); ok {
-			value, err = g.getFromPeer(ctx, peer, key)
+		hedged := false // value was loaded locally by a hedge
+		peer, remote := g.pickPeer(key, opts)
+		if remote {
+			if opts.ForceRefresh {
+				if r, ok := peer.(Remover); ok {
+					err = r.Remove(ctx, &pb.GetRequest{Group: &g.name, Key: &key})
+				} else {
+					err = ErrNotSupported
+				}
+			}
 			if err == nil {
-				g.Stats.PeerLoads.Add(1)
-				return value, nil
+				value, hedged, err = g.fetchFromOwner(ctx, peer, key, opts)
+			}
+			if !hedged {
+				g.countPeerLoads(peer, 1, err)
+				if err == nil {
+					return value, nil
+				}
+				if _, ok := err.(*NoFallbackError); ok {
+					return nil, err
+				}
+				if value, ok := g.getFromReplicas(ctx, key, opts); ok {
+					return value, nil
+				}
 			}
-			g.Stats.PeerErrors.Add(1)
 			// TODO(bradfitz): log the peer's error? keep
 			// log of the past few for /groupcachez?  It's
 			// probably boring (normal task movement), so not
 			// worth logging I imagine.
 		}
-		value, err = g.getLocally(ctx, key, dest)
+		ldest := dest
+		if cw != nil {
+			ldest = cwdest
+		} else if detached {
+			var sink ByteView
+			ldest = ByteViewSink(&sink)
+		}
+		if !hedged {
+			value, err = g.getLocally(ctx, key, opts.namespace, ldest)
+		}
 		if err != nil {
 			g.Stats.LocalLoadErrs.Add(1)
+			// err is the local Getter's: a peer's error was
+			// replaced by the local load above, and a failed
+			// hedge returns the error of its local load.
+			if negativeCacheable(err) {
+				g.addNegative(key, err)
+			}
 			return nil, err
 		}
 		g.Stats.LocalLoads.Add(1)
-		destPopulated = true // only one caller of load gets this return value
-		g.populateCache(key, value, &g.mainCache)
+		// Only one caller of load gets this return value. A hedge
+		// loaded into its own sink, which the caller copies.
+		populated := !hedged && !detached
+		if populated {
+			destPopulated = true
+		}
+		if value.e.IsZero() && g.opts.DefaultTTL > 0 {
+			value.e = time.Now().Add(g.defaultTTL())
+			if populated {
+				dest.SetExpire(value.e)
+			}
+		}
+		if cw != nil && !hedged {
+			// The caller that started the load has the
+			// value, unless it stopped waiting.
+			cw.done(value)
+		}
+		if ws, ok := ldest.(*writerSink); ok && ws.oversize {
+			g.Stats.OversizeLoads.Add(1)
+			return nil, errStreamedOversize
+		}
+		if g.oversize(value) {
+			g.Stats.OversizeLoads.Add(1)
+			if g.opts.OversizePolicy == RejectOversize {
+				if populated {
+					destPopulated = false
+				}
+				return nil, ErrValueTooLarge
+			}
+			return value, nil
+		}
+		g.populateCache(key, opts.namespace, value, &g.mainCache)
+		if !remote && !opts.LocalOnly {
+			g.replicate(key, opts.namespace, value)
+		}
 		return value, nil
 	})
+	if cw != nil {
+		// From here on, fn no longer writes to dest.
+		v, written, werr := cw.detach()
+		if werr != nil {
+			return ByteView{}, false, werr
+		}
+		if written {
+			ws.v = v
+			destPopulated = true
+		}
+	}
+	if err == errStreamedOversize {
+		if destPopulated {
+			return ByteView{}, true, nil
+		}
+		err = ErrValueTooLarge
+	}
 	if err == nil {
 		value = viewi.(ByteView)
 	}
 	return
 }
 
-func (g *Group) getLocally(ctx Context, key string, dest Sink) (ByteView, error) {
+// defaultTTL returns opts.DefaultTTL, jittered by opts.TTLJitter.
+func (g *Group) defaultTTL() time.Duration {
+	ttl := g.opts.DefaultTTL
+	if j := g.opts.TTLJitter; j > 0 {
+		ttl = time.Duration(float64(ttl) * (1 + j*(2*rand.Float64()-1)))
+	}
+	return ttl
+}
+
+// pickPeer is like g.peers.PickPeer, but picks no peer if opts are
+// LocalOnly.
+func (g *Group) pickPeer(key string, opts GetOptions) (ProtoGetter, bool) {
+	if opts.LocalOnly {
+		return nil, false
+	}
+	return g.peers.PickPeer(key)
+}
+
+// oversize reports whether value is too large for the group to cache.
+func (g *Group) oversize(value ByteView) bool {
+	max := g.opts.MaxValueBytes
+	return max > 0 && int64(value.Len()) > max
+}
+
+// flight runs fn through loadGroup. If the group is closed while fn
+// is in flight, flight returns ErrGroupClosed without waiting for fn,
+// unless loadGroup can only Do. If loadGroup is a contextFlightGroup,
+// fn runs with a context that is only canceled once all the loads
+// sharing it have given up, and flight returns ctx.Err() as soon as
+// ctx is done; a panic in fn, such as in the group's Getter, is
+// returned as a *singleflight.PanicError.
+func (g *Group) flight(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	switch lg := g.loadGroup.(type) {
+	case contextFlightGroup:
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		defer context.AfterFunc(g.closed, func() { cancel(ErrGroupClosed) })()
+		v, err := lg.DoContext(ctx, key, fn)
+		if err != nil && err == ctx.Err() && context.Cause(ctx) == ErrGroupClosed {
+			return nil, ErrGroupClosed
+		}
+		return v, err
+	case chanFlightGroup:
+		select {
+		case r := <-lg.DoChan(key, func() (interface{}, error) { return fn(ctx) }):
+			return r.Val, r.Err
+		case <-g.closed.Done():
+			return nil, ErrGroupClosed
+		}
+	}
+	return g.loadGroup.Do(key, func() (interface{}, error) { return fn(ctx) })
+}
+
+// outlivesCaller reports whether a load through loadGroup may still be
+// running after flight returns.
+func (g *Group) outlivesCaller() bool {
+	switch g.loadGroup.(type) {
+	case contextFlightGroup, chanFlightGroup:
+		return true
+	}
+	return false
+}
+
+// getLocally loads key, in namespace ns, with the Getter.
+func (g *Group) getLocally(ctx context.Context, key, ns string, dest Sink) (ByteView, error) {
+	if ns != "" {
+		ctx = context.WithValue(ctx, nsContextKey{}, ns)
+	}
+	key = userKey(ns, key)
+	if g.loadSlots != nil {
+		if err := g.acquireLoadSlot(ctx); err != nil {
+			return ByteView{}, err
+		}
+		defer func() { <-g.loadSlots }()
+	}
 	err := g.getter.Get(ctx, key, dest)
 	if err != nil {
 		return ByteView{}, err
@@ -300,49 +1192,271 @@ func (g *Group) getLocally(ctx Context, key string, dest Sink) (ByteView, error)
 	return dest.view()
 }
 
-func (g *Group) getFromPeer(ctx Context, peer ProtoGetter, key string) (ByteView, error) {
-	req := &pb.GetRequest{
-		Group: &g.name,
-		Key:   &key,
+// acquireLoadSlot takes one of the loadSlots, according to the
+// group's LoadOverflow policy.
+func (g *Group) acquireLoadSlot(ctx context.Context) error {
+	select {
+	case g.loadSlots <- struct{}{}:
+		return nil
+	default:
+	}
+	if g.opts.LoadOverflow == RejectLoads {
+		g.Stats.LoadsShed.Add(1)
+		return ErrTooManyLoads
 	}
+	var timeout <-chan time.Time
+	if d := g.opts.LoadQueueTimeout; d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case g.loadSlots <- struct{}{}:
+		return nil
+	case <-timeout:
+		g.Stats.LoadsShed.Add(1)
+		return ErrTooManyLoads
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer ProtoGetter, key, ns string) (ByteView, error) {
+	value, err := g.fetchFromPeer(ctx, peer, key, ns)
+	if err != nil {
+		return ByteView{}, err
+	}
+	if g.admitHot(key, value) {
+		g.populateCache(key, ns, value, &g.hotCache)
+	}
+	return value, nil
+}
+
+// fetchFromPeer gets the value for key, in namespace ns, from peer
+// without caching it.
+func (g *Group) fetchFromPeer(ctx context.Context, peer ProtoGetter, key, ns string) (ByteView, error) {
 	res := &pb.GetResponse{}
-	err := peer.Get(ctx, req, res)
+	err := peer.Get(ctx, g.getRequest(key, ns), res)
 	if err != nil {
 		return ByteView{}, err
 	}
 	value := ByteView{b: res.Value}
-	// TODO(bradfitz): use res.MinuteQps or something smart to
-	// conditionally populate hotCache.  For now just do it some
-	// percentage of the time.
-	if rand.Intn(10) == 0 {
-		g.populateCache(key, value, &g.hotCache)
+	if res.Expire != nil {
+		value.e = time.Unix(0, res.GetExpire())
 	}
 	return value, nil
 }
 
+// getRequest returns the request to a peer for key, in namespace ns.
+func (g *Group) getRequest(key, ns string) *pb.GetRequest {
+	req := &pb.GetRequest{
+		Group: &g.name,
+		Key:   &key,
+	}
+	if ns != "" {
+		req.Namespace = &ns
+	}
+	return req
+}
+
+// refresh reloads key, in namespace ns, into c in the background,
+// unless a reload of key is already in flight. Values in the hot cache
+// are reloaded from their owner, others with the Getter.
+func (g *Group) refresh(key string, c *cache, ns string) {
+	g.refreshMu.Lock()
+	if g.refreshing[key] {
+		g.refreshMu.Unlock()
+		return
+	}
+	if g.refreshing == nil {
+		g.refreshing = make(map[string]bool)
+	}
+	g.refreshing[key] = true
+	g.refreshMu.Unlock()
+	g.Stats.Refreshes.Add(1)
+
+	go func() {
+		defer func() {
+			g.refreshMu.Lock()
+			delete(g.refreshing, key)
+			g.refreshMu.Unlock()
+		}()
+		// The caller that noticed the stale value does not wait
+		// for the reload, so its context does not apply.
+		ctx := context.Background()
+		var value ByteView
+		var err error
+		if c == &g.hotCache {
+			peer, ok := g.peers.PickPeer(key)
+			if !ok {
+				return
+			}
+			value, err = g.fetchFromPeer(ctx, peer, key, ns)
+		} else {
+			value, err = g.getLocally(ctx, key, ns, ByteViewSink(&value))
+		}
+		if err == nil {
+			g.populateCache(key, ns, value, c)
+		}
+	}()
+}
+
+// streamFromPeer streams the value for key, in namespace ns, from its
+// owner into dest,
+// if the owner is a peer that implements StreamGetter. Streamed values
+// bypass the load deduplication and the hot cache, so that they never
+// need to be held in memory as a whole. streamed is false if the value
+// was not streamed and nothing was written to dest, in which case the
+// caller should load it the normal way.
+func (g *Group) streamFromPeer(ctx context.Context, key, ns string, dest *writerSink) (streamed bool, err error) {
+	peer, ok := g.peers.PickPeer(key)
+	if !ok {
+		return false, nil
+	}
+	sg, ok := peer.(StreamGetter)
+	if !ok {
+		return false, nil
+	}
+	g.Stats.Loads.Add(1)
+	w := &countingWriter{w: dest.w}
+	expire, err := sg.GetStream(ctx, g.getRequest(key, ns), w)
+	g.countPeerLoads(peer, 1, err)
+	if err != nil {
+		return w.n > 0, err
+	}
+	dest.v.e = expire
+	return true, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// defaultHotCacheRatio is the default GroupOptions.HotCacheRatio.
+const defaultHotCacheRatio = 1.0 / 8
+
+// hotCacheAdmitHits is the number of recent requests of a key after
+// which the hot cache admission filter mirrors its value, if the hot
+// cache's policy cannot tell which entry the value would evict.
+const hotCacheAdmitHits = 2
+
+// admitHot reports whether value, just fetched from a peer for key,
+// should be added to the hot cache.
+func (g *Group) admitHot(key string, value ByteView) bool {
+	if g.opts.DisableHotCache {
+		return false
+	}
+	if g.hotAdmission == nil {
+		// TODO(bradfitz): use res.MinuteQps or something smart to
+		// conditionally populate hotCache.  For now just do it some
+		// percentage of the time.
+		return rand.Intn(10) == 0
+	}
+	g.admissionMu.Lock()
+	defer g.admissionMu.Unlock()
+	g.hotAdmission.Increment(key)
+	if !g.hotCacheFull(int64(len(key) + value.Len())) {
+		return true
+	}
+	victim, ok := g.hotCache.victim()
+	if !ok {
+		return g.hotAdmission.Estimate(key) >= hotCacheAdmitHits
+	}
+	return g.hotAdmission.Estimate(key) > g.hotAdmission.Estimate(victim)
+}
+
+// hotCacheFull reports whether adding size bytes to the hot cache
+// would make evictOverflow evict from it.
+func (g *Group) hotCacheFull(size int64) bool {
+	mainBytes := g.mainCache.bytes()
+	hotBytes := g.hotCache.bytes() + size
+	return mainBytes+hotBytes > g.CacheBytes() && float64(hotBytes) > float64(mainBytes)*g.hotCacheRatio()
+}
+
+// hotCacheRatio returns opts.HotCacheRatio, or its default.
+func (g *Group) hotCacheRatio() float64 {
+	if ratio := g.opts.HotCacheRatio; ratio > 0 {
+		return ratio
+	}
+	return defaultHotCacheRatio
+}
+
 func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
-	if g.cacheBytes <= 0 {
+	value, _, _, ok = g.lookupCacheEntry(key, GetOptions{})
+	return
+}
+
+// lookupCacheEntry is like lookupCache, but also returns the cache
+// holding the value and when the value was added to it. The hot cache
+// is skipped if opts say so.
+func (g *Group) lookupCacheEntry(key string, opts GetOptions) (value ByteView, c *cache, added time.Time, ok bool) {
+	if g.CacheBytes() <= 0 {
 		return
 	}
-	value, ok = g.mainCache.get(key)
-	if ok {
+	c = &g.mainCache
+	value, added, ok = c.getEntry(key)
+	if ok || opts.SkipHotCache {
 		return
 	}
-	value, ok = g.hotCache.get(key)
+	c = &g.hotCache
+	value, added, ok = c.getEntry(key)
+	if ok && g.hotAdmission != nil {
+		// Hot cache hits count too, so that the keys the hot
+		// cache serves hold their place against new ones.
+		g.admissionMu.Lock()
+		g.hotAdmission.Increment(key)
+		g.admissionMu.Unlock()
+	}
 	return
 }
 
-func (g *Group) populateCache(key string, value ByteView, cache *cache) {
-	if g.cacheBytes <= 0 {
+func (g *Group) populateCache(key, ns string, value ByteView, cache *cache) {
+	if g.CacheBytes() <= 0 || value.expired(time.Now()) || g.oversize(value) || g.isClosed() {
+		return
+	}
+	if admit := g.opts.AdmitFunc; admit != nil && !admit(key, value) {
+		g.Stats.NotAdmitted.Add(1)
+		return
+	}
+	cache.addNS(key, ns, value)
+	g.enforceQuota(ns)
+	g.evictOverflow()
+}
+
+// CacheBytes returns the group's current cache size limit, in bytes.
+func (g *Group) CacheBytes() int64 {
+	return atomic.LoadInt64(&g.cacheBytes)
+}
+
+// SetCacheBytes changes the limit for the sum of the group's main and
+// hot cache sizes. Items are evicted immediately if the caches exceed
+// the new limit. A limit of zero or less disables caching and flushes
+// both caches.
+func (g *Group) SetCacheBytes(n int64) {
+	atomic.StoreInt64(&g.cacheBytes, n)
+	if n <= 0 {
+		g.mainCache.clear()
+		g.hotCache.clear()
 		return
 	}
-	cache.add(key, value)
+	g.evictOverflow()
+}
 
-	// Evict items from cache(s) if necessary.
+// evictOverflow evicts items from the cache(s) until their combined
+// size is within the group's limit.
+func (g *Group) evictOverflow() {
 	for {
 		mainBytes := g.mainCache.bytes()
 		hotBytes := g.hotCache.bytes()
-		if mainBytes+hotBytes <= g.cacheBytes {
+		if mainBytes+hotBytes <= g.CacheBytes() {
 			return
 		}
 
@@ -350,13 +1464,120 @@ func (g *Group) populateCache(key string, value ByteView, cache *cache) {
 		// It should be something based on measurements and/or
 		// respecting the costs of different resources.
 		victim := &g.mainCache
-		if hotBytes > mainBytes/8 {
+		if float64(hotBytes) > float64(mainBytes)*g.hotCacheRatio() {
 			victim = &g.hotCache
 		}
 		victim.removeOldest()
 	}
 }
 
+// A HotKey is one of a group's most requested keys.
+type HotKey struct {
+	Key       string
+	Namespace string `json:",omitempty"` // as passed to GetNS
+	Gets      int64  // estimated; may be overcounted by up to MaxError
+	// MaxError bounds how much Gets may overcount, because the key
+	// displaced a less requested one that was being counted.
+	MaxError int64
+}
+
+// HotKeys returns up to n of the keys requested most often from the
+// group, most requested first, including requests from peers. It
+// returns nil if n <= 0 or GroupOptions.HotKeyCapacity is not set.
+func (g *Group) HotKeys(n int) []HotKey {
+	if g.hotKeys == nil || n <= 0 {
+		return nil
+	}
+	g.hotKeysMu.Lock()
+	top := g.hotKeys.Top(n)
+	g.hotKeysMu.Unlock()
+	hot := make([]HotKey, len(top))
+	for i, kc := range top {
+		ns, key := splitCacheKey(kc.Key)
+		hot[i] = HotKey{Key: key, Namespace: ns, Gets: kc.Count, MaxError: kc.Err}
+	}
+	return hot
+}
+
+// Generation returns the group's current generation. See
+// BumpGeneration.
+func (g *Group) Generation() uint64 {
+	return atomic.LoadUint64(&g.generation)
+}
+
+// BumpGeneration invalidates every value the group has cached, at
+// once and without walking the caches: the group moves to a new
+// generation, and values cached in earlier ones are treated as misses
+// and dropped as they are found. If the group's PeerPicker is a
+// PeerLister, the new generation is sent to every peer that is a
+// GenerationSetter, and the first error from them is returned.
+func (g *Group) BumpGeneration(ctx context.Context) error {
+	g.peersOnce.Do(g.initPeers)
+	gen := atomic.AddUint64(&g.generation, 1)
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	req := &pb.GenerationRequest{
+		Group:      &g.name,
+		Generation: &gen,
+	}
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, peer := range lister.AllPeers() {
+		gs, ok := peer.(GenerationSetter)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(gs GenerationSetter) {
+			defer wg.Done()
+			if err := gs.SetGeneration(ctx, req); err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+		}(gs)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// localSetGeneration raises the group's generation to gen, if it is
+// lower.
+func (g *Group) localSetGeneration(gen uint64) {
+	for {
+		cur := atomic.LoadUint64(&g.generation)
+		if gen <= cur || atomic.CompareAndSwapUint64(&g.generation, cur, gen) {
+			return
+		}
+	}
+}
+
+// OnEvict registers fn to be called whenever an entry leaves one of
+// the group's caches, with the size of its key and value, the cache,
+// and why it left. Entries of earlier generations are reported as
+// lru.EvictExpired. fn runs with the cache locked, so it must be quick
+// and must not call methods of the group.
+func (g *Group) OnEvict(fn func(key string, size int64, which CacheType, reason lru.EvictReason)) {
+	g.evictMu.Lock()
+	defer g.evictMu.Unlock()
+	g.evictHooks = append(g.evictHooks, fn)
+}
+
+func (g *Group) notifyEvict(key string, size int64, which CacheType, reason lru.EvictReason) {
+	g.evictMu.RLock()
+	defer g.evictMu.RUnlock()
+	for _, fn := range g.evictHooks {
+		fn(key, size, which, reason)
+	}
+}
+
 // CacheType represents a type of cache.
 type CacheType int
 
@@ -383,15 +1604,89 @@ func (g *Group) CacheStats(which CacheType) CacheStats {
 	}
 }
 
-// cache is a wrapper around an *lru.Cache that adds synchronization,
+// A CachePolicy creates the lru.Policy that backs one of a Group's
+// caches. The returned Policy must call onEvicted for every entry it
+// removes, but not for a value that Add replaces in place, and must
+// not limit its own size: the Group evicts with RemoveOldest to stay
+// within its byte budget.
+type CachePolicy func(onEvicted func(key lru.Key, value interface{})) lru.Policy
+
+// LRUPolicy is a CachePolicy that evicts the least recently used entry.
+func LRUPolicy(onEvicted func(key lru.Key, value interface{})) lru.Policy {
+	return &lru.Cache{OnEvicted: onEvicted}
+}
+
+// ARCPolicy is a CachePolicy that uses an Adaptive Replacement Cache,
+// which resists being flushed by scans of keys that are used once.
+func ARCPolicy(onEvicted func(key lru.Key, value interface{})) lru.Policy {
+	return &lru.ARCCache{OnEvicted: onEvicted}
+}
+
+// SLRUPolicy is a CachePolicy that uses a segmented LRU, which only
+// protects entries from eviction once they have been hit twice.
+func SLRUPolicy(onEvicted func(key lru.Key, value interface{})) lru.Policy {
+	return &lru.SLRUCache{OnEvicted: onEvicted}
+}
+
+// LFUPolicy is a CachePolicy that evicts the least frequently used
+// entry, which suits heavily skewed workloads.
+func LFUPolicy(onEvicted func(key lru.Key, value interface{})) lru.Policy {
+	return &lru.LFUCache{OnEvicted: onEvicted}
+}
+
+// ClockPolicy is a CachePolicy that approximates LRU with the CLOCK
+// algorithm, which is cheaper for read-heavy caches.
+func ClockPolicy(onEvicted func(key lru.Key, value interface{})) lru.Policy {
+	return &lru.ClockCache{OnEvicted: onEvicted}
+}
+
+// TwoQueuePolicy is a CachePolicy that uses the 2Q algorithm, which
+// only admits entries to its main queue once they are reused.
+func TwoQueuePolicy(onEvicted func(key lru.Key, value interface{})) lru.Policy {
+	return &lru.TwoQueueCache{OnEvicted: onEvicted}
+}
+
+// SampledPolicy is a CachePolicy that approximates LRU by sampling,
+// which uses less memory per entry for caches of many small values.
+func SampledPolicy(onEvicted func(key lru.Key, value interface{})) lru.Policy {
+	return &lru.SampledCache{OnEvicted: onEvicted}
+}
+
+// cache is a wrapper around an lru.Policy that adds synchronization,
 // makes values always be ByteView, and counts the size of all keys and
 // values.
 type cache struct {
 	mu         sync.RWMutex
 	nbytes     int64 // of all keys and values
-	lru        *lru.Cache
+	policy     CachePolicy
+	cloneOnGet bool
+	lru        lru.Policy
 	nhit, nget int64
 	nevict     int64 // number of evictions
+
+	// onAdd and onRemove, if non-nil, are called with mu held when
+	// a key of namespace ns is added to or removed from the cache.
+	// size counts the key and value, as in nbytes.
+	onAdd    func(key, ns string, size int64)
+	onRemove func(key, ns string, size int64, reason lru.EvictReason)
+
+	// reason is why the policy is being asked to drop entries, for
+	// its eviction callback. The zero value means lru.EvictCapacity.
+	reason lru.EvictReason
+
+	// keys indexes the cached keys, for purgePrefix.
+	keys map[string]cachedKey
+
+	// generation, if non-nil, points at the owning group's
+	// generation. Entries added in earlier generations are stale.
+	generation *uint64
+}
+
+func (c *cache) currentGeneration() uint64 {
+	if c.generation == nil {
+		return 0
+	}
+	return atomic.LoadUint64(c.generation)
 }
 
 func (c *cache) stats() CacheStats {
@@ -406,23 +1701,80 @@ func (c *cache) stats() CacheStats {
 	}
 }
 
+// cachedKey describes a key in a cache.
+type cachedKey struct {
+	size int64 // of the key and value, as counted in nbytes
+	ns   string
+}
+
+// add adds key, in no namespace, to the cache.
 func (c *cache) add(key string, value ByteView) {
+	c.addNS(key, "", value)
+}
+
+// addNS adds key, of namespace ns, to the cache.
+func (c *cache) addNS(key, ns string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
-		c.lru = &lru.Cache{
-			OnEvicted: func(key lru.Key, value interface{}) {
-				val := value.(ByteView)
-				c.nbytes -= int64(len(key.(string))) + int64(val.Len())
+		newPolicy := c.policy
+		if newPolicy == nil {
+			newPolicy = LRUPolicy
+		}
+		c.lru = newPolicy(func(key lru.Key, value interface{}) {
+			e := value.(cacheEntry)
+			size := int64(len(key.(string))) + int64(e.value.Len())
+			c.nbytes -= size
+			delete(c.keys, key.(string))
+			reason := c.reason
+			if reason == 0 {
+				reason = lru.EvictCapacity
+			}
+			if reason != lru.EvictReplaced && reason != lru.EvictCleared {
 				c.nevict++
-			},
+			}
+			if c.onRemove != nil {
+				c.onRemove(key.(string), e.ns, size, reason)
+			}
+		})
+	}
+	// Policies replace the value of a key they hold in place,
+	// without calling the eviction callback, so the old value is
+	// accounted for here. Removing it from the policy first would
+	// also drop the ghost entries ARC and 2Q adapt by.
+	if old, ok := c.keys[key]; ok {
+		c.nbytes -= old.size
+		if c.onRemove != nil {
+			c.onRemove(key, old.ns, old.size, lru.EvictReplaced)
 		}
 	}
-	c.lru.Add(key, value)
-	c.nbytes += int64(len(key)) + int64(value.Len())
+	c.lru.Add(key, cacheEntry{value: value, ns: ns, added: time.Now(), generation: c.currentGeneration()})
+	size := int64(len(key)) + int64(value.Len())
+	c.nbytes += size
+	if c.keys == nil {
+		c.keys = make(map[string]cachedKey)
+	}
+	c.keys[key] = cachedKey{size: size, ns: ns}
+	if c.onAdd != nil {
+		c.onAdd(key, ns, size)
+	}
+}
+
+// cacheEntry is the value type stored in a cache's lru.Policy.
+type cacheEntry struct {
+	value      ByteView
+	ns         string // namespace of the key
+	added      time.Time
+	generation uint64
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	value, _, ok = c.getEntry(key)
+	return
+}
+
+// getEntry is like get, but also returns when the value was added.
+func (c *cache) getEntry(key string) (value ByteView, added time.Time, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.nget++
@@ -433,8 +1785,81 @@ func (c *cache) get(key string) (value ByteView, ok bool) {
 	if !ok {
 		return
 	}
+	ce := vi.(cacheEntry)
+	value, added = ce.value, ce.added
+	if value.expired(time.Now()) || ce.generation < c.currentGeneration() {
+		c.removeLocked(key, lru.EvictExpired)
+		return ByteView{}, time.Time{}, false
+	}
 	c.nhit++
-	return vi.(ByteView), true
+	if c.cloneOnGet && value.b != nil {
+		value.b = cloneBytes(value.b)
+	}
+	return value, added, true
+}
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.removeLocked(key, lru.EvictRemoved)
+	}
+}
+
+// removeLocked removes key from c.lru, reporting reason to the
+// eviction callback.
+func (c *cache) removeLocked(key string, reason lru.EvictReason) {
+	c.reason = reason
+	c.lru.Remove(key)
+	c.reason = 0
+}
+
+// clear drops all entries. They are reported as cleared, not counted
+// as evictions.
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.reason = lru.EvictCleared
+		c.lru.Clear()
+		c.reason = 0
+	}
+	c.lru = nil
+	c.nbytes = 0
+	c.keys = nil
+}
+
+// purgePrefix removes all keys starting with prefix and returns how
+// many there were.
+func (c *cache) purgePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var purge []string
+	for k := range c.keys {
+		if strings.HasPrefix(k, prefix) {
+			purge = append(purge, k)
+		}
+	}
+	for _, k := range purge {
+		c.removeLocked(k, lru.EvictRemoved)
+	}
+	return len(purge)
+}
+
+// victim returns the key the cache's policy would evict next, if the
+// policy is an lru.Victimer and the cache is not empty.
+func (c *cache) victim() (key string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.lru.(lru.Victimer)
+	if !ok {
+		return "", false
+	}
+	k, ok := v.Victim()
+	if !ok {
+		return "", false
+	}
+	return k.(string), true
 }
 
 func (c *cache) removeOldest() {
@@ -19,12 +19,18 @@ limitations under the License.
 package groupcache
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"unsafe"
@@ -32,6 +38,8 @@ import (
 	"github.com/golang/protobuf/proto"
 
 	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/groupcache/lru"
+	"github.com/golang/groupcache/singleflight"
 	testpb "github.com/golang/groupcache/testpb"
 )
 
@@ -41,7 +49,7 @@ var (
 
 	stringc = make(chan string)
 
-	dummyCtx Context
+	dummyCtx = context.TODO()
 
 	// cacheFills is the number of times stringGroup or
 	// protoGroup's Getter have been called. Read using the
@@ -58,7 +66,7 @@ const (
 )
 
 func testSetup() {
-	stringGroup = NewGroup(stringGroupName, cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+	stringGroup = NewGroup(stringGroupName, cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
 		if key == fromChan {
 			key = <-stringc
 		}
@@ -66,7 +74,7 @@ func testSetup() {
 		return dest.SetString("ECHO:" + key)
 	}))
 
-	protoGroup = NewGroup(protoGroupName, cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+	protoGroup = NewGroup(protoGroupName, cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
 		if key == fromChan {
 			key = <-stringc
 		}
@@ -226,21 +234,53 @@ func TestCacheEviction(t *testing.T) {
 }
 
 type fakePeer struct {
-	hits int
-	fail bool
+	hits    int
+	removes int
+	sets    []*pb.SetRequest
+	expire  time.Time
+	fail    bool
 }
 
-func (p *fakePeer) Get(_ Context, in *pb.GetRequest, out *pb.GetResponse) error {
+func (p *fakePeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
 	p.hits++
 	if p.fail {
 		return errors.New("simulated error from peer")
 	}
 	out.Value = []byte("got:" + in.GetKey())
+	if !p.expire.IsZero() {
+		out.Expire = proto.Int64(p.expire.UnixNano())
+	}
+	return nil
+}
+
+func (p *fakePeer) Remove(_ context.Context, in *pb.GetRequest) error {
+	p.removes++
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(_ context.Context, in *pb.SetRequest) error {
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	p.sets = append(p.sets, in)
 	return nil
 }
 
 type fakePeers []ProtoGetter
 
+func (p fakePeers) AllPeers() []ProtoGetter {
+	var peers []ProtoGetter
+	for _, peer := range p {
+		if peer != nil {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
 func (p fakePeers) PickPeer(key string) (peer ProtoGetter, ok bool) {
 	if len(p) == 0 {
 		return
@@ -259,11 +299,11 @@ func TestPeers(t *testing.T) {
 	peerList := fakePeers([]ProtoGetter{peer0, peer1, peer2, nil})
 	const cacheSize = 0 // disabled
 	localHits := 0
-	getter := func(_ Context, key string, dest Sink) error {
+	getter := func(_ context.Context, key string, dest Sink) error {
 		localHits++
 		return dest.SetString("got:" + key)
 	}
-	testGroup := newGroup("TestPeers-group", cacheSize, GetterFunc(getter), peerList)
+	testGroup := newGroup("TestPeers-group", cacheSize, GetterFunc(getter), peerList, nil)
 	run := func(name string, n int, wantSummary string) {
 		// Reset counters
 		localHits = 0
@@ -387,9 +427,9 @@ func (g *orderedFlightGroup) Do(key string, fn func() (interface{}, error)) (int
 func TestNoDedup(t *testing.T) {
 	const testkey = "testkey"
 	const testval = "testval"
-	g := newGroup("testgroup", 1024, GetterFunc(func(_ Context, key string, dest Sink) error {
+	g := newGroup("testgroup", 1024, GetterFunc(func(_ context.Context, key string, dest Sink) error {
 		return dest.SetString(testval)
-	}), nil)
+	}), nil, nil)
 
 	orderedGroup := &orderedFlightGroup{
 		stage1: make(chan bool),
@@ -444,12 +484,1444 @@ func TestNoDedup(t *testing.T) {
 	}
 }
 
+func TestCachePolicy(t *testing.T) {
+	const cacheSize = 64
+	fills := 0
+	g := newGroup("TestCachePolicy-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fills++
+		return dest.SetString("val")
+	}), NoPeers{}, &GroupOptions{CachePolicy: ARCPolicy})
+	get := func(key string) {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		get("hot")
+	}
+	if _, ok := g.mainCache.lru.(*lru.ARCCache); !ok {
+		t.Fatalf("main cache policy is %T; want *lru.ARCCache", g.mainCache.lru)
+	}
+	// A scan of new keys overflows the byte budget but must not
+	// evict the key that was used twice.
+	for i := 0; i < 50; i++ {
+		get(fmt.Sprintf("scan-%d", i))
+	}
+	if got := g.mainCache.bytes(); got > cacheSize {
+		t.Errorf("main cache holds %d bytes; want at most %d", got, cacheSize)
+	}
+	fills = 0
+	get("hot")
+	if fills != 0 {
+		t.Errorf("hot key was evicted by a scan")
+	}
+}
+
+func TestARCPolicyAdapts(t *testing.T) {
+	const cacheSize = 64
+	g := newGroup("TestARCPolicyAdapts-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("val")
+	}), NoPeers{}, &GroupOptions{CachePolicy: ARCPolicy})
+	get := func(key string) {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cached := func(key string) bool {
+		_, ok := g.mainCache.keys[key]
+		return ok
+	}
+
+	// A key used twice, so that the ghost of one used once is kept.
+	get("hot")
+	get("hot")
+	get("once")
+	for i := 0; cached("once"); i++ {
+		get(fmt.Sprintf("scan-%d", i))
+	}
+	arc := g.mainCache.lru.(*lru.ARCCache)
+	if p := arc.Target(); p != 0 {
+		t.Fatalf("ARC target before a ghost hit = %d; want 0", p)
+	}
+
+	// Loading the evicted key again hits its ghost, which makes ARC
+	// keep more of the entries seen once.
+	get("once")
+	if p := arc.Target(); p == 0 {
+		t.Error("ARC target did not adapt to a ghost hit")
+	}
+}
+
+func TestTwoQueuePolicyPromotes(t *testing.T) {
+	const cacheSize = 64
+	fills := 0
+	g := newGroup("TestTwoQueuePolicyPromotes-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fills++
+		return dest.SetString("val")
+	}), NoPeers{}, &GroupOptions{CachePolicy: TwoQueuePolicy})
+	get := func(key string) {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cached := func(key string) bool {
+		_, ok := g.mainCache.keys[key]
+		return ok
+	}
+
+	// Scan until hot is evicted, leaving its ghost, then load it
+	// again: the ghost hit admits it to the main queue.
+	get("hot")
+	for i := 0; cached("hot"); i++ {
+		get(fmt.Sprintf("scan-%d", i))
+	}
+	get("hot")
+
+	// A later scan only churns the FIFO queue.
+	for i := 0; i < 50; i++ {
+		get(fmt.Sprintf("rescan-%d", i))
+	}
+	fills = 0
+	get("hot")
+	if fills != 0 {
+		t.Errorf("reused key was evicted by a scan")
+	}
+}
+
+func TestHotCacheAdmission(t *testing.T) {
+	peer := &fakePeer{}
+	// Room for the hot key and one scanned key: "hot" and "got:hot"
+	// take 10 bytes, "scan-00" and "got:scan-00" 18.
+	g := newGroup("TestHotCacheAdmission-group", 30, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("local getter called")
+	}), fakePeers([]ProtoGetter{peer}), &GroupOptions{HotCacheAdmission: 100})
+	get := func(key string) {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A hot cache with room admits a key on its first fetch.
+	for i := 0; i < 10; i++ {
+		get("hot")
+	}
+	if peer.hits != 1 {
+		t.Fatalf("peer hits = %d; want 1", peer.hits)
+	}
+
+	// A scan, even of keys fetched twice, does not displace it.
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("scan-%02d", i)
+		get(key)
+		get(key)
+	}
+	if _, ok := g.hotCache.get("hot"); !ok {
+		t.Error("the scan displaced the hot key from the hot cache")
+	}
+	if n := g.hotCache.items(); n != 2 {
+		t.Errorf("hot cache has %d items; want 2", n)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	peer0 := &fakePeer{}
+	peer1 := &fakePeer{}
+	loads := 0
+	g := newGroup("TestRemove-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{peer0, peer1, nil}), nil)
+
+	// Find a key this process owns, and one peer0 owns.
+	var localKey, remoteKey string
+	for i := 0; localKey == "" || remoteKey == ""; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		switch peer, _ := g.peers.PickPeer(key); peer {
+		case nil:
+			localKey = key
+		case peer0:
+			remoteKey = key
+		}
+	}
+
+	var s string
+	if err := g.Get(dummyCtx, localKey, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Remove(dummyCtx, localKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get(localKey); ok {
+		t.Error("Remove left the key in the main cache")
+	}
+	if peer0.removes != 0 || peer1.removes != 0 {
+		t.Errorf("peer removes = %d, %d; want 0, 0", peer0.removes, peer1.removes)
+	}
+	if err := g.RemoveWithOptions(dummyCtx, localKey, RemoveOptions{AllPeers: true}); err != nil {
+		t.Fatal(err)
+	}
+	if peer0.removes != 1 || peer1.removes != 1 {
+		t.Errorf("peer removes = %d, %d; want 1, 1", peer0.removes, peer1.removes)
+	}
+	if err := g.Get(dummyCtx, localKey, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 2 {
+		t.Errorf("loads = %d; want 2", loads)
+	}
+
+	// The owner is asked once, not again by the broadcast.
+	g.hotCache.add(remoteKey, ByteView{s: "stale"})
+	if err := g.RemoveWithOptions(dummyCtx, remoteKey, RemoveOptions{AllPeers: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.hotCache.get(remoteKey); ok {
+		t.Error("Remove left the key in the hot cache")
+	}
+	if peer0.removes != 2 || peer1.removes != 2 {
+		t.Errorf("peer removes = %d, %d; want 2, 2", peer0.removes, peer1.removes)
+	}
+
+	// The local copy is removed even if the owner fails.
+	peer0.fail = true
+	g.hotCache.add(remoteKey, ByteView{s: "stale"})
+	if err := g.Remove(dummyCtx, remoteKey); err == nil {
+		t.Error("Remove ignored the owner's error")
+	}
+	if _, ok := g.hotCache.get(remoteKey); ok {
+		t.Error("a failed Remove left the key in the hot cache")
+	}
+}
+
+// getOnlyPeer hides the optional methods of the ProtoGetter it wraps.
+type getOnlyPeer struct {
+	ProtoGetter
+}
+
+func TestRemoveNotSupported(t *testing.T) {
+	peer := &fakePeer{}
+	g := newGroup("TestRemoveNotSupported-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{getOnlyPeer{peer}}), nil)
+
+	g.hotCache.add("k", ByteView{s: "stale"})
+	if err := g.Remove(dummyCtx, "k"); err != ErrNotSupported {
+		t.Errorf("Remove = %v; want ErrNotSupported", err)
+	}
+	if _, ok := g.hotCache.get("k"); ok {
+		t.Error("Remove left the key in the hot cache")
+	}
+	if peer.removes != 0 {
+		t.Errorf("peer removes = %d; want 0", peer.removes)
+	}
+}
+
+func TestSetNotSupported(t *testing.T) {
+	peer := &fakePeer{}
+	g := newGroup("TestSetNotSupported-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{getOnlyPeer{peer}}), nil)
+
+	if err := g.Set(dummyCtx, "k", []byte("v"), time.Time{}); err != ErrNotSupported {
+		t.Errorf("Set = %v; want ErrNotSupported", err)
+	}
+	if len(peer.sets) != 0 {
+		t.Errorf("peer sets = %d; want 0", len(peer.sets))
+	}
+}
+
+func TestSet(t *testing.T) {
+	peer0 := &fakePeer{}
+	loads := 0
+	g := newGroup("TestSet-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("loaded")
+	}), fakePeers([]ProtoGetter{peer0, nil}), nil)
+	var localKey, remoteKey string
+	for i := 0; localKey == "" || remoteKey == ""; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, remote := g.peers.PickPeer(key); remote {
+			remoteKey = key
+		} else {
+			localKey = key
+		}
+	}
+
+	get := func(key string) string {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	get(localKey)
+	value := []byte("pushed")
+	if err := g.Set(dummyCtx, localKey, value, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	value[0] = 'X' // Set must have copied it
+	if got := get(localKey); got != "pushed" || loads != 1 {
+		t.Errorf("after Set, Get = %q with %d loads; want %q with 1", got, loads, "pushed")
+	}
+	if got, want := g.mainCache.bytes(), int64(len(localKey)+len("pushed")); got != want {
+		t.Errorf("main cache holds %d bytes after replacement; want %d", got, want)
+	}
+
+	expire := time.Now().Add(time.Hour)
+	if err := g.SetWithOptions(dummyCtx, remoteKey, []byte("remote"), expire, SetOptions{HotCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(peer0.sets) != 1 || string(peer0.sets[0].GetValue()) != "remote" ||
+		peer0.sets[0].GetExpire() != expire.UnixNano() {
+		t.Fatalf("owner received %v; want one set of %q", peer0.sets, "remote")
+	}
+	if v, ok := g.hotCache.get(remoteKey); !ok || v.String() != "remote" || !v.Expire().Equal(expire) {
+		t.Errorf("hot cache has %v, %v; want %q expiring at %v", v, ok, "remote", expire)
+	}
+
+	// Expired values are not served.
+	g.mainCache.add(localKey, ByteView{s: "old", e: time.Now().Add(-time.Second)})
+	if got := get(localKey); got != "loaded" || loads != 2 {
+		t.Errorf("Get of expired value = %q with %d loads; want %q with 2", got, loads, "loaded")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	loads := 0
+	var expire time.Time
+	g := newGroup("TestExpire-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		dest.SetExpire(expire)
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	get := func() ByteView {
+		var v ByteView
+		if err := g.Get(dummyCtx, "key", ByteViewSink(&v)); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// A value that already expired is returned but not cached.
+	expire = time.Now().Add(-time.Second)
+	get()
+	get()
+	if loads != 2 {
+		t.Errorf("loads = %d; want 2", loads)
+	}
+
+	expire = time.Now().Add(time.Hour).Round(0)
+	for i := 0; i < 2; i++ {
+		if v := get(); !v.Expire().Equal(expire) {
+			t.Errorf("Get returned expiration %v; want %v", v.Expire(), expire)
+		}
+	}
+	if loads != 3 {
+		t.Errorf("loads = %d; want 3", loads)
+	}
+
+	// Expirations from peers reach the caller.
+	peer := &fakePeer{expire: expire}
+	pg := newGroup("TestExpire-peer-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("local getter called")
+	}), fakePeers([]ProtoGetter{peer}), nil)
+	var s string
+	sink := StringSink(&s)
+	if err := pg.Get(dummyCtx, "key", sink); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := sink.view(); !v.Expire().Equal(expire) {
+		t.Errorf("peer value expires at %v; want %v", v.Expire(), expire)
+	}
+}
+
+func TestByteViewSinkExpire(t *testing.T) {
+	e := time.Unix(100, 0)
+	var before, after ByteView
+	s := ByteViewSink(&before)
+	s.SetExpire(e)
+	s.SetString("x")
+	s = ByteViewSink(&after)
+	s.SetBytes([]byte("x"))
+	s.SetExpire(e)
+	if !before.Expire().Equal(e) || !after.Expire().Equal(e) {
+		t.Errorf("expirations = %v, %v; want %v", before.Expire(), after.Expire(), e)
+	}
+}
+
+func TestSetReader(t *testing.T) {
+	g := newGroup("TestSetReader-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetReader(strings.NewReader("read:" + key))
+	}), NoPeers{}, nil)
+	var s string
+	var b []byte
+	var w bytes.Buffer
+	for _, sink := range []Sink{StringSink(&s), AllocatingByteSliceSink(&b), WriterSink(&w)} {
+		if err := g.Get(dummyCtx, "key", sink); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s != "read:key" || string(b) != "read:key" || w.String() != "read:key" {
+		t.Errorf("got %q, %q, %q; want %q for all", s, b, w.String(), "read:key")
+	}
+}
+
+// streamPeer is a fakePeer that can also stream values.
+type streamPeer struct {
+	fakePeer
+	streams int
+}
+
+func (p *streamPeer) GetStream(_ context.Context, in *pb.GetRequest, w io.Writer) (time.Time, error) {
+	p.streams++
+	if p.fail {
+		return time.Time{}, errors.New("simulated error from peer")
+	}
+	_, err := io.WriteString(w, "streamed:"+in.GetKey())
+	return p.expire, err
+}
+
+func TestCodecSink(t *testing.T) {
+	type point struct{ X, Y int }
+	for _, c := range []Codec{JSONCodec, GobCodec} {
+		name := fmt.Sprintf("codec-sink-group-%T", c)
+		g := NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return SetCodec(dest, c, point{1, 2})
+		}))
+		for i := 0; i < 2; i++ { // miss, then hit
+			var p point
+			if err := g.Get(dummyCtx, "p", CodecSink(c, &p)); err != nil {
+				t.Fatalf("%T: %v", c, err)
+			}
+			if p != (point{1, 2}) {
+				t.Errorf("%T: got %+v; want {1 2}", c, p)
+			}
+		}
+	}
+}
+
+// readerFunc is an io.Reader calling itself.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestWriterSinkStreamsLocally(t *testing.T) {
+	var w bytes.Buffer
+	expire := time.Now().Add(time.Hour).Round(0)
+	g := newGroup("TestWriterSinkStreamsLocally-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if _, ok := dest.(*writerSink); !ok {
+			t.Errorf("Getter got a %T; want a *writerSink", dest)
+		}
+		dest.SetExpire(expire)
+		return dest.SetReader(io.MultiReader(strings.NewReader("first,"), readerFunc(func(p []byte) (int, error) {
+			if got := w.String(); got != "first," {
+				t.Errorf("while loading, writer has %q; want %q", got, "first,")
+			}
+			return 0, io.EOF
+		})))
+	}), NoPeers{}, nil)
+	sink := WriterSink(&w)
+	if err := g.Get(dummyCtx, "key", sink); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "first," {
+		t.Errorf("got %q; want %q", w.String(), "first,")
+	}
+	if v, _ := sink.view(); !v.Expire().Equal(expire) {
+		t.Errorf("streamed value expires at %v; want %v", v.Expire(), expire)
+	}
+	if v, ok := g.mainCache.get("key"); !ok || v.String() != "first," {
+		t.Errorf("cached %q, %v; want %q", v.String(), ok, "first,")
+	}
+}
+
+// returnedWriter fails the test if it's written to once returned is
+// set.
+type returnedWriter struct {
+	t        *testing.T
+	mu       sync.Mutex
+	returned bool
+	buf      bytes.Buffer
+}
+
+func (w *returnedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.returned {
+		w.t.Errorf("%q written after Get returned", p)
+	}
+	return w.buf.Write(p)
+}
+
+func TestWriterSinkCanceledCaller(t *testing.T) {
+	release := make(chan bool)
+	loaded := make(chan bool)
+	g := newGroup("TestWriterSinkCanceledCaller-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		defer close(loaded)
+		late := readerFunc(func(p []byte) (int, error) {
+			<-release
+			return copy(p, "late"), io.EOF
+		})
+		return dest.SetReader(io.MultiReader(strings.NewReader("early,"), late))
+	}), NoPeers{}, nil)
+
+	w := &returnedWriter{t: t}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- g.Get(ctx, "key", WriterSink(w)) }()
+	for {
+		w.mu.Lock()
+		n := w.buf.Len()
+		w.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Get = %v; want %v", err, context.Canceled)
+	}
+	w.mu.Lock()
+	w.returned = true
+	w.mu.Unlock()
+	close(release)
+	<-loaded
+
+	var s string
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil || s != "early,late" {
+		t.Errorf("after the load, Get = %q, %v; want %q", s, err, "early,late")
+	}
+}
+
+func TestWriterSinkStreamsFromPeer(t *testing.T) {
+	peer := &streamPeer{}
+	peer.expire = time.Now().Add(time.Hour).Round(0)
+	g := newGroup("TestWriterSinkStreamsFromPeer-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("local getter called")
+	}), fakePeers([]ProtoGetter{peer}), &GroupOptions{HotCacheAdmission: 100})
+	var w bytes.Buffer
+	sink := WriterSink(&w)
+	for i := 0; i < 3; i++ {
+		w.Reset()
+		if err := g.Get(dummyCtx, "key", sink); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.String() != "streamed:key" || peer.streams != 3 || peer.hits != 0 {
+		t.Errorf("got %q after %d streams and %d gets; want %q, 3, 0", w.String(), peer.streams, peer.hits, "streamed:key")
+	}
+	if v, _ := sink.view(); !v.Expire().Equal(peer.expire) {
+		t.Errorf("streamed value expires at %v; want %v", v.Expire(), peer.expire)
+	}
+	if n := g.hotCache.items(); n != 0 {
+		t.Errorf("hot cache has %d items; want 0", n)
+	}
+
+	// A stream that fails before writing falls back to a normal load.
+	peer.fail = true
+	w.Reset()
+	if err := g.Get(dummyCtx, "key", sink); err == nil {
+		t.Fatal("Get succeeded with a failing peer and getter")
+	}
+	if peer.hits != 1 {
+		t.Errorf("peer gets = %d; want 1", peer.hits)
+	}
+}
+
+func TestSoftTTL(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		version int
+		release = make(chan bool)
+	)
+	g := newGroup("TestSoftTTL-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		mu.Lock()
+		version++
+		v := version
+		mu.Unlock()
+		if v > 1 {
+			<-release
+		}
+		return dest.SetString(fmt.Sprintf("v%d", v))
+	}), NoPeers{}, &GroupOptions{SoftTTL: time.Millisecond})
+	get := func() string {
+		var s string
+		if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	get()
+	time.Sleep(5 * time.Millisecond)
+	// Stale hits are served at once and start a single reload.
+	for i := 0; i < 3; i++ {
+		if got := get(); got != "v1" {
+			t.Fatalf("stale Get = %q; want v1", got)
+		}
+	}
+	release <- true
+	for deadline := time.Now().Add(time.Second); get() != "v2"; {
+		if time.Now().After(deadline) {
+			t.Fatal("background reload did not replace the value")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := g.Stats.Refreshes.Get(); n != 1 {
+		t.Errorf("Refreshes = %d; want 1", n)
+	}
+	close(release)
+}
+
+func TestHotCacheOptions(t *testing.T) {
+	peer := &fakePeer{}
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("local getter called")
+	})
+	g := newGroup("TestHotCacheOptions-disabled", 1<<20, getter, fakePeers([]ProtoGetter{peer}),
+		&GroupOptions{DisableHotCache: true, HotCacheAdmission: 100})
+	for i := 0; i < 5; i++ {
+		var s string
+		if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := g.hotCache.items(); n != 0 || peer.hits != 5 {
+		t.Errorf("disabled hot cache has %d items after %d peer hits; want 0 after 5", n, peer.hits)
+	}
+
+	g = newGroup("TestHotCacheOptions-split", 1000, getter, fakePeers([]ProtoGetter{peer}),
+		&GroupOptions{HotCacheRatio: 1, HotCachePolicy: ClockPolicy})
+	// Each entry is 10 bytes: 5 of key, 5 of value.
+	for i := 0; i < 50; i++ {
+		g.populateCache(fmt.Sprintf("m-%03d", i), "", ByteView{s: "01234"}, &g.mainCache)
+		g.populateCache(fmt.Sprintf("h-%03d", i), "", ByteView{s: "01234"}, &g.hotCache)
+	}
+	g.populateCache("m-new", "", ByteView{s: "01234"}, &g.mainCache)
+	// With a ratio of 1, the hot cache may be as big as the main
+	// cache before it is evicted from first.
+	if main, hot := g.mainCache.bytes(), g.hotCache.bytes(); main != 500 || hot != 500 {
+		t.Errorf("main, hot cache bytes = %d, %d; want 500, 500", main, hot)
+	}
+	if _, ok := g.hotCache.lru.(*lru.ClockCache); !ok {
+		t.Errorf("hot cache policy is %T; want *lru.ClockCache", g.hotCache.lru)
+	}
+	if _, ok := g.mainCache.lru.(*lru.Cache); !ok {
+		t.Errorf("main cache policy is %T; want *lru.Cache", g.mainCache.lru)
+	}
+}
+
+// chanOnlyFlightGroup is a flightGroup that has DoChan but not
+// DoContext.
+type chanOnlyFlightGroup struct {
+	g singleflight.Group
+}
+
+func (f *chanOnlyFlightGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return f.g.Do(key, fn)
+}
+
+func (f *chanOnlyFlightGroup) DoChan(key string, fn func() (interface{}, error)) <-chan singleflight.Result {
+	return f.g.DoChan(key, fn)
+}
+
+// TestCloseChanFlight tests that a load that outlives its caller,
+// because the group was closed, does not write to the caller's sink.
+func TestCloseChanFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan bool, 1)
+	finished := make(chan bool, 1)
+	g := newGroup("close-chan-flight", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		started <- true
+		<-release
+		err := dest.SetString("late")
+		finished <- true
+		return err
+	}), nil, nil)
+	g.loadGroup = &chanOnlyFlightGroup{}
+
+	var s string
+	errc := make(chan error, 1)
+	go func() { errc <- g.Get(dummyCtx, "k", StringSink(&s)) }()
+	<-started
+	g.Close()
+	if err := <-errc; err != ErrGroupClosed {
+		t.Fatalf("blocked Get = %v; want ErrGroupClosed", err)
+	}
+	close(release)
+	<-finished
+	if s != "" {
+		t.Errorf("sink = %q after Get returned; want it untouched", s)
+	}
+}
+
+func TestCacheCloneOnGet(t *testing.T) {
+	for _, clone := range []bool{false, true} {
+		c := &cache{cloneOnGet: clone}
+		c.add("k", ByteView{b: []byte("val")})
+		v1, _ := c.get("k")
+		v2, _ := c.get("k")
+		shared := &v1.b[0] == &v2.b[0]
+		if shared == clone {
+			t.Errorf("cloneOnGet=%v: hits share memory = %v", clone, shared)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	const name = "close-group"
+	release := make(chan struct{})
+	started := make(chan bool, 1)
+	g := NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "block" {
+			started <- true
+			<-release
+		}
+		return dest.SetString("v")
+	}))
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- g.Get(dummyCtx, "block", StringSink(&s)) }()
+	<-started
+	g.Close()
+	if err := <-errc; err != ErrGroupClosed {
+		t.Errorf("blocked Get = %v; want ErrGroupClosed", err)
+	}
+	close(release)
+
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != ErrGroupClosed {
+		t.Errorf("Get after Close = %v; want ErrGroupClosed", err)
+	}
+	if n := g.CacheStats(MainCache).Items; n != 0 {
+		t.Errorf("main cache has %d items after Close; want 0", n)
+	}
+	if GetGroup(name) != nil {
+		t.Errorf("GetGroup(%q) after Close is non-nil", name)
+	}
+	g.Close() // idempotent
+
+	g2 := NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v2")
+	}))
+	if GetGroup(name) != g2 {
+		t.Errorf("GetGroup(%q) did not return re-registered group", name)
+	}
+	DeregisterGroup(name)
+	if GetGroup(name) != nil {
+		t.Errorf("GetGroup(%q) after DeregisterGroup is non-nil", name)
+	}
+}
+
+func TestSetCacheBytes(t *testing.T) {
+	g := NewGroup("set-cache-bytes-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(strings.Repeat("x", 100))
+	}))
+	var s string
+	for i := 0; i < 10; i++ {
+		if err := g.Get(dummyCtx, fmt.Sprint("k", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := g.CacheStats(MainCache).Items; got != 10 {
+		t.Fatalf("items = %d; want 10", got)
+	}
+
+	g.SetCacheBytes(350)
+	if got := g.CacheBytes(); got != 350 {
+		t.Errorf("CacheBytes = %d; want 350", got)
+	}
+	st := g.CacheStats(MainCache)
+	if st.Bytes > 350 || st.Items != 3 {
+		t.Errorf("after shrinking: %d items, %d bytes; want 3 items within 350 bytes", st.Items, st.Bytes)
+	}
+
+	g.SetCacheBytes(0)
+	if got := g.CacheStats(MainCache).Items; got != 0 {
+		t.Errorf("items after disabling cache = %d; want 0", got)
+	}
+	g.Get(dummyCtx, "k0", StringSink(&s))
+	if got := g.CacheStats(MainCache).Items; got != 0 {
+		t.Errorf("items cached while disabled = %d; want 0", got)
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	errMissing := errors.New("missing")
+	var calls int
+	g := NewGroupOpts("negative-ttl-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		calls++
+		return errMissing
+	}), &GroupOptions{NegativeTTL: time.Hour})
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != errMissing {
+		t.Fatalf("first Get = %v; want %v", err, errMissing)
+	}
+	err := g.Get(dummyCtx, "k", StringSink(&s))
+	if ce, ok := err.(*CachedError); !ok || ce.Err != errMissing {
+		t.Errorf("second Get = %#v; want *CachedError wrapping %v", err, errMissing)
+	}
+	if calls != 1 {
+		t.Errorf("getter called %d times; want 1", calls)
+	}
+	if got := g.Stats.NegativeHits.Get(); got != 1 {
+		t.Errorf("NegativeHits = %d; want 1", got)
+	}
+
+	g.Remove(dummyCtx, "k")
+	g.Get(dummyCtx, "k", StringSink(&s))
+	if calls != 2 {
+		t.Errorf("after Remove, getter called %d times; want 2", calls)
+	}
+}
+
+func TestNegativeTTLSkipsCancellation(t *testing.T) {
+	for _, cause := range []error{context.Canceled, context.DeadlineExceeded, ErrTooManyLoads} {
+		var calls int
+		g := newGroup("negative-ttl-cancel-group-"+cause.Error(), 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			calls++
+			return fmt.Errorf("loading %s: %w", key, cause)
+		}), nil, &GroupOptions{NegativeTTL: time.Hour})
+		var s string
+		for i := 0; i < 2; i++ {
+			if err := g.Get(dummyCtx, "k", StringSink(&s)); !errors.Is(err, cause) {
+				t.Fatalf("Get = %v; want %v", err, cause)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("with %v, getter called %d times; want 2", cause, calls)
+		}
+	}
+}
+
+func TestGetNS(t *testing.T) {
+	g := NewGroupOpts("get-ns-group", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		return dest.SetString(Namespace(ctx) + ":" + key + strings.Repeat(".", 90))
+	}), &GroupOptions{NamespaceQuotas: map[string]int64{"small": 250}})
+
+	for _, ns := range []string{"", "a", "b"} {
+		var s string
+		if err := g.GetNS(dummyCtx, ns, "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if want := ns + ":k"; !strings.HasPrefix(s, want) {
+			t.Errorf("GetNS(%q, k) = %q; want prefix %q", ns, s, want)
+		}
+	}
+	var s string
+	g.GetNS(dummyCtx, "a", "k", StringSink(&s))
+	st := g.NamespaceStats("a")
+	if st.Gets != 2 || st.CacheHits != 1 || st.Loads != 1 || st.Items != 1 {
+		t.Errorf("stats of a = %+v; want 2 gets, 1 hit, 1 load, 1 item", st)
+	}
+
+	for i := 0; i < 5; i++ {
+		g.GetNS(dummyCtx, "small", fmt.Sprint("k", i), StringSink(&s))
+	}
+	st = g.NamespaceStats("small")
+	if st.Bytes > 250 || st.Items != 2 {
+		t.Errorf("stats of small = %+v; want 2 items within 250 bytes", st)
+	}
+	if _, ok := g.mainCache.get(cacheKey("small", "k0")); ok {
+		t.Error("oldest key of namespace over its quota is still cached")
+	}
+	if _, ok := g.mainCache.get(cacheKey("a", "k")); !ok {
+		t.Error("quota of one namespace evicted another's key")
+	}
+}
+
+func TestGetNULKey(t *testing.T) {
+	var gotKey, gotNS string
+	g := newGroup("TestGetNULKey-group", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		gotKey, gotNS = key, Namespace(ctx)
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	var s string
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprint("ns", i, "\x00k")
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if gotKey != key || gotNS != "" {
+			t.Errorf("Getter got key %q in namespace %q; want %q in none", gotKey, gotNS, key)
+		}
+	}
+	if n := len(g.namespaces); n != 0 {
+		t.Errorf("Get of keys with NUL bytes created %d namespaces; want 0", n)
+	}
+}
+
+func TestNamespaceKeySpace(t *testing.T) {
+	g := newGroup("TestNamespaceKeySpace-group", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		return dest.SetString(Namespace(ctx) + "|" + key + strings.Repeat(".", 40))
+	}), NoPeers{}, &GroupOptions{NamespaceQuotas: map[string]int64{"a": 100}, HotKeyCapacity: 10})
+	get := func(ns, key string) string {
+		var s string
+		if err := g.GetNS(dummyCtx, ns, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimRight(s, ".")
+	}
+	tests := []struct{ ns, key, want string }{
+		{"", "a\x00b", "|a\x00b"},
+		{"a", "b", "a|b"},
+		{"", "\x00a\x00b", "|\x00a\x00b"},
+	}
+	for i := 0; i < 2; i++ {
+		for _, tt := range tests {
+			if got := get(tt.ns, tt.key); got != tt.want {
+				t.Errorf("GetNS(%q, %q) = %q; want %q", tt.ns, tt.key, got, tt.want)
+			}
+		}
+	}
+	if n := g.Stats.LocalLoads.Get(); n != int64(len(tests)) {
+		t.Errorf("%d loads; want %d", n, len(tests))
+	}
+
+	// Keys passed to Get are neither charged to namespace a nor
+	// evicted by its quota.
+	for i := 0; i < 5; i++ {
+		get("", fmt.Sprint("a\x00", i))
+	}
+	if st := g.NamespaceStats("a"); st.Items != 1 {
+		t.Errorf("stats of a = %+v; want 1 item", st)
+	}
+	if _, ok := g.mainCache.get(cacheKey("a", "b")); !ok {
+		t.Error("keys passed to Get evicted a key of namespace a")
+	}
+	g.Remove(dummyCtx, "a\x00b")
+	if _, ok := g.mainCache.get(cacheKey("a", "b")); !ok {
+		t.Error("Remove of a key passed to Get removed a key of namespace a")
+	}
+
+	found := false
+	for _, hk := range g.HotKeys(10) {
+		if hk.Namespace == "a" && hk.Key == "b" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("HotKeys = %+v; want b in namespace a", g.HotKeys(10))
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	for _, tt := range []struct{ ns, key string }{
+		{"", "k"}, {"", ""}, {"", "\x00"}, {"", "\x00\x00k"}, {"", "a\x00b"}, {"a", "b"}, {"a", "\x00b"}, {"a", ""},
+	} {
+		k := cacheKey(tt.ns, tt.key)
+		if !validKey(tt.ns, k) {
+			t.Errorf("cacheKey(%q, %q) = %q is not valid", tt.ns, tt.key, k)
+		}
+		if ns, key := splitCacheKey(k); ns != tt.ns || key != tt.key {
+			t.Errorf("splitCacheKey(%q) = %q, %q; want %q, %q", k, ns, key, tt.ns, tt.key)
+		}
+		if other := "x"; validKey(other, k) {
+			t.Errorf("cacheKey(%q, %q) = %q is valid in namespace %q", tt.ns, tt.key, k, other)
+		}
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	g := NewGroupOpts("hot-keys-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), &GroupOptions{HotKeyCapacity: 10})
+	once.Do(testSetup)
+	var s string
+	for i := 0; i < 5; i++ {
+		g.Get(dummyCtx, "a", StringSink(&s))
+	}
+	for i := 0; i < 3; i++ {
+		g.Get(dummyCtx, "b", StringSink(&s))
+	}
+	g.Get(dummyCtx, "c", StringSink(&s))
+	want := []HotKey{{Key: "a", Gets: 5}, {Key: "b", Gets: 3}}
+	if got := g.HotKeys(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("HotKeys(2) = %+v; want %+v", got, want)
+	}
+	if got := g.HotKeys(-1); got != nil {
+		t.Errorf("HotKeys(-1) = %+v; want nil", got)
+	}
+	if got := GetGroup(stringGroupName).HotKeys(2); got != nil {
+		t.Errorf("HotKeys without HotKeyCapacity = %+v; want nil", got)
+	}
+}
+
+func TestRemoveForgetsFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan bool)
+	var loads int32
+	g := NewGroupOpts("remove-forgets-flight", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			started <- true
+			<-release
+			return dest.SetString("stale")
+		}
+		return dest.SetString("fresh")
+	}), nil)
+	errc := make(chan error)
+	go func() {
+		var s string
+		errc <- g.Get(dummyCtx, "k", StringSink(&s))
+	}()
+	<-started
+	if err := g.Remove(dummyCtx, "k"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Get after Remove loads again instead of waiting for the stale
+	// load in flight.
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil || s != "fresh" {
+		t.Errorf("Get after Remove = %q, %v; want fresh, nil", s, err)
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Errorf("stale Get = %v", err)
+	}
+}
+
+func TestLoadOutlivesCanceledCaller(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan bool)
+	var loads int32
+	g := NewGroupOpts("load-outlives-caller", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		atomic.AddInt32(&loads, 1)
+		started <- true
+		<-release
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return dest.SetString("v")
+	}), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 2)
+	go func() {
+		var s string
+		errc <- g.Get(ctx, "k", StringSink(&s))
+	}()
+	<-started
+	var s string
+	go func() {
+		errc <- g.Get(dummyCtx, "k", StringSink(&s))
+	}()
+	time.Sleep(50 * time.Millisecond) // let the second Get join the load
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("canceled Get = %v; want context.Canceled", err)
+	}
+	close(release)
+	if err := <-errc; err != nil || s != "v" {
+		t.Errorf("other Get = %q, %v; want v, nil", s, err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("loads = %d; want 1", n)
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	panics := true
+	g := NewGroupOpts("getter-panic", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if panics {
+			panic("boom")
+		}
+		return dest.SetString("v")
+	}), nil)
+	var s string
+	err := g.Get(dummyCtx, "k", StringSink(&s))
+	if pe, ok := err.(*singleflight.PanicError); !ok || pe.Value != "boom" {
+		t.Fatalf("Get with panicking Getter = %v; want a *singleflight.PanicError", err)
+	}
+	panics = false
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil || s != "v" {
+		t.Errorf("Get after panic = %q, %v; want v, nil", s, err)
+	}
+}
+
+func TestFlightResultTTL(t *testing.T) {
+	var loads int32
+	g := NewGroupOpts("flight-result-ttl", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return fmt.Errorf("load %d failed", atomic.AddInt32(&loads, 1))
+	}), &GroupOptions{FlightResultTTL: time.Hour})
+	var s string
+	for i := 0; i < 3; i++ {
+		if err := g.Get(dummyCtx, "k", StringSink(&s)); err == nil || err.Error() != "load 1 failed" {
+			t.Errorf("Get %d = %v; want the first load's error", i, err)
+		}
+	}
+
+	// Remove drops the kept result.
+	if err := g.Remove(dummyCtx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err == nil || err.Error() != "load 2 failed" {
+		t.Errorf("Get after Remove = %v; want a new load's error", err)
+	}
+}
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts GroupOptions
+	}{
+		{"reject", GroupOptions{MaxConcurrentLoads: 1, LoadOverflow: RejectLoads}},
+		{"queue", GroupOptions{MaxConcurrentLoads: 1, LoadQueueTimeout: 10 * time.Millisecond}},
+	} {
+		release := make(chan struct{})
+		started := make(chan bool)
+		g := NewGroupOpts("max-loads-"+tt.name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			if key == "slow" {
+				started <- true
+				<-release
+			}
+			return dest.SetString("v")
+		}), &tt.opts)
+		errc := make(chan error)
+		go func() {
+			var s string
+			errc <- g.Get(dummyCtx, "slow", StringSink(&s))
+		}()
+		<-started
+		var s string
+		if err := g.Get(dummyCtx, "other", StringSink(&s)); err != ErrTooManyLoads {
+			t.Errorf("%s: Get while at limit = %v; want ErrTooManyLoads", tt.name, err)
+		}
+		if n := g.Stats.LoadsShed.Get(); n != 1 {
+			t.Errorf("%s: LoadsShed = %d; want 1", tt.name, n)
+		}
+		close(release)
+		if err := <-errc; err != nil {
+			t.Errorf("%s: slow Get = %v", tt.name, err)
+		}
+		if err := g.Get(dummyCtx, "other", StringSink(&s)); err != nil {
+			t.Errorf("%s: Get after slot freed = %v", tt.name, err)
+		}
+	}
+}
+
+func TestFlightShards(t *testing.T) {
+	g := NewGroupOpts("flight-shards-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), &GroupOptions{FlightShards: 4})
+	if _, ok := g.loadGroup.(*singleflight.ShardedGroup); !ok {
+		t.Fatalf("loadGroup is %T; want *singleflight.ShardedGroup", g.loadGroup)
+	}
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil || s != "k" {
+		t.Errorf("Get = %q, %v; want k, nil", s, err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next Getter) Getter {
+			return GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+				order = append(order, name)
+				err := next.Get(ctx, key, dest)
+				order = append(order, "/"+name)
+				return err
+			})
+		}
+	}
+	g := NewGroupOpts("middleware-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		order = append(order, "getter")
+		return dest.SetString(key)
+	}), &GroupOptions{Middleware: []Middleware{mw("outer"), mw("inner")}})
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil || s != "k" {
+		t.Fatalf("Get = %q, %v; want k, nil", s, err)
+	}
+	want := []string{"outer", "inner", "getter", "/inner", "/outer"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("call order = %q; want %q", order, want)
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	big := strings.Repeat("x", 100)
+	for _, policy := range []OversizePolicy{PassOversize, RejectOversize, StreamOversize} {
+		policy := policy
+		getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			if key != "big" {
+				return dest.SetString("small")
+			}
+			if err := dest.SetReader(strings.NewReader(big)); err != nil {
+				return err
+			}
+			if policy != StreamOversize {
+				return nil
+			}
+			ws, ok := dest.(*writerSink)
+			if !ok {
+				t.Errorf("policy %d: Getter got a %T; want a *writerSink", policy, dest)
+			} else if !ws.oversize || ws.v.Len() != 0 {
+				t.Errorf("policy %d: sink buffered %d bytes, oversize %v; want 0 bytes, oversize", policy, ws.v.Len(), ws.oversize)
+			}
+			return nil
+		})
+		g := NewGroupOpts(fmt.Sprintf("max-value-bytes-%d", policy), 1<<20, getter,
+			&GroupOptions{MaxValueBytes: 10, OversizePolicy: policy})
+		var buf bytes.Buffer
+		err := g.Get(dummyCtx, "big", WriterSink(&buf))
+		if policy == RejectOversize {
+			if err != ErrValueTooLarge {
+				t.Errorf("policy %d: Get = %v; want ErrValueTooLarge", policy, err)
+			}
+		} else if err != nil || buf.String() != big {
+			t.Errorf("policy %d: Get = %d bytes, %v; want %d bytes", policy, buf.Len(), err, len(big))
+		}
+		var s string
+		if err := g.Get(dummyCtx, "small", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if n := g.CacheStats(MainCache).Items; n != 1 {
+			t.Errorf("policy %d: %d items cached; want only the small one", policy, n)
+		}
+		if _, ok := g.mainCache.get("big"); ok {
+			t.Errorf("policy %d: oversized value was cached", policy)
+		}
+		if n := g.Stats.OversizeLoads.Get(); n != 1 {
+			t.Errorf("policy %d: OversizeLoads = %d; want 1", policy, n)
+		}
+	}
+
+	ws := &writerSink{w: ioutil.Discard, maxBuffer: 10}
+	if err := ws.SetReader(strings.NewReader(big)); err != nil {
+		t.Fatal(err)
+	}
+	if !ws.oversize || ws.v.Len() != 0 {
+		t.Errorf("capped writerSink kept %d bytes, oversize %v; want 0 bytes, oversize", ws.v.Len(), ws.oversize)
+	}
+}
+
+func TestAdmitFunc(t *testing.T) {
+	var loads int
+	g := NewGroupOpts("admit-func-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		if key == "empty" {
+			return dest.SetString("")
+		}
+		return dest.SetString("v")
+	}), &GroupOptions{AdmitFunc: func(key string, value ByteView) bool {
+		return value.Len() > 0
+	}})
+	for i := 0; i < 2; i++ {
+		var s string
+		if err := g.Get(dummyCtx, "empty", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Get(dummyCtx, "full", StringSink(&s)); err != nil || s != "v" {
+			t.Fatalf("Get(full) = %q, %v", s, err)
+		}
+	}
+	if loads != 3 {
+		t.Errorf("%d loads; want 3 (empty value reloaded, full value cached)", loads)
+	}
+	if n := g.Stats.NotAdmitted.Get(); n != 2 {
+		t.Errorf("NotAdmitted = %d; want 2", n)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	g := NewGroupOpts("default-ttl-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "own" {
+			dest.SetExpire(time.Now().Add(time.Minute))
+		}
+		return dest.SetString("v")
+	}), &GroupOptions{DefaultTTL: time.Hour, TTLJitter: 0.1})
+	var v ByteView
+	start := time.Now()
+	if err := g.Get(dummyCtx, "k", ByteViewSink(&v)); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := v.Expire().Sub(start); ttl < 54*time.Minute || ttl > 66*time.Minute+time.Second {
+		t.Errorf("TTL = %v; want within 10%% of an hour", ttl)
+	}
+	if err := g.Get(dummyCtx, "own", ByteViewSink(&v)); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := v.Expire().Sub(start); ttl > 2*time.Minute {
+		t.Errorf("TTL set by Getter = %v; want about a minute", ttl)
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		seen[g.defaultTTL()] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("defaultTTL with jitter returned %d distinct values; want several", len(seen))
+	}
+}
+
+type generationPeer struct {
+	fakePeer
+	gen uint64
+}
+
+func (p *generationPeer) SetGeneration(_ context.Context, in *pb.GenerationRequest) error {
+	p.gen = in.GetGeneration()
+	return nil
+}
+
+func TestBumpGeneration(t *testing.T) {
+	var loads int
+	peer := &generationPeer{}
+	g := newGroup("bump-generation-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("v")
+	}), fakePeers{nil, peer}, &GroupOptions{DisableHotCache: true})
+	key := "local"
+	for i := 0; ; i++ { // find a key this process owns
+		if _, remote := g.peers.PickPeer(key); !remote {
+			break
+		}
+		key = fmt.Sprint("local", i)
+	}
+	var s string
+	for i := 0; i < 2; i++ {
+		g.Get(dummyCtx, key, StringSink(&s))
+	}
+	if loads != 1 {
+		t.Fatalf("loads = %d; want 1", loads)
+	}
+	if err := g.BumpGeneration(dummyCtx); err != nil {
+		t.Fatal(err)
+	}
+	if g.Generation() != 1 || peer.gen != 1 {
+		t.Errorf("generation = %d, peer's = %d; want 1 and 1", g.Generation(), peer.gen)
+	}
+	g.Get(dummyCtx, key, StringSink(&s))
+	if loads != 2 {
+		t.Errorf("loads after BumpGeneration = %d; want 2", loads)
+	}
+	if n := g.CacheStats(MainCache).Items; n != 1 {
+		t.Errorf("%d items cached; want the stale entry replaced", n)
+	}
+}
+
+func TestGetWithOptions(t *testing.T) {
+	var loads int
+	peer := &fakePeer{}
+	g := newGroup("get-with-options-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("local:" + key)
+	}), fakePeers{peer}, nil)
+	var s string
+
+	if err := g.GetWithOptions(dummyCtx, "a", StringSink(&s), GetOptions{LocalOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s != "local:a" || peer.hits != 0 {
+		t.Errorf("LocalOnly: got %q with %d peer hits; want local:a and none", s, peer.hits)
+	}
+
+	g.hotCache.add("b", ByteView{s: "hot:b"})
+	if err := g.GetWithOptions(dummyCtx, "b", StringSink(&s), GetOptions{SkipHotCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:b" || peer.hits != 1 {
+		t.Errorf("SkipHotCache: got %q with %d peer hits; want got:b and 1", s, peer.hits)
+	}
+
+	if err := g.GetWithOptions(dummyCtx, "a", StringSink(&s), GetOptions{ForceRefresh: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:a" || peer.removes != 1 || peer.hits != 2 {
+		t.Errorf("ForceRefresh: got %q with %d removes, %d hits; want got:a, 1, 2", s, peer.removes, peer.hits)
+	}
+	if _, ok := g.mainCache.get("a"); ok {
+		t.Error("ForceRefresh left the old value of a in the main cache")
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d; want 1", loads)
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	g := NewGroup("on-evict-group", 25, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("0123456789")
+	}))
+	var events []string
+	g.OnEvict(func(key string, size int64, which CacheType, reason lru.EvictReason) {
+		events = append(events, fmt.Sprintf("%s:%d:%d:%v", key, size, which, reason))
+	})
+	var s string
+	g.Get(dummyCtx, "a", StringSink(&s))
+	g.Get(dummyCtx, "b", StringSink(&s))
+	g.Get(dummyCtx, "c", StringSink(&s)) // pushes out a
+	g.Set(dummyCtx, "b", []byte("new"), time.Time{})
+	g.Remove(dummyCtx, "c")
+	g.Set(dummyCtx, "d", []byte("old"), time.Now().Add(-time.Second))
+	g.localSet("e", "", []byte("v"), time.Time{}, &g.hotCache)
+	g.hotCache.add("f", ByteView{s: "v", e: time.Now().Add(-time.Second)})
+	g.hotCache.get("f")
+	g.Close()
+	want := []string{
+		"a:11:1:capacity",
+		"b:11:1:replaced",
+		"c:11:1:removed",
+		"f:2:2:expired",
+		"b:4:1:cleared",
+		"e:2:2:cleared",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q; want %q", events, want)
+	}
+}
+
+func TestFlushAndPurgePrefix(t *testing.T) {
+	var loads int
+	g := NewGroupOpts("flush-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("v")
+	}), &GroupOptions{NegativeTTL: time.Hour})
+	var s string
+	for _, key := range []string{"user/1", "user/2", "item/1"} {
+		g.Get(dummyCtx, key, StringSink(&s))
+	}
+	g.localSet("user/3", "", []byte("v"), time.Time{}, &g.hotCache)
+
+	if n := g.PurgePrefix("user/"); n != 3 {
+		t.Errorf("PurgePrefix = %d; want 3", n)
+	}
+	if n := g.CacheStats(MainCache).Items + g.CacheStats(HotCache).Items; n != 1 {
+		t.Errorf("%d items left after PurgePrefix; want 1", n)
+	}
+	if _, ok := g.mainCache.get("item/1"); !ok {
+		t.Error("PurgePrefix removed a key without the prefix")
+	}
+
+	g.Flush()
+	st := g.CacheStats(MainCache)
+	if st.Items != 0 || st.Bytes != 0 {
+		t.Errorf("main cache after Flush: %d items, %d bytes; want none", st.Items, st.Bytes)
+	}
+	g.Get(dummyCtx, "item/1", StringSink(&s))
+	if loads != 4 {
+		t.Errorf("loads = %d; want 4", loads)
+	}
+}
+
 func TestGroupStatsAlignment(t *testing.T) {
 	var g Group
 	off := unsafe.Offsetof(g.Stats)
 	if off%8 != 0 {
 		t.Fatal("Stats structure is not 8-byte aligned.")
 	}
+	if off := unsafe.Offsetof(g.cacheBytes); off%8 != 0 {
+		t.Fatal("cacheBytes is not 8-byte aligned.")
+	}
+	if off := unsafe.Offsetof(g.generation); off%8 != 0 {
+		t.Fatal("generation is not 8-byte aligned.")
+	}
 }
 
 // TODO(bradfitz): port the Google-internal full integration test into here,
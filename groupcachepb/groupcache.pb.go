@@ -16,6 +16,7 @@ var _ = math.Inf
 type GetRequest struct {
 	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
 	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
+	Namespace        *string `protobuf:"bytes,3,opt,name=namespace" json:"namespace,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -37,9 +38,17 @@ func (m *GetRequest) GetKey() string {
 	return ""
 }
 
+func (m *GetRequest) GetNamespace() string {
+	if m != nil && m.Namespace != nil {
+		return *m.Namespace
+	}
+	return ""
+}
+
 type GetResponse struct {
 	Value            []byte   `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
 	MinuteQps        *float64 `protobuf:"fixed64,2,opt,name=minute_qps" json:"minute_qps,omitempty"`
+	Expire           *int64   `protobuf:"varint,3,opt,name=expire" json:"expire,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -61,5 +70,188 @@ func (m *GetResponse) GetMinuteQps() float64 {
 	return 0
 }
 
+func (m *GetResponse) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+type SetRequest struct {
+	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
+	Value            []byte  `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	Expire           *int64  `protobuf:"varint,4,opt,name=expire" json:"expire,omitempty"`
+	Namespace        *string `protobuf:"bytes,5,opt,name=namespace" json:"namespace,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *SetRequest) Reset()         { *m = SetRequest{} }
+func (m *SetRequest) String() string { return proto.CompactTextString(m) }
+func (*SetRequest) ProtoMessage()    {}
+
+func (m *SetRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *SetRequest) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *SetRequest) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *SetRequest) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+func (m *SetRequest) GetNamespace() string {
+	if m != nil && m.Namespace != nil {
+		return *m.Namespace
+	}
+	return ""
+}
+
+type SetResponse struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SetResponse) Reset()         { *m = SetResponse{} }
+func (m *SetResponse) String() string { return proto.CompactTextString(m) }
+func (*SetResponse) ProtoMessage()    {}
+
+type GetMultiRequest struct {
+	Group            *string  `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              []string `protobuf:"bytes,2,rep,name=key" json:"key,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *GetMultiRequest) Reset()         { *m = GetMultiRequest{} }
+func (m *GetMultiRequest) String() string { return proto.CompactTextString(m) }
+func (*GetMultiRequest) ProtoMessage()    {}
+
+func (m *GetMultiRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *GetMultiRequest) GetKey() []string {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+type KeyValue struct {
+	Key              *string `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Value            []byte  `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	Expire           *int64  `protobuf:"varint,3,opt,name=expire" json:"expire,omitempty"`
+	Error            *string `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *KeyValue) Reset()         { *m = KeyValue{} }
+func (m *KeyValue) String() string { return proto.CompactTextString(m) }
+func (*KeyValue) ProtoMessage()    {}
+
+func (m *KeyValue) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *KeyValue) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *KeyValue) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+func (m *KeyValue) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+type GetMultiResponse struct {
+	Values           []*KeyValue `protobuf:"bytes,1,rep,name=values" json:"values,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *GetMultiResponse) Reset()         { *m = GetMultiResponse{} }
+func (m *GetMultiResponse) String() string { return proto.CompactTextString(m) }
+func (*GetMultiResponse) ProtoMessage()    {}
+
+func (m *GetMultiResponse) GetValues() []*KeyValue {
+	if m != nil {
+		return m.Values
+	}
+	return nil
+}
+
+type GenerationRequest struct {
+	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Generation       *uint64 `protobuf:"varint,2,req,name=generation" json:"generation,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *GenerationRequest) Reset()         { *m = GenerationRequest{} }
+func (m *GenerationRequest) String() string { return proto.CompactTextString(m) }
+func (*GenerationRequest) ProtoMessage()    {}
+
+func (m *GenerationRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *GenerationRequest) GetGeneration() uint64 {
+	if m != nil && m.Generation != nil {
+		return *m.Generation
+	}
+	return 0
+}
+
+type GenerationResponse struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *GenerationResponse) Reset()         { *m = GenerationResponse{} }
+func (m *GenerationResponse) String() string { return proto.CompactTextString(m) }
+func (*GenerationResponse) ProtoMessage()    {}
+
+type RemoveResponse struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *RemoveResponse) Reset()         { *m = RemoveResponse{} }
+func (m *RemoveResponse) String() string { return proto.CompactTextString(m) }
+func (*RemoveResponse) ProtoMessage()    {}
+
 func init() {
 }
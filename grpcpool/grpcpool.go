@@ -0,0 +1,189 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grpcpool provides a gRPC peer transport for groupcache, an
+// alternative to groupcache.HTTPPool for environments standardized
+// on gRPC.
+//
+// A process serves its peers by registering the groupcache service on
+// its gRPC server with Register, and reaches them through a Pool:
+//
+//	s := grpc.NewServer()
+//	grpcpool.Register(s)
+//	pool := grpcpool.New("10.0.0.1:8080", nil)
+//	pool.Set("10.0.0.1:8080", "10.0.0.2:8080")
+package grpcpool
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache"
+	"github.com/golang/groupcache/consistenthash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const defaultReplicas = 50
+
+// Pool implements groupcache.PeerPicker for a pool of gRPC peers.
+// A connection is kept open to each peer and reused across requests
+// and across calls to Set.
+type Pool struct {
+	// this peer's address, e.g. "10.0.0.1:8080"
+	self string
+
+	// opts specifies the options.
+	opts Options
+
+	mu      sync.Mutex // guards peers and getters
+	peers   *consistenthash.Map
+	getters map[string]*grpcGetter // keyed by address
+}
+
+// Options are the configurations of a Pool.
+type Options struct {
+	// Replicas specifies the number of key replicas on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+
+	// TLS optionally specifies the TLS configuration used to dial
+	// peers. If nil, connections are not encrypted unless
+	// DialOptions sets transport credentials. Servers enable TLS by
+	// passing grpc.Creds to grpc.NewServer.
+	TLS *tls.Config
+
+	// Timeout optionally bounds each request to a peer whose context
+	// has no deadline. Deadlines are propagated to the peer.
+	Timeout time.Duration
+
+	// DialOptions are passed to grpc.Dial, after those implied by TLS.
+	DialOptions []grpc.DialOption
+}
+
+// New initializes a gRPC pool of peers with the given options, and
+// registers it as the PeerPicker. The self argument is the address of
+// the current server, as it appears in the list passed to Set.
+// New must be called only once.
+func New(self string, o *Options) *Pool {
+	p := newPool(self, o)
+	groupcache.RegisterPeerPicker(func() groupcache.PeerPicker { return p })
+	return p
+}
+
+func newPool(self string, o *Options) *Pool {
+	p := &Pool{
+		self:    self,
+		getters: make(map[string]*grpcGetter),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	return p
+}
+
+// Set updates the pool's list of peers. Each peer value should be a
+// gRPC target, for example "10.0.0.2:8080". Connections to peers no
+// longer in the list are closed; those to remaining peers are kept.
+func (p *Pool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers.Set(peers...)
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if peer == p.self {
+			continue
+		}
+		if g, ok := p.getters[peer]; ok {
+			getters[peer] = g
+			delete(p.getters, peer)
+			continue
+		}
+		g, err := p.dial(peer)
+		if err != nil {
+			// Leave the peer without a getter; PickPeer treats
+			// its keys as local until the next Set.
+			continue
+		}
+		getters[peer] = g
+	}
+	for _, g := range p.getters {
+		g.conn.Close()
+	}
+	p.getters = getters
+}
+
+func (p *Pool) dial(peer string) (*grpcGetter, error) {
+	creds := insecure.NewCredentials()
+	if p.opts.TLS != nil {
+		creds = credentials.NewTLS(p.opts.TLS)
+	}
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, p.opts.DialOptions...)
+	conn, err := grpc.Dial(peer, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcGetter{conn: conn, addr: peer, timeout: p.opts.Timeout}, nil
+}
+
+// PickPeer implements groupcache.PeerPicker.
+func (p *Pool) PickPeer(key string) (groupcache.ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil, false
+	}
+	if g, ok := p.getters[p.peers.Get(key)]; ok {
+		return g, true
+	}
+	return nil, false
+}
+
+// AllPeers implements groupcache.PeerLister.
+func (p *Pool) AllPeers() []groupcache.ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]groupcache.ProtoGetter, 0, len(p.getters))
+	for _, g := range p.getters {
+		peers = append(peers, g)
+	}
+	return peers
+}
+
+// Close closes the connections to all peers and empties the pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for _, g := range p.getters {
+		if cerr := g.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.getters = make(map[string]*grpcGetter)
+	return err
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcpool
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/groupcache"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startServer serves the groupcache service on a local port and
+// returns its address.
+func startServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	Register(s)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	return ln.Addr().String()
+}
+
+func TestPool(t *testing.T) {
+	const groupName = "grpcpool-test"
+	g := groupcache.NewGroup(groupName, 1<<20, groupcache.GetterFunc(
+		func(_ context.Context, key string, dest groupcache.Sink) error {
+			return dest.SetString(strings.Repeat(key, 3))
+		}))
+	addr := startServer(t)
+	p := newPool("self", nil)
+	defer p.Close()
+	p.Set("self", addr)
+
+	ctx := context.Background()
+	var peer groupcache.ProtoGetter
+	for i := 0; peer == nil; i++ {
+		if i == 100 {
+			t.Fatal("no key maps to the remote peer")
+		}
+		peer, _ = p.PickPeer(string(rune('a' + i)))
+	}
+
+	out := new(pb.GetResponse)
+	if err := peer.Get(ctx, &pb.GetRequest{Group: proto.String(groupName), Key: proto.String("ab")}, out); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out.GetValue()); got != "ababab" {
+		t.Errorf("Get = %q; want %q", got, "ababab")
+	}
+
+	expire := time.Now().Add(time.Hour).Round(0)
+	set := &pb.SetRequest{Group: proto.String(groupName), Key: proto.String("k"), Value: []byte("set"), Expire: proto.Int64(expire.UnixNano())}
+	if err := peer.(groupcache.Setter).Set(ctx, set); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gotExpire, err := peer.(groupcache.StreamGetter).GetStream(ctx, &pb.GetRequest{Group: proto.String(groupName), Key: proto.String("k")}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "set" || !gotExpire.Equal(expire) {
+		t.Errorf("GetStream = %q, %v; want %q, %v", buf.String(), gotExpire, "set", expire)
+	}
+
+	if err := peer.(groupcache.Remover).Remove(ctx, &pb.GetRequest{Group: proto.String(groupName), Key: proto.String("k")}); err != nil {
+		t.Fatal(err)
+	}
+	var v string
+	if err := g.Get(ctx, "k", groupcache.StringSink(&v)); err != nil || v != "kkk" {
+		t.Errorf("after Remove, Get = %q, %v; want %q", v, err, "kkk")
+	}
+
+	multi := new(pb.GetMultiResponse)
+	if err := peer.(groupcache.BatchGetter).GetMulti(ctx, &pb.GetMultiRequest{Group: proto.String(groupName), Key: []string{"x", "y", "x"}}, multi); err != nil {
+		t.Fatal(err)
+	}
+	if len(multi.Values) != 2 || string(multi.Values[1].GetValue()) != "yyy" {
+		t.Errorf("GetMulti = %v; want values for x and y", multi.Values)
+	}
+
+	gen := &pb.GenerationRequest{Group: proto.String(groupName), Generation: proto.Uint64(3)}
+	if err := peer.(groupcache.GenerationSetter).SetGeneration(ctx, gen); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Generation(); got != 3 {
+		t.Errorf("Generation = %d; want 3", got)
+	}
+
+	err = peer.Get(ctx, &pb.GetRequest{Group: proto.String("no-such-group"), Key: proto.String("k")}, new(pb.GetResponse))
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get of unknown group = %v; want NotFound", err)
+	}
+}
+
+func TestPoolSetReusesConnections(t *testing.T) {
+	p := newPool("self", nil)
+	defer p.Close()
+	p.Set("self", "10.0.0.1:1", "10.0.0.2:1")
+	before := p.getters["10.0.0.1:1"]
+	if before == nil || len(p.getters) != 2 {
+		t.Fatalf("getters = %v; want one per remote peer", p.getters)
+	}
+	p.Set("10.0.0.1:1")
+	if got := p.getters["10.0.0.1:1"]; got != before {
+		t.Error("Set replaced the getter of a remaining peer")
+	}
+	if _, ok := p.getters["10.0.0.2:1"]; ok {
+		t.Error("Set kept the getter of a removed peer")
+	}
+}
+
+func TestGetterTimeout(t *testing.T) {
+	h := &grpcGetter{timeout: time.Second}
+	ctx, cancel := h.context(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("context without deadline was not bounded by the timeout")
+	}
+	want := time.Now().Add(time.Minute)
+	parent, cancelParent := context.WithDeadline(context.Background(), want)
+	defer cancelParent()
+	ctx, cancel = h.context(parent)
+	defer cancel()
+	if d, _ := ctx.Deadline(); !d.Equal(want) {
+		t.Errorf("deadline = %v; want the caller's %v", d, want)
+	}
+}
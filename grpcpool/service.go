@@ -0,0 +1,304 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcpool
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/golang/groupcache"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serviceName is the GroupCache service of groupcache.proto.
+const serviceName = "groupcachepb.GroupCache"
+
+// streamChunkSize is the most value bytes sent in one GetStream message.
+const streamChunkSize = 32 << 10
+
+// Register registers the groupcache service on s, serving peer
+// requests from this process's groups.
+func Register(s grpc.ServiceRegistrar) {
+	s.RegisterService(&serviceDesc, server{})
+}
+
+// groupCacheServer is the server API of the GroupCache service.
+type groupCacheServer interface {
+	Get(context.Context, *pb.GetRequest) (*pb.GetResponse, error)
+	Set(context.Context, *pb.SetRequest) (*pb.SetResponse, error)
+	Remove(context.Context, *pb.GetRequest) (*pb.RemoveResponse, error)
+	GetMulti(context.Context, *pb.GetMultiRequest) (*pb.GetMultiResponse, error)
+	SetGeneration(context.Context, *pb.GenerationRequest) (*pb.GenerationResponse, error)
+	GetStream(*pb.GetRequest, grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*groupCacheServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Get", Handler: unaryHandler("Get", new(pb.GetRequest), func(s groupCacheServer, ctx context.Context, in proto.Message) (interface{}, error) {
+			return s.Get(ctx, in.(*pb.GetRequest))
+		})},
+		{MethodName: "Set", Handler: unaryHandler("Set", new(pb.SetRequest), func(s groupCacheServer, ctx context.Context, in proto.Message) (interface{}, error) {
+			return s.Set(ctx, in.(*pb.SetRequest))
+		})},
+		{MethodName: "Remove", Handler: unaryHandler("Remove", new(pb.GetRequest), func(s groupCacheServer, ctx context.Context, in proto.Message) (interface{}, error) {
+			return s.Remove(ctx, in.(*pb.GetRequest))
+		})},
+		{MethodName: "GetMulti", Handler: unaryHandler("GetMulti", new(pb.GetMultiRequest), func(s groupCacheServer, ctx context.Context, in proto.Message) (interface{}, error) {
+			return s.GetMulti(ctx, in.(*pb.GetMultiRequest))
+		})},
+		{MethodName: "SetGeneration", Handler: unaryHandler("SetGeneration", new(pb.GenerationRequest), func(s groupCacheServer, ctx context.Context, in proto.Message) (interface{}, error) {
+			return s.SetGeneration(ctx, in.(*pb.GenerationRequest))
+		})},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "GetStream",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := new(pb.GetRequest)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(groupCacheServer).GetStream(in, stream)
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "groupcache.proto",
+}
+
+// unaryHandler returns the handler of a unary method, which decodes a
+// request of the same type as proto and passes it to call.
+func unaryHandler(method string, prototype proto.Message, call func(groupCacheServer, context.Context, proto.Message) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	fullMethod := "/" + serviceName + "/" + method
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := proto.Clone(prototype)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(groupCacheServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(groupCacheServer), ctx, req.(proto.Message))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+// server implements groupCacheServer with groupcache.LocalPeer.
+type server struct{}
+
+// peer returns the local peer, or a NotFound error if the process has
+// no such group.
+func (server) peer(group string) (groupcache.ProtoGetter, error) {
+	if groupcache.GetGroup(group) == nil {
+		return nil, status.Errorf(codes.NotFound, "no such group: %s", group)
+	}
+	return groupcache.LocalPeer(), nil
+}
+
+func (s server) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	p, err := s.peer(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	out := new(pb.GetResponse)
+	if err := p.Get(ctx, in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s server) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, error) {
+	p, err := s.peer(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.(groupcache.Setter).Set(ctx, in); err != nil {
+		return nil, err
+	}
+	return new(pb.SetResponse), nil
+}
+
+func (s server) Remove(ctx context.Context, in *pb.GetRequest) (*pb.RemoveResponse, error) {
+	p, err := s.peer(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.(groupcache.Remover).Remove(ctx, in); err != nil {
+		return nil, err
+	}
+	return new(pb.RemoveResponse), nil
+}
+
+func (s server) GetMulti(ctx context.Context, in *pb.GetMultiRequest) (*pb.GetMultiResponse, error) {
+	p, err := s.peer(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	out := new(pb.GetMultiResponse)
+	if err := p.(groupcache.BatchGetter).GetMulti(ctx, in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s server) SetGeneration(ctx context.Context, in *pb.GenerationRequest) (*pb.GenerationResponse, error) {
+	p, err := s.peer(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.(groupcache.GenerationSetter).SetGeneration(ctx, in); err != nil {
+		return nil, err
+	}
+	return new(pb.GenerationResponse), nil
+}
+
+func (s server) GetStream(in *pb.GetRequest, stream grpc.ServerStream) error {
+	p, err := s.peer(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	w := &chunkWriter{stream: stream}
+	expire, err := p.(groupcache.StreamGetter).GetStream(stream.Context(), in, w)
+	if err != nil {
+		return err
+	}
+	last := &pb.GetResponse{}
+	if !expire.IsZero() {
+		last.Expire = proto.Int64(expire.UnixNano())
+	}
+	return stream.SendMsg(last)
+}
+
+// chunkWriter sends the bytes written to it as GetResponse messages of
+// at most streamChunkSize value bytes.
+type chunkWriter struct {
+	stream grpc.ServerStream
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > streamChunkSize {
+			chunk = chunk[:streamChunkSize]
+		}
+		if err := w.stream.SendMsg(&pb.GetResponse{Value: chunk}); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// grpcGetter implements groupcache.ProtoGetter, and the optional peer
+// interfaces, over a connection to one peer.
+type grpcGetter struct {
+	conn    *grpc.ClientConn
+	addr    string
+	timeout time.Duration
+}
+
+// context returns ctx bounded by the getter's timeout, if ctx has no
+// deadline.
+func (h *grpcGetter) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok || h.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, h.timeout)
+}
+
+func (h *grpcGetter) invoke(ctx context.Context, method string, in, out proto.Message) error {
+	ctx, cancel := h.context(ctx)
+	defer cancel()
+	return h.conn.Invoke(ctx, "/"+serviceName+"/"+method, in, out)
+}
+
+func (h *grpcGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	return h.invoke(ctx, "Get", in, out)
+}
+
+// Remove implements groupcache.Remover.
+func (h *grpcGetter) Remove(ctx context.Context, in *pb.GetRequest) error {
+	return h.invoke(ctx, "Remove", in, new(pb.RemoveResponse))
+}
+
+// Set implements groupcache.Setter.
+func (h *grpcGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	return h.invoke(ctx, "Set", in, new(pb.SetResponse))
+}
+
+// GetMulti implements groupcache.BatchGetter.
+func (h *grpcGetter) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	return h.invoke(ctx, "GetMulti", in, out)
+}
+
+// SetGeneration implements groupcache.GenerationSetter.
+func (h *grpcGetter) SetGeneration(ctx context.Context, in *pb.GenerationRequest) error {
+	return h.invoke(ctx, "SetGeneration", in, new(pb.GenerationResponse))
+}
+
+// GetStream implements groupcache.StreamGetter, copying each chunk of
+// the value to w as it arrives.
+func (h *grpcGetter) GetStream(ctx context.Context, in *pb.GetRequest, w io.Writer) (expire time.Time, err error) {
+	ctx, cancel := h.context(ctx)
+	defer cancel()
+	stream, err := h.conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/GetStream")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := stream.SendMsg(in); err != nil {
+		return time.Time{}, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return time.Time{}, err
+	}
+	for {
+		res := new(pb.GetResponse)
+		err := stream.RecvMsg(res)
+		if err == io.EOF {
+			return expire, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if _, err := w.Write(res.GetValue()); err != nil {
+			return time.Time{}, err
+		}
+		if res.Expire != nil {
+			expire = time.Unix(0, res.GetExpire())
+		}
+	}
+}
+
+// String returns the address of the peer.
+func (h *grpcGetter) String() string {
+	return h.addr
+}
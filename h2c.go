@@ -0,0 +1,62 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// h2c.go carries peer requests over HTTP/2 without TLS.
+
+package groupcache
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cTransport sends requests with http URLs over h2c, and others over
+// the wrapped transport.
+type h2cTransport struct {
+	h2  *http2.Transport
+	tls *http.Transport
+}
+
+func newH2CTransport(t *http.Transport, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *h2cTransport {
+	return &h2cTransport{
+		h2: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		},
+		tls: t,
+	}
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+// H2CHandler wraps h, typically an HTTPPool or a mux serving one, so
+// that it also accepts HTTP/2 requests without TLS, as sent by pools
+// with the HTTP2 option.
+func H2CHandler(h http.Handler) http.Handler {
+	return h2c.NewHandler(h, &http2.Server{})
+}
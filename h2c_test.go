@@ -0,0 +1,76 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+func TestHTTP2(t *testing.T) {
+	g := newGroup("TestHTTP2-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	var h2 int32
+	srv := httptest.NewServer(H2CHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			atomic.AddInt32(&h2, 1)
+		}
+		(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}).ServeHTTP(w, r)
+	})))
+	defer srv.Close()
+
+	pool := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, HTTP2: true}}
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, transport: pool.transportLocked()}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	res := &pb.GetResponse{}
+	if err := peer.Get(context.Background(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "value" {
+		t.Errorf("Get = %q; want %q", res.Value, "value")
+	}
+	if atomic.LoadInt32(&h2) != 1 {
+		t.Error("the request did not use HTTP/2")
+	}
+}
+
+func TestClientTransportTuning(t *testing.T) {
+	tr := newClientTransport(&HTTPPoolOptions{}, "").(*http.Transport)
+	if tr.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		t.Errorf("MaxIdleConnsPerHost = %d; want %d", tr.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	}
+	tr = newClientTransport(&HTTPPoolOptions{MaxIdleConnsPerHost: 7, MaxConnsPerHost: 9}, "").(*http.Transport)
+	if tr.MaxIdleConnsPerHost != 7 || tr.MaxConnsPerHost != 9 {
+		t.Errorf("MaxIdleConnsPerHost, MaxConnsPerHost = %d, %d; want 7, 9", tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost)
+	}
+
+	// All peers share the pool's transport.
+	p := &HTTPPool{self: "http://a", opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas}}
+	p.Set("http://a", "http://b")
+	ctx := context.Background()
+	if p.httpGetters["http://a"].transport(ctx) != p.httpGetters["http://b"].transport(ctx) {
+		t.Error("peers use different transports")
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// health.go ejects unhealthy peers from an HTTPPool's consistent hash.
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/jump"
+)
+
+// healthPath is the path, under the pool's BasePath, that answers
+// health checks.
+const healthPath = "_health"
+
+const (
+	defaultEjectionTime        = 30 * time.Second
+	defaultHealthCheckInterval = 5 * time.Second
+)
+
+// peerHealth tracks the failures of one peer.
+type peerHealth struct {
+	failures int
+	ejected  bool
+	readmit  *time.Timer // re-admits an ejected peer
+}
+
+// setHealthLocked keeps the health of the peers that remain in peers
+// and starts the others healthy. p.mu must be held.
+func (p *HTTPPool) setHealthLocked(peers []string) {
+	health := make(map[string]*peerHealth, len(peers))
+	for _, peer := range peers {
+		if h, ok := p.health[peer]; ok {
+			health[peer] = h
+			delete(p.health, peer)
+		} else {
+			health[peer] = &peerHealth{}
+		}
+	}
+	for _, h := range p.health {
+		if h.readmit != nil {
+			h.readmit.Stop()
+		}
+	}
+	p.health = health
+}
+
+// rebuildLocked updates the consistent hash to hold the peers that are
+// not ejected, leaving out p itself if it is draining. Only the keys of
+// the peers that joined or left the hash move. p.mu must be held.
+//
+// A jump.Map numbers peers by their position in the list, so leaving
+// out one in the middle would move the keys of all those after it,
+// differently on each process. It keeps every peer instead, and the
+// keys of those left out go to a fallback ring of the others.
+func (p *HTTPPool) rebuildLocked() {
+	if p.peers == nil {
+		p.peers = p.newRing()
+	}
+	draining := p.isDraining()
+	var members []string
+	for _, peer := range p.peerList {
+		if peer == p.self && draining {
+			continue
+		}
+		if h := p.health[peer]; h == nil || !h.ejected {
+			members = append(members, peer)
+		}
+	}
+	p.left, p.fallback = nil, nil
+	if _, numbered := p.peers.(*jump.Map); numbered && len(members) < len(p.peerList) {
+		p.left = make(map[string]bool, len(p.peerList)-len(members))
+		for _, peer := range p.peerList {
+			p.left[peer] = true
+		}
+		for _, peer := range members {
+			delete(p.left, peer)
+		}
+		p.fallback = p.newRing()
+		p.fallback.Set(members...)
+		members = p.peerList
+	}
+	p.peers.Set(members...)
+	wr, ok := p.peers.(WeightedRing)
+	if !ok {
+		return
+	}
+	for _, peer := range members {
+		w, ok := p.weights[peer]
+		if !ok {
+			w = 1
+		}
+		if wr.Weight(peer) != w {
+			wr.AddWeighted(peer, w)
+		}
+	}
+}
+
+// ownerLocked returns the peer that owns key, or "" if there is none.
+// p.mu must be held.
+func (p *HTTPPool) ownerLocked(key string) string {
+	peer := p.peers.Get(key)
+	if p.left[peer] {
+		peer = p.fallback.Get(key)
+	}
+	return peer
+}
+
+// recordResult records the outcome of a request to peer, ejecting the
+// peer after MaxFailures consecutive failures and re-admitting it on
+// success.
+func (p *HTTPPool) recordResult(peer string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.health[peer]
+	if !ok || peer == p.self {
+		return
+	}
+	if err == nil {
+		h.failures = 0
+		if h.ejected {
+			p.readmitLocked(h)
+		}
+		return
+	}
+	h.failures++
+	if p.opts.MaxFailures > 0 && h.failures >= p.opts.MaxFailures && !h.ejected {
+		p.ejectLocked(peer, h)
+	}
+}
+
+func (p *HTTPPool) ejectLocked(peer string, h *peerHealth) {
+	h.ejected = true
+	d := p.opts.EjectionTime
+	if d <= 0 {
+		d = defaultEjectionTime
+	}
+	h.readmit = time.AfterFunc(d, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.health[peer] == h && h.ejected {
+			p.readmitLocked(h)
+		}
+	})
+	p.rebuildLocked()
+}
+
+func (p *HTTPPool) readmitLocked(h *peerHealth) {
+	h.ejected = false
+	h.failures = 0
+	if h.readmit != nil {
+		h.readmit.Stop()
+		h.readmit = nil
+	}
+	p.rebuildLocked()
+}
+
+// Ejected returns the peers currently ejected from the consistent hash.
+func (p *HTTPPool) Ejected() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ejected []string
+	for _, peer := range p.peerList {
+		if h := p.health[peer]; h != nil && h.ejected {
+			ejected = append(ejected, peer)
+		}
+	}
+	return ejected
+}
+
+// RunHealthChecks pings every other peer each HealthCheckInterval
+// until ctx is done, and returns ctx.Err(). Failed pings count toward
+// MaxFailures like failed requests, so peers are only ejected if
+// MaxFailures is set; a successful ping re-admits an ejected peer.
+func (p *HTTPPool) RunHealthChecks(ctx context.Context) error {
+	interval := p.opts.HealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		p.checkHealth(ctx, interval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// checkHealth pings every other peer once, waiting at most timeout for
+// each reply.
+func (p *HTTPPool) checkHealth(ctx context.Context, timeout time.Duration) {
+	p.mu.Lock()
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, g := range p.httpGetters {
+		if peer != p.self {
+			getters[peer] = g
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for peer, g := range getters {
+		wg.Add(1)
+		go func(peer string, g *httpGetter) {
+			defer wg.Done()
+			pctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := g.ping(pctx)
+			if ctx.Err() == nil {
+				p.recordResult(peer, err)
+			}
+		}(peer, g)
+	}
+	wg.Wait()
+}
+
+// ping checks that the peer answers health checks.
+func (h *httpGetter) ping(ctx context.Context) error {
+	req, err := http.NewRequest("GET", h.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(versionHeader, strconv.Itoa(ProtocolVersion))
+	if h.signer != nil {
+		if err := h.signer.Sign(req); err != nil {
+			return err
+		}
+	}
+	tr := http.DefaultTransport
+	if h.transport != nil {
+		tr = h.transport(ctx)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return &statusError{code: res.StatusCode, status: res.Status}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestHTTPPoolPassiveEjection(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL := dead.URL
+	dead.Close()
+
+	p := &HTTPPool{
+		self: "self",
+		opts: HTTPPoolOptions{
+			BasePath:     defaultBasePath,
+			Replicas:     defaultReplicas,
+			MaxFailures:  2,
+			EjectionTime: 50 * time.Millisecond,
+		},
+	}
+	p.Set("self", deadURL)
+	req := &pb.GetRequest{Group: proto.String("group"), Key: proto.String("key")}
+	for i := 0; i < 2; i++ {
+		if len(p.Ejected()) != 0 {
+			t.Fatalf("peer ejected after %d failures", i)
+		}
+		if err := p.httpGetters[deadURL].Get(context.TODO(), req, &pb.GetResponse{}); err == nil {
+			t.Fatal("Get from a closed server succeeded")
+		}
+	}
+	if got := p.Ejected(); len(got) != 1 || got[0] != deadURL {
+		t.Fatalf("Ejected = %q; want [%q]", got, deadURL)
+	}
+	for i := 0; i < 100; i++ {
+		if _, remote := p.PickPeer(string(rune('a' + i))); remote {
+			t.Fatal("PickPeer picked an ejected peer")
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := p.Ejected(); len(got) != 0 {
+		t.Errorf("Ejected after EjectionTime = %q; want none", got)
+	}
+}
+
+func TestHTTPPoolHealthChecks(t *testing.T) {
+	var healthy int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/"+healthPath) || atomic.LoadInt32(&healthy) == 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	good := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer good.Close()
+
+	p := &HTTPPool{
+		self: "self",
+		opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas, MaxFailures: 1, EjectionTime: time.Hour},
+	}
+	p.Set("self", srv.URL, good.URL)
+	ctx := context.Background()
+	p.checkHealth(ctx, time.Second)
+	if got := p.Ejected(); len(got) != 0 {
+		t.Fatalf("Ejected = %q; want none", got)
+	}
+	atomic.StoreInt32(&healthy, 0)
+	p.checkHealth(ctx, time.Second)
+	if got := p.Ejected(); len(got) != 1 || got[0] != srv.URL {
+		t.Fatalf("Ejected = %q; want [%q]", got, srv.URL)
+	}
+
+	// Ejection survives Set if the peer remains.
+	p.Set("self", srv.URL, good.URL)
+	if got := p.Ejected(); len(got) != 1 {
+		t.Fatalf("Ejected after Set = %q; want [%q]", got, srv.URL)
+	}
+	atomic.StoreInt32(&healthy, 1)
+	p.checkHealth(ctx, time.Second)
+	if got := p.Ejected(); len(got) != 0 {
+		t.Errorf("Ejected after recovery = %q; want none", got)
+	}
+}
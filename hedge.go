@@ -0,0 +1,151 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// hedge.go races slow peer fetches against local loads.
+
+package groupcache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is the number of recent peer fetch latencies a group
+// keeps for GroupOptions.HedgePercentile.
+const latencySamples = 128
+
+// latencyWindow holds the latencies of recent peer fetches.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	n       int // number of samples held
+	next    int // index of the next sample to overwrite
+	added   int // samples added since cached was computed
+	cached  time.Duration
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencySamples
+	if w.n < latencySamples {
+		w.n++
+	}
+	w.added++
+}
+
+// percentile returns the p'th percentile of the held latencies, or 0
+// if there are too few of them. It is recomputed every few samples.
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.n < latencySamples/4 {
+		return 0
+	}
+	if w.cached == 0 || w.added >= latencySamples/8 {
+		s := make([]time.Duration, w.n)
+		copy(s, w.samples[:w.n])
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		w.cached = s[int(p*float64(len(s)-1))]
+		w.added = 0
+	}
+	return w.cached
+}
+
+// hedgeDelay returns how long a load waits for the owner of a key
+// before also loading it locally, or 0 if loads are not hedged.
+func (g *Group) hedgeDelay() time.Duration {
+	if p := g.opts.HedgePercentile; p > 0 && p < 1 {
+		if d := g.peerLatency.percentile(p); d > g.opts.HedgeDelay {
+			return d
+		}
+	}
+	return g.opts.HedgeDelay
+}
+
+type hedgeResult struct {
+	value ByteView
+	local bool
+	err   error
+}
+
+// fetchFromOwner fetches the value for key from peer, the key's owner.
+// If the owner has not answered within the group's hedge delay, the
+// key is also loaded locally and the first value to arrive is used.
+// local reports whether the result comes from the local load.
+func (g *Group) fetchFromOwner(ctx context.Context, peer ProtoGetter, key string, opts GetOptions) (value ByteView, local bool, err error) {
+	fetch := g.getFromPeer
+	if opts.SkipHotCache {
+		fetch = g.fetchFromPeer
+	}
+	delay := g.hedgeDelay()
+	if delay <= 0 {
+		// Until enough latencies are known, a HedgePercentile
+		// without a HedgeDelay leaves delay 0.
+		start := time.Now()
+		value, err = fetch(ctx, peer, key, opts.namespace)
+		if err == nil && g.opts.HedgePercentile > 0 {
+			g.peerLatency.add(time.Since(start))
+		}
+		return value, false, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, 2)
+	start := time.Now()
+	go func() {
+		value, err := fetch(ctx, peer, key, opts.namespace)
+		if err == nil {
+			g.peerLatency.add(time.Since(start))
+		}
+		results <- hedgeResult{value: value, err: err}
+	}()
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case r := <-results:
+		return r.value, false, r.err
+	case <-t.C:
+	}
+	g.Stats.HedgedLoads.Add(1)
+	go func() {
+		var sink ByteView
+		value, err := g.getLocally(ctx, key, opts.namespace, ByteViewSink(&sink))
+		results <- hedgeResult{value: value, local: true, err: err}
+	}()
+
+	// Use the first success, or the local load's error if both fail:
+	// a failed peer fetch falls back to the local load anyway.
+	var failed hedgeResult
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err == nil {
+			if r.local {
+				g.Stats.HedgeWins.Add(1)
+			}
+			return r.value, r.local, nil
+		}
+		if r.local || failed.err == nil {
+			failed = r
+		}
+	}
+	return failed.value, failed.local, failed.err
+}
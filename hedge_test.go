@@ -0,0 +1,141 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// slowPeer answers Gets after delay, or fails them if their context is
+// done first, closing canceled.
+type slowPeer struct {
+	fakePeer
+	delay    time.Duration
+	canceled chan struct{}
+	once     sync.Once
+}
+
+func (p *slowPeer) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	select {
+	case <-time.After(p.delay):
+		return p.fakePeer.Get(ctx, in, out)
+	case <-ctx.Done():
+		p.once.Do(func() { close(p.canceled) })
+		return ctx.Err()
+	}
+}
+
+func TestHedgedLoad(t *testing.T) {
+	peer := &slowPeer{delay: time.Hour, canceled: make(chan struct{})}
+	g := newGroup("TestHedgedLoad-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{peer}), &GroupOptions{HedgeDelay: 10 * time.Millisecond})
+
+	var s string
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "local:key" {
+		t.Errorf("Get = %q; want the locally loaded value", s)
+	}
+	select {
+	case <-peer.canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("the peer fetch was not canceled")
+	}
+	if g.Stats.HedgedLoads.Get() != 1 || g.Stats.HedgeWins.Get() != 1 {
+		t.Errorf("HedgedLoads, HedgeWins = %d, %d; want 1, 1", g.Stats.HedgedLoads.Get(), g.Stats.HedgeWins.Get())
+	}
+	if snap := g.StatsSnapshot(); snap.HedgedLoads != 1 || snap.HedgeWins != 1 {
+		t.Errorf("snapshot HedgedLoads, HedgeWins = %d, %d; want 1, 1", snap.HedgedLoads, snap.HedgeWins)
+	}
+
+	// A peer that answers within the delay is not hedged.
+	peer.delay = 0
+	if err := g.Get(dummyCtx, "other", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:other" {
+		t.Errorf("Get = %q; want the peer's value", s)
+	}
+	if g.Stats.HedgedLoads.Get() != 1 {
+		t.Errorf("HedgedLoads = %d; want 1", g.Stats.HedgedLoads.Get())
+	}
+}
+
+func TestHedgedLoadBothFail(t *testing.T) {
+	peer := &slowPeer{delay: 20 * time.Millisecond, canceled: make(chan struct{})}
+	peer.fail = true
+	localErr := errors.New("local failure")
+	g := newGroup("TestHedgedLoadBothFail-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return localErr
+	}), fakePeers([]ProtoGetter{peer}), &GroupOptions{HedgeDelay: time.Millisecond})
+
+	var s string
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); err != localErr {
+		t.Errorf("Get = %v; want %v", err, localErr)
+	}
+}
+
+func TestHedgePercentileOnly(t *testing.T) {
+	peer := &slowPeer{canceled: make(chan struct{})}
+	g := newGroup("TestHedgePercentileOnly-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{peer}), &GroupOptions{HedgePercentile: 0.95})
+
+	var s string
+	for i := 0; i < latencySamples; i++ {
+		if err := g.Get(dummyCtx, fmt.Sprintf("key-%d", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hedged := g.Stats.HedgedLoads.Get()
+
+	peer.delay = time.Hour
+	if err := g.Get(dummyCtx, "slow", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "local:slow" {
+		t.Errorf("Get = %q; want the locally loaded value", s)
+	}
+	if n := g.Stats.HedgedLoads.Get() - hedged; n != 1 {
+		t.Errorf("slow fetch hedged %d times; want 1", n)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	var w latencyWindow
+	for i := 1; i < latencySamples/4; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	if d := w.percentile(0.9); d != 0 {
+		t.Errorf("percentile with few samples = %v; want 0", d)
+	}
+	for i := latencySamples / 4; i <= latencySamples; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	if d, want := w.percentile(0.5), 64*time.Millisecond; d != want {
+		t.Errorf("percentile(0.5) = %v; want %v", d, want)
+	}
+}
@@ -18,12 +18,21 @@ package groupcache
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/groupcache/consistenthash"
 	pb "github.com/golang/groupcache/groupcachepb"
@@ -34,17 +43,19 @@ const defaultBasePath = "/_groupcache/"
 
 const defaultReplicas = 50
 
+const defaultMaxIdleConnsPerHost = 100
+
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
 type HTTPPool struct {
 	// Context optionally specifies a context for the server to use when it
 	// receives a request.
-	// If nil, the server uses a nil Context.
-	Context func(*http.Request) Context
+	// If nil, the server uses the request's context.
+	Context func(*http.Request) context.Context
 
 	// Transport optionally specifies an http.RoundTripper for the client
 	// to use when it makes a request.
 	// If nil, the client uses http.DefaultTransport.
-	Transport func(Context) http.RoundTripper
+	Transport func(context.Context) http.RoundTripper
 
 	// this peer's base URL, e.g. "https://example.net:8000"
 	self string
@@ -52,9 +63,37 @@ type HTTPPool struct {
 	// opts specifies the options.
 	opts HTTPPoolOptions
 
-	mu          sync.Mutex // guards peers and httpGetters
-	peers       *consistenthash.Map
+	mu          sync.Mutex // guards the fields below
+	peers       Ring
 	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
+
+	// peerList is the list passed to Set; peers holds those of them
+	// that are not ejected. A jump.Map ring holds them all instead,
+	// and the keys of the peers in left go to fallback.
+	peerList []string
+	health   map[string]*peerHealth
+	left     map[string]bool
+	fallback Ring
+
+	limiterOnce sync.Once
+	limiter     *requestLimiter // nil if opts set no request limits
+
+	drainMu  sync.RWMutex // guards draining
+	draining bool
+	inflight sync.WaitGroup // peer requests being served
+
+	// clientTransport is the transport built from opts, if they
+	// configure one.
+	clientTransport http.RoundTripper
+
+	// unixTransports are the transports of peers on UNIX domain
+	// sockets, keyed by socket path.
+	unixTransports map[string]http.RoundTripper
+
+	weights     map[string]int    // peer weights, from SetWeights
+	zones       map[string]string // peer zones, from SetZones
+	zoneTraffic map[string]*zoneCounters
+	migrated    float64 // fraction of keys moved to opts.Labels
 }
 
 // HTTPPoolOptions are the configurations of a HTTPPool.
@@ -63,6 +102,11 @@ type HTTPPoolOptions struct {
 	// If blank, it defaults to "/_groupcache/".
 	BasePath string
 
+	// RegisterDefaultHandler makes NewHTTPPoolOpts register the pool
+	// with http.DefaultServeMux at BasePath, as NewHTTPPool does.
+	// Applications that manage their own mux leave it unset.
+	RegisterDefaultHandler bool
+
 	// Replicas specifies the number of key replicas on the consistent hash.
 	// If blank, it defaults to 50.
 	Replicas int
@@ -70,6 +114,202 @@ type HTTPPoolOptions struct {
 	// HashFn specifies the hash function of the consistent hash.
 	// If blank, it defaults to crc32.ChecksumIEEE.
 	HashFn consistenthash.Hash
+
+	// HashFn64 optionally specifies a 64-bit hash function, such as
+	// xxhash.Sum64, for the consistent hash, used instead of HashFn.
+	// Its larger ring makes collisions between the replicas of
+	// different peers much rarer.
+	HashFn64 consistenthash.Hash64
+
+	// KeyHashFn optionally specifies the hash function that places
+	// keys on the consistent hash, separately from HashFn or
+	// HashFn64, which place the replicas of peers. If blank, keys
+	// are hashed like replicas.
+	KeyHashFn consistenthash.Hash64
+
+	// Labels optionally selects how the consistent hash names the
+	// replicas of peers, which every peer must agree on. If blank,
+	// it defaults to consistenthash.LabelsLegacy.
+	Labels consistenthash.Labels
+
+	// MigrateLabels optionally names the Labels that peers used
+	// before, for a rolling upgrade to new Labels: keys keep the
+	// owners they have under MigrateLabels until SetLabelMigration
+	// moves them, a fraction at a time, to their owners under
+	// Labels.
+	MigrateLabels consistenthash.Labels
+
+	// NewRing optionally returns the empty Ring that maps keys to
+	// peers, such as a rendezvous.Map for better balance over few
+	// peers, or a jump.Map for large clusters of numbered peers. A
+	// jump.Map keeps ejected and draining peers in place, so as not
+	// to renumber the others, and their keys go to the rest. If
+	// nil, it defaults to a consistenthash.Map with Replicas,
+	// HashFn or HashFn64, KeyHashFn and Labels. Peer weights need a WeightedRing, and LoadFactor a
+	// BoundedRing.
+	NewRing func() Ring
+
+	// Owners specifies how many peers own each key: the primary
+	// owner on the consistent hash, which loads the key, and
+	// Owners-1 replicas that hold copies and serve the key while
+	// the primary is down. If blank, keys have no replicas.
+	Owners int
+
+	// Zone optionally names the zone, such as an availability zone
+	// or region, that this peer runs in. The zones of the other
+	// peers are given to SetZones. With Owners above one, a key
+	// whose primary owner is in another zone is fetched from one of
+	// its replicas in this zone if there is one, and replicas in
+	// this zone are tried first.
+	Zone string
+
+	// LoadFactor optionally enables consistent hashing with bounded
+	// loads: a peer with more than LoadFactor times the average
+	// number of requests in flight to it from this peer has its keys
+	// sent to the next peer on the consistent hash instead, which
+	// loads them itself. It should be above 1; 1.25 is typical.
+	LoadFactor float64
+
+	// ClientTLS optionally specifies the TLS configuration used to
+	// dial peers with https base URLs: the RootCAs that verify them,
+	// the ServerName to verify and, for mutual TLS, this peer's
+	// Certificates. It is ignored if the pool's Transport is set.
+	ClientTLS *tls.Config
+
+	// ServerTLS optionally specifies the TLS configuration used by
+	// ListenAndServe: this peer's Certificates and, for mutual TLS,
+	// the ClientAuth policy and the ClientCAs that verify peers.
+	ServerTLS *tls.Config
+
+	// Signer optionally attaches credentials to requests sent to
+	// peers, such as BearerToken or HMACAuth.
+	Signer Signer
+
+	// Verifier optionally checks the credentials of requests
+	// received from peers, rejecting those without valid ones.
+	Verifier Verifier
+
+	// Propagator optionally carries request metadata, such as trace
+	// or tenant IDs, from the contexts of loads to the peers that
+	// serve them, and back into the contexts their Getters see.
+	Propagator Propagator
+
+	// Compressors optionally lists the content codings, such as
+	// Gzip, that peers may compress responses with, in order of
+	// preference. A peer compresses its response with the first
+	// coding that the requesting peer also lists.
+	Compressors []Compressor
+
+	// CompressMinBytes specifies the size below which responses are
+	// not compressed. If blank, it defaults to 1024. Streamed
+	// values are always compressed, as their size is not known when
+	// the response starts.
+	CompressMinBytes int
+
+	// MaxFailures optionally specifies the number of consecutive
+	// failed requests to a peer, such as connection errors or failed
+	// health checks, after which the peer is ejected from the
+	// consistent hash until EjectionTime passes or a health check
+	// succeeds. If blank, peers are never ejected.
+	MaxFailures int
+
+	// EjectionTime specifies how long an ejected peer stays out of
+	// the consistent hash. If blank, it defaults to 30 seconds.
+	EjectionTime time.Duration
+
+	// HealthCheckInterval specifies how often RunHealthChecks pings
+	// each peer. If blank, it defaults to 5 seconds.
+	HealthCheckInterval time.Duration
+
+	// Retry specifies how failed requests to peers are retried and
+	// whether the key is then loaded locally. By default requests
+	// are not retried and failed keys are loaded locally.
+	Retry RetryPolicy
+
+	// BreakerFailures optionally specifies the number of failed
+	// requests to a peer within BreakerWindow that open the peer's
+	// circuit breaker. While it is open, requests to the peer fail
+	// with ErrCircuitOpen and its keys are loaded locally; after
+	// BreakerCooldown one trial request is let through, and the
+	// circuit closes if it succeeds. If blank, circuits never open.
+	BreakerFailures int
+
+	// BreakerWindow specifies the window in which BreakerFailures
+	// are counted. If blank, it defaults to 10 seconds.
+	BreakerWindow time.Duration
+
+	// BreakerCooldown specifies how long a circuit stays open before
+	// a trial request. If blank, it defaults to 5 seconds.
+	BreakerCooldown time.Duration
+
+	// DialTimeout specifies how long connecting to a peer may take.
+	// If blank, it defaults to the 30 seconds of
+	// http.DefaultTransport. It is ignored if the pool's Transport
+	// is set.
+	DialTimeout time.Duration
+
+	// ResponseHeaderTimeout optionally limits how long to wait for a
+	// peer's response headers once a request is sent. It is ignored
+	// if the pool's Transport is set.
+	ResponseHeaderTimeout time.Duration
+
+	// RequestTimeout optionally limits how long each request to a
+	// peer may take, including reading its reply; each retry gets a
+	// fresh timeout. A deadline of the caller's context that comes
+	// sooner still applies.
+	RequestTimeout time.Duration
+
+	// MaxIdleConnsPerHost specifies how many idle connections to
+	// each peer are kept for reuse. If blank, it defaults to 100.
+	// It is ignored if the pool's Transport is set, as are the
+	// other connection options below.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost optionally limits the connections to each
+	// peer, including those in use.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout specifies how long an idle connection to a
+	// peer is kept. If blank, it defaults to 90 seconds.
+	IdleConnTimeout time.Duration
+
+	// HTTP2 makes requests to peers with http base URLs use HTTP/2
+	// without TLS (h2c), multiplexing them over one connection per
+	// peer, and makes ListenAndServe accept such requests; servers
+	// set up otherwise should wrap their handler with H2CHandler.
+	// Peers with https base URLs use HTTP/2 whenever they support
+	// it. ResponseHeaderTimeout does not apply to h2c requests.
+	HTTP2 bool
+
+	// HandoffKeys specifies how many of the hottest keys of each
+	// group Drain pushes to the peers that own them next, for
+	// groups with a HotKeyCapacity. If blank, nothing is pushed.
+	HandoffKeys int
+
+	// RequestRate optionally limits the peer requests the pool
+	// serves, in requests per second over all peers. Requests over
+	// a limit are refused with 429 Too Many Requests, which the
+	// peer that sent them returns from Get as a NoFallbackError
+	// instead of loading the key itself, unless its RetryPolicy
+	// says otherwise. Health checks are never limited.
+	RequestRate float64
+
+	// PeerRequestRate optionally limits the requests per second the
+	// pool serves to each peer, as told apart by its IP address.
+	PeerRequestRate float64
+
+	// RequestBurst specifies how many requests over RequestRate and
+	// PeerRequestRate may be served at once after a quiet period.
+	// If blank, it defaults to one second's worth.
+	RequestBurst int
+
+	// MaxConcurrentRequests optionally limits the peer requests the
+	// pool serves at once over all peers.
+	MaxConcurrentRequests int
+
+	// MaxPeerConcurrentRequests optionally limits the requests the
+	// pool serves at once to each peer.
+	MaxPeerConcurrentRequests int
 }
 
 // NewHTTPPool initializes an HTTP pool of peers, and registers itself as a PeerPicker.
@@ -77,16 +317,17 @@ type HTTPPoolOptions struct {
 // The self argument should be a valid base URL that points to the current server,
 // for example "http://example.net:8000".
 func NewHTTPPool(self string) *HTTPPool {
-	p := NewHTTPPoolOpts(self, nil)
-	http.Handle(p.opts.BasePath, p)
-	return p
+	return NewHTTPPoolOpts(self, &HTTPPoolOptions{RegisterDefaultHandler: true})
 }
 
 var httpPoolMade bool
 
 // NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
-// Unlike NewHTTPPool, this function does not register the created pool as an HTTP handler.
-// The returned *HTTPPool implements http.Handler and must be registered using http.Handle.
+// Unlike NewHTTPPool, this function does not register the created pool as an
+// HTTP handler unless the RegisterDefaultHandler option is set. The returned
+// *HTTPPool implements http.Handler and can be registered on any mux at its
+// BasePath, mounted with Handler, or served on a port of its own with
+// ListenAndServe.
 func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
 	if httpPoolMade {
 		panic("groupcache: NewHTTPPool must be called only once")
@@ -106,24 +347,184 @@ func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
 	if p.opts.Replicas == 0 {
 		p.opts.Replicas = defaultReplicas
 	}
-	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers = p.newRing()
 
 	RegisterPeerPicker(func() PeerPicker { return p })
+	if p.opts.RegisterDefaultHandler {
+		http.Handle(p.opts.BasePath, p)
+	}
 	return p
 }
 
 // Set updates the pool's list of peers.
 // Each peer value should be a valid base URL,
-// for example "http://example.net:8000".
+// for example "http://example.net:8000", or the URL of a UNIX domain
+// socket served by ListenAndServe on the same host, for example
+// "unix:///var/run/groupcache.sock".
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
-	p.peers.Add(peers...)
+	p.peerList = append([]string(nil), peers...)
+	p.setHealthLocked(peers)
+	p.rebuildLocked()
+	old := p.httpGetters
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	transport := p.transportLocked()
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{transport: p.Transport, baseURL: peer + p.opts.BasePath}
+		g := p.newGetterLocked(peer, transport)
+		if prev, ok := old[peer]; ok && prev.breaker != nil {
+			g.breaker = prev.breaker
+		}
+		p.httpGetters[peer] = g
+	}
+}
+
+// newGetterLocked returns a getter for the peer at the base URL peer.
+// p.mu must be held.
+func (p *HTTPPool) newGetterLocked(peer string, transport func(context.Context) http.RoundTripper) *httpGetter {
+	baseURL := peer + p.opts.BasePath
+	if socket := unixSocket(peer); socket != "" {
+		baseURL = "http://unix" + p.opts.BasePath
+		if p.Transport == nil {
+			transport = p.unixTransportLocked(socket)
+		}
+	}
+	return &httpGetter{
+		transport:   transport,
+		signer:      p.opts.Signer,
+		propagator:  p.opts.Propagator,
+		compressors: p.opts.Compressors,
+		baseURL:     baseURL,
+		report:      func(err error) { p.recordResult(peer, err) },
+		traffic:     func(n int64, err error) { p.countZone(peer, n, err) },
+		load:        func(delta int) { p.countLoad(peer, delta) },
+		retry:       p.opts.Retry,
+		breaker:     newBreaker(&p.opts),
+		timeout:     p.opts.RequestTimeout,
+	}
+}
+
+// SetWeights gives peers, keyed by the base URLs passed to Set, weights
+// on the consistent hash, so that a peer owns about as much of the
+// keyspace as its weight relative to the others: twice the memory, for
+// instance, for a weight of 2. Peers left out have a weight of 1. The
+// weights are kept across calls to Set.
+func (p *HTTPPool) SetWeights(weights map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.weights = make(map[string]int, len(weights))
+	for peer, w := range weights {
+		p.weights[peer] = w
+	}
+	p.rebuildLocked()
+}
+
+// transportLocked returns the transport for peer requests: the pool's
+// Transport, or one shared by all peers and tuned by opts. p.mu must
+// be held.
+func (p *HTTPPool) transportLocked() func(context.Context) http.RoundTripper {
+	if p.Transport != nil {
+		return p.Transport
+	}
+	if p.clientTransport == nil {
+		p.clientTransport = newClientTransport(&p.opts, "")
 	}
+	tr := p.clientTransport
+	return func(context.Context) http.RoundTripper { return tr }
+}
+
+// newClientTransport returns a transport configured by o. If socket is
+// not empty, the transport connects to the UNIX domain socket at that
+// path whatever the request's host.
+func newClientTransport(o *HTTPPoolOptions, socket string) http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: o.DialTimeout, KeepAlive: 30 * time.Second}
+	if dialer.Timeout <= 0 {
+		dialer.Timeout = 30 * time.Second
+	}
+	dial := dialer.DialContext
+	if socket != "" {
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	t.DialContext = dial
+	if o.ClientTLS != nil {
+		t.TLSClientConfig = o.ClientTLS.Clone()
+	}
+	t.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+	t.MaxIdleConns = 0
+	t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	if t.MaxIdleConnsPerHost <= 0 {
+		t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	t.MaxConnsPerHost = o.MaxConnsPerHost
+	if o.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.HTTP2 {
+		return newH2CTransport(t, dial)
+	}
+	return t
+}
+
+// ListenAndServe serves the pool's peer requests on the TCP address
+// addr, over HTTPS if the pool's ServerTLS option is set. An addr like
+// "unix:///var/run/groupcache.sock" serves plain HTTP on that UNIX
+// domain socket instead. It always returns a non-nil error.
+func (p *HTTPPool) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(p.opts.BasePath, p)
+	srv := &http.Server{Addr: addr, Handler: mux, TLSConfig: p.opts.ServerTLS}
+	if socket := unixSocket(addr); socket != "" {
+		l, err := listenUnix(socket)
+		if err != nil {
+			return err
+		}
+		if p.opts.HTTP2 {
+			srv.Handler = H2CHandler(mux)
+		}
+		return srv.Serve(l)
+	}
+	if srv.TLSConfig == nil {
+		if p.opts.HTTP2 {
+			srv.Handler = H2CHandler(mux)
+		}
+		return srv.ListenAndServe()
+	}
+	return srv.ListenAndServeTLS("", "")
+}
+
+// MutualTLS loads the PEM certificate and key of this peer and the PEM
+// certificates of the CAs that issue peer certificates, and returns
+// matching HTTPPoolOptions ServerTLS and ClientTLS configurations for
+// mutual TLS: each side presents the certificate and verifies the
+// other's against the CAs.
+func MutualTLS(certFile, keyFile, caFile string) (server, client *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(pem) {
+		return nil, nil, errors.New("groupcache: no certificates in " + caFile)
+	}
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    cas,
+		MinVersion:   tls.VersionTLS12,
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      cas,
+		MinVersion:   tls.VersionTLS12,
+	}
+	return server, client, nil
 }
 
 func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
@@ -132,18 +533,98 @@ func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
 	if p.peers.IsEmpty() {
 		return nil, false
 	}
-	if peer := p.peers.Get(key); peer != p.self {
+	var peer string
+	if br, ok := p.peers.(BoundedRing); ok && p.opts.LoadFactor > 0 {
+		peer = br.GetBounded(key, p.opts.LoadFactor)
+	} else {
+		peer = p.ownerLocked(key)
+	}
+	if r := p.zoneReplicaLocked(key, peer); r != "" {
+		peer = r
+	}
+	if peer != p.self && peer != "" {
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// AllPeers returns the getters of all peers except p itself.
+func (p *HTTPPool) AllPeers() []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]ProtoGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Parse request.
 	if !strings.HasPrefix(r.URL.Path, p.opts.BasePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
-	parts := strings.SplitN(r.URL.Path[len(p.opts.BasePath):], "/", 2)
+	p.serve(w, r, r.URL.Path[len(p.opts.BasePath):])
+}
+
+// BasePath returns the HTTP path under which the pool serves and sends
+// peer requests.
+func (p *HTTPPool) BasePath() string {
+	return p.opts.BasePath
+}
+
+// Handler returns an http.Handler serving the pool's peer requests
+// with paths relative to the pool's BasePath, for mounting the pool on
+// routers that strip the prefix they mount handlers at, as in
+//
+//	mux.Handle("/cache/", http.StripPrefix("/cache/", pool.Handler()))
+//
+// The prefix should match the BasePath of the pools of the other
+// peers, which send their requests there.
+func (p *HTTPPool) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, strings.TrimPrefix(r.URL.Path, "/"))
+	})
+}
+
+// serve serves a peer request for path, relative to the BasePath.
+func (p *HTTPPool) serve(w http.ResponseWriter, r *http.Request, path string) {
+	if p.opts.Verifier != nil {
+		if err := p.opts.Verifier.Verify(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	version, err := negotiateVersion(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(versionHeader, strconv.Itoa(version))
+	if !p.serveStart() {
+		http.Error(w, "peer is draining", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.serveDone()
+	if path == healthPath {
+		io.WriteString(w, "ok")
+		return
+	}
+	if l := p.requestLimiter(); l != nil {
+		peer := requestPeer(r)
+		if !l.admit(peer) {
+			tooManyRequests(w)
+			return
+		}
+		defer l.done(peer)
+	}
+	if p.opts.LoadFactor > 0 {
+		p.countLoad(p.self, 1)
+		defer p.countLoad(p.self, -1)
+	}
+	parts := strings.SplitN(path, "/", 2)
 	if len(parts) != 2 {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
@@ -157,69 +638,505 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
-	var ctx Context
+	ctx := r.Context()
 	if p.Context != nil {
 		ctx = p.Context(r)
 	}
+	if p.opts.Propagator != nil {
+		ctx = p.opts.Propagator.Extract(ctx, r.Header)
+	}
 
 	group.Stats.ServerRequests.Add(1)
-	var value []byte
-	err := group.Get(ctx, key, AllocatingByteSliceSink(&value))
+	switch r.Method {
+	case "DELETE":
+		group.localRemove(key)
+		return
+	case "PUT":
+		body, ok := readBody(w, r, group.maxSetBytes(key))
+		if !ok {
+			return
+		}
+		var in pb.SetRequest
+		if err := proto.Unmarshal(body, &in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in.Key = &key
+		if err := group.setRequest(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	case "POST":
+		body, ok := readBody(w, r, maxRequestBytes)
+		if !ok {
+			return
+		}
+		if r.URL.Query().Get("batch") != "" {
+			p.serveBatch(ctx, w, r, group, body)
+			return
+		}
+		var in pb.GenerationRequest
+		if err := proto.Unmarshal(body, &in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.localSetGeneration(in.GetGeneration())
+		return
+	}
+	compressor := p.negotiateCompressor(w, r)
+	opts := p.serveOptions(key)
+	opts.namespace = r.URL.Query().Get(namespaceParam)
+	if !validKey(opts.namespace, key) {
+		http.Error(w, errKeyNamespace.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Accept") == streamContentType {
+		serveStream(ctx, w, group, key, compressor, opts)
+		return
+	}
+	var value ByteView
+	err = group.get(ctx, key, ByteViewSink(&value), opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, peerError(err).Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Write the value to the response body as a proto message.
-	body, err := proto.Marshal(&pb.GetResponse{Value: value})
+	res := &pb.GetResponse{Value: value.ByteSlice()}
+	if e := value.Expire(); !e.IsZero() {
+		res.Expire = proto.Int64(e.UnixNano())
+	}
+	p.writeProto(w, res, compressor)
+}
+
+// serveBatch answers a request for the keys of the GetMultiRequest in
+// body with a GetMultiResponse.
+func (p *HTTPPool) serveBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, group *Group, body []byte) {
+	var in pb.GetMultiRequest
+	if err := proto.Unmarshal(body, &in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var res pb.GetMultiResponse
+	if err := group.multiResponse(ctx, in.GetKey(), &res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.writeProto(w, &res, p.negotiateCompressor(w, r))
+}
+
+// negotiateCompressor returns the compressor to encode the response to
+// r with, or nil.
+func (p *HTTPPool) negotiateCompressor(w http.ResponseWriter, r *http.Request) Compressor {
+	if len(p.opts.Compressors) == 0 {
+		return nil
+	}
+	w.Header().Set("Vary", "Accept-Encoding")
+	return negotiateCompressor(r, p.opts.Compressors)
+}
+
+// writeProto writes m to the response body, compressed with c if it is
+// not nil and the body is large enough.
+func (p *HTTPPool) writeProto(w http.ResponseWriter, m proto.Message, c Compressor) {
+	body, err := proto.Marshal(m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/x-protobuf")
+	if c != nil && len(body) >= p.compressMinBytes() {
+		w.Header().Set("Content-Encoding", c.Name())
+		zw := c.NewWriter(w)
+		zw.Write(body)
+		zw.Close()
+		return
+	}
 	w.Write(body)
 }
 
+func (p *HTTPPool) compressMinBytes() int {
+	if p.opts.CompressMinBytes > 0 {
+		return p.opts.CompressMinBytes
+	}
+	return defaultCompressMinBytes
+}
+
+// namespaceParam is the URL query parameter holding the namespace of
+// a key requested with GetNS.
+const namespaceParam = "ns"
+
+// streamContentType is the content type of streamed values, which
+// are sent as raw bytes rather than as a GetResponse.
+const streamContentType = "application/octet-stream"
+
+// expireTrailer is the HTTP trailer holding a streamed value's
+// expiration time in Unix nanoseconds. It is a trailer because the
+// expiration is only known once the value has been loaded.
+const expireTrailer = "X-Groupcache-Expire"
+
+// maxRequestBytes is the largest body a peer request may have, unless
+// the group's MaxValueBytes limits it further.
+const maxRequestBytes = 64 << 20
+
+// readBody reads the body of r, which may be at most max bytes long.
+// If it fails, it answers r with an error and returns false.
+func readBody(w http.ResponseWriter, r *http.Request, max int64) ([]byte, bool) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return nil, false
+	}
+	return body, true
+}
+
+// maxSetBytes returns the largest body of a Set request for key: one
+// whose value is at most the group's MaxValueBytes long, if that is
+// set.
+func (g *Group) maxSetBytes(key string) int64 {
+	max := g.opts.MaxValueBytes
+	if max <= 0 || max > maxRequestBytes {
+		return maxRequestBytes
+	}
+	// Besides the value, the request holds the group, the key, its
+	// namespace and its expiration time.
+	return max + int64(len(g.name)+2*len(key)) + 64
+}
+
+// serveStream writes the value for key to w as the group produces it,
+// so that large values are not buffered in the response. The value is
+// compressed with c, if it is not nil.
+func serveStream(ctx context.Context, w http.ResponseWriter, group *Group, key string, c Compressor, opts GetOptions) {
+	w.Header().Set("Content-Type", streamContentType)
+	w.Header().Set("Trailer", expireTrailer)
+	var body io.Writer = w
+	var zw io.WriteCloser
+	if c != nil {
+		w.Header().Set("Content-Encoding", c.Name())
+		zw = c.NewWriter(w)
+		body = zw
+	}
+	sw := &countingWriter{w: body}
+	sink := &writerSink{w: sw}
+	if err := group.get(ctx, key, sink, opts); err != nil {
+		if sw.n == 0 {
+			w.Header().Del("Content-Encoding")
+			http.Error(w, peerError(err).Error(), http.StatusInternalServerError)
+			return
+		}
+		// Too late for an error status; abort the response so
+		// the client sees a broken stream, not a short value.
+		panic(http.ErrAbortHandler)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if e := sink.v.Expire(); !e.IsZero() {
+		w.Header().Set(expireTrailer, strconv.FormatInt(e.UnixNano(), 10))
+	}
+}
+
 type httpGetter struct {
-	transport func(Context) http.RoundTripper
-	baseURL   string
+	transport   func(context.Context) http.RoundTripper
+	signer      Signer
+	propagator  Propagator
+	compressors []Compressor
+	baseURL     string
+
+	// report optionally receives the outcome of each request: nil if
+	// the peer responded, or the error if it could not be reached.
+	report func(err error)
+
+	// traffic optionally receives the outcome of each request and
+	// the bytes of its response body once it is closed.
+	traffic func(n int64, err error)
+
+	// load optionally receives 1 when a request starts and -1 when
+	// it ends.
+	load func(delta int)
+
+	retry   RetryPolicy
+	breaker *breaker
+	timeout time.Duration // of each request, if positive
+
+	// peerVersion is the protocol version of the peer's last
+	// response, or 0 before the first one. It is accessed
+	// atomically.
+	peerVersion int32
 }
 
 var bufferPool = sync.Pool{
 	New: func() interface{} { return new(bytes.Buffer) },
 }
 
-func (h *httpGetter) Get(context Context, in *pb.GetRequest, out *pb.GetResponse) error {
+// do sends a request with the given method for the group and key in
+// the request, and returns the response if its status is OK. The
+// request is canceled if ctx is done before it completes.
+func (h *httpGetter) do(ctx context.Context, method string, in *pb.GetRequest, query string, body []byte, accept string) (*http.Response, error) {
+	if h.load != nil {
+		h.load(1)
+		defer h.load(-1)
+	}
+	for attempt := 0; ; attempt++ {
+		if !h.breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+		res, err := h.attempt(ctx, method, in, query, body, accept)
+		switch {
+		case ctx != nil && ctx.Err() == context.Canceled:
+			h.breaker.abandon()
+		case err != nil && ClassifyPeerError(err)&(PeerOtherError|PeerThrottled) != 0:
+			// The peer answered; the request itself was bad, or
+			// the peer is shedding load.
+			h.breaker.record(nil)
+		default:
+			h.breaker.record(err)
+		}
+		if h.traffic != nil {
+			if err != nil {
+				h.traffic(0, err)
+			} else {
+				res.Body = &trafficBody{ReadCloser: res.Body, done: h.traffic}
+			}
+		}
+		if err == nil {
+			return h.decode(res)
+		}
+		if !h.retry.retry(ctx, attempt, err) {
+			return nil, h.retry.failed(err)
+		}
+	}
+}
+
+// attempt sends one request to the peer, limited to the getter's
+// request timeout.
+func (h *httpGetter) attempt(ctx context.Context, method string, in *pb.GetRequest, query string, body []byte, accept string) (*http.Response, error) {
+	if h.timeout <= 0 {
+		return h.roundTrip(ctx, method, in, query, body, accept)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	res, err := h.roundTrip(ctx, method, in, query, body, accept)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelBody cancels the context of its request when it is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// roundTrip sends one request to the peer and returns its reply if
+// its status is 200.
+func (h *httpGetter) roundTrip(ctx context.Context, method string, in *pb.GetRequest, query string, body []byte, accept string) (*http.Response, error) {
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 	)
-	req, err := http.NewRequest("GET", u, nil)
+	if ns := in.GetNamespace(); ns != "" {
+		if query != "" {
+			query += "&"
+		}
+		query += namespaceParam + "=" + url.QueryEscape(ns)
+	}
+	if query != "" {
+		u += "?" + query
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+	req.Header.Set(versionHeader, strconv.Itoa(ProtocolVersion))
+	if h.propagator != nil && ctx != nil {
+		h.propagator.Inject(ctx, req.Header)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if len(h.compressors) > 0 {
+		req.Header.Set("Accept-Encoding", acceptEncoding(h.compressors))
+	}
+	if h.signer != nil {
+		if err := h.signer.Sign(req); err != nil {
+			return nil, err
+		}
 	}
 	tr := http.DefaultTransport
 	if h.transport != nil {
-		tr = h.transport(context)
+		tr = h.transport(ctx)
 	}
 	res, err := tr.RoundTrip(req)
+	if h.report != nil && (ctx == nil || ctx.Err() != context.Canceled) {
+		h.report(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	v, err := checkVersion(res)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	atomic.StoreInt32(&h.peerVersion, int32(v))
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, &statusError{code: res.StatusCode, status: res.Status}
+	}
+	return res, nil
+}
+
+// decode wraps the body of res to undo its content coding.
+func (h *httpGetter) decode(res *http.Response) (*http.Response, error) {
+	if ce := res.Header.Get("Content-Encoding"); ce != "" {
+		c := compressorNamed(h.compressors, ce)
+		if c == nil {
+			res.Body.Close()
+			return nil, fmt.Errorf("unsupported response encoding %q", ce)
+		}
+		zr, err := c.NewReader(res.Body)
+		if err != nil {
+			res.Body.Close()
+			return nil, fmt.Errorf("decoding response body: %v", err)
+		}
+		res.Body = &decompressedBody{ReadCloser: zr, body: res.Body}
+	}
+	return res, nil
+}
+
+// Remove implements Remover.
+func (h *httpGetter) Remove(ctx context.Context, in *pb.GetRequest) error {
+	res, err := h.do(ctx, "DELETE", in, "", nil, "")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Set implements Setter.
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	key := &pb.GetRequest{Group: in.Group, Key: in.Key}
+	res, err := h.do(ctx, "PUT", key, "", body, "")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// SetGeneration implements GenerationSetter.
+func (h *httpGetter) SetGeneration(ctx context.Context, in *pb.GenerationRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := h.do(ctx, "POST", &pb.GetRequest{Group: in.Group}, "", body, "")
 	if err != nil {
 		return err
 	}
+	res.Body.Close()
+	return nil
+}
+
+// GetStream implements StreamGetter, requesting the value as a raw
+// byte stream and copying it to w in chunks.
+func (h *httpGetter) GetStream(ctx context.Context, in *pb.GetRequest, w io.Writer) (expire time.Time, err error) {
+	res, err := h.do(ctx, "GET", in, "", nil, streamContentType)
+	if err != nil {
+		return time.Time{}, err
+	}
 	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return time.Time{}, fmt.Errorf("reading response body: %v", err)
 	}
+	if t := res.Trailer.Get(expireTrailer); t != "" {
+		ns, err := strconv.ParseInt(t, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("decoding expiration: %v", err)
+		}
+		expire = time.Unix(0, ns)
+	}
+	return expire, nil
+}
+
+// String returns the base URL of the peer.
+func (h *httpGetter) String() string {
+	return h.baseURL
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	res, err := h.do(ctx, "GET", in, "", nil, "")
+	if err != nil {
+		return err
+	}
+	return readProto(res, out)
+}
+
+// GetMulti implements BatchGetter, fetching all of the keys in one
+// request.
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	if v := atomic.LoadInt32(&h.peerVersion); v != 0 && v < batchProtocolVersion {
+		return errBatchUnsupported
+	}
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := h.do(ctx, "POST", &pb.GetRequest{Group: in.Group}, "batch=1", body, "")
+	if err != nil {
+		return err
+	}
+	return readProto(res, out)
+}
+
+// errBatchUnsupported is returned by GetMulti for peers that speak a
+// protocol version without batch requests. Group.GetMulti then fetches
+// their keys one by one.
+var errBatchUnsupported = errors.New("groupcache: peer does not support batch requests")
+
+// readProto decodes the body of res into m and closes it.
+func readProto(res *http.Response, m proto.Message) error {
+	defer res.Body.Close()
 	b := bufferPool.Get().(*bytes.Buffer)
 	b.Reset()
 	defer bufferPool.Put(b)
-	_, err = io.Copy(b, res.Body)
+	_, err := io.Copy(b, res.Body)
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
-	err = proto.Unmarshal(b.Bytes(), out)
+	err = proto.Unmarshal(b.Bytes(), m)
 	if err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
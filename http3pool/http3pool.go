@@ -0,0 +1,89 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package http3pool carries the peer requests of a groupcache.HTTPPool
+// over HTTP/3, which avoids head-of-line blocking between requests and
+// sets up connections in fewer round trips than HTTPS over TCP. It
+// suits peers in different regions linked by lossy networks.
+//
+// HTTP/3 always uses TLS, so the pool's peers are https base URLs.
+// A process serves its peers with ListenAndServe and reaches them
+// through a Transport:
+//
+//	pool := groupcache.NewHTTPPoolOpts("https://10.0.0.1:8443", nil)
+//	t := http3pool.NewTransport(clientTLS)
+//	pool.Transport = t.RoundTripper
+//	go http3pool.ListenAndServe(":8443", pool, serverTLS)
+//
+// The package is experimental.
+package http3pool
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/golang/groupcache"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Transport sends peer requests over HTTP/3. Its connections are kept
+// open and reused across requests.
+type Transport struct {
+	rt *http3.Transport
+}
+
+// NewTransport returns a Transport that verifies peers with tlsConfig,
+// which may be nil to verify them against the system's roots.
+func NewTransport(tlsConfig *tls.Config) *Transport {
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+	}
+	return &Transport{rt: &http3.Transport{TLSClientConfig: tlsConfig}}
+}
+
+// RoundTripper returns the HTTP/3 round tripper. It is meant to be
+// assigned to the Transport field of a groupcache.HTTPPool.
+func (t *Transport) RoundTripper(context.Context) http.RoundTripper {
+	return t.rt
+}
+
+// Close closes the Transport's connections.
+func (t *Transport) Close() error {
+	return t.rt.Close()
+}
+
+// ListenAndServe serves pool's peer requests over HTTP/3 on the UDP
+// address addr, presenting the certificate of tlsConfig. It always
+// returns a non-nil error.
+func ListenAndServe(addr string, pool *groupcache.HTTPPool, tlsConfig *tls.Config) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return Serve(conn, pool, tlsConfig)
+}
+
+// Serve serves pool's peer requests over HTTP/3 on conn, presenting
+// the certificate of tlsConfig. It always returns a non-nil error.
+func Serve(conn net.PacketConn, pool *groupcache.HTTPPool, tlsConfig *tls.Config) error {
+	mux := http.NewServeMux()
+	mux.Handle(pool.BasePath(), pool)
+	srv := &http3.Server{Handler: mux, TLSConfig: http3.ConfigureTLSConfig(tlsConfig)}
+	return srv.Serve(conn)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http3pool
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/groupcache"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestHTTP3Pool(t *testing.T) {
+	const groupName = "http3pool-test"
+	groupcache.NewGroup(groupName, 1<<20, groupcache.GetterFunc(
+		func(_ context.Context, key string, dest groupcache.Sink) error {
+			return dest.SetString(strings.Repeat(key, 3))
+		}))
+
+	// Borrow the test certificate of httptest, valid for 127.0.0.1.
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	serverTLS := ts.TLS.Clone()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	ts.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	self := "https://" + conn.LocalAddr().String()
+	pool := groupcache.NewHTTPPoolOpts(self, nil)
+	go Serve(conn, pool, serverTLS)
+
+	tr := NewTransport(&tls.Config{RootCAs: roots})
+	defer tr.Close()
+	pool.Transport = tr.RoundTripper
+	peer, err := pool.NewPeer(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(pb.GetResponse)
+	if err := peer.Get(context.Background(), &pb.GetRequest{Group: proto.String(groupName), Key: proto.String("ab")}, out); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out.GetValue()); got != "ababab" {
+		t.Errorf("Get = %q; want %q", got, "ababab")
+	}
+}
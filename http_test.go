@@ -17,18 +17,34 @@ limitations under the License.
 package groupcache
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"flag"
+	"io"
+	"io/ioutil"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
 )
 
 var (
@@ -85,14 +101,14 @@ func TestHTTPPool(t *testing.T) {
 	// Dummy getter function. Gets should go to children only.
 	// The only time this process will handle a get is when the
 	// children can't be contacted for some reason.
-	getter := GetterFunc(func(ctx Context, key string, dest Sink) error {
+	getter := GetterFunc(func(ctx context.Context, key string, dest Sink) error {
 		return errors.New("parent getter called; something's wrong")
 	})
 	g := NewGroup("httpPoolTest", 1<<20, getter)
 
 	for _, key := range testKeys(nGets) {
 		var value string
-		if err := g.Get(nil, key, StringSink(&value)); err != nil {
+		if err := g.Get(context.TODO(), key, StringSink(&value)); err != nil {
 			t.Fatal(err)
 		}
 		if suffix := ":" + key; !strings.HasSuffix(value, suffix) {
@@ -102,6 +118,395 @@ func TestHTTPPool(t *testing.T) {
 	}
 }
 
+func TestHTTPRemove(t *testing.T) {
+	loads := 0
+	g := newGroup("TestHTTPRemove-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	for i := 0; i < 2; i++ {
+		if err := peer.Get(context.TODO(), req, &pb.GetResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loads = %d; want 1", loads)
+	}
+	if err := peer.Remove(context.TODO(), req); err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Get(context.TODO(), req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 2 {
+		t.Fatalf("loads after Remove = %d; want 2", loads)
+	}
+}
+
+func TestHTTPSet(t *testing.T) {
+	g := newGroup("TestHTTPSet-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("getter called")
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	expire := time.Now().Add(time.Hour)
+	err := peer.Set(context.TODO(), &pb.SetRequest{
+		Group:  proto.String(g.Name()),
+		Key:    proto.String("key"),
+		Value:  []byte("value"),
+		Expire: proto.Int64(expire.UnixNano()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := g.mainCache.get("key")
+	if !ok || v.String() != "value" || !v.Expire().Equal(time.Unix(0, expire.UnixNano())) {
+		t.Fatalf("main cache has %v, %v (expire %v); want %q, true", v, ok, v.Expire(), "value")
+	}
+}
+
+func TestHTTPSetTooLarge(t *testing.T) {
+	g := newGroup("TestHTTPSetTooLarge-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("getter called")
+	}), NoPeers{}, &GroupOptions{MaxValueBytes: 10})
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	for _, value := range []string{"0123456789", strings.Repeat("x", 1<<10)} {
+		err := peer.Set(context.TODO(), &pb.SetRequest{
+			Group: proto.String(g.Name()),
+			Key:   proto.String(value[:1]),
+			Value: []byte(value),
+		})
+		if tooLarge := len(value) > 10; (err != nil) != tooLarge {
+			t.Errorf("Set of %d bytes = %v; want error %v", len(value), err, tooLarge)
+		}
+	}
+	if n := g.CacheStats(MainCache).Items; n != 1 {
+		t.Errorf("main cache has %d items; want 1", n)
+	}
+}
+
+func TestHTTPSetGeneration(t *testing.T) {
+	g := newGroup("TestHTTPSetGeneration-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	for _, gen := range []uint64{5, 3} {
+		err := peer.SetGeneration(context.TODO(), &pb.GenerationRequest{
+			Group:      proto.String(g.Name()),
+			Generation: proto.Uint64(gen),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := g.Generation(); got != 5 {
+		t.Errorf("Generation = %d; want 5, as generations never go back", got)
+	}
+}
+
+func TestHTTPGetExpire(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	g := newGroup("TestHTTPGetExpire-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		dest.SetExpire(expire)
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	res := &pb.GetResponse{}
+	if err := peer.Get(context.TODO(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if got := res.GetExpire(); got != expire.UnixNano() {
+		t.Fatalf("response expire = %d; want %d", got, expire.UnixNano())
+	}
+}
+
+func TestHTTPGetNS(t *testing.T) {
+	g := newGroup("TestHTTPGetNS-group", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		return dest.SetString(Namespace(ctx) + ":" + key)
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	tests := []struct {
+		ns, key, want string
+	}{
+		{"a", cacheKey("a", "k"), "a:k"},
+		{"", cacheKey("", "\x00b"), ":\x00b"},
+		{"", cacheKey("b", "k"), ""},
+		{"c", cacheKey("b", "k"), ""},
+	}
+	for _, tt := range tests {
+		req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String(tt.key)}
+		if tt.ns != "" {
+			req.Namespace = proto.String(tt.ns)
+		}
+		res := &pb.GetResponse{}
+		err := peer.Get(context.TODO(), req, res)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Get(%q, %q) succeeded; want an error for a key outside the namespace", tt.ns, tt.key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(res.GetValue()); got != tt.want {
+			t.Errorf("Get(%q, %q) = %q; want %q", tt.ns, tt.key, got, tt.want)
+		}
+	}
+	if st := g.NamespaceStats("a"); st.Loads != 1 {
+		t.Errorf("stats of a = %+v; want 1 load", st)
+	}
+	for _, ns := range []string{"b", "c"} {
+		if st := g.NamespaceStats(ns); st != (NamespaceStats{}) {
+			t.Errorf("stats of %s = %+v; want none", ns, st)
+		}
+	}
+}
+
+func TestHTTPContext(t *testing.T) {
+	type ctxKey struct{}
+	var gotValue interface{}
+	g := newGroup("TestHTTPContext-group", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		gotValue = ctx.Value(ctxKey{})
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	pool := &HTTPPool{
+		opts: HTTPPoolOptions{BasePath: defaultBasePath},
+		Context: func(r *http.Request) context.Context {
+			return context.WithValue(r.Context(), ctxKey{}, "from-request")
+		},
+	}
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	if err := peer.Get(context.Background(), req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if gotValue != "from-request" {
+		t.Errorf("getter saw context value %v; want %q", gotValue, "from-request")
+	}
+
+	// Peer requests give up when the caller's context is done.
+	block := make(chan struct{})
+	defer close(block)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	peer = &httpGetter{baseURL: slow.URL + defaultBasePath}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := peer.Get(ctx, req, &pb.GetResponse{}); err == nil {
+		t.Fatal("Get succeeded after its context was done")
+	}
+}
+
+func TestHTTPPoolHandler(t *testing.T) {
+	g := newGroup("TestHTTPPoolHandler-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+	pool := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	mux := http.NewServeMux()
+	mux.Handle("/cache/", http.StripPrefix("/cache/", pool.Handler()))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	peer := &httpGetter{baseURL: srv.URL + "/cache/"}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("a/b")}
+	res := &pb.GetResponse{}
+	if err := peer.Get(context.Background(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "value:a/b" {
+		t.Errorf("Get = %q; want %q", res.Value, "value:a/b")
+	}
+	if err := peer.ping(context.Background()); err != nil {
+		t.Errorf("health check = %v", err)
+	}
+}
+
+func TestHTTPGetterPanic(t *testing.T) {
+	g := newGroup("TestHTTPGetterPanic-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		panic("secret detail")
+	}), NoPeers{}, nil)
+	pool := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	for _, accept := range []string{"", streamContentType} {
+		req, _ := http.NewRequest("GET", srv.URL+defaultBasePath+g.Name()+"/k", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Accept %q: status = %d; want 500", accept, res.StatusCode)
+		}
+		if b := string(body); strings.Contains(b, "secret") || strings.Contains(b, "goroutine") {
+			t.Errorf("Accept %q: response reveals the panic: %q", accept, b)
+		}
+	}
+}
+
+func TestHTTPGetMulti(t *testing.T) {
+	g := newGroup("TestHTTPGetMulti-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "bad" {
+			return errors.New("bad key")
+		}
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+	var reqs int32
+	pool := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	req := &pb.GetMultiRequest{Group: proto.String(g.Name()), Key: []string{"x", "bad", "y", "x"}}
+	res := &pb.GetMultiResponse{}
+	if err := peer.GetMulti(context.Background(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if reqs != 1 {
+		t.Errorf("GetMulti made %d requests; want 1", reqs)
+	}
+	got := make(map[string]string)
+	for _, kv := range res.Values {
+		if kv.Error != nil {
+			got[kv.GetKey()] = "error"
+		} else {
+			got[kv.GetKey()] = string(kv.Value)
+		}
+	}
+	want := map[string]string{"x": "value:x", "y": "value:y", "bad": "error"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMulti = %v; want %v", got, want)
+	}
+
+	// Peers that speak an older protocol are not sent batches.
+	peer.peerVersion = 1
+	if err := peer.GetMulti(context.Background(), req, &pb.GetMultiResponse{}); err != errBatchUnsupported {
+		t.Errorf("GetMulti to a version 1 peer = %v; want %v", err, errBatchUnsupported)
+	}
+}
+
+func TestHTTPTimeouts(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	req := &pb.GetRequest{Group: proto.String("group"), Key: proto.String("key")}
+
+	for _, tt := range []struct {
+		name    string
+		timeout time.Duration // of the getter
+		ctx     time.Duration // of the caller's context
+	}{
+		{"RequestTimeout", 20 * time.Millisecond, time.Hour},
+		{"shorter caller deadline", time.Hour, 20 * time.Millisecond},
+	} {
+		peer := &httpGetter{baseURL: slow.URL + defaultBasePath, timeout: tt.timeout}
+		ctx, cancel := context.WithTimeout(context.Background(), tt.ctx)
+		start := time.Now()
+		err := peer.Get(ctx, req, &pb.GetResponse{})
+		cancel()
+		if ClassifyPeerError(err) != PeerTimeout {
+			t.Errorf("%s: Get = %v; want a timeout", tt.name, err)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("%s: Get took %v", tt.name, d)
+		}
+	}
+
+	pool := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, DialTimeout: time.Second, ResponseHeaderTimeout: 20 * time.Millisecond}}
+	tr := pool.transportLocked()(context.Background()).(*http.Transport)
+	if tr.ResponseHeaderTimeout != 20*time.Millisecond {
+		t.Errorf("ResponseHeaderTimeout = %v; want 20ms", tr.ResponseHeaderTimeout)
+	}
+	peer := &httpGetter{baseURL: slow.URL + defaultBasePath, transport: pool.transportLocked()}
+	if err := peer.Get(context.Background(), req, &pb.GetResponse{}); err == nil {
+		t.Error("Get succeeded past the ResponseHeaderTimeout")
+	}
+}
+
+func TestHTTPGetStream(t *testing.T) {
+	const size = 4 << 20
+	expire := time.Now().Add(time.Hour)
+	g := newGroup("TestHTTPGetStream-group", 1<<30, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		dest.SetExpire(expire)
+		return dest.SetReader(io.LimitReader(zeros{}, size))
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	for i := 0; i < 2; i++ {
+		var w countingWriter
+		w.w = ioutil.Discard
+		got, err := peer.GetStream(context.Background(), req, &w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.n != size {
+			t.Fatalf("streamed %d bytes; want %d", w.n, size)
+		}
+		if got.UnixNano() != expire.UnixNano() {
+			t.Fatalf("streamed expiration = %v; want %v", got, expire)
+		}
+	}
+
+	bad := &pb.GetRequest{Group: proto.String("no-such-group"), Key: proto.String("key")}
+	if _, err := peer.GetStream(context.Background(), bad, ioutil.Discard); err == nil {
+		t.Fatal("GetStream of a missing group succeeded")
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
 func testKeys(n int) (keys []string) {
 	keys = make([]string, n)
 	for i := range keys {
@@ -116,7 +521,7 @@ func beChildForTestHTTPPool() {
 	p := NewHTTPPool("http://" + addrs[*peerIndex])
 	p.Set(addrToURL(addrs)...)
 
-	getter := GetterFunc(func(ctx Context, key string, dest Sink) error {
+	getter := GetterFunc(func(ctx context.Context, key string, dest Sink) error {
 		dest.SetString(strconv.Itoa(*peerIndex) + ":" + key)
 		return nil
 	})
@@ -164,3 +569,95 @@ func awaitAddrReady(t *testing.T, addr string, wg *sync.WaitGroup) {
 		time.Sleep(delay)
 	}
 }
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, valid
+// for both servers and clients, and its key to dir as PEM files.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHTTPMutualTLS(t *testing.T) {
+	g := newGroup("TestHTTPMutualTLS-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("secret")
+	}), NoPeers{}, nil)
+	dir, err := ioutil.TempDir("", "groupcache-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir)
+	serverTLS, clientTLS, err := MutualTLS(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	srv.TLS = serverTLS
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, ClientTLS: clientTLS}}
+	pool.Set(srv.URL)
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	res := &pb.GetResponse{}
+	if err := pool.httpGetters[srv.URL].Get(context.TODO(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.GetValue()); got != "secret" {
+		t.Errorf("Get = %q; want %q", got, "secret")
+	}
+
+	// Peers without a client certificate are turned away.
+	anon := clientTLS.Clone()
+	anon.Certificates = nil
+	pool = &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, ClientTLS: anon}}
+	pool.Set(srv.URL)
+	if err := pool.httpGetters[srv.URL].Get(context.TODO(), req, &pb.GetResponse{}); err == nil {
+		t.Error("Get without a client certificate succeeded")
+	}
+}
+
+func TestHTTPPoolSetWeights(t *testing.T) {
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas}}
+	p.Set("http://a", "http://b")
+	p.SetWeights(map[string]int{"http://b": 4})
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		peer, _ := p.PickPeer(strconv.Itoa(i))
+		counts[peer.(*httpGetter).baseURL]++
+	}
+	a, b := counts["http://a"+defaultBasePath], counts["http://b"+defaultBasePath]
+	if r := float64(b) / float64(a); r < 2.5 || r > 6 {
+		t.Errorf("b owns %.1f times the keys of a; want about 4", r)
+	}
+}
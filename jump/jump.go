@@ -0,0 +1,105 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jump provides an implementation of the jump consistent hash
+// of Lamping and Veach, "A Fast, Minimal Memory, Consistent Hash
+// Algorithm", with the interface of consistenthash.Map.
+//
+// Jump hashing keeps no ring: it needs no memory beyond the list of
+// nodes and no rebuild when the list changes, and it spreads keys
+// evenly. Nodes are numbered by their position in the list, though,
+// so it suits stable node sets that grow and shrink at their end, as
+// in a StatefulSet: appending a node to n moves 1/(n+1) of the
+// keys, but removing one from the middle renumbers those after it.
+package jump
+
+import "hash/fnv"
+
+// Hash is the hash function applied to keys.
+type Hash func(data []byte) uint64
+
+// Map maps keys to nodes. It is not safe for concurrent use.
+type Map struct {
+	hash  Hash
+	nodes []string
+}
+
+// New returns an empty Map that hashes keys with fn. If fn is nil, it
+// defaults to 64-bit FNV-1a.
+func New(fn Hash) *Map {
+	m := &Map{hash: fn}
+	if m.hash == nil {
+		m.hash = fnv64a
+	}
+	return m
+}
+
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// IsEmpty returns true if there are no nodes.
+func (m *Map) IsEmpty() bool {
+	return len(m.nodes) == 0
+}
+
+// Add appends nodes to the list.
+func (m *Map) Add(nodes ...string) {
+	m.nodes = append(m.nodes, nodes...)
+}
+
+// Remove removes nodes from the list. The nodes after them move up.
+func (m *Map) Remove(nodes ...string) {
+	gone := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		gone[n] = true
+	}
+	kept := m.nodes[:0]
+	for _, n := range m.nodes {
+		if !gone[n] {
+			kept = append(kept, n)
+		}
+	}
+	m.nodes = kept
+}
+
+// Set replaces the list with nodes, in the order given. Every peer
+// must pass the same list in the same order.
+func (m *Map) Set(nodes ...string) {
+	m.nodes = append(m.nodes[:0], nodes...)
+}
+
+// Get returns the node that key hashes to, or "" if the Map is empty.
+func (m *Map) Get(key string) string {
+	if m.IsEmpty() {
+		return ""
+	}
+	return m.nodes[Bucket(m.hash([]byte(key)), len(m.nodes))]
+}
+
+// Bucket returns the bucket in [0, buckets) of the jump consistent
+// hash of key.
+func Bucket(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
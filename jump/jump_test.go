@@ -0,0 +1,96 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jump
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestBucket(t *testing.T) {
+	// A key stays in its bucket as buckets are added, or moves to
+	// the new one.
+	for key := uint64(0); key < 1000; key++ {
+		k := key * 0x9E3779B97F4A7C15
+		prev := Bucket(k, 1)
+		if prev != 0 {
+			t.Fatalf("Bucket(%#x, 1) = %d; want 0", k, prev)
+		}
+		for n := 2; n <= 64; n++ {
+			b := Bucket(k, n)
+			if b != prev && b != n-1 {
+				t.Fatalf("Bucket(%#x, %d) = %d; want %d or %d", k, n, b, prev, n-1)
+			}
+			prev = b
+		}
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	m := New(nil)
+	m.Add("a", "b", "c")
+	counts := make(map[string]int)
+	before := make(map[string]string)
+	for i := 0; i < 30000; i++ {
+		k := strconv.Itoa(i)
+		before[k] = m.Get(k)
+		counts[before[k]]++
+	}
+	for _, n := range []string{"a", "b", "c"} {
+		if c := counts[n]; c < 9000 || c > 11000 {
+			t.Errorf("node %s owns %d of 30000 keys; want about 10000", n, c)
+		}
+	}
+
+	// Appending a node moves keys only to it.
+	m.Set("a", "b", "c", "d")
+	moved := 0
+	for k, owner := range before {
+		if got := m.Get(k); got != owner {
+			if got != "d" {
+				t.Fatalf("Get(%s) moved from %s to %s", k, owner, got)
+			}
+			moved++
+		}
+	}
+	if moved < 6500 || moved > 8500 {
+		t.Errorf("%d of 30000 keys moved to the new node; want about 7500", moved)
+	}
+
+	m.Remove("d")
+	for k, owner := range before {
+		if got := m.Get(k); got != owner {
+			t.Fatalf("after removing the last node, Get(%s) = %s; want %s", k, got, owner)
+		}
+	}
+	m.Set()
+	if !m.IsEmpty() || m.Get("k") != "" {
+		t.Error("Map not empty after Set()")
+	}
+}
+
+func BenchmarkGet32(b *testing.B) {
+	m := New(nil)
+	for i := 0; i < 32; i++ {
+		m.Add(fmt.Sprintf("shard-%d", i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get("key")
+	}
+}
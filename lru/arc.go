@@ -0,0 +1,265 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "container/list"
+
+// ARCCache is an Adaptive Replacement Cache, as described by Megiddo
+// and Modha. It balances recency and frequency by keeping entries
+// seen once (t1) apart from entries seen more than once (t2), and
+// adapts the target size of each from hits on the keys of recently
+// evicted entries (b1 and b2). Unlike Cache, a single scan of new
+// keys cannot flush frequently used entries. It is not safe for
+// concurrent access.
+type ARCCache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit, in which case the
+	// caller is expected to evict with RemoveOldest and the
+	// adaptation is bounded by the current number of entries.
+	MaxEntries int
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	p              int // target size of t1
+	t1, t2, b1, b2 *list.List
+	items          map[interface{}]*list.Element
+}
+
+type arcEntry struct {
+	key   Key
+	value interface{}
+	ll    *list.List // the list holding this entry
+}
+
+// NewARC creates a new ARCCache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func NewARC(maxEntries int) *ARCCache {
+	c := &ARCCache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *ARCCache) init() {
+	c.t1, c.t2 = list.New(), list.New()
+	c.b1, c.b2 = list.New(), list.New()
+	c.items = make(map[interface{}]*list.Element)
+}
+
+// Add adds a value to the cache.
+func (c *ARCCache) Add(key Key, value interface{}) {
+	if c.items == nil {
+		c.init()
+	}
+	ele, ok := c.items[key]
+	if !ok {
+		c.items[key] = c.push(c.t1, &arcEntry{key: key, value: value})
+		if c.MaxEntries != 0 && c.Len() > c.MaxEntries {
+			c.replace(false)
+		}
+		c.trimGhosts()
+		return
+	}
+	e := ele.Value.(*arcEntry)
+	switch e.ll {
+	case c.t1, c.t2:
+		e.value = value
+		c.move(ele, c.t2)
+		return
+	case c.b1:
+		delta := 1
+		if n := c.b2.Len() / c.b1.Len(); n > delta {
+			delta = n
+		}
+		c.p += delta
+		if n := c.capacity(); c.p > n {
+			c.p = n
+		}
+	case c.b2:
+		delta := 1
+		if n := c.b1.Len() / c.b2.Len(); n > delta {
+			delta = n
+		}
+		c.p -= delta
+		if c.p < 0 {
+			c.p = 0
+		}
+	}
+	inB2 := e.ll == c.b2
+	e.value = value
+	c.move(ele, c.t2)
+	if c.MaxEntries != 0 && c.Len() > c.MaxEntries {
+		c.replace(inB2)
+	}
+	c.trimGhosts()
+}
+
+// Get looks up a key's value from the cache.
+func (c *ARCCache) Get(key Key) (value interface{}, ok bool) {
+	if c.items == nil {
+		return
+	}
+	ele, hit := c.items[key]
+	if !hit {
+		return
+	}
+	e := ele.Value.(*arcEntry)
+	if e.ll != c.t1 && e.ll != c.t2 {
+		return
+	}
+	c.move(ele, c.t2)
+	return e.value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *ARCCache) Remove(key Key) {
+	if c.items == nil {
+		return
+	}
+	ele, hit := c.items[key]
+	if !hit {
+		return
+	}
+	e := ele.Value.(*arcEntry)
+	e.ll.Remove(ele)
+	delete(c.items, key)
+	if (e.ll == c.t1 || e.ll == c.t2) && c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// RemoveOldest removes the least valuable item from the cache,
+// remembering its key so that an early re-add adapts the policy.
+func (c *ARCCache) RemoveOldest() {
+	if c.items == nil {
+		return
+	}
+	c.replace(false)
+	c.trimGhosts()
+}
+
+// Victim implements Victimer.
+func (c *ARCCache) Victim() (key Key, ok bool) {
+	if c.items == nil {
+		return nil, false
+	}
+	if from, _ := c.replaceLists(false); from != nil {
+		return from.Back().Value.(*arcEntry).key, true
+	}
+	return nil, false
+}
+
+// Target returns the number of entries the cache currently aims to
+// keep among those seen only once, which it raises and lowers as keys
+// recently evicted from either kind are added again.
+func (c *ARCCache) Target() int {
+	return c.p
+}
+
+// Len returns the number of items in the cache.
+func (c *ARCCache) Len() int {
+	if c.items == nil {
+		return 0
+	}
+	return c.t1.Len() + c.t2.Len()
+}
+
+// Clear purges all stored items from the cache.
+func (c *ARCCache) Clear() {
+	if c.OnEvicted != nil && c.items != nil {
+		for _, ll := range []*list.List{c.t1, c.t2} {
+			for ele := ll.Front(); ele != nil; ele = ele.Next() {
+				e := ele.Value.(*arcEntry)
+				c.OnEvicted(e.key, e.value)
+			}
+		}
+	}
+	c.p = 0
+	c.t1, c.t2, c.b1, c.b2 = nil, nil, nil, nil
+	c.items = nil
+}
+
+func (c *ARCCache) capacity() int {
+	if c.MaxEntries != 0 {
+		return c.MaxEntries
+	}
+	return c.Len()
+}
+
+func (c *ARCCache) push(ll *list.List, e *arcEntry) *list.Element {
+	e.ll = ll
+	return ll.PushFront(e)
+}
+
+func (c *ARCCache) move(ele *list.Element, to *list.List) {
+	e := ele.Value.(*arcEntry)
+	if e.ll == to {
+		to.MoveToFront(ele)
+		return
+	}
+	e.ll.Remove(ele)
+	c.items[e.key] = c.push(to, e)
+}
+
+// replace evicts the least recently used entry of t1 or t2 into the
+// corresponding ghost list, choosing t1 when it exceeds its target.
+func (c *ARCCache) replace(inB2 bool) {
+	from, to := c.replaceLists(inB2)
+	if from == nil {
+		return
+	}
+	ele := from.Back()
+	e := ele.Value.(*arcEntry)
+	value := e.value
+	e.value = nil
+	c.move(ele, to)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, value)
+	}
+}
+
+// replaceLists returns the list replace evicts from and the ghost list
+// it moves the entry to, or nils if the cache is empty.
+func (c *ARCCache) replaceLists(inB2 bool) (from, to *list.List) {
+	switch {
+	case c.t1.Len() > 0 && (c.t1.Len() > c.p || (inB2 && c.t1.Len() == c.p) || c.t2.Len() == 0):
+		return c.t1, c.b1
+	case c.t2.Len() > 0:
+		return c.t2, c.b2
+	}
+	return nil, nil
+}
+
+// trimGhosts bounds the ghost lists so that t1+b1 and the whole
+// directory hold at most one and two times the capacity.
+func (c *ARCCache) trimGhosts() {
+	n := c.capacity()
+	for c.b1.Len() > 0 && c.t1.Len()+c.b1.Len() > n {
+		c.dropGhost(c.b1)
+	}
+	for c.b2.Len() > 0 && c.Len()+c.b1.Len()+c.b2.Len() > 2*n {
+		c.dropGhost(c.b2)
+	}
+}
+
+func (c *ARCCache) dropGhost(ll *list.List) {
+	ele := ll.Back()
+	ll.Remove(ele)
+	delete(c.items, ele.Value.(*arcEntry).key)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestARCGet(t *testing.T) {
+	for _, tt := range getTests {
+		arc := NewARC(0)
+		arc.Add(tt.keyToAdd, 1234)
+		val, ok := arc.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+// scan fills p with hot keys that are each used twice, then adds a
+// long scan of keys that are used once, and returns how many hot
+// keys survived.
+func scan(p Policy) int {
+	const hot = 5
+	for i := 0; i < hot; i++ {
+		key := fmt.Sprintf("hot%d", i)
+		p.Add(key, i)
+		p.Get(key)
+	}
+	for i := 0; i < 100; i++ {
+		p.Add(fmt.Sprintf("scan%d", i), i)
+	}
+	n := 0
+	for i := 0; i < hot; i++ {
+		if _, ok := p.Get(fmt.Sprintf("hot%d", i)); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func TestARCScanResistance(t *testing.T) {
+	if n := scan(New(10)); n != 0 {
+		t.Fatalf("LRU kept %d hot keys; want 0", n)
+	}
+	if n := scan(NewARC(10)); n != 5 {
+		t.Fatalf("ARC kept %d hot keys; want 5", n)
+	}
+}
+
+func TestARCAdapt(t *testing.T) {
+	var evicted int
+	arc := NewARC(4)
+	arc.OnEvicted = func(key Key, value interface{}) { evicted++ }
+	for i := 0; i < 2; i++ {
+		arc.Add(i, i)
+		arc.Get(i)
+	}
+	for i := 2; i < 6; i++ {
+		arc.Add(i, i)
+	}
+	if arc.Len() != 4 || evicted != 2 {
+		t.Fatalf("got %d entries, %d evictions; want 4, 2", arc.Len(), evicted)
+	}
+	// Re-adding a recently evicted key is a ghost hit that grows
+	// the recency target and puts the key in the frequent list.
+	arc.Add(3, 3)
+	if arc.Target() != 1 {
+		t.Fatalf("Target() = %d after ghost hit; want 1", arc.Target())
+	}
+	if v, ok := arc.Get(3); !ok || v != 3 {
+		t.Fatalf("Get(3) = %v, %v; want 3, true", v, ok)
+	}
+	if arc.Len() != 4 {
+		t.Fatalf("got %d entries; want 4", arc.Len())
+	}
+}
+
+func TestARCRemoveOldestUnbounded(t *testing.T) {
+	var evictedKeys []Key
+	arc := NewARC(0)
+	arc.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	arc.Add("a", 1)
+	arc.Add("b", 2)
+	arc.Get("a")
+	arc.RemoveOldest()
+	if len(evictedKeys) != 1 || evictedKeys[0] != Key("b") {
+		t.Fatalf("evicted keys = %v; want [b]", evictedKeys)
+	}
+	arc.Remove("a")
+	arc.Clear()
+	if arc.Len() != 0 || len(evictedKeys) != 2 {
+		t.Fatalf("got %d entries, %d evictions; want 0, 2", arc.Len(), len(evictedKeys))
+	}
+}
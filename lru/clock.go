@@ -0,0 +1,157 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+// ClockCache is an approximate LRU cache using the CLOCK (second
+// chance) algorithm. Entries live in a flat ring and a hit only sets a
+// reference bit, so Get does no list manipulation. To evict, a hand
+// sweeps the ring, clearing reference bits until it finds an entry
+// that was not referenced since the last sweep. It is not safe for
+// concurrent access.
+type ClockCache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	slots []clockSlot
+	free  []int // indexes of unused slots
+	items map[interface{}]int
+	hand  int
+}
+
+type clockSlot struct {
+	key   Key
+	value interface{}
+	ref   bool
+	used  bool
+}
+
+// NewClock creates a new ClockCache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func NewClock(maxEntries int) *ClockCache {
+	c := &ClockCache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *ClockCache) init() {
+	c.slots = make([]clockSlot, 0, c.MaxEntries)
+	c.items = make(map[interface{}]int, c.MaxEntries)
+}
+
+// Add adds a value to the cache.
+func (c *ClockCache) Add(key Key, value interface{}) {
+	if c.items == nil {
+		c.init()
+	}
+	if i, ok := c.items[key]; ok {
+		c.slots[i].value = value
+		c.slots[i].ref = true
+		return
+	}
+	if c.MaxEntries != 0 && len(c.items) >= c.MaxEntries {
+		c.RemoveOldest()
+	}
+	s := clockSlot{key: key, value: value, used: true}
+	var i int
+	if n := len(c.free); n > 0 {
+		i = c.free[n-1]
+		c.free = c.free[:n-1]
+		c.slots[i] = s
+	} else {
+		i = len(c.slots)
+		c.slots = append(c.slots, s)
+	}
+	c.items[key] = i
+}
+
+// Get looks up a key's value from the cache.
+func (c *ClockCache) Get(key Key) (value interface{}, ok bool) {
+	i, hit := c.items[key]
+	if !hit {
+		return
+	}
+	s := &c.slots[i]
+	s.ref = true
+	return s.value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *ClockCache) Remove(key Key) {
+	if i, hit := c.items[key]; hit {
+		c.removeSlot(i)
+	}
+}
+
+// RemoveOldest removes an item that was not referenced since the hand
+// last passed it.
+func (c *ClockCache) RemoveOldest() {
+	if len(c.items) == 0 {
+		return
+	}
+	for {
+		if c.hand >= len(c.slots) {
+			c.hand = 0
+		}
+		s := &c.slots[c.hand]
+		i := c.hand
+		c.hand++
+		switch {
+		case !s.used:
+		case s.ref:
+			s.ref = false
+		default:
+			c.removeSlot(i)
+			return
+		}
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *ClockCache) Len() int {
+	return len(c.items)
+}
+
+// Clear purges all stored items from the cache.
+func (c *ClockCache) Clear() {
+	if c.OnEvicted != nil {
+		for _, s := range c.slots {
+			if s.used {
+				c.OnEvicted(s.key, s.value)
+			}
+		}
+	}
+	c.slots = nil
+	c.free = nil
+	c.items = nil
+	c.hand = 0
+}
+
+func (c *ClockCache) removeSlot(i int) {
+	s := c.slots[i]
+	c.slots[i] = clockSlot{}
+	c.free = append(c.free, i)
+	delete(c.items, s.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(s.key, s.value)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClockGet(t *testing.T) {
+	for _, tt := range getTests {
+		clock := NewClock(0)
+		clock.Add(tt.keyToAdd, 1234)
+		val, ok := clock.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestClockSecondChance(t *testing.T) {
+	var evictedKeys []Key
+	clock := NewClock(3)
+	clock.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	clock.Add("a", 1)
+	clock.Add("b", 2)
+	clock.Add("c", 3)
+	clock.Get("a")
+	// a was referenced, so the hand skips it and evicts b.
+	clock.Add("d", 4)
+	// d reuses b's slot; the hand moves on to c.
+	clock.Add("e", 5)
+	if got, want := fmt.Sprint(evictedKeys), "[b c]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	for _, k := range []string{"a", "d", "e"} {
+		if _, ok := clock.Get(k); !ok {
+			t.Errorf("Get(%s) missed", k)
+		}
+	}
+	clock.Remove("a")
+	clock.Clear()
+	if clock.Len() != 0 || len(evictedKeys) != 5 {
+		t.Fatalf("got %d entries, %d evictions; want 0, 5", clock.Len(), len(evictedKeys))
+	}
+}
+
+const benchEntries = 1 << 14
+
+func benchmarkPolicy(b *testing.B, p Policy) {
+	keys := make([]string, 2*benchEntries)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	for i := 0; i < benchEntries; i++ {
+		p.Add(keys[i], i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Read-heavy: one Add for every 16 Gets.
+		k := keys[(i*7919)%len(keys)]
+		if _, ok := p.Get(k); !ok && i%16 == 0 {
+			p.Add(k, i)
+		}
+	}
+}
+
+func BenchmarkReadHeavyLRU(b *testing.B)   { benchmarkPolicy(b, New(benchEntries)) }
+func BenchmarkReadHeavyClock(b *testing.B) { benchmarkPolicy(b, NewClock(benchEntries)) }
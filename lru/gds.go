@@ -0,0 +1,212 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "container/heap"
+
+// GDSCache is a GreedyDual-Size cache for entries of unequal value.
+// Each entry carries a weight, such as the cost of recomputing it,
+// and the entry with the lowest weight is evicted first. An inflation
+// value, raised to the priority of every victim, ages entries that are
+// no longer accessed, so costly entries cannot stay in the cache
+// forever. It is not safe for concurrent access.
+type GDSCache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// MaxWeight is the maximum total weight of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxWeight int64
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	items   map[interface{}]*gdsEntry
+	queue   gdsQueue
+	inflate int64 // priority of the last victim
+	weight  int64
+	seq     uint64
+}
+
+type gdsEntry struct {
+	key      Key
+	value    interface{}
+	weight   int64
+	priority int64
+	seq      uint64 // breaks ties in favor of evicting older entries
+	index    int    // in queue
+}
+
+// NewGDS creates a new GDSCache.
+// If maxEntries is zero, the cache has no limit on the number of
+// entries; MaxWeight may be set to bound the total weight instead.
+func NewGDS(maxEntries int) *GDSCache {
+	return &GDSCache{
+		MaxEntries: maxEntries,
+		items:      make(map[interface{}]*gdsEntry),
+	}
+}
+
+// Add adds a value with weight 1 to the cache.
+func (c *GDSCache) Add(key Key, value interface{}) {
+	c.AddWeighted(key, value, 1)
+}
+
+// AddWeighted adds a value with the given weight to the cache. A
+// negative weight is treated as zero.
+func (c *GDSCache) AddWeighted(key Key, value interface{}, weight int64) {
+	if c.items == nil {
+		c.items = make(map[interface{}]*gdsEntry)
+	}
+	if weight < 0 {
+		weight = 0
+	}
+	if e, ok := c.items[key]; ok {
+		c.weight += weight - e.weight
+		e.value = value
+		e.weight = weight
+		c.touch(e)
+		heap.Fix(&c.queue, e.index)
+	} else {
+		e := &gdsEntry{key: key, value: value, weight: weight}
+		c.items[key] = e
+		c.weight += weight
+		c.touch(e)
+		heap.Push(&c.queue, e)
+	}
+	for c.overCapacity() {
+		c.RemoveOldest()
+	}
+}
+
+// Get looks up a key's value from the cache.
+func (c *GDSCache) Get(key Key) (value interface{}, ok bool) {
+	e, hit := c.items[key]
+	if !hit {
+		return
+	}
+	c.touch(e)
+	heap.Fix(&c.queue, e.index)
+	return e.value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *GDSCache) Remove(key Key) {
+	if e, hit := c.items[key]; hit {
+		heap.Remove(&c.queue, e.index)
+		c.removeEntry(e)
+	}
+}
+
+// RemoveOldest removes the entry with the lowest priority from the
+// cache and raises the inflation value to its priority.
+func (c *GDSCache) RemoveOldest() {
+	if len(c.queue) == 0 {
+		return
+	}
+	e := heap.Pop(&c.queue).(*gdsEntry)
+	c.inflate = e.priority
+	c.removeEntry(e)
+}
+
+// Victim implements Victimer.
+func (c *GDSCache) Victim() (key Key, ok bool) {
+	if len(c.queue) == 0 {
+		return nil, false
+	}
+	return c.queue[0].key, true
+}
+
+// Len returns the number of items in the cache.
+func (c *GDSCache) Len() int {
+	return len(c.items)
+}
+
+// Weight returns the total weight of the items in the cache.
+func (c *GDSCache) Weight() int64 {
+	return c.weight
+}
+
+// Clear purges all stored items from the cache.
+func (c *GDSCache) Clear() {
+	if c.OnEvicted != nil {
+		for _, e := range c.items {
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	c.items = nil
+	c.queue = nil
+	c.inflate = 0
+	c.weight = 0
+	c.seq = 0
+}
+
+func (c *GDSCache) overCapacity() bool {
+	return (c.MaxEntries != 0 && len(c.items) > c.MaxEntries) ||
+		(c.MaxWeight != 0 && c.weight > c.MaxWeight)
+}
+
+// touch resets e's priority to the inflation value plus its weight,
+// the GreedyDual-Size credit for an access.
+func (c *GDSCache) touch(e *gdsEntry) {
+	e.priority = c.inflate + e.weight
+	c.seq++
+	e.seq = c.seq
+}
+
+func (c *GDSCache) removeEntry(e *gdsEntry) {
+	delete(c.items, e.key)
+	c.weight -= e.weight
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// gdsQueue is a min-heap of entries by priority.
+type gdsQueue []*gdsEntry
+
+func (q gdsQueue) Len() int { return len(q) }
+
+func (q gdsQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority < q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q gdsQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *gdsQueue) Push(x interface{}) {
+	e := x.(*gdsEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *gdsQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
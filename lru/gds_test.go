@@ -0,0 +1,90 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGDSGet(t *testing.T) {
+	for _, tt := range getTests {
+		gds := NewGDS(0)
+		gds.Add(tt.keyToAdd, 1234)
+		val, ok := gds.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestGDSWeighted(t *testing.T) {
+	var evictedKeys []Key
+	gds := NewGDS(0)
+	gds.MaxWeight = 100
+	gds.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	gds.AddWeighted("cheap", 1, 10)
+	gds.AddWeighted("costly", 2, 50)
+	gds.AddWeighted("mid", 3, 30)
+	// Over budget: the cheapest entry goes first.
+	gds.AddWeighted("new", 4, 20)
+	if got, want := fmt.Sprint(evictedKeys), "[cheap]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	// "new" was credited before "cheap" raised the inflation value,
+	// so it now ranks below "mid".
+	gds.AddWeighted("x", 5, 40)
+	if got, want := fmt.Sprint(evictedKeys), "[cheap new mid]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	// Inflation has caught up with "costly", which was never read.
+	gds.AddWeighted("y", 6, 20)
+	if got, want := fmt.Sprint(evictedKeys), "[cheap new mid costly]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	if w := gds.Weight(); w != 60 {
+		t.Fatalf("Weight() = %d; want 60", w)
+	}
+	gds.Remove("x")
+	if w, n := gds.Weight(), gds.Len(); w != 20 || n != 1 {
+		t.Fatalf("after Remove, Weight, Len = %d, %d; want 20, 1", w, n)
+	}
+	gds.Clear()
+	if gds.Len() != 0 || gds.Weight() != 0 {
+		t.Fatal("Clear left entries behind")
+	}
+}
+
+func TestGDSGetRefreshes(t *testing.T) {
+	gds := NewGDS(2)
+	gds.AddWeighted("a", 1, 5)
+	gds.AddWeighted("b", 2, 5)
+	gds.Get("a")
+	gds.Add("c", 3)
+	// "c" has the lowest weight, so it is evicted before "b".
+	gds.Add("d", 4)
+	if _, ok := gds.Get("c"); ok {
+		t.Fatal("low-weight entry survived")
+	}
+	if _, ok := gds.Get("a"); !ok {
+		t.Fatal("high-weight entry was evicted")
+	}
+}
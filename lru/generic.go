@@ -0,0 +1,277 @@
+//go:build go1.18
+
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "time"
+
+// CacheOf is a type-safe LRU cache. It mirrors Cache, but stores keys
+// and values without interface{} boxing, so Get neither allocates nor
+// needs a type assertion. It is not safe for concurrent access.
+type CacheOf[K comparable, V any] struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// MaxBytes is the maximum total size of cache entries, as
+	// reported by SizeOf, before an item is evicted. Zero means
+	// no limit.
+	MaxBytes int64
+
+	// SizeOf optionally reports the size of an entry for MaxBytes
+	// accounting. If nil, every entry has size zero.
+	SizeOf func(key K, value V) int64
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key K, value V)
+
+	// OnExpired optionally specifies a callback function to be
+	// executed when an entry is purged because its time-to-live
+	// elapsed. If nil, OnEvicted is called for expired entries.
+	OnExpired func(key K, value V)
+
+	// now returns the current time. If nil, time.Now is used.
+	now func() time.Time
+
+	// root is the sentinel of a circular list; root.next is the
+	// most recently used entry and root.prev the least.
+	root   nodeOf[K, V]
+	cache  map[K]*nodeOf[K, V]
+	nbytes int64
+}
+
+type nodeOf[K comparable, V any] struct {
+	next, prev *nodeOf[K, V]
+	key        K
+	value      V
+	expires    time.Time // zero means the entry never expires
+	size       int64
+}
+
+// NewOf creates a new CacheOf.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func NewOf[K comparable, V any](maxEntries int) *CacheOf[K, V] {
+	c := &CacheOf[K, V]{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *CacheOf[K, V]) init() {
+	c.cache = make(map[K]*nodeOf[K, V])
+	c.root.next = &c.root
+	c.root.prev = &c.root
+}
+
+// Add adds a value to the cache.
+func (c *CacheOf[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// AddWithTTL adds a value to the cache that expires after ttl.
+// A ttl of zero or less means the value never expires.
+func (c *CacheOf[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.timeNow().Add(ttl)
+	}
+	if c.cache == nil {
+		c.init()
+	}
+	size := c.sizeOf(key, value)
+	if n, ok := c.cache[key]; ok {
+		c.moveToFront(n)
+		c.nbytes += size - n.size
+		n.value = value
+		n.expires = expires
+		n.size = size
+	} else {
+		n := &nodeOf[K, V]{key: key, value: value, expires: expires, size: size}
+		c.pushFront(n)
+		c.cache[key] = n
+		c.nbytes += size
+	}
+	for c.overCapacity() {
+		c.RemoveOldest()
+	}
+}
+
+// Get looks up a key's value from the cache.
+func (c *CacheOf[K, V]) Get(key K) (value V, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	n, hit := c.cache[key]
+	if !hit {
+		return
+	}
+	if c.expired(n) {
+		c.expireNode(n)
+		return
+	}
+	c.moveToFront(n)
+	return n.value, true
+}
+
+// Peek looks up a key's value from the cache without updating its
+// recency.
+func (c *CacheOf[K, V]) Peek(key K) (value V, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if n, hit := c.cache[key]; hit && !c.expired(n) {
+		return n.value, true
+	}
+	return
+}
+
+// Contains reports whether key is in the cache without updating its
+// recency.
+func (c *CacheOf[K, V]) Contains(key K) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
+// Remove removes the provided key from the cache.
+func (c *CacheOf[K, V]) Remove(key K) {
+	if c.cache == nil {
+		return
+	}
+	if n, hit := c.cache[key]; hit {
+		c.removeNode(n)
+	}
+}
+
+// RemoveOldest removes the oldest item from the cache.
+func (c *CacheOf[K, V]) RemoveOldest() {
+	if c.cache == nil || c.root.prev == &c.root {
+		return
+	}
+	c.removeNode(c.root.prev)
+}
+
+// RemoveExpired removes all expired items from the cache and returns
+// the number of items removed.
+func (c *CacheOf[K, V]) RemoveExpired() int {
+	if c.cache == nil {
+		return 0
+	}
+	n := 0
+	for e := c.root.prev; e != &c.root; {
+		prev := e.prev
+		if c.expired(e) {
+			c.expireNode(e)
+			n++
+		}
+		e = prev
+	}
+	return n
+}
+
+// Len returns the number of items in the cache. Expired items that
+// have not been purged yet are included.
+func (c *CacheOf[K, V]) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the total size of the items in the cache, as
+// reported by SizeOf.
+func (c *CacheOf[K, V]) Bytes() int64 {
+	return c.nbytes
+}
+
+// Clear purges all stored items from the cache.
+func (c *CacheOf[K, V]) Clear() {
+	if c.OnEvicted != nil {
+		for _, n := range c.cache {
+			c.OnEvicted(n.key, n.value)
+		}
+	}
+	c.cache = nil
+	c.root.next = nil
+	c.root.prev = nil
+	c.nbytes = 0
+}
+
+func (c *CacheOf[K, V]) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *CacheOf[K, V]) sizeOf(key K, value V) int64 {
+	if c.SizeOf == nil {
+		return 0
+	}
+	return c.SizeOf(key, value)
+}
+
+func (c *CacheOf[K, V]) overCapacity() bool {
+	return (c.MaxEntries != 0 && len(c.cache) > c.MaxEntries) ||
+		(c.MaxBytes != 0 && c.nbytes > c.MaxBytes)
+}
+
+func (c *CacheOf[K, V]) expired(n *nodeOf[K, V]) bool {
+	return !n.expires.IsZero() && !c.timeNow().Before(n.expires)
+}
+
+func (c *CacheOf[K, V]) pushFront(n *nodeOf[K, V]) {
+	n.prev = &c.root
+	n.next = c.root.next
+	c.root.next.prev = n
+	c.root.next = n
+}
+
+func (c *CacheOf[K, V]) unlink(n *nodeOf[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	n.next = nil
+	n.prev = nil
+}
+
+func (c *CacheOf[K, V]) moveToFront(n *nodeOf[K, V]) {
+	if c.root.next == n {
+		return
+	}
+	c.unlink(n)
+	c.pushFront(n)
+}
+
+func (c *CacheOf[K, V]) detach(n *nodeOf[K, V]) {
+	c.unlink(n)
+	delete(c.cache, n.key)
+	c.nbytes -= n.size
+}
+
+func (c *CacheOf[K, V]) removeNode(n *nodeOf[K, V]) {
+	c.detach(n)
+	if c.OnEvicted != nil {
+		c.OnEvicted(n.key, n.value)
+	}
+}
+
+func (c *CacheOf[K, V]) expireNode(n *nodeOf[K, V]) {
+	if c.OnExpired == nil {
+		c.removeNode(n)
+		return
+	}
+	c.detach(n)
+	c.OnExpired(n.key, n.value)
+}
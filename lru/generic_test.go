@@ -0,0 +1,118 @@
+//go:build go1.18
+
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCacheOfGet(t *testing.T) {
+	lru := NewOf[simpleStruct, int](0)
+	lru.Add(simpleStruct{1, "two"}, 1234)
+	if v, ok := lru.Get(simpleStruct{1, "two"}); !ok || v != 1234 {
+		t.Fatalf("Get = %v, %v; want 1234, true", v, ok)
+	}
+	if _, ok := lru.Get(simpleStruct{0, "noway"}); ok {
+		t.Fatal("Get returned a value for a missing key")
+	}
+	lru.Remove(simpleStruct{1, "two"})
+	if _, ok := lru.Get(simpleStruct{1, "two"}); ok {
+		t.Fatal("Get returned a removed entry")
+	}
+}
+
+func TestCacheOfEvict(t *testing.T) {
+	var evictedKeys []string
+	lru := NewOf[string, int](20)
+	lru.OnEvicted = func(key string, value int) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	for i := 0; i < 22; i++ {
+		lru.Add(fmt.Sprintf("myKey%d", i), i)
+	}
+	lru.Get("myKey2")
+	lru.Add("myKey22", 22)
+	want := []string{"myKey0", "myKey1", "myKey3"}
+	if fmt.Sprint(evictedKeys) != fmt.Sprint(want) {
+		t.Fatalf("evicted keys = %v; want %v", evictedKeys, want)
+	}
+	if lru.Len() != 20 {
+		t.Fatalf("got %d entries; want 20", lru.Len())
+	}
+}
+
+func TestCacheOfZeroValueAndExpire(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var lru CacheOf[string, []byte]
+	lru.now = clock.now
+	lru.MaxBytes = 4
+	lru.SizeOf = func(key string, value []byte) int64 { return int64(len(value)) }
+	lru.AddWithTTL("a", []byte("12"), time.Second)
+	lru.Add("b", []byte("34"))
+	clock.advance(time.Second)
+	if _, ok := lru.Get("a"); ok {
+		t.Fatal("Get returned an expired entry")
+	}
+	lru.Add("c", []byte("56"))
+	if lru.Len() != 2 || lru.Bytes() != 4 {
+		t.Fatalf("got %d entries, %d bytes; want 2, 4", lru.Len(), lru.Bytes())
+	}
+	lru.Clear()
+	if lru.Len() != 0 {
+		t.Fatalf("got %d entries after Clear; want 0", lru.Len())
+	}
+	lru.Add("d", nil)
+	if _, ok := lru.Get("d"); !ok {
+		t.Fatal("Add after Clear was lost")
+	}
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	lru := New(0)
+	lru.Add("key", 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v, _ := lru.Get("key")
+		_ = v.(int)
+	}
+}
+
+func BenchmarkCacheOfGet(b *testing.B) {
+	lru := NewOf[string, int](0)
+	lru.Add("key", 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lru.Get("key")
+	}
+}
+
+func TestCacheOfPeek(t *testing.T) {
+	lru := NewOf[string, int](2)
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	if v, ok := lru.Peek("a"); !ok || v != 1 {
+		t.Fatalf("Peek(a) = %v, %v; want 1, true", v, ok)
+	}
+	lru.Add("c", 3)
+	if lru.Contains("a") || !lru.Contains("b") {
+		t.Fatal("Peek promoted a")
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "container/list"
+
+// LFUCache is a least frequently used cache. Entries are kept in
+// buckets of equal access counts, so every operation is O(1); within a
+// bucket, the least recently used entry is evicted first. It is not
+// safe for concurrent access.
+type LFUCache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	freqs *list.List // of *lfuBucket, in increasing frequency
+	items map[interface{}]*list.Element
+}
+
+type lfuBucket struct {
+	freq    int
+	entries *list.List // of *lfuEntry, most recently used first
+}
+
+type lfuEntry struct {
+	key    Key
+	value  interface{}
+	bucket *list.Element // element of freqs holding this entry
+}
+
+// NewLFU creates a new LFUCache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func NewLFU(maxEntries int) *LFUCache {
+	c := &LFUCache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *LFUCache) init() {
+	c.freqs = list.New()
+	c.items = make(map[interface{}]*list.Element)
+}
+
+// Add adds a value to the cache. Adding a key that is already
+// present counts as an access.
+func (c *LFUCache) Add(key Key, value interface{}) {
+	if c.items == nil {
+		c.init()
+	}
+	if ele, ok := c.items[key]; ok {
+		ele.Value.(*lfuEntry).value = value
+		c.touch(ele)
+		return
+	}
+	if c.MaxEntries != 0 && len(c.items) >= c.MaxEntries {
+		c.RemoveOldest()
+	}
+	front := c.freqs.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = c.freqs.PushFront(&lfuBucket{freq: 1, entries: list.New()})
+	}
+	e := &lfuEntry{key: key, value: value, bucket: front}
+	c.items[key] = front.Value.(*lfuBucket).entries.PushFront(e)
+}
+
+// Get looks up a key's value from the cache.
+func (c *LFUCache) Get(key Key) (value interface{}, ok bool) {
+	if c.items == nil {
+		return
+	}
+	ele, hit := c.items[key]
+	if !hit {
+		return
+	}
+	c.touch(ele)
+	return ele.Value.(*lfuEntry).value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *LFUCache) Remove(key Key) {
+	if c.items == nil {
+		return
+	}
+	if ele, hit := c.items[key]; hit {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveOldest removes the least frequently used item from the cache.
+func (c *LFUCache) RemoveOldest() {
+	if c.items == nil {
+		return
+	}
+	if front := c.freqs.Front(); front != nil {
+		c.removeElement(front.Value.(*lfuBucket).entries.Back())
+	}
+}
+
+// Victim implements Victimer.
+func (c *LFUCache) Victim() (key Key, ok bool) {
+	if c.items == nil {
+		return nil, false
+	}
+	if front := c.freqs.Front(); front != nil {
+		return front.Value.(*lfuBucket).entries.Back().Value.(*lfuEntry).key, true
+	}
+	return nil, false
+}
+
+// Len returns the number of items in the cache.
+func (c *LFUCache) Len() int {
+	return len(c.items)
+}
+
+// Frequency returns the number of accesses recorded for key, or zero
+// if key is not in the cache.
+func (c *LFUCache) Frequency(key Key) int {
+	if ele, ok := c.items[key]; ok {
+		return ele.Value.(*lfuEntry).bucket.Value.(*lfuBucket).freq
+	}
+	return 0
+}
+
+// Clear purges all stored items from the cache.
+func (c *LFUCache) Clear() {
+	if c.OnEvicted != nil {
+		for _, ele := range c.items {
+			e := ele.Value.(*lfuEntry)
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	c.freqs = nil
+	c.items = nil
+}
+
+// touch moves ele to the bucket for one more access.
+func (c *LFUCache) touch(ele *list.Element) {
+	e := ele.Value.(*lfuEntry)
+	cur := e.bucket
+	b := cur.Value.(*lfuBucket)
+	next := cur.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != b.freq+1 {
+		next = c.freqs.InsertAfter(&lfuBucket{freq: b.freq + 1, entries: list.New()}, cur)
+	}
+	b.entries.Remove(ele)
+	if b.entries.Len() == 0 {
+		c.freqs.Remove(cur)
+	}
+	e.bucket = next
+	c.items[e.key] = next.Value.(*lfuBucket).entries.PushFront(e)
+}
+
+func (c *LFUCache) removeElement(ele *list.Element) {
+	e := ele.Value.(*lfuEntry)
+	b := e.bucket.Value.(*lfuBucket)
+	b.entries.Remove(ele)
+	if b.entries.Len() == 0 {
+		c.freqs.Remove(e.bucket)
+	}
+	delete(c.items, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLFUGet(t *testing.T) {
+	for _, tt := range getTests {
+		lfu := NewLFU(0)
+		lfu.Add(tt.keyToAdd, 1234)
+		val, ok := lfu.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestLFUEvict(t *testing.T) {
+	var evictedKeys []Key
+	lfu := NewLFU(3)
+	lfu.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	lfu.Add("a", 1)
+	lfu.Add("b", 2)
+	lfu.Add("c", 3)
+	lfu.Get("a")
+	lfu.Get("a")
+	lfu.Get("c")
+	// b has the fewest accesses.
+	lfu.Add("d", 4)
+	// Now d is the only entry with a single access.
+	lfu.Add("e", 5)
+	if got, want := fmt.Sprint(evictedKeys), "[b d]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	if f := lfu.Frequency("a"); f != 3 {
+		t.Fatalf("Frequency(a) = %d; want 3", f)
+	}
+	lfu.Remove("a")
+	lfu.Clear()
+	if lfu.Len() != 0 || len(evictedKeys) != 5 {
+		t.Fatalf("got %d entries, %d evictions; want 0, 5", lfu.Len(), len(evictedKeys))
+	}
+}
@@ -20,6 +20,7 @@ package lru
 import (
 	"container/list"
 	"fmt"
+	"time"
 )
 
 // Cache is an LRU cache. It is not safe for concurrent access.
@@ -29,23 +30,153 @@ type Cache struct {
 	// lru容量限制，0表示无限制
 	MaxEntries int
 
+	// MaxBytes is the maximum total size of cache entries, as
+	// reported by SizeOf, before an item is evicted. Zero means
+	// no limit.
+	MaxBytes int64
+
+	// EvictSlack is the fraction by which the cache may exceed
+	// MaxEntries and MaxBytes before Add evicts. Once the slack is
+	// used up, items are evicted in one batch until the cache is
+	// back within its limits, which amortizes eviction under heavy
+	// Add churn. Zero means items are evicted as soon as the cache
+	// is over its limits.
+	EvictSlack float64
+
+	// SizeOf optionally reports the size of an entry for MaxBytes
+	// accounting. If nil, every entry has size zero.
+	SizeOf func(key Key, value interface{}) int64
+
 	// OnEvicted optionally specificies a callback function to be
 	// executed when an entry is purged from the cache.
 	// entry从cache中移出时的回调函数
 	OnEvicted func(key Key, value interface{})
 
+	// OnExpired optionally specifies a callback function to be
+	// executed when an entry is purged because its time-to-live
+	// elapsed. If nil, OnEvicted is called for expired entries.
+	OnExpired func(key Key, value interface{})
+
+	// OnEvictedReason optionally specifies a callback function to
+	// be executed when an entry leaves the cache for any reason,
+	// including when Add replaces its value. It is called in
+	// addition to OnEvicted and OnExpired.
+	OnEvictedReason func(key Key, value interface{}, reason EvictReason)
+
+	// CloneOnGet makes Get, Peek and the other methods that return
+	// values without removing them return a copy of values that
+	// implement Cloner, so that callers cannot modify the values
+	// held by the cache.
+	CloneOnGet bool
+
+	// OnUpdated optionally specifies a callback function to be
+	// executed when Add replaces the value of an entry that is
+	// already in the cache.
+	OnUpdated func(key Key, old, new interface{})
+
+	// now returns the current time. If nil, time.Now is used.
+	now func() time.Time
+
 	// 辅助链表
-	ll    *list.List
+	ll *list.List
 	// 存储cache数据，这里list.Element.Value的类型是*entry
 	cache map[interface{}]*list.Element
+	// 所有entry的总大小
+	nbytes int64
+	// 统计计数
+	stats Stats
+}
+
+// Stats are statistics about a Cache.
+type Stats struct {
+	Hits      int64 // Gets that found the key
+	Misses    int64 // Gets that did not find the key, or found it expired
+	Adds      int64 // calls to Add, including replacements
+	Evictions int64 // entries removed for capacity or expiry
+	Len       int   // current number of entries
+}
+
+// A Cloner is a value that can copy itself. See Cache.CloneOnGet.
+type Cloner interface {
+	// Clone returns a deep copy of the value.
+	Clone() interface{}
 }
 
 // A Key may be any value that is comparable. See http://golang.org/ref/spec#Comparison_operators
 type Key interface{}
 
+// Negative is the value of entries added with AddNegative. Get returns
+// it, with ok true, for keys that are known to be missing.
+var Negative interface{} = negative{}
+
+type negative struct{}
+
+func (negative) String() string { return "lru.Negative" }
+
+// An Entry is a key/value pair, as used by the batch operations.
+type Entry struct {
+	Key   Key
+	Value interface{}
+}
+
+// An EvictReason describes why an entry left the cache.
+type EvictReason int
+
+const (
+	// EvictCapacity means the entry was the oldest when the cache
+	// exceeded its limits or RemoveOldest was called.
+	EvictCapacity EvictReason = iota + 1
+
+	// EvictRemoved means the entry was removed with Remove.
+	EvictRemoved
+
+	// EvictCleared means the entry was purged by Clear.
+	EvictCleared
+
+	// EvictExpired means the entry's time-to-live elapsed.
+	EvictExpired
+
+	// EvictReplaced means Add replaced the entry's value; the
+	// callback receives the old value.
+	EvictReplaced
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictRemoved:
+		return "removed"
+	case EvictCleared:
+		return "cleared"
+	case EvictExpired:
+		return "expired"
+	case EvictReplaced:
+		return "replaced"
+	}
+	return fmt.Sprintf("EvictReason(%d)", int(r))
+}
+
 type entry struct {
-	key   Key
-	value interface{}
+	key     Key
+	value   interface{}
+	expires time.Time // zero means the entry never expires
+	size    int64
+	pinned  bool
+	onEvict func(key Key, value interface{})
+
+	created, accessed time.Time
+	hits              int64
+}
+
+// EntryInfo describes a cache entry.
+type EntryInfo struct {
+	Created    time.Time // when the current value was added
+	LastAccess time.Time // last Add or Get hit
+	Hits       int64     // Get hits since the value was added
+	Expires    time.Time // zero if the entry never expires
+	Size       int64     // as reported by SizeOf
+	Pinned     bool
 }
 
 // New creates a new Cache.
@@ -62,44 +193,220 @@ func New(maxEntries int) *Cache {
 // Add adds a value to the cache.
 // 向cache中添加entry
 func (c *Cache) Add(key Key, value interface{}) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// AddWithTTL adds a value to the cache that expires after ttl.
+// A ttl of zero or less means the value never expires.
+func (c *Cache) AddWithTTL(key Key, value interface{}, ttl time.Duration) {
+	now := c.timeNow()
+	var expires time.Time
+	if ttl > 0 {
+		expires = now.Add(ttl)
+	}
+	c.add(key, value, expires, now, nil)
+}
+
+// AddWithCallback adds a value to the cache with its own eviction
+// callback. onEvict is called when the value leaves the cache for any
+// reason, including when Add replaces it, in addition to the cache-wide
+// callbacks. It suits values that hold resources, such as open files,
+// that must be released however they leave the cache.
+func (c *Cache) AddWithCallback(key Key, value interface{}, onEvict func(key Key, value interface{})) {
+	c.add(key, value, time.Time{}, c.timeNow(), onEvict)
+}
+
+// AddNegative records that key is known to be missing, for instance
+// because the backend reported it does not exist. Until ttl elapses,
+// Get returns Negative for key instead of a miss. Negative entries
+// have size zero and are evicted like any other entry; the eviction
+// callbacks receive Negative as the value. A ttl of zero or less
+// means the entry never expires.
+func (c *Cache) AddNegative(key Key, ttl time.Duration) {
+	c.AddWithTTL(key, Negative, ttl)
+}
+
+// add adds a value that expires at expires, which may be zero.
+// onEvict is the entry's own eviction callback, which may be nil.
+func (c *Cache) add(key Key, value interface{}, expires, now time.Time, onEvict func(key Key, value interface{})) {
 	// 如果cache为空，先new出来
 	if c.cache == nil {
 		c.cache = make(map[interface{}]*list.Element)
 		c.ll = list.New()
 	}
 
+	c.stats.Adds++
+	size := c.sizeOf(key, value)
 	// 如果entry已存在，移到ll的最前面，更新value
 	if ee, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ee)
-		ee.Value.(*entry).value = value
-		return
+		kv := ee.Value.(*entry)
+		old := *kv
+		c.nbytes += size - kv.size
+		kv.value = value
+		kv.expires = expires
+		kv.size = size
+		kv.onEvict = onEvict
+		kv.created, kv.accessed, kv.hits = now, now, 0
+		c.notify(&old, EvictReplaced)
+		if c.OnUpdated != nil {
+			c.OnUpdated(key, old.value, value)
+		}
+	} else {
+		// 如果是新的entry，插入最前面
+		ele := c.ll.PushFront(&entry{key: key, value: value, expires: expires, size: size, onEvict: onEvict, created: now, accessed: now})
+		c.cache[key] = ele
+		c.nbytes += size
 	}
-	// 如果是新的entry，插入最前面
-	ele := c.ll.PushFront(&entry{key, value})
-	c.cache[key] = ele
-	// 如果ll长度超过最大限制，删除最旧的entry
-	if c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries {
-		c.RemoveOldest()
+	// 如果超过最大限制，删除最旧的entry
+	c.evictOverflow()
+}
+
+func (c *Cache) sizeOf(key Key, value interface{}) int64 {
+	if c.SizeOf == nil || value == Negative {
+		return 0
 	}
+	return c.SizeOf(key, value)
+}
+
+func (c *Cache) overCapacity() bool {
+	return (c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries) ||
+		(c.MaxBytes != 0 && c.nbytes > c.MaxBytes)
+}
+
+// overSlack reports whether the cache exceeds its limits by more
+// than EvictSlack.
+func (c *Cache) overSlack() bool {
+	slack := 1 + c.EvictSlack
+	return (c.MaxEntries != 0 && float64(c.ll.Len()) > float64(c.MaxEntries)*slack) ||
+		(c.MaxBytes != 0 && float64(c.nbytes) > float64(c.MaxBytes)*slack)
+}
+
+// evictOverflow evicts once the cache is over its limits by more than
+// EvictSlack, and returns the number of items removed.
+func (c *Cache) evictOverflow() int {
+	if c.EvictSlack > 0 && !c.overSlack() {
+		return 0
+	}
+	return c.EvictExcess()
+}
+
+// EvictExcess removes the oldest unpinned items until the cache is
+// within its limits, ignoring EvictSlack, and returns the number of
+// items removed. The cache stays over its limits if only pinned items
+// are left.
+func (c *Cache) EvictExcess() (evicted int) {
+	if c.cache == nil {
+		return 0
+	}
+	for c.overCapacity() {
+		ele := c.evictable()
+		if ele == nil {
+			break
+		}
+		c.removeElement(ele, EvictCapacity)
+		evicted++
+	}
+	return evicted
+}
+
+// evictable returns the oldest unpinned element, or nil.
+func (c *Cache) evictable() *list.Element {
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		if !e.Value.(*entry).pinned {
+			return e
+		}
+	}
+	return nil
 }
 
 // Get looks up a key's value from the cache.
 // 查询key对应的entry的value
 func (c *Cache) Get(key Key) (value interface{}, ok bool) {
+	value, _, ok = c.GetWithExpiry(key)
+	return
+}
+
+// GetWithExpiry is like Get, but also returns when the value expires,
+// or the zero time if it never does. Callers can use it to refresh
+// values shortly before they expire, at randomized times, so that
+// popular keys do not all expire and reload at once.
+func (c *Cache) GetWithExpiry(key Key) (value interface{}, expires time.Time, ok bool) {
 	// 如果cache为空，返回默认值
 	if c.cache == nil {
+		c.stats.Misses++
 		return
 	}
 
 	// 如果命中，将entry放到最前面，返回entry的value
 	if ele, hit := c.cache[key]; hit {
+		if c.expired(ele.Value.(*entry)) {
+			c.removeElement(ele, EvictExpired)
+			c.stats.Misses++
+			return
+		}
 		c.ll.MoveToFront(ele)
-		return ele.Value.(*entry).value, true
+		c.stats.Hits++
+		kv := ele.Value.(*entry)
+		kv.accessed = c.timeNow()
+		kv.hits++
+		return c.read(kv.value), kv.expires, true
 	}
 	// 未命中，返回默认值
+	c.stats.Misses++
 	return
 }
 
+// GetOrAdd returns the existing value for key if present. Otherwise,
+// it adds value and returns it. The loaded result is true if the value
+// was found, false if it was added. A found value is counted and
+// promoted as by Get.
+func (c *Cache) GetOrAdd(key Key, value interface{}) (actual interface{}, loaded bool) {
+	if v, ok := c.Get(key); ok {
+		return v, true
+	}
+	c.Add(key, value)
+	return value, false
+}
+
+// AddAll adds all entries to the cache, in order.
+func (c *Cache) AddAll(entries []Entry) {
+	for _, e := range entries {
+		c.Add(e.Key, e.Value)
+	}
+}
+
+// GetAll looks up the values of keys from the cache. The returned map
+// holds only the keys that were found.
+func (c *Cache) GetAll(keys []Key) map[Key]interface{} {
+	values := make(map[Key]interface{}, len(keys))
+	for _, key := range keys {
+		if v, ok := c.Get(key); ok {
+			values[key] = v
+		}
+	}
+	return values
+}
+
+// Peek looks up a key's value from the cache without updating its
+// recency.
+func (c *Cache) Peek(key Key) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit && !c.expired(ele.Value.(*entry)) {
+		return c.read(ele.Value.(*entry).value), true
+	}
+	return
+}
+
+// Contains reports whether key is in the cache without updating its
+// recency.
+func (c *Cache) Contains(key Key) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
 // Remove removes the provided key from the cache.
 func (c *Cache) Remove(key Key) {
 	// 如果cache为空，返回
@@ -108,36 +415,229 @@ func (c *Cache) Remove(key Key) {
 	}
 	// 如果有对应的entry，将它删除
 	if ele, hit := c.cache[key]; hit {
-		c.removeElement(ele)
+		c.removeElement(ele, EvictRemoved)
+	}
+}
+
+// GetOldest returns the oldest unpinned item in the cache without
+// updating its recency. Expired items found at the old end are purged.
+func (c *Cache) GetOldest() (key Key, value interface{}, ok bool) {
+	ele := c.oldest()
+	if ele == nil {
+		return
+	}
+	kv := ele.Value.(*entry)
+	return kv.key, c.read(kv.value), true
+}
+
+// PopOldest removes the oldest unpinned item from the cache and
+// returns it.
+// The eviction callbacks run as for RemoveOldest.
+func (c *Cache) PopOldest() (key Key, value interface{}, ok bool) {
+	ele := c.oldest()
+	if ele == nil {
+		return
+	}
+	kv := ele.Value.(*entry)
+	c.removeElement(ele, EvictCapacity)
+	return kv.key, kv.value, true
+}
+
+// OldestN returns up to n of the oldest items in the cache, oldest
+// first, in the order they would be evicted. It does not remove them
+// or update their recency. Pinned and expired items are skipped.
+func (c *Cache) OldestN(n int) []Entry {
+	if c.cache == nil || n <= 0 {
+		return nil
+	}
+	if l := c.ll.Len(); n > l {
+		n = l
 	}
+	entries := make([]Entry, 0, n)
+	for e := c.ll.Back(); e != nil && len(entries) < n; e = e.Prev() {
+		kv := e.Value.(*entry)
+		if !kv.pinned && !c.expired(kv) {
+			entries = append(entries, Entry{kv.key, c.read(kv.value)})
+		}
+	}
+	return entries
 }
 
-// RemoveOldest removes the oldest item from the cache.
+// oldest returns the oldest unpinned, unexpired element, purging
+// expired elements behind it.
+func (c *Cache) oldest() *list.Element {
+	if c.cache == nil {
+		return nil
+	}
+	for {
+		ele := c.evictable()
+		if ele == nil || !c.expired(ele.Value.(*entry)) {
+			return ele
+		}
+		c.removeElement(ele, EvictExpired)
+	}
+}
+
+// RemoveOldest removes the oldest unpinned item from the cache.
 func (c *Cache) RemoveOldest() {
 	// 如果cache为空，返回
 	if c.cache == nil {
 		return
 	}
 	// 从尾部删除
-	ele := c.ll.Back()
+	ele := c.evictable()
 	if ele != nil {
-		c.removeElement(ele)
+		c.removeElement(ele, EvictCapacity)
+	}
+}
+
+// Victim implements Victimer.
+func (c *Cache) Victim() (key Key, ok bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+	if ele := c.evictable(); ele != nil {
+		return ele.Value.(*entry).key, true
+	}
+	return nil, false
+}
+
+// EntryInfo returns information about the item for key without
+// updating its recency. It reports false if key is not in the cache
+// or has expired.
+func (c *Cache) EntryInfo(key Key) (info EntryInfo, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	ele, hit := c.cache[key]
+	if !hit {
+		return
+	}
+	kv := ele.Value.(*entry)
+	if c.expired(kv) {
+		return
 	}
+	return EntryInfo{
+		Created:    kv.created,
+		LastAccess: kv.accessed,
+		Hits:       kv.hits,
+		Expires:    kv.expires,
+		Size:       kv.size,
+		Pinned:     kv.pinned,
+	}, true
 }
 
-func (c *Cache) removeElement(e *list.Element) {
+// Pin protects the item for key from eviction for capacity until it
+// is unpinned. Pinned items still count towards MaxEntries and
+// MaxBytes, can still expire, and are still removed by Remove and
+// Clear. Pin reports whether key was found.
+func (c *Cache) Pin(key Key) bool {
+	if c.cache == nil {
+		return false
+	}
+	ele, ok := c.cache[key]
+	if ok {
+		ele.Value.(*entry).pinned = true
+	}
+	return ok
+}
+
+// Unpin makes the item for key evictable again, evicting the oldest
+// items if the cache is over its limits. Unpin reports whether key
+// was found.
+func (c *Cache) Unpin(key Key) bool {
+	if c.cache == nil {
+		return false
+	}
+	ele, ok := c.cache[key]
+	if ok {
+		ele.Value.(*entry).pinned = false
+		c.evictOverflow()
+	}
+	return ok
+}
+
+// Resize changes MaxEntries to newMaxEntries and immediately evicts
+// the oldest items that no longer fit. It returns the number of items
+// evicted. A newMaxEntries of zero means no limit.
+func (c *Cache) Resize(newMaxEntries int) (evicted int) {
+	c.MaxEntries = newMaxEntries
+	return c.EvictExcess()
+}
+
+// RemoveExpired removes all expired items from the cache and returns
+// the number of items removed. Get never returns expired items, so
+// calling RemoveExpired is only needed to reclaim their memory early.
+func (c *Cache) RemoveExpired() int {
+	if c.cache == nil {
+		return 0
+	}
+	n := 0
+	for e := c.ll.Back(); e != nil; {
+		prev := e.Prev()
+		if c.expired(e.Value.(*entry)) {
+			c.removeElement(e, EvictExpired)
+			n++
+		}
+		e = prev
+	}
+	return n
+}
+
+// read returns value as it should be handed to callers, cloning it
+// if CloneOnGet is set.
+func (c *Cache) read(value interface{}) interface{} {
+	if c.CloneOnGet {
+		if cl, ok := value.(Cloner); ok {
+			return cl.Clone()
+		}
+	}
+	return value
+}
+
+func (c *Cache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *Cache) expired(e *entry) bool {
+	return !e.expires.IsZero() && !c.timeNow().Before(e.expires)
+}
+
+func (c *Cache) removeElement(e *list.Element, reason EvictReason) {
 	// 删除ll中的element
 	c.ll.Remove(e)
 	kv := e.Value.(*entry)
 	// 删除map中对应的键值对
 	delete(c.cache, kv.key)
-	if c.OnEvicted != nil {
-		// 调用回调函数
+	c.nbytes -= kv.size
+	// 调用回调函数
+	c.notify(kv, reason)
+}
+
+// notify runs the eviction callbacks that apply to reason.
+func (c *Cache) notify(kv *entry, reason EvictReason) {
+	if reason == EvictCapacity || reason == EvictExpired {
+		c.stats.Evictions++
+	}
+	switch {
+	case reason == EvictExpired && c.OnExpired != nil:
+		c.OnExpired(kv.key, kv.value)
+	case reason != EvictReplaced && c.OnEvicted != nil:
 		c.OnEvicted(kv.key, kv.value)
 	}
+	if kv.onEvict != nil {
+		kv.onEvict(kv.key, kv.value)
+	}
+	if c.OnEvictedReason != nil {
+		c.OnEvictedReason(kv.key, kv.value, reason)
+	}
 }
 
-// Len returns the number of items in the cache.
+// Len returns the number of items in the cache. Expired items that
+// have not been purged yet are included.
 func (c *Cache) Len() int {
 	if c.cache == nil {
 		return 0
@@ -145,16 +645,65 @@ func (c *Cache) Len() int {
 	return c.ll.Len()
 }
 
+// Range calls f for each item in the cache, from the most to the
+// least recently used, until f returns false. Range iterates over a
+// snapshot taken before the first call, so f may modify the cache;
+// such changes are not reflected in the iteration. Range does not
+// update recency and skips expired items.
+func (c *Cache) Range(f func(key Key, value interface{}) bool) {
+	if c.cache == nil {
+		return
+	}
+	entries := make([]entry, 0, c.ll.Len())
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		kv := e.Value.(*entry)
+		if !c.expired(kv) {
+			entries = append(entries, *kv)
+		}
+	}
+	for _, kv := range entries {
+		if !f(kv.key, c.read(kv.value)) {
+			return
+		}
+	}
+}
+
+// Keys returns the keys in the cache, from the most to the least
+// recently used. Expired items are skipped.
+func (c *Cache) Keys() []Key {
+	if c.cache == nil {
+		return nil
+	}
+	keys := make([]Key, 0, c.ll.Len())
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		if kv := e.Value.(*entry); !c.expired(kv) {
+			keys = append(keys, kv.key)
+		}
+	}
+	return keys
+}
+
+// Stats returns statistics about the cache.
+func (c *Cache) Stats() Stats {
+	s := c.stats
+	s.Len = c.Len()
+	return s
+}
+
+// Bytes returns the total size of the items in the cache, as
+// reported by SizeOf.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
 // Clear purges all stored items from the cache.
 func (c *Cache) Clear() {
-	if c.OnEvicted != nil {
-		for _, e := range c.cache {
-			kv := e.Value.(*entry)
-			c.OnEvicted(kv.key, kv.value)
-		}
+	for _, e := range c.cache {
+		c.notify(e.Value.(*entry), EvictCleared)
 	}
 	c.ll = nil
 	c.cache = nil
+	c.nbytes = 0
 }
 
 func (c *Cache) String() (s string) {
@@ -163,4 +712,4 @@ func (c *Cache) String() (s string) {
 			v.Value.(*entry).key, v.Value.(*entry).value)
 	}
 	return
-}
\ No newline at end of file
+}
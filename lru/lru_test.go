@@ -19,6 +19,7 @@ package lru
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 type simpleStruct struct {
@@ -100,3 +101,512 @@ func TestEvict(t *testing.T) {
 		t.Fatalf("got %v in second evicted key; want %s", evictedKeys[1], "myKey1")
 	}
 }
+
+// fakeClock is a manually advanced clock for testing expiration.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestExpire(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	lru := New(0)
+	lru.now = clock.now
+	lru.AddWithTTL("short", 1, time.Second)
+	lru.AddWithTTL("long", 2, time.Minute)
+	lru.Add("forever", 3)
+
+	if _, ok := lru.Get("short"); !ok {
+		t.Fatal("short-lived entry missing before its TTL elapsed")
+	}
+	clock.advance(2 * time.Second)
+	if _, ok := lru.Get("short"); ok {
+		t.Fatal("Get returned an expired entry")
+	}
+	if _, ok := lru.Get("long"); !ok {
+		t.Fatal("long-lived entry expired too early")
+	}
+	clock.advance(time.Hour)
+	if n := lru.RemoveExpired(); n != 1 {
+		t.Fatalf("RemoveExpired removed %d entries; want 1", n)
+	}
+	if _, ok := lru.Get("forever"); !ok {
+		t.Fatal("entry without TTL expired")
+	}
+	if lru.Len() != 1 {
+		t.Fatalf("got %d entries; want 1", lru.Len())
+	}
+}
+
+func TestOnExpired(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var evicted, expired []Key
+	lru := New(2)
+	lru.now = clock.now
+	lru.OnEvicted = func(key Key, value interface{}) {
+		evicted = append(evicted, key)
+	}
+	lru.OnExpired = func(key Key, value interface{}) {
+		expired = append(expired, key)
+	}
+	lru.AddWithTTL("a", 1, time.Second)
+	lru.Add("b", 2)
+	lru.Add("c", 3)
+	lru.AddWithTTL("d", 4, time.Second)
+	clock.advance(time.Second)
+	lru.Get("d")
+
+	if len(evicted) != 2 || evicted[0] != Key("a") || evicted[1] != Key("b") {
+		t.Errorf("evicted = %v; want [a b]", evicted)
+	}
+	if len(expired) != 1 || expired[0] != Key("d") {
+		t.Errorf("expired = %v; want [d]", expired)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	var evictedKeys []Key
+	lru := &Cache{
+		MaxBytes: 10,
+		SizeOf: func(key Key, value interface{}) int64 {
+			return int64(len(value.(string)))
+		},
+		OnEvicted: func(key Key, value interface{}) {
+			evictedKeys = append(evictedKeys, key)
+		},
+	}
+	lru.Add("a", "1234")
+	lru.Add("b", "1234")
+	if got := lru.Bytes(); got != 8 {
+		t.Fatalf("got %d bytes; want 8", got)
+	}
+	lru.Add("c", "1234567")
+	if len(evictedKeys) != 2 || evictedKeys[0] != Key("a") || evictedKeys[1] != Key("b") {
+		t.Fatalf("evicted keys = %v; want [a b]", evictedKeys)
+	}
+	if got := lru.Bytes(); got != 7 {
+		t.Fatalf("got %d bytes; want 7", got)
+	}
+
+	// Replacing a value adjusts the accounted size.
+	lru.Add("c", "12")
+	if got := lru.Bytes(); got != 2 {
+		t.Fatalf("got %d bytes after replace; want 2", got)
+	}
+	lru.Remove("c")
+	if got := lru.Bytes(); got != 0 {
+		t.Fatalf("got %d bytes after remove; want 0", got)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var evictedKeys []Key
+	lru := New(2)
+	lru.now = clock.now
+	lru.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	if v, ok := lru.Peek("a"); !ok || v != 1 {
+		t.Fatalf("Peek(a) = %v, %v; want 1, true", v, ok)
+	}
+	if !lru.Contains("b") || lru.Contains("c") {
+		t.Fatal("Contains reported wrong membership")
+	}
+	// Neither Peek nor Contains promoted a, so it is evicted first.
+	lru.Add("c", 3)
+	if len(evictedKeys) != 1 || evictedKeys[0] != Key("a") {
+		t.Fatalf("evicted keys = %v; want [a]", evictedKeys)
+	}
+
+	lru.AddWithTTL("d", 4, time.Second)
+	clock.advance(time.Second)
+	if lru.Contains("d") {
+		t.Fatal("Contains reported an expired entry")
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := New(0)
+	for i := 0; i < 4; i++ {
+		lru.Add(i, i*10)
+	}
+	lru.Get(1)
+	if got, want := fmt.Sprint(lru.Keys()), "[1 3 2 0]"; got != want {
+		t.Fatalf("Keys = %v; want %v", got, want)
+	}
+
+	var seen []Key
+	lru.Range(func(key Key, value interface{}) bool {
+		if value != key.(int)*10 {
+			t.Errorf("Range value for %v = %v; want %v", key, value, key.(int)*10)
+		}
+		seen = append(seen, key)
+		// Mutating the cache must not disturb the iteration.
+		lru.Remove(key)
+		lru.Add(key.(int)+100, 0)
+		return len(seen) < 3
+	})
+	if got, want := fmt.Sprint(seen), "[1 3 2]"; got != want {
+		t.Fatalf("Range visited %v; want %v", got, want)
+	}
+	if got, want := fmt.Sprint(lru.Keys()), "[102 103 101 0]"; got != want {
+		t.Fatalf("Keys after Range = %v; want %v", got, want)
+	}
+}
+
+func TestOnEvictedReason(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var got []string
+	lru := New(2)
+	lru.now = clock.now
+	lru.OnEvictedReason = func(key Key, value interface{}, reason EvictReason) {
+		got = append(got, fmt.Sprintf("%v=%v:%v", key, value, reason))
+	}
+	lru.Add("a", 1)
+	lru.Add("a", 2)
+	lru.Add("b", 3)
+	lru.Add("c", 4)
+	lru.Remove("b")
+	lru.AddWithTTL("d", 5, time.Second)
+	clock.advance(time.Second)
+	lru.Get("d")
+	lru.Clear()
+
+	want := "[a=1:replaced a=2:capacity b=3:removed d=5:expired c=4:cleared]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("reasons = %v; want %v", got, want)
+	}
+}
+
+func TestOnUpdated(t *testing.T) {
+	var got []string
+	lru := New(0)
+	lru.OnUpdated = func(key Key, old, new interface{}) {
+		got = append(got, fmt.Sprintf("%v:%v->%v", key, old, new))
+	}
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	lru.Add("a", 3)
+	lru.Remove("b")
+	if want := "[a:1->3]"; fmt.Sprint(got) != want {
+		t.Fatalf("updates = %v; want %v", got, want)
+	}
+}
+
+type cloneableSlice []int
+
+func (s cloneableSlice) Clone() interface{} {
+	return append(cloneableSlice(nil), s...)
+}
+
+func TestCloneOnGet(t *testing.T) {
+	for _, clone := range []bool{false, true} {
+		lru := New(0)
+		lru.CloneOnGet = clone
+		lru.Add("a", cloneableSlice{1, 2})
+		v, _ := lru.Get("a")
+		v.(cloneableSlice)[0] = 9
+		p, _ := lru.Peek("a")
+		if got := p.(cloneableSlice)[0]; (got == 1) != clone {
+			t.Errorf("CloneOnGet=%v: cached value is %v after writing to result", clone, p)
+		}
+	}
+}
+
+func TestAddAllGetAll(t *testing.T) {
+	lru := New(3)
+	lru.AddAll([]Entry{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}})
+	got := lru.GetAll([]Key{"a", "b", "d", "x"})
+	if len(got) != 2 || got["b"] != 2 || got["d"] != 4 {
+		t.Fatalf("GetAll = %v; want map[b:2 d:4]", got)
+	}
+}
+
+func TestGetOrAdd(t *testing.T) {
+	lru := New(2)
+	if v, loaded := lru.GetOrAdd("a", 1); loaded || v != 1 {
+		t.Fatalf("GetOrAdd(a, 1) = %v, %v; want 1, false", v, loaded)
+	}
+	lru.Add("b", 2)
+	if v, loaded := lru.GetOrAdd("a", 3); !loaded || v != 1 {
+		t.Fatalf("GetOrAdd(a, 3) = %v, %v; want 1, true", v, loaded)
+	}
+	// The hit made "a" the most recent, so "b" is evicted next.
+	lru.Add("c", 4)
+	if _, ok := lru.Get("b"); ok {
+		t.Fatal("GetOrAdd hit did not update recency")
+	}
+}
+
+func TestAddNegative(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	lru := New(0)
+	lru.now = clock.now
+	lru.SizeOf = func(key Key, value interface{}) int64 {
+		return int64(len(value.(string)))
+	}
+	lru.AddWithTTL("present", "value", time.Hour)
+	lru.AddNegative("missing", time.Minute)
+	if v, ok := lru.Get("missing"); !ok || v != Negative {
+		t.Fatalf("Get(missing) = %v, %v; want Negative, true", v, ok)
+	}
+	if b := lru.Bytes(); b != 5 {
+		t.Fatalf("Bytes() = %d; want 5", b)
+	}
+	clock.advance(2 * time.Minute)
+	if _, ok := lru.Get("missing"); ok {
+		t.Fatal("negative entry outlived its ttl")
+	}
+	if _, ok := lru.Get("present"); !ok {
+		t.Fatal("positive entry expired with the negative one")
+	}
+}
+
+func TestEvictSlack(t *testing.T) {
+	evicted := 0
+	lru := New(20)
+	lru.EvictSlack = 0.1
+	lru.OnEvicted = func(key Key, value interface{}) {
+		evicted++
+	}
+	for i := 0; i < 22; i++ {
+		lru.Add(i, i)
+	}
+	if n := lru.Len(); n != 22 || evicted != 0 {
+		t.Fatalf("within slack: Len() = %d, evicted %d; want 22, 0", n, evicted)
+	}
+	// The 23rd entry exceeds the slack and trims back to MaxEntries.
+	lru.Add(22, 22)
+	if n := lru.Len(); n != 20 || evicted != 3 {
+		t.Fatalf("past slack: Len() = %d, evicted %d; want 20, 3", n, evicted)
+	}
+	if _, ok := lru.Get(2); ok {
+		t.Fatal("oldest entries were not the ones evicted")
+	}
+	lru.Add(23, 23)
+	if n := lru.EvictExcess(); n != 1 || lru.Len() != 20 {
+		t.Fatalf("EvictExcess() = %d, Len() = %d; want 1, 20", n, lru.Len())
+	}
+}
+
+func TestGetWithExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	lru := New(0)
+	lru.now = clock.now
+	lru.AddWithTTL("a", 1, time.Minute)
+	lru.Add("b", 2)
+	if v, exp, ok := lru.GetWithExpiry("a"); !ok || v != 1 || !exp.Equal(time.Unix(60, 0)) {
+		t.Fatalf("GetWithExpiry(a) = %v, %v, %v; want 1, %v, true", v, exp, ok, time.Unix(60, 0))
+	}
+	if v, exp, ok := lru.GetWithExpiry("b"); !ok || v != 2 || !exp.IsZero() {
+		t.Fatalf("GetWithExpiry(b) = %v, %v, %v; want 2, zero time, true", v, exp, ok)
+	}
+	clock.advance(time.Minute)
+	if _, _, ok := lru.GetWithExpiry("a"); ok {
+		t.Fatal("GetWithExpiry returned an expired entry")
+	}
+}
+
+func TestAddWithCallback(t *testing.T) {
+	var global, own []string
+	lru := New(2)
+	lru.OnEvicted = func(key Key, value interface{}) {
+		global = append(global, fmt.Sprint(key))
+	}
+	closer := func(key Key, value interface{}) {
+		own = append(own, fmt.Sprintf("%v=%v", key, value))
+	}
+	lru.AddWithCallback("a", 1, closer)
+	lru.AddWithCallback("b", 2, closer)
+	// Replacing "b" releases its old value.
+	lru.Add("b", 3)
+	lru.Add("c", 4)
+	lru.AddWithCallback("d", 5, closer)
+	lru.Clear()
+	if got, want := fmt.Sprint(own), "[b=2 a=1 d=5]"; got != want {
+		t.Fatalf("per-entry callbacks = %v; want %v", got, want)
+	}
+	if got, want := len(global), 4; got != want {
+		t.Fatalf("global callbacks ran %d times; want %d", got, want)
+	}
+}
+
+func TestResize(t *testing.T) {
+	var evictedKeys []Key
+	lru := New(5)
+	lru.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	for i := 0; i < 5; i++ {
+		lru.Add(i, i)
+	}
+	if n := lru.Resize(2); n != 3 {
+		t.Fatalf("Resize(2) evicted %d; want 3", n)
+	}
+	if got, want := fmt.Sprint(evictedKeys), "[0 1 2]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	if n := lru.Resize(10); n != 0 {
+		t.Fatalf("Resize(10) evicted %d; want 0", n)
+	}
+	for i := 5; i < 13; i++ {
+		lru.Add(i, i)
+	}
+	if lru.Len() != 10 {
+		t.Fatalf("got %d entries after growing; want 10", lru.Len())
+	}
+}
+
+func TestGetOldestPopOldest(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var evictedKeys []Key
+	lru := New(0)
+	lru.now = clock.now
+	lru.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	if _, _, ok := lru.GetOldest(); ok {
+		t.Fatal("GetOldest on an empty cache returned an item")
+	}
+	lru.AddWithTTL("stale", 0, time.Second)
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	clock.advance(time.Second)
+
+	if k, v, ok := lru.GetOldest(); !ok || k != Key("a") || v != 1 {
+		t.Fatalf("GetOldest = %v, %v, %v; want a, 1, true", k, v, ok)
+	}
+	if k, v, ok := lru.PopOldest(); !ok || k != Key("a") || v != 1 {
+		t.Fatalf("PopOldest = %v, %v, %v; want a, 1, true", k, v, ok)
+	}
+	if got, want := fmt.Sprint(evictedKeys), "[stale a]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	if lru.Len() != 1 {
+		t.Fatalf("got %d entries; want 1", lru.Len())
+	}
+}
+
+func TestOldestN(t *testing.T) {
+	lru := New(0)
+	for i := 0; i < 5; i++ {
+		lru.Add(i, i*10)
+	}
+	lru.Get(0)
+	lru.Pin(2)
+	if got, want := fmt.Sprint(lru.OldestN(3)), "[{1 10} {3 30} {4 40}]"; got != want {
+		t.Fatalf("OldestN(3) = %v; want %v", got, want)
+	}
+	if got := lru.OldestN(10); len(got) != 4 {
+		t.Fatalf("OldestN(10) returned %d entries; want 4", len(got))
+	}
+	if lru.Len() != 5 {
+		t.Fatal("OldestN removed entries")
+	}
+	if got, _, _ := lru.GetOldest(); got != 1 {
+		t.Fatalf("OldestN changed recency: oldest is %v", got)
+	}
+}
+
+func TestStats(t *testing.T) {
+	lru := New(2)
+	lru.Get("a")
+	lru.Add("a", 1)
+	lru.Add("a", 2)
+	lru.Add("b", 3)
+	lru.Add("c", 4)
+	lru.Get("c")
+	lru.Get("a")
+	lru.Peek("b")
+	lru.Remove("b")
+
+	want := Stats{Hits: 1, Misses: 2, Adds: 4, Evictions: 1, Len: 1}
+	if got := lru.Stats(); got != want {
+		t.Fatalf("Stats = %+v; want %+v", got, want)
+	}
+}
+
+func TestPin(t *testing.T) {
+	var evictedKeys []Key
+	lru := New(2)
+	lru.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	if lru.Pin("missing") {
+		t.Fatal("Pin reported a missing key as found")
+	}
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	if !lru.Pin("a") {
+		t.Fatal("Pin reported a present key as missing")
+	}
+	lru.Add("c", 3)
+	lru.Add("d", 4)
+	if got, want := fmt.Sprint(evictedKeys), "[b c]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	if k, _, _ := lru.GetOldest(); k != Key("d") {
+		t.Fatalf("GetOldest = %v; want the oldest unpinned key d", k)
+	}
+
+	// When all older entries are pinned, a new entry is the only
+	// eviction candidate.
+	lru.Pin("d")
+	lru.Add("e", 5)
+	if got, want := fmt.Sprint(evictedKeys), "[b c e]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	// With every entry pinned the cache overflows instead of
+	// evicting.
+	if n := lru.Resize(1); n != 0 || lru.Len() != 2 {
+		t.Fatalf("Resize(1) evicted %d, left %d entries; want 0, 2", n, lru.Len())
+	}
+	lru.Unpin("a")
+	if got, want := fmt.Sprint(evictedKeys), "[b c e a]"; got != want {
+		t.Fatalf("evicted keys after Unpin = %v; want %v", got, want)
+	}
+	lru.Remove("d")
+	if lru.Len() != 0 {
+		t.Fatalf("got %d entries; want 0", lru.Len())
+	}
+}
+
+func TestEntryInfo(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	lru := New(0)
+	lru.now = clock.now
+	lru.AddWithTTL("a", 1, time.Hour)
+	clock.advance(time.Second)
+	lru.Get("a")
+	clock.advance(time.Second)
+	lru.Get("a")
+	lru.Peek("a")
+
+	info, ok := lru.EntryInfo("a")
+	if !ok {
+		t.Fatal("EntryInfo reported a present key as missing")
+	}
+	want := EntryInfo{
+		Created:    time.Unix(1000, 0),
+		LastAccess: time.Unix(1002, 0),
+		Hits:       2,
+		Expires:    time.Unix(1000, 0).Add(time.Hour),
+	}
+	if info != want {
+		t.Fatalf("EntryInfo = %+v; want %+v", info, want)
+	}
+
+	lru.Add("a", 2)
+	if info, _ := lru.EntryInfo("a"); info.Hits != 0 || !info.Created.Equal(clock.t) {
+		t.Fatalf("EntryInfo after replace = %+v; want fresh info", info)
+	}
+	if _, ok := lru.EntryInfo("missing"); ok {
+		t.Fatal("EntryInfo reported a missing key as found")
+	}
+}
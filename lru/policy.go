@@ -0,0 +1,71 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+// A Policy is a cache with an eviction policy. Cache is the LRU
+// Policy; other implementations in this package trade its simplicity
+// for better hit rates under particular workloads. Policies are not
+// safe for concurrent access.
+type Policy interface {
+	// Add adds a value to the cache.
+	Add(key Key, value interface{})
+
+	// Get looks up a key's value from the cache.
+	Get(key Key) (value interface{}, ok bool)
+
+	// Remove removes the provided key from the cache.
+	Remove(key Key)
+
+	// RemoveOldest removes the entry the policy considers the
+	// best eviction candidate.
+	RemoveOldest()
+
+	// Len returns the number of items in the cache.
+	Len() int
+
+	// Clear purges all stored items from the cache.
+	Clear()
+}
+
+// A Victimer is a Policy that can tell which entry RemoveOldest would
+// remove, without removing it. Admission filters such as TinyLFU use
+// it to weigh a new entry against the one it would displace.
+type Victimer interface {
+	// Victim returns the key of the entry RemoveOldest would
+	// remove, or false if there is none.
+	Victim() (key Key, ok bool)
+}
+
+var (
+	_ Victimer = (*Cache)(nil)
+	_ Victimer = (*ARCCache)(nil)
+	_ Victimer = (*SLRUCache)(nil)
+	_ Victimer = (*LFUCache)(nil)
+	_ Victimer = (*TwoQueueCache)(nil)
+	_ Victimer = (*GDSCache)(nil)
+)
+
+var (
+	_ Policy = (*Cache)(nil)
+	_ Policy = (*ARCCache)(nil)
+	_ Policy = (*SLRUCache)(nil)
+	_ Policy = (*LFUCache)(nil)
+	_ Policy = (*ClockCache)(nil)
+	_ Policy = (*TwoQueueCache)(nil)
+	_ Policy = (*GDSCache)(nil)
+	_ Policy = (*SampledCache)(nil)
+)
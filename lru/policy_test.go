@@ -0,0 +1,52 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "testing"
+
+func TestVictim(t *testing.T) {
+	var evicted []Key
+	onEvicted := func(key Key, value interface{}) { evicted = append(evicted, key) }
+	policies := []Policy{
+		&Cache{OnEvicted: onEvicted},
+		&ARCCache{MaxEntries: 4, OnEvicted: onEvicted},
+		&SLRUCache{OnEvicted: onEvicted},
+		&LFUCache{OnEvicted: onEvicted},
+		&TwoQueueCache{MaxEntries: 4, OnEvicted: onEvicted},
+		&GDSCache{OnEvicted: onEvicted},
+	}
+	for _, p := range policies {
+		v := p.(Victimer)
+		if key, ok := v.Victim(); ok {
+			t.Errorf("%T: Victim of an empty cache = %v; want none", p, key)
+		}
+		for i := 0; i < 4; i++ {
+			p.Add(i, i)
+		}
+		p.Get(0)
+		p.Get(2)
+		p.Get(2)
+		for p.Len() > 0 {
+			key, ok := v.Victim()
+			evicted = nil
+			p.RemoveOldest()
+			if !ok || len(evicted) != 1 || evicted[0] != key {
+				t.Errorf("%T: Victim = %v, %v; RemoveOldest evicted %v", p, key, ok, evicted)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+// DefaultSampleSize is the SampledCache sample size used when
+// SampleSize is zero.
+const DefaultSampleSize = 5
+
+// SampledCache is an approximate LRU cache for very large numbers of
+// entries. Instead of a linked list it keeps each entry's last access
+// time in a flat slice and, to evict, picks the least recently used of
+// a few randomly sampled entries, as Redis does. This saves the list
+// pointers of Cache at the cost of sometimes evicting an entry that
+// is not the oldest. It is not safe for concurrent access.
+type SampledCache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// SampleSize is the number of entries sampled per eviction.
+	// Larger samples approximate LRU more closely but make each
+	// eviction slower. Zero means DefaultSampleSize.
+	SampleSize int
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	entries []sampledEntry
+	items   map[interface{}]int // index into entries
+	clock   uint64              // logical time of the last access
+	rng     uint64              // xorshift state
+}
+
+type sampledEntry struct {
+	key      Key
+	value    interface{}
+	accessed uint64
+}
+
+// NewSampled creates a new SampledCache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func NewSampled(maxEntries int) *SampledCache {
+	c := &SampledCache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *SampledCache) init() {
+	c.entries = make([]sampledEntry, 0, c.MaxEntries)
+	c.items = make(map[interface{}]int, c.MaxEntries)
+}
+
+// Add adds a value to the cache.
+func (c *SampledCache) Add(key Key, value interface{}) {
+	if c.items == nil {
+		c.init()
+	}
+	c.clock++
+	if i, ok := c.items[key]; ok {
+		c.entries[i].value = value
+		c.entries[i].accessed = c.clock
+		return
+	}
+	if c.MaxEntries != 0 && len(c.items) >= c.MaxEntries {
+		c.RemoveOldest()
+	}
+	c.items[key] = len(c.entries)
+	c.entries = append(c.entries, sampledEntry{key: key, value: value, accessed: c.clock})
+}
+
+// Get looks up a key's value from the cache.
+func (c *SampledCache) Get(key Key) (value interface{}, ok bool) {
+	i, hit := c.items[key]
+	if !hit {
+		return
+	}
+	c.clock++
+	c.entries[i].accessed = c.clock
+	return c.entries[i].value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *SampledCache) Remove(key Key) {
+	if i, hit := c.items[key]; hit {
+		c.removeIndex(i)
+	}
+}
+
+// RemoveOldest removes the least recently used of SampleSize randomly
+// chosen entries from the cache.
+func (c *SampledCache) RemoveOldest() {
+	n := len(c.entries)
+	if n == 0 {
+		return
+	}
+	samples := c.SampleSize
+	if samples <= 0 {
+		samples = DefaultSampleSize
+	}
+	victim := -1
+	if samples >= n {
+		for i := range c.entries {
+			if victim < 0 || c.entries[i].accessed < c.entries[victim].accessed {
+				victim = i
+			}
+		}
+	} else {
+		for s := 0; s < samples; s++ {
+			i := int(c.random() % uint64(n))
+			if victim < 0 || c.entries[i].accessed < c.entries[victim].accessed {
+				victim = i
+			}
+		}
+	}
+	c.removeIndex(victim)
+}
+
+// Len returns the number of items in the cache.
+func (c *SampledCache) Len() int {
+	return len(c.items)
+}
+
+// Clear purges all stored items from the cache.
+func (c *SampledCache) Clear() {
+	if c.OnEvicted != nil {
+		for _, e := range c.entries {
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	c.entries = nil
+	c.items = nil
+}
+
+// removeIndex removes the entry at i, moving the last entry into
+// its place.
+func (c *SampledCache) removeIndex(i int) {
+	e := c.entries[i]
+	last := len(c.entries) - 1
+	if i != last {
+		c.entries[i] = c.entries[last]
+		c.items[c.entries[i].key] = i
+	}
+	c.entries[last] = sampledEntry{}
+	c.entries = c.entries[:last]
+	delete(c.items, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// random returns the next value of a xorshift64* generator, which is
+// cheaper than math/rand and needs no locking.
+func (c *SampledCache) random() uint64 {
+	if c.rng == 0 {
+		c.rng = 0x9e3779b97f4a7c15
+	}
+	c.rng ^= c.rng >> 12
+	c.rng ^= c.rng << 25
+	c.rng ^= c.rng >> 27
+	return c.rng * 0x2545f4914f6cdd1d
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSampledGet(t *testing.T) {
+	for _, tt := range getTests {
+		sc := NewSampled(0)
+		sc.Add(tt.keyToAdd, 1234)
+		val, ok := sc.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestSampledEvict(t *testing.T) {
+	var evictedKeys []Key
+	sc := NewSampled(3)
+	sc.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	// With more samples than entries, eviction is exact LRU.
+	sc.Add("a", 1)
+	sc.Add("b", 2)
+	sc.Add("c", 3)
+	sc.Get("a")
+	sc.Add("d", 4)
+	sc.Add("e", 5)
+	if got, want := fmt.Sprint(evictedKeys), "[b c]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	sc.Remove("a")
+	if _, ok := sc.Get("a"); ok || sc.Len() != 2 {
+		t.Fatalf("after Remove, Len() = %d; want 2", sc.Len())
+	}
+	if v, ok := sc.Get("e"); !ok || v != 5 {
+		t.Fatalf("Get(e) = %v, %v; want 5, true", v, ok)
+	}
+}
+
+func TestSampledApproximatesLRU(t *testing.T) {
+	const max = 1000
+	sc := NewSampled(max)
+	for i := 0; i < max; i++ {
+		sc.Add(i, i)
+	}
+	// Touch the newer half, then make room for a quarter more.
+	for i := max / 2; i < max; i++ {
+		sc.Get(i)
+	}
+	for i := max; i < max+max/4; i++ {
+		sc.Add(i, i)
+	}
+	hot := 0
+	for i := max / 2; i < max; i++ {
+		if _, ok := sc.Get(i); ok {
+			hot++
+		}
+	}
+	// Sampling five keeps nearly all of the recently used half.
+	if hot < max/2*9/10 {
+		t.Fatalf("kept %d of %d recently used entries", hot, max/2)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ShardedCache is an LRU cache that is safe for concurrent access.
+// Keys are hashed across a fixed number of shards, each of which is
+// an independently locked Cache, so callers operating on different
+// shards do not contend on a single lock. Recency is tracked per
+// shard, so eviction order is only approximately LRU overall.
+type ShardedCache struct {
+	shards []shard
+}
+
+type shard struct {
+	mu sync.Mutex
+	c  Cache
+}
+
+// NewSharded creates a new ShardedCache with the given number of
+// shards, each holding at most maxEntriesPerShard entries.
+// If maxEntriesPerShard is zero, the shards have no limit.
+func NewSharded(shards, maxEntriesPerShard int) *ShardedCache {
+	if shards <= 0 {
+		panic("lru: NewSharded shards must be positive")
+	}
+	s := &ShardedCache{shards: make([]shard, shards)}
+	for i := range s.shards {
+		s.shards[i].c.MaxEntries = maxEntriesPerShard
+	}
+	return s
+}
+
+func (s *ShardedCache) shardIndex(key Key) int {
+	return int(hashKey(key) % uint32(len(s.shards)))
+}
+
+func (s *ShardedCache) shardFor(key Key) *shard {
+	return &s.shards[s.shardIndex(key)]
+}
+
+// Add adds a value to the cache.
+func (s *ShardedCache) Add(key Key, value interface{}) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	sh.c.Add(key, value)
+	sh.mu.Unlock()
+}
+
+// Get looks up a key's value from the cache.
+func (s *ShardedCache) Get(key Key) (value interface{}, ok bool) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	value, ok = sh.c.Get(key)
+	sh.mu.Unlock()
+	return
+}
+
+// GetWithExpiry is like Get, but also returns when the value expires,
+// or the zero time if it never does.
+func (s *ShardedCache) GetWithExpiry(key Key) (value interface{}, expires time.Time, ok bool) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	value, expires, ok = sh.c.GetWithExpiry(key)
+	sh.mu.Unlock()
+	return
+}
+
+// GetOrAdd returns the existing value for key if present. Otherwise,
+// it adds value and returns it. The lookup and the add happen under a
+// single lock, so concurrent callers agree on the value.
+func (s *ShardedCache) GetOrAdd(key Key, value interface{}) (actual interface{}, loaded bool) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	actual, loaded = sh.c.GetOrAdd(key, value)
+	sh.mu.Unlock()
+	return
+}
+
+// AddAll adds all entries to the cache, locking each shard once.
+func (s *ShardedCache) AddAll(entries []Entry) {
+	byShard := make([][]Entry, len(s.shards))
+	for _, e := range entries {
+		i := s.shardIndex(e.Key)
+		byShard[i] = append(byShard[i], e)
+	}
+	for i, batch := range byShard {
+		if len(batch) == 0 {
+			continue
+		}
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.c.AddAll(batch)
+		sh.mu.Unlock()
+	}
+}
+
+// GetAll looks up the values of keys from the cache, locking each
+// shard once. The returned map holds only the keys that were found.
+func (s *ShardedCache) GetAll(keys []Key) map[Key]interface{} {
+	byShard := make([][]Key, len(s.shards))
+	for _, key := range keys {
+		i := s.shardIndex(key)
+		byShard[i] = append(byShard[i], key)
+	}
+	values := make(map[Key]interface{}, len(keys))
+	for i, batch := range byShard {
+		if len(batch) == 0 {
+			continue
+		}
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for _, key := range batch {
+			if v, ok := sh.c.Get(key); ok {
+				values[key] = v
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return values
+}
+
+// Remove removes the provided key from the cache.
+func (s *ShardedCache) Remove(key Key) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	sh.c.Remove(key)
+	sh.mu.Unlock()
+}
+
+// Len returns the number of items in the cache.
+func (s *ShardedCache) Len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		n += sh.c.Len()
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// Clear purges all stored items from the cache.
+func (s *ShardedCache) Clear() {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.c.Clear()
+		sh.mu.Unlock()
+	}
+}
+
+// hashKey returns a 32-bit FNV-1a hash of key. Common key types are
+// hashed directly; other comparable types are hashed through their
+// fmt representation.
+func hashKey(key Key) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	var s string
+	switch k := key.(type) {
+	case string:
+		s = k
+	case int:
+		return hashUint64(uint64(k))
+	case int64:
+		return hashUint64(uint64(k))
+	case uint64:
+		return hashUint64(k)
+	case int32:
+		return hashUint64(uint64(k))
+	case uint32:
+		return hashUint64(uint64(k))
+	default:
+		s = fmt.Sprintf("%T:%v", key, key)
+	}
+	h := uint32(offset32)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= prime32
+	}
+	return h
+}
+
+func hashUint64(x uint64) uint32 {
+	// Finalizer from MurmurHash3 to spread sequential integers.
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return uint32(x)
+}
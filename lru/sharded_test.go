@@ -0,0 +1,117 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestShardedGet(t *testing.T) {
+	for _, tt := range getTests {
+		lru := NewSharded(4, 0)
+		lru.Add(tt.keyToAdd, 1234)
+		val, ok := lru.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	const (
+		shards    = 8
+		perShard  = 16
+		goroutine = 8
+		keys      = 1000
+	)
+	lru := NewSharded(shards, perShard)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutine; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				key := fmt.Sprintf("key-%d-%d", g, i)
+				lru.Add(key, i)
+				lru.Get(key)
+				if i%3 == 0 {
+					lru.Remove(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := lru.Len(); n > shards*perShard {
+		t.Fatalf("got %d entries; want at most %d", n, shards*perShard)
+	}
+	lru.Clear()
+	if n := lru.Len(); n != 0 {
+		t.Fatalf("got %d entries after Clear; want 0", n)
+	}
+}
+
+func TestShardedAddAllGetAll(t *testing.T) {
+	lru := NewSharded(4, 0)
+	var entries []Entry
+	var keys []Key
+	for i := 0; i < 100; i++ {
+		entries = append(entries, Entry{i, i * 2})
+		keys = append(keys, i)
+	}
+	lru.AddAll(entries)
+	got := lru.GetAll(append(keys, "missing"))
+	if len(got) != 100 {
+		t.Fatalf("GetAll found %d keys; want 100", len(got))
+	}
+	for i := 0; i < 100; i++ {
+		if got[i] != i*2 {
+			t.Fatalf("GetAll[%d] = %v; want %d", i, got[i], i*2)
+		}
+	}
+}
+
+func TestShardedGetOrAdd(t *testing.T) {
+	lru := NewSharded(4, 0)
+	const goroutines = 8
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		actuals = make(map[interface{}]bool)
+		added   int
+	)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			v, loaded := lru.GetOrAdd("key", g)
+			mu.Lock()
+			actuals[v] = true
+			if !loaded {
+				added++
+			}
+			mu.Unlock()
+		}(g)
+	}
+	wg.Wait()
+	if added != 1 || len(actuals) != 1 {
+		t.Fatalf("added %d values, saw %d distinct; want 1 and 1", added, len(actuals))
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "container/list"
+
+// DefaultProtectedRatio is the share of an SLRUCache reserved for the
+// protected segment when ProtectedRatio is zero.
+const DefaultProtectedRatio = 0.8
+
+// SLRUCache is a segmented LRU cache. New entries land in a probation
+// segment and are promoted to a protected segment on their second hit,
+// so a scan of keys that are used once only churns the probation
+// segment. Entries pushed out of the protected segment are demoted to
+// the front of the probation segment. It is not safe for concurrent
+// access.
+type SLRUCache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit, in which case the
+	// segment sizes are relative to the current number of entries.
+	MaxEntries int
+
+	// ProtectedRatio is the share of entries, strictly between 0
+	// and 1, that the protected segment may hold, leaving room on
+	// probation for new entries. Zero, or a value outside that
+	// range, means DefaultProtectedRatio.
+	ProtectedRatio float64
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	probation, protected *list.List
+	items                map[interface{}]*list.Element
+}
+
+type slruEntry struct {
+	key       Key
+	value     interface{}
+	protected bool
+}
+
+// NewSLRU creates a new SLRUCache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller. protectedRatio must be zero or
+// between 0 and 1.
+func NewSLRU(maxEntries int, protectedRatio float64) *SLRUCache {
+	if protectedRatio < 0 || protectedRatio >= 1 {
+		panic("lru: NewSLRU protectedRatio must be in [0, 1)")
+	}
+	c := &SLRUCache{MaxEntries: maxEntries, ProtectedRatio: protectedRatio}
+	c.init()
+	return c
+}
+
+func (c *SLRUCache) init() {
+	c.probation, c.protected = list.New(), list.New()
+	c.items = make(map[interface{}]*list.Element)
+}
+
+// Add adds a value to the cache. Adding a key that is already
+// present counts as a hit.
+func (c *SLRUCache) Add(key Key, value interface{}) {
+	if c.items == nil {
+		c.init()
+	}
+	if ele, ok := c.items[key]; ok {
+		ele.Value.(*slruEntry).value = value
+		c.hit(ele)
+		return
+	}
+	c.items[key] = c.probation.PushFront(&slruEntry{key: key, value: value})
+	if c.MaxEntries != 0 && c.Len() > c.MaxEntries {
+		c.RemoveOldest()
+	}
+}
+
+// Get looks up a key's value from the cache.
+func (c *SLRUCache) Get(key Key) (value interface{}, ok bool) {
+	if c.items == nil {
+		return
+	}
+	ele, hit := c.items[key]
+	if !hit {
+		return
+	}
+	c.hit(ele)
+	return ele.Value.(*slruEntry).value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *SLRUCache) Remove(key Key) {
+	if c.items == nil {
+		return
+	}
+	if ele, hit := c.items[key]; hit {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveOldest removes the least recently used probation entry, or
+// the least recently used protected entry if probation is empty.
+func (c *SLRUCache) RemoveOldest() {
+	if c.items == nil {
+		return
+	}
+	if ele := c.oldest(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// Victim implements Victimer.
+func (c *SLRUCache) Victim() (key Key, ok bool) {
+	if c.items == nil {
+		return nil, false
+	}
+	if ele := c.oldest(); ele != nil {
+		return ele.Value.(*slruEntry).key, true
+	}
+	return nil, false
+}
+
+// oldest returns the element RemoveOldest removes: the least recently
+// used one on probation, or in the protected segment if probation is
+// empty.
+func (c *SLRUCache) oldest() *list.Element {
+	if ele := c.probation.Back(); ele != nil {
+		return ele
+	}
+	return c.protected.Back()
+}
+
+// Len returns the number of items in the cache.
+func (c *SLRUCache) Len() int {
+	if c.items == nil {
+		return 0
+	}
+	return len(c.items)
+}
+
+// ProtectedLen returns the number of items in the protected segment.
+func (c *SLRUCache) ProtectedLen() int {
+	if c.items == nil {
+		return 0
+	}
+	return c.protected.Len()
+}
+
+// Clear purges all stored items from the cache.
+func (c *SLRUCache) Clear() {
+	if c.OnEvicted != nil {
+		for _, ele := range c.items {
+			e := ele.Value.(*slruEntry)
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	c.probation, c.protected = nil, nil
+	c.items = nil
+}
+
+func (c *SLRUCache) protectedCap() int {
+	ratio := c.ProtectedRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = DefaultProtectedRatio
+	}
+	n := c.MaxEntries
+	if n == 0 {
+		n = c.Len()
+	}
+	return int(ratio * float64(n))
+}
+
+// hit promotes ele to the front of the protected segment, demoting
+// protected entries beyond its capacity back to probation.
+func (c *SLRUCache) hit(ele *list.Element) {
+	e := ele.Value.(*slruEntry)
+	if e.protected {
+		c.protected.MoveToFront(ele)
+		return
+	}
+	c.probation.Remove(ele)
+	e.protected = true
+	c.items[e.key] = c.protected.PushFront(e)
+	for c.protected.Len() > 1 && c.protected.Len() > c.protectedCap() {
+		back := c.protected.Back()
+		d := c.protected.Remove(back).(*slruEntry)
+		d.protected = false
+		c.items[d.key] = c.probation.PushFront(d)
+	}
+}
+
+func (c *SLRUCache) removeElement(ele *list.Element) {
+	e := ele.Value.(*slruEntry)
+	if e.protected {
+		c.protected.Remove(ele)
+	} else {
+		c.probation.Remove(ele)
+	}
+	delete(c.items, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "testing"
+
+func TestSLRUGet(t *testing.T) {
+	for _, tt := range getTests {
+		slru := NewSLRU(0, 0)
+		slru.Add(tt.keyToAdd, 1234)
+		val, ok := slru.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestSLRUScanResistance(t *testing.T) {
+	if n := scan(NewSLRU(10, 0.5)); n != 5 {
+		t.Fatalf("SLRU kept %d hot keys; want 5", n)
+	}
+}
+
+func TestSLRUDemote(t *testing.T) {
+	var evictedKeys []Key
+	slru := NewSLRU(4, 0.5)
+	slru.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		slru.Add(k, k)
+		slru.Get(k)
+	}
+	// The protected segment holds 2 entries, so promoting c demoted a.
+	if n := slru.ProtectedLen(); n != 2 {
+		t.Fatalf("protected segment has %d entries; want 2", n)
+	}
+	slru.Add("d", "d")
+	slru.Add("e", "e")
+	if len(evictedKeys) != 1 || evictedKeys[0] != Key("a") {
+		t.Fatalf("evicted keys = %v; want [a]", evictedKeys)
+	}
+	slru.Clear()
+	if slru.Len() != 0 || len(evictedKeys) != 5 {
+		t.Fatalf("got %d entries, %d evictions; want 0, 5", slru.Len(), len(evictedKeys))
+	}
+}
+
+func TestSLRUProtectedRatio(t *testing.T) {
+	// A ratio of 1 would leave no room on probation, so that every
+	// new key was evicted as soon as it was added.
+	for _, ratio := range []float64{1, 2, -1} {
+		slru := &SLRUCache{MaxEntries: 4, ProtectedRatio: ratio}
+		for _, k := range []string{"a", "b", "c", "d"} {
+			slru.Add(k, k)
+			slru.Get(k)
+		}
+		slru.Add("new", "new")
+		if _, ok := slru.Get("new"); !ok {
+			t.Errorf("ratio %v: a new key was evicted at once", ratio)
+		}
+		// DefaultProtectedRatio of 4 entries.
+		if n := slru.ProtectedLen(); n > 3 {
+			t.Errorf("ratio %v: protected segment has %d entries; want at most 3", ratio, n)
+		}
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewSLRU(4, %v) did not panic", ratio)
+				}
+			}()
+			NewSLRU(4, ratio)
+		}()
+	}
+}
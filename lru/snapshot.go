@@ -0,0 +1,141 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+)
+
+// snapshotVersion is the version of the Snapshot format.
+const snapshotVersion = 1
+
+// A ValueCodec serializes cache values for Snapshot and Restore.
+type ValueCodec interface {
+	EncodeValue(value interface{}) ([]byte, error)
+	DecodeValue(data []byte) (interface{}, error)
+}
+
+type snapshotHeader struct {
+	Version    int
+	MaxEntries int
+	MaxBytes   int64
+	Count      int
+}
+
+type snapshotEntry struct {
+	Key     Key
+	Value   interface{} // if the snapshot has no codec
+	Data    []byte      // if the snapshot has a codec
+	Expires time.Time
+}
+
+// Snapshot writes the unexpired items in the cache to w, from the
+// least to the most recently used, so that Restore reproduces their
+// order. Keys are gob-encoded. Values are encoded with codec, or
+// gob-encoded if codec is nil. As with any gob-encoded interface
+// value, the concrete types of keys and values other than basic
+// types must be registered with gob.Register.
+func (c *Cache) Snapshot(w io.Writer, codec ValueCodec) error {
+	var entries []*entry
+	if c.cache != nil {
+		entries = make([]*entry, 0, c.ll.Len())
+		for e := c.ll.Back(); e != nil; e = e.Prev() {
+			if kv := e.Value.(*entry); !c.expired(kv) {
+				entries = append(entries, kv)
+			}
+		}
+	}
+	enc := gob.NewEncoder(w)
+	err := enc.Encode(&snapshotHeader{
+		Version:    snapshotVersion,
+		MaxEntries: c.MaxEntries,
+		MaxBytes:   c.MaxBytes,
+		Count:      len(entries),
+	})
+	if err != nil {
+		return err
+	}
+	for _, kv := range entries {
+		se := snapshotEntry{Key: kv.key, Expires: kv.expires}
+		if codec != nil {
+			if se.Data, err = codec.EncodeValue(kv.value); err != nil {
+				return fmt.Errorf("lru: encoding value for key %v: %v", kv.key, err)
+			}
+		} else {
+			se.Value = kv.value
+		}
+		if err := enc.Encode(&se); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore creates a new Cache with the limits and items of a snapshot
+// written by Snapshot with the same codec. Items that expired since
+// the snapshot was taken are skipped.
+func Restore(r io.Reader, codec ValueCodec) (*Cache, error) {
+	c := New(0)
+	if err := c.load(r, codec, true); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load adds the items of a snapshot written by Snapshot with the same
+// codec to c, keeping c's own limits and callbacks. Items that
+// expired since the snapshot was taken are skipped.
+func (c *Cache) Load(r io.Reader, codec ValueCodec) error {
+	return c.load(r, codec, false)
+}
+
+func (c *Cache) load(r io.Reader, codec ValueCodec, limits bool) error {
+	dec := gob.NewDecoder(r)
+	var h snapshotHeader
+	if err := dec.Decode(&h); err != nil {
+		return err
+	}
+	if h.Version != snapshotVersion {
+		return fmt.Errorf("lru: unsupported snapshot version %d", h.Version)
+	}
+	if limits {
+		c.MaxEntries = h.MaxEntries
+		c.MaxBytes = h.MaxBytes
+	}
+	for i := 0; i < h.Count; i++ {
+		var se snapshotEntry
+		if err := dec.Decode(&se); err != nil {
+			return err
+		}
+		now := c.timeNow()
+		if !se.Expires.IsZero() && !now.Before(se.Expires) {
+			continue
+		}
+		value := se.Value
+		if codec != nil {
+			var err error
+			if value, err = codec.DecodeValue(se.Data); err != nil {
+				return fmt.Errorf("lru: decoding value for key %v: %v", se.Key, err)
+			}
+		}
+		c.add(se.Key, value, se.Expires, now, nil)
+	}
+	return nil
+}
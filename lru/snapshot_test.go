@@ -0,0 +1,105 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	lru := New(10)
+	lru.MaxBytes = 1 << 10
+	for i := 0; i < 4; i++ {
+		lru.Add(fmt.Sprintf("key%d", i), i)
+	}
+	lru.AddWithTTL("ttl", 99, time.Hour)
+	lru.AddWithTTL("gone", 0, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	lru.Get("key1")
+
+	var buf bytes.Buffer
+	if err := lru.Snapshot(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := Restore(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(restored.Keys()), "[key1 ttl key3 key2 key0]"; got != want {
+		t.Fatalf("restored keys = %v; want %v", got, want)
+	}
+	if v, ok := restored.Get("key2"); !ok || v != 2 {
+		t.Fatalf("restored Get(key2) = %v, %v; want 2, true", v, ok)
+	}
+	if restored.MaxEntries != 10 || restored.MaxBytes != 1<<10 {
+		t.Fatalf("restored limits = %d, %d; want 10, 1024", restored.MaxEntries, restored.MaxBytes)
+	}
+	if info, _ := restored.EntryInfo("ttl"); info.Expires.IsZero() {
+		t.Fatal("restored entry lost its expiration")
+	}
+}
+
+// upperCodec stores string values upper-cased, to show that the
+// codec is used in both directions.
+type upperCodec struct{}
+
+func (upperCodec) EncodeValue(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	return []byte(strings.ToUpper(s)), nil
+}
+
+func (upperCodec) DecodeValue(data []byte) (interface{}, error) {
+	return strings.ToLower(string(data)) + "!", nil
+}
+
+func TestSnapshotCodec(t *testing.T) {
+	lru := New(0)
+	lru.Add("a", "hello")
+	var buf bytes.Buffer
+	if err := lru.Snapshot(&buf, upperCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("HELLO")) {
+		t.Fatal("snapshot does not hold the encoded value")
+	}
+
+	// Load keeps the destination cache's limits.
+	dst := New(1)
+	dst.Add("b", "other")
+	if err := dst.Load(&buf, upperCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := dst.Get("a"); !ok || v != "hello!" {
+		t.Fatalf("Get(a) = %v, %v; want hello!, true", v, ok)
+	}
+	if dst.Len() != 1 {
+		t.Fatalf("got %d entries; want 1", dst.Len())
+	}
+
+	lru.Add("bad", 1)
+	if err := lru.Snapshot(&buf, upperCodec{}); err == nil {
+		t.Fatal("Snapshot ignored a codec error")
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+// TinyLFU is an approximate frequency counter for cache admission, as
+// described by Einziger, Friedman and Manes. A doorkeeper bloom filter
+// absorbs the first occurrence of every key, so one-hit wonders never
+// reach the count-min sketch that counts repeated occurrences. All
+// counts are periodically halved so that the estimates favor recent
+// popularity. It is not safe for concurrent access.
+type TinyLFU struct {
+	mask      uint32 // counters per row, minus one
+	rows      [sketchDepth][]uint8
+	door      []uint64
+	additions int
+	resetAt   int
+}
+
+const (
+	sketchDepth = 4
+	maxCount    = 15
+)
+
+// NewTinyLFU creates a new TinyLFU sized to track about samples
+// distinct keys.
+func NewTinyLFU(samples int) *TinyLFU {
+	if samples <= 0 {
+		panic("lru: NewTinyLFU samples must be positive")
+	}
+	width := uint32(1)
+	for int(width) < samples {
+		width <<= 1
+	}
+	t := &TinyLFU{
+		mask:    width - 1,
+		door:    make([]uint64, (width+63)/64),
+		resetAt: 10 * samples,
+	}
+	for i := range t.rows {
+		t.rows[i] = make([]uint8, width)
+	}
+	return t
+}
+
+// Increment records an occurrence of key.
+func (t *TinyLFU) Increment(key string) {
+	h1, h2 := hashPair(key)
+	if !t.doorAdd(h1, h2) {
+		// Conservative update: only raise the smallest counters.
+		min := t.sketchEstimate(h1, h2)
+		if min < maxCount {
+			for i := range t.rows {
+				c := &t.rows[i][t.index(h1, h2, i)]
+				if *c == min {
+					*c++
+				}
+			}
+		}
+	}
+	t.additions++
+	if t.additions >= t.resetAt {
+		t.reset()
+	}
+}
+
+// Estimate returns the estimated number of recent occurrences of key.
+func (t *TinyLFU) Estimate(key string) int {
+	h1, h2 := hashPair(key)
+	n := int(t.sketchEstimate(h1, h2))
+	if t.doorContains(h1, h2) {
+		n++
+	}
+	return n
+}
+
+func (t *TinyLFU) index(h1, h2 uint32, i int) uint32 {
+	return (h1 + uint32(i)*h2) & t.mask
+}
+
+func (t *TinyLFU) sketchEstimate(h1, h2 uint32) uint8 {
+	min := uint8(maxCount)
+	for i := range t.rows {
+		if c := t.rows[i][t.index(h1, h2, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// doorAdd adds the key hashed to h1, h2 to the doorkeeper and reports
+// whether it was absent.
+func (t *TinyLFU) doorAdd(h1, h2 uint32) bool {
+	added := false
+	for i := 0; i < sketchDepth; i++ {
+		bit := t.index(h1, h2, i)
+		w, m := bit/64, uint64(1)<<(bit%64)
+		if t.door[w]&m == 0 {
+			t.door[w] |= m
+			added = true
+		}
+	}
+	return added
+}
+
+func (t *TinyLFU) doorContains(h1, h2 uint32) bool {
+	for i := 0; i < sketchDepth; i++ {
+		bit := t.index(h1, h2, i)
+		if t.door[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// reset halves all counters and clears the doorkeeper.
+func (t *TinyLFU) reset() {
+	for i := range t.rows {
+		for j := range t.rows[i] {
+			t.rows[i][j] >>= 1
+		}
+	}
+	for i := range t.door {
+		t.door[i] = 0
+	}
+	t.additions /= 2
+}
+
+// hashPair returns two independent 32-bit hashes of s, taken from a
+// 64-bit FNV-1a hash, for double hashing.
+func hashPair(s string) (uint32, uint32) {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return uint32(h), uint32(h>>32) | 1
+}
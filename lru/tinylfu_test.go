@@ -0,0 +1,60 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTinyLFUEstimate(t *testing.T) {
+	lfu := NewTinyLFU(1000)
+	if n := lfu.Estimate("hot"); n != 0 {
+		t.Fatalf("Estimate before any Increment = %d; want 0", n)
+	}
+	for i := 0; i < 5; i++ {
+		lfu.Increment("hot")
+	}
+	lfu.Increment("once")
+	if n := lfu.Estimate("hot"); n != 5 {
+		t.Errorf("Estimate(hot) = %d; want 5", n)
+	}
+	if n := lfu.Estimate("once"); n != 1 {
+		t.Errorf("Estimate(once) = %d; want 1", n)
+	}
+	for i := 0; i < 100; i++ {
+		lfu.Increment("hot")
+	}
+	if n := lfu.Estimate("hot"); n != maxCount+1 {
+		t.Errorf("Estimate(hot) = %d; want saturation at %d", n, maxCount+1)
+	}
+}
+
+func TestTinyLFUReset(t *testing.T) {
+	const samples = 100
+	lfu := NewTinyLFU(samples)
+	for i := 0; i < 8; i++ {
+		lfu.Increment("hot")
+	}
+	// Flood with enough one-hit wonders for the sketch to age once.
+	for i := 0; i < lfu.resetAt; i++ {
+		lfu.Increment(fmt.Sprintf("cold-%d", i))
+	}
+	if n := lfu.Estimate("hot"); n < 3 || n > 4 {
+		t.Errorf("Estimate(hot) after reset = %d; want about half of 8", n)
+	}
+}
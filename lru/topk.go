@@ -0,0 +1,134 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// TopK finds the most frequent keys of a stream in fixed space, using
+// the Space-Saving algorithm of Metwally, Agrawal and El Abbadi. It
+// counts at most Capacity keys; a new key replaces the least frequent
+// one and inherits its count, so counts may be overestimated, by at
+// most the Err of each KeyCount. It is not safe for concurrent access.
+type TopK struct {
+	capacity int
+	entries  map[string]*topKEntry
+	heap     topKHeap // least frequent first
+}
+
+// A KeyCount is a key and its estimated number of occurrences.
+type KeyCount struct {
+	Key   string
+	Count int64
+	Err   int64 // maximum overestimation of Count
+}
+
+type topKEntry struct {
+	KeyCount
+	index int // in heap
+}
+
+// NewTopK creates a new TopK that counts up to capacity keys.
+func NewTopK(capacity int) *TopK {
+	if capacity <= 0 {
+		panic("lru: NewTopK capacity must be positive")
+	}
+	return &TopK{
+		capacity: capacity,
+		entries:  make(map[string]*topKEntry, capacity),
+	}
+}
+
+// Add records an occurrence of key.
+func (t *TopK) Add(key string) {
+	if e, ok := t.entries[key]; ok {
+		e.Count++
+		heap.Fix(&t.heap, e.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		e := &topKEntry{KeyCount: KeyCount{Key: key, Count: 1}}
+		t.entries[key] = e
+		heap.Push(&t.heap, e)
+		return
+	}
+	e := t.heap[0]
+	delete(t.entries, e.Key)
+	e.Key = key
+	e.Err = e.Count
+	e.Count++
+	t.entries[key] = e
+	heap.Fix(&t.heap, 0)
+}
+
+// Top returns up to n of the most frequent keys, most frequent first.
+// It returns nil if n <= 0.
+func (t *TopK) Top(n int) []KeyCount {
+	if n <= 0 {
+		return nil
+	}
+	top := make([]KeyCount, 0, len(t.heap))
+	for _, e := range t.heap {
+		top = append(top, e.KeyCount)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	if n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+// Len returns the number of keys being counted.
+func (t *TopK) Len() int {
+	return len(t.heap)
+}
+
+// Reset forgets all counts.
+func (t *TopK) Reset() {
+	t.entries = make(map[string]*topKEntry, t.capacity)
+	t.heap = nil
+}
+
+type topKHeap []*topKEntry
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	e := x.(*topKEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
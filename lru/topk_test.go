@@ -0,0 +1,60 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	tk := NewTopK(3)
+	for i := 0; i < 10; i++ {
+		tk.Add("hot")
+	}
+	for i := 0; i < 5; i++ {
+		tk.Add("warm")
+	}
+	// Each cold key displaces the last, inheriting its count, but
+	// none catches up with warm.
+	for i := 0; i < 4; i++ {
+		tk.Add(fmt.Sprintf("cold-%d", i))
+	}
+	top := tk.Top(2)
+	if len(top) != 2 || top[0].Key != "hot" || top[1].Key != "warm" {
+		t.Fatalf("Top(2) = %+v; want hot, then warm", top)
+	}
+	if top[0].Count != 10 || top[0].Err != 0 {
+		t.Errorf("hot = %+v; want exact count 10", top[0])
+	}
+	if n := tk.Len(); n != 3 {
+		t.Errorf("Len = %d; want capacity 3", n)
+	}
+	for _, n := range []int{0, -1} {
+		if top := tk.Top(n); top != nil {
+			t.Errorf("Top(%d) = %+v; want nil", n, top)
+		}
+	}
+	all := tk.Top(10)
+	if len(all) != 3 || all[2].Key != "cold-3" || all[2].Count != 4 || all[2].Err != 3 {
+		t.Errorf("Top(10) = %+v; want cold-3 last, counted 4 with error 3", all)
+	}
+	tk.Reset()
+	if n := tk.Len(); n != 0 {
+		t.Errorf("Len after Reset = %d; want 0", n)
+	}
+}
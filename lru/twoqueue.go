@@ -0,0 +1,243 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import "container/list"
+
+const (
+	// DefaultInRatio is the share of a TwoQueueCache given to the
+	// a1in queue when InRatio is zero.
+	DefaultInRatio = 0.25
+
+	// DefaultGhostRatio is the size of the a1out ghost queue of a
+	// TwoQueueCache, relative to its capacity, when GhostRatio is
+	// zero.
+	DefaultGhostRatio = 0.5
+)
+
+// TwoQueueCache is a 2Q cache, as described by Johnson and Shasha.
+// New entries enter the a1in FIFO queue. Keys evicted from a1in are
+// remembered in the a1out ghost queue, and only a key that is added
+// again while in a1out is admitted to the am LRU queue. A scan thus
+// only churns a1in. It is not safe for concurrent access.
+type TwoQueueCache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit, in which case the
+	// queue sizes are relative to the current number of entries.
+	MaxEntries int
+
+	// InRatio is the share of entries, between 0 and 1, that the
+	// a1in queue may hold before it is preferred for eviction.
+	// Zero means DefaultInRatio.
+	InRatio float64
+
+	// GhostRatio is the number of keys the a1out queue remembers,
+	// relative to the capacity. Zero means DefaultGhostRatio.
+	GhostRatio float64
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	a1in, a1out, am *list.List
+	items           map[interface{}]*list.Element
+}
+
+type twoQueueEntry struct {
+	key   Key
+	value interface{}
+	ll    *list.List // the queue holding this entry
+}
+
+// NewTwoQueue creates a new TwoQueueCache with the default queue
+// ratios.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func NewTwoQueue(maxEntries int) *TwoQueueCache {
+	c := &TwoQueueCache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *TwoQueueCache) init() {
+	c.a1in, c.a1out, c.am = list.New(), list.New(), list.New()
+	c.items = make(map[interface{}]*list.Element)
+}
+
+// Add adds a value to the cache.
+func (c *TwoQueueCache) Add(key Key, value interface{}) {
+	if c.items == nil {
+		c.init()
+	}
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*twoQueueEntry)
+		switch e.ll {
+		case c.am:
+			e.value = value
+			c.am.MoveToFront(ele)
+			return
+		case c.a1in:
+			e.value = value
+			return
+		}
+		// A ghost hit: the key was evicted from a1in recently.
+		c.a1out.Remove(ele)
+		e.value = value
+		e.ll = c.am
+		c.items[key] = c.am.PushFront(e)
+	} else {
+		e := &twoQueueEntry{key: key, value: value, ll: c.a1in}
+		c.items[key] = c.a1in.PushFront(e)
+	}
+	if c.MaxEntries != 0 && c.Len() > c.MaxEntries {
+		c.RemoveOldest()
+	}
+}
+
+// Get looks up a key's value from the cache.
+func (c *TwoQueueCache) Get(key Key) (value interface{}, ok bool) {
+	if c.items == nil {
+		return
+	}
+	ele, hit := c.items[key]
+	if !hit {
+		return
+	}
+	e := ele.Value.(*twoQueueEntry)
+	switch e.ll {
+	case c.am:
+		c.am.MoveToFront(ele)
+	case c.a1in:
+		// a1in is a FIFO; hits do not reorder it.
+	default:
+		return
+	}
+	return e.value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *TwoQueueCache) Remove(key Key) {
+	if c.items == nil {
+		return
+	}
+	ele, hit := c.items[key]
+	if !hit {
+		return
+	}
+	e := ele.Value.(*twoQueueEntry)
+	e.ll.Remove(ele)
+	delete(c.items, key)
+	if e.ll != c.a1out && c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// RemoveOldest removes the oldest a1in entry if a1in is over its
+// share, and the least recently used am entry otherwise.
+func (c *TwoQueueCache) RemoveOldest() {
+	if c.items == nil || c.Len() == 0 {
+		return
+	}
+	if c.evictsRecent() {
+		ele := c.a1in.Back()
+		e := ele.Value.(*twoQueueEntry)
+		c.a1in.Remove(ele)
+		value := e.value
+		e.value = nil
+		e.ll = c.a1out
+		c.items[e.key] = c.a1out.PushFront(e)
+		c.trimGhosts()
+		if c.OnEvicted != nil {
+			c.OnEvicted(e.key, value)
+		}
+		return
+	}
+	ele := c.am.Back()
+	e := ele.Value.(*twoQueueEntry)
+	c.am.Remove(ele)
+	delete(c.items, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Victim implements Victimer.
+func (c *TwoQueueCache) Victim() (key Key, ok bool) {
+	if c.items == nil || c.Len() == 0 {
+		return nil, false
+	}
+	ll := c.am
+	if c.evictsRecent() {
+		ll = c.a1in
+	}
+	return ll.Back().Value.(*twoQueueEntry).key, true
+}
+
+// evictsRecent reports whether RemoveOldest removes from a1in rather
+// than am. The cache must not be empty.
+func (c *TwoQueueCache) evictsRecent() bool {
+	inRatio := c.InRatio
+	if inRatio == 0 {
+		inRatio = DefaultInRatio
+	}
+	return c.am.Len() == 0 || (c.a1in.Len() > 0 && float64(c.a1in.Len()) > inRatio*float64(c.capacity()))
+}
+
+// Len returns the number of items in the cache.
+func (c *TwoQueueCache) Len() int {
+	if c.items == nil {
+		return 0
+	}
+	return c.a1in.Len() + c.am.Len()
+}
+
+// Clear purges all stored items from the cache.
+func (c *TwoQueueCache) Clear() {
+	if c.OnEvicted != nil && c.items != nil {
+		for _, ll := range []*list.List{c.a1in, c.am} {
+			for ele := ll.Front(); ele != nil; ele = ele.Next() {
+				e := ele.Value.(*twoQueueEntry)
+				c.OnEvicted(e.key, e.value)
+			}
+		}
+	}
+	c.a1in, c.a1out, c.am = nil, nil, nil
+	c.items = nil
+}
+
+func (c *TwoQueueCache) capacity() int {
+	if c.MaxEntries != 0 {
+		return c.MaxEntries
+	}
+	return c.Len()
+}
+
+func (c *TwoQueueCache) trimGhosts() {
+	ratio := c.GhostRatio
+	if ratio == 0 {
+		ratio = DefaultGhostRatio
+	}
+	max := int(ratio * float64(c.capacity()))
+	if max < 1 {
+		max = 1
+	}
+	for c.a1out.Len() > max {
+		ele := c.a1out.Back()
+		c.a1out.Remove(ele)
+		delete(c.items, ele.Value.(*twoQueueEntry).key)
+	}
+}
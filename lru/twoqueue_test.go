@@ -0,0 +1,81 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTwoQueueGet(t *testing.T) {
+	for _, tt := range getTests {
+		q := NewTwoQueue(0)
+		q.Add(tt.keyToAdd, 1234)
+		val, ok := q.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestTwoQueueGhostPromotion(t *testing.T) {
+	var evictedKeys []Key
+	q := NewTwoQueue(4)
+	q.OnEvicted = func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	for i := 0; i < 5; i++ {
+		q.Add(i, i)
+	}
+	if got, want := fmt.Sprint(evictedKeys), "[0]"; got != want {
+		t.Fatalf("evicted keys = %v; want %v", got, want)
+	}
+	if _, ok := q.Get(0); ok {
+		t.Fatal("Get returned a ghost entry")
+	}
+	// Re-adding 0 while it is remembered in a1out admits it to am,
+	// where a scan of new keys cannot reach it.
+	q.Add(0, 0)
+	for i := 10; i < 30; i++ {
+		q.Add(i, i)
+	}
+	if _, ok := q.Get(0); !ok {
+		t.Fatal("scan evicted an entry from am")
+	}
+	if q.Len() != 4 {
+		t.Fatalf("got %d entries; want 4", q.Len())
+	}
+}
+
+func TestTwoQueueScanResistance(t *testing.T) {
+	q := NewTwoQueue(10)
+	// Hot keys reach am through a1out.
+	for i := 0; i < 5; i++ {
+		q.Add(fmt.Sprintf("hot%d", i), i)
+	}
+	for i := 0; i < 10; i++ {
+		q.Add(fmt.Sprintf("warm%d", i), i)
+	}
+	for i := 0; i < 5; i++ {
+		q.Add(fmt.Sprintf("hot%d", i), i)
+	}
+	if n := scan(q); n != 5 {
+		t.Fatalf("2Q kept %d hot keys; want 5", n)
+	}
+}
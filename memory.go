@@ -0,0 +1,162 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// A MemoryController shrinks the byte limits of groups while the
+// process uses more memory than a target, and grows them back to
+// their configured sizes once it uses less, so that caches give memory
+// back under pressure instead of running the process out of it.
+type MemoryController struct {
+	// Limit is the target memory use, in bytes, as reported by
+	// Signal.
+	Limit uint64
+
+	// Signal optionally reports the memory in use. If nil, the heap
+	// in use from runtime.ReadMemStats is used.
+	Signal func() uint64
+
+	// Interval is how often Run adjusts the limits. If zero, it
+	// defaults to one second.
+	Interval time.Duration
+
+	// MinFraction is the smallest fraction of its configured limit
+	// a group is shrunk to. If zero, it defaults to 1/10.
+	MinFraction float64
+
+	mu     sync.Mutex
+	scale  float64          // fraction of the configured limits in effect
+	groups map[*Group]int64 // configured limits
+}
+
+// NewMemoryController returns a MemoryController that aims to keep the
+// process's heap in use under limit bytes.
+func NewMemoryController(limit uint64) *MemoryController {
+	return &MemoryController{Limit: limit}
+}
+
+// Add puts g under the controller's management. The group's current
+// CacheBytes is taken as its configured limit, which the controller
+// never exceeds.
+func (m *MemoryController) Add(g *Group) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groups == nil {
+		m.groups = make(map[*Group]int64)
+		m.scale = 1
+	}
+	m.groups[g] = g.CacheBytes()
+	g.SetCacheBytes(m.scaled(m.groups[g]))
+}
+
+// Remove restores g's configured limit and stops managing it.
+func (m *MemoryController) Remove(g *Group) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, ok := m.groups[g]; ok {
+		delete(m.groups, g)
+		g.SetCacheBytes(n)
+	}
+}
+
+// Run adjusts the groups' limits every Interval until ctx is done.
+func (m *MemoryController) Run(ctx context.Context) {
+	d := m.Interval
+	if d <= 0 {
+		d = time.Second
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.Adjust()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Adjust checks the memory in use once and resizes the groups' limits:
+// over Limit, they shrink in proportion to the excess; under nine
+// tenths of Limit, they grow by a tenth, back up to their configured
+// sizes.
+func (m *MemoryController) Adjust() {
+	used := m.used()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groups == nil || m.Limit == 0 {
+		return
+	}
+	scale := m.scale
+	switch {
+	case used > m.Limit:
+		scale *= float64(m.Limit) / float64(used)
+		if min := m.minFraction(); scale < min {
+			scale = min
+		}
+	case used < m.Limit/10*9:
+		scale *= 1.1
+		if scale > 1 {
+			scale = 1
+		}
+	}
+	if scale == m.scale {
+		return
+	}
+	m.scale = scale
+	for g, n := range m.groups {
+		g.SetCacheBytes(m.scaled(n))
+	}
+}
+
+// Scale returns the fraction of the groups' configured limits
+// currently in effect.
+func (m *MemoryController) Scale() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groups == nil {
+		return 1
+	}
+	return m.scale
+}
+
+func (m *MemoryController) scaled(n int64) int64 {
+	return int64(float64(n) * m.scale)
+}
+
+func (m *MemoryController) minFraction() float64 {
+	if m.MinFraction > 0 {
+		return m.MinFraction
+	}
+	return 0.1
+}
+
+func (m *MemoryController) used() uint64 {
+	if m.Signal != nil {
+		return m.Signal()
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapInuse
+}
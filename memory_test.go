@@ -0,0 +1,57 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryController(t *testing.T) {
+	g := NewGroup("memory-controller-group", 1000, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}))
+	used := uint64(100)
+	m := NewMemoryController(100)
+	m.Signal = func() uint64 { return used }
+	m.Add(g)
+
+	used = 200
+	m.Adjust()
+	if got := g.CacheBytes(); got != 500 {
+		t.Errorf("CacheBytes at twice the limit = %d; want 500", got)
+	}
+	used = 10000
+	m.Adjust()
+	if got := g.CacheBytes(); got != 100 {
+		t.Errorf("CacheBytes far over the limit = %d; want the 1/10 floor, 100", got)
+	}
+	used = 50
+	for i := 0; i < 100; i++ {
+		m.Adjust()
+	}
+	if got := g.CacheBytes(); got != 1000 {
+		t.Errorf("CacheBytes after pressure eased = %d; want 1000", got)
+	}
+
+	used = 200
+	m.Adjust()
+	m.Remove(g)
+	if got := g.CacheBytes(); got != 1000 {
+		t.Errorf("CacheBytes after Remove = %d; want 1000", got)
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+)
+
+// nsSep separates the namespace from the key in the keys that GetNS
+// caches and sends to peers.
+const nsSep = "\x00"
+
+// cacheKey returns the form of key, in namespace ns, under which it is
+// cached, deduplicated and sent to peers. A key in a namespace is
+// nsSep+ns+nsSep+key. Of the keys in no namespace, those that begin
+// with nsSep get another nsSep in front and the rest are kept as they
+// are, so a key passed to Get never takes the form of a namespaced
+// one.
+func cacheKey(ns, key string) string {
+	if ns != "" {
+		return nsSep + ns + nsSep + key
+	}
+	if strings.HasPrefix(key, nsSep) {
+		return nsSep + key
+	}
+	return key
+}
+
+// userKey returns the key that cacheKey made k from, in namespace ns.
+func userKey(ns, k string) string {
+	if ns != "" {
+		return k[len(ns)+2*len(nsSep):]
+	}
+	return strings.TrimPrefix(k, nsSep)
+}
+
+// validKey reports whether k can have been made by cacheKey in
+// namespace ns. It checks the keys of peers' requests.
+func validKey(ns, k string) bool {
+	if ns == "" {
+		return !strings.HasPrefix(k, nsSep) || strings.HasPrefix(k, nsSep+nsSep)
+	}
+	return !strings.Contains(ns, nsSep) && strings.HasPrefix(k, nsSep+ns+nsSep)
+}
+
+// splitCacheKey returns the namespace and key that cacheKey made k
+// from.
+func splitCacheKey(k string) (ns, key string) {
+	if strings.HasPrefix(k, nsSep) && !strings.HasPrefix(k, nsSep+nsSep) {
+		if i := strings.Index(k[len(nsSep):], nsSep); i >= 0 {
+			ns = k[len(nsSep) : len(nsSep)+i]
+			return ns, userKey(ns, k)
+		}
+	}
+	return "", userKey("", k)
+}
+
+// errKeyNamespace is returned to a peer whose request has a key that
+// doesn't belong to the request's namespace.
+var errKeyNamespace = errors.New("groupcache: key does not match namespace")
+
+type nsContextKey struct{}
+
+// Namespace returns the namespace of the key a Getter is asked to
+// load, as passed to Group.GetNS. It returns "" for keys requested
+// with Get.
+func Namespace(ctx context.Context) string {
+	ns, _ := ctx.Value(nsContextKey{}).(string)
+	return ns
+}
+
+// GetNS is like Get, but looks up key within namespace ns, so one
+// group can hold several logical datasets whose keys may collide. The
+// Getter receives key unchanged and can find ns with Namespace(ctx).
+// Each namespace has its own NamespaceStats and, optionally, a byte
+// quota in GroupOptions.NamespaceQuotas. An empty ns is the same as
+// Get.
+func (g *Group) GetNS(ctx context.Context, ns, key string, dest Sink) error {
+	if ns == "" {
+		return g.Get(ctx, key, dest)
+	}
+	if strings.Contains(ns, nsSep) {
+		return errors.New("groupcache: namespace contains NUL byte")
+	}
+	return g.get(ctx, cacheKey(ns, key), dest, GetOptions{namespace: ns})
+}
+
+// NamespaceStats are per-namespace statistics of a group, returned
+// by Group.NamespaceStats.
+type NamespaceStats struct {
+	Gets      int64
+	CacheHits int64
+	Loads     int64 // after singleflight
+	Bytes     int64 // of the namespace's keys and values in the caches
+	Items     int64
+}
+
+// NamespaceStats returns statistics about namespace ns of the group.
+func (g *Group) NamespaceStats(ns string) NamespaceStats {
+	g.nsMu.Lock()
+	defer g.nsMu.Unlock()
+	n := g.namespaces[ns]
+	if n == nil {
+		return NamespaceStats{}
+	}
+	return NamespaceStats{
+		Gets:      n.gets.Get(),
+		CacheHits: n.hits.Get(),
+		Loads:     n.loads.Get(),
+		Bytes:     n.bytes,
+		Items:     int64(n.entries.Len()),
+	}
+}
+
+// namespace tracks the stats and cache usage of one namespace.
+type namespace struct {
+	gets, hits, loads AtomicInt
+
+	// The rest is guarded by Group.nsMu.
+	bytes   int64
+	entries *list.List // of *nsEntry, oldest first
+	byKey   map[nsEntryKey]*list.Element
+}
+
+type nsEntryKey struct {
+	c   *cache
+	key string
+}
+
+type nsEntry struct {
+	nsEntryKey
+	size int64
+}
+
+// namespaceOf returns namespace ns, creating it if needed, or nil if
+// ns is "". Namespaces are only named by GetNS, locally or through a
+// peer, so the keys passed to Get can't create them.
+func (g *Group) namespaceOf(ns string) *namespace {
+	if ns == "" {
+		return nil
+	}
+	g.nsMu.Lock()
+	defer g.nsMu.Unlock()
+	return g.namespaceLocked(ns)
+}
+
+func (g *Group) namespaceLocked(ns string) *namespace {
+	n := g.namespaces[ns]
+	if n == nil {
+		n = &namespace{
+			entries: list.New(),
+			byKey:   make(map[nsEntryKey]*list.Element),
+		}
+		if g.namespaces == nil {
+			g.namespaces = make(map[string]*namespace)
+		}
+		g.namespaces[ns] = n
+	}
+	return n
+}
+
+// nsAdded and nsRemoved are called by c, with its lock held, as keys
+// of namespace ns are added to and removed from it.
+func (g *Group) nsAdded(c *cache, key, ns string, size int64) {
+	if ns == "" {
+		return
+	}
+	g.nsMu.Lock()
+	defer g.nsMu.Unlock()
+	n := g.namespaceLocked(ns)
+	k := nsEntryKey{c, key}
+	if el, ok := n.byKey[k]; ok {
+		n.forgetLocked(el)
+	}
+	n.byKey[k] = n.entries.PushBack(&nsEntry{nsEntryKey: k, size: size})
+	n.bytes += size
+}
+
+func (g *Group) nsRemoved(c *cache, key, ns string, size int64) {
+	if ns == "" {
+		return
+	}
+	g.nsMu.Lock()
+	defer g.nsMu.Unlock()
+	if n := g.namespaces[ns]; n != nil {
+		if el, ok := n.byKey[nsEntryKey{c, key}]; ok {
+			n.forgetLocked(el)
+		}
+	}
+}
+
+func (n *namespace) forgetLocked(el *list.Element) {
+	e := n.entries.Remove(el).(*nsEntry)
+	delete(n.byKey, e.nsEntryKey)
+	n.bytes -= e.size
+}
+
+// enforceQuota evicts the oldest entries of namespace ns until it is
+// within its quota.
+func (g *Group) enforceQuota(ns string) {
+	if ns == "" {
+		return
+	}
+	quota := g.opts.NamespaceQuotas[ns]
+	if quota <= 0 {
+		return
+	}
+	for {
+		g.nsMu.Lock()
+		n := g.namespaces[ns]
+		if n == nil || n.bytes <= quota || n.entries.Len() == 0 {
+			g.nsMu.Unlock()
+			return
+		}
+		el := n.entries.Front()
+		e := el.Value.(*nsEntry)
+		g.nsMu.Unlock()
+
+		// Removing the key calls nsRemoved, which must not run
+		// with nsMu held.
+		e.c.remove(e.key)
+
+		g.nsMu.Lock()
+		if n.byKey[e.nsEntryKey] == el {
+			// The cache no longer had it; don't spin on it.
+			n.forgetLocked(el)
+		}
+		g.nsMu.Unlock()
+	}
+}
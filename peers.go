@@ -19,17 +19,67 @@ limitations under the License.
 package groupcache
 
 import (
+	"context"
+	"io"
+	"time"
+
 	pb "github.com/golang/groupcache/groupcachepb"
 )
 
-// Context is an opaque value passed through calls to the
-// ProtoGetter. It may be nil if your ProtoGetter implementation does
-// not require a context.
-type Context interface{}
+// Context is an alias of context.Context, kept for compatibility
+// with code written when groupcache passed an opaque value.
+//
+// Deprecated: use context.Context.
+type Context = context.Context
 
 // ProtoGetter is the interface that must be implemented by a peer.
 type ProtoGetter interface {
-	Get(context Context, in *pb.GetRequest, out *pb.GetResponse) error
+	Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error
+}
+
+// StreamGetter is implemented by ProtoGetters that can stream a value
+// instead of returning it in a single message. Group.Get uses it for
+// values requested with a WriterSink.
+type StreamGetter interface {
+	// GetStream writes the value for the key in the request to w
+	// as it arrives and returns the value's expiration time.
+	GetStream(ctx context.Context, in *pb.GetRequest, w io.Writer) (expire time.Time, err error)
+}
+
+// Remover is implemented by ProtoGetters that can remove a key from a
+// peer's caches. Group.Remove uses it to invalidate the key on its
+// owner and, optionally, on every peer.
+type Remover interface {
+	// Remove removes the key in the request from the peer's
+	// caches.
+	Remove(ctx context.Context, in *pb.GetRequest) error
+}
+
+// Setter is implemented by ProtoGetters that can store a value in a
+// peer's main cache. Group.Set uses it to write through to the key's
+// owner, and a primary owner to copy the values it loads to replicas.
+type Setter interface {
+	// Set stores the value in the request in the peer's main
+	// cache.
+	Set(ctx context.Context, in *pb.SetRequest) error
+}
+
+// BatchGetter is implemented by ProtoGetters that can fetch several
+// keys in one request. Group.GetMulti uses it to make one request per
+// peer; keys of other peers are fetched one by one.
+type BatchGetter interface {
+	// GetMulti fills out with a value or an error for each key in
+	// the request.
+	GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error
+}
+
+// GenerationSetter is implemented by ProtoGetters that can raise a
+// peer's generation of a group. Group.BumpGeneration uses it to
+// invalidate the group on every peer.
+type GenerationSetter interface {
+	// SetGeneration raises the peer's generation of the group in
+	// the request to the one in the request, if it is lower.
+	SetGeneration(ctx context.Context, in *pb.GenerationRequest) error
 }
 
 // PeerPicker is the interface that must be implemented to locate
@@ -41,6 +91,25 @@ type PeerPicker interface {
 	PickPeer(key string) (peer ProtoGetter, ok bool)
 }
 
+// PeerLister is implemented by PeerPickers that can list all of
+// their peers, so that operations like Group.RemoveWithOptions can
+// reach every peer's hot cache.
+type PeerLister interface {
+	// AllPeers returns all peers except the current one.
+	AllPeers() []ProtoGetter
+}
+
+// ReplicaPicker is implemented by PeerPickers that give each key
+// replicas besides its primary owner, the peer returned by PickPeer.
+// When the primary fails to return a key, Group.Get tries the
+// replicas before loading the key locally; a primary copies the
+// values it loads to their replicas.
+type ReplicaPicker interface {
+	// PickReplicas returns the replicas of key other than the
+	// current peer, in the order they should be tried.
+	PickReplicas(key string) []ProtoGetter
+}
+
 // NoPeers is an implementation of PeerPicker that never finds a peer.
 type NoPeers struct{}
 
@@ -0,0 +1,69 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// propagate.go carries request metadata to the peers serving a load.
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+)
+
+// A Propagator carries metadata of a request, such as a trace ID, a
+// tenant ID or end-user credentials, from the context of a load to the
+// peer that serves it, so that a load the owner runs for another peer
+// sees the identity of the request that caused it.
+type Propagator interface {
+	// Inject copies metadata from ctx to the headers of a request
+	// to a peer.
+	Inject(ctx context.Context, h http.Header)
+
+	// Extract returns a copy of ctx carrying the metadata in the
+	// headers of a request from a peer.
+	Extract(ctx context.Context, h http.Header) context.Context
+}
+
+// ContextHeaders returns a Propagator that sends the string values of
+// context keys as headers: each header name in headers is set to the
+// value of its context key, when that is a non-empty string, and the
+// value of a received header is stored under its context key.
+func ContextHeaders(headers map[string]interface{}) Propagator {
+	m := make(contextHeaders, len(headers))
+	for name, key := range headers {
+		m[http.CanonicalHeaderKey(name)] = key
+	}
+	return m
+}
+
+type contextHeaders map[string]interface{}
+
+func (m contextHeaders) Inject(ctx context.Context, h http.Header) {
+	for name, key := range m {
+		if v, ok := ctx.Value(key).(string); ok && v != "" {
+			h.Set(name, v)
+		}
+	}
+}
+
+func (m contextHeaders) Extract(ctx context.Context, h http.Header) context.Context {
+	for name, key := range m {
+		if v := h.Get(name); v != "" {
+			ctx = context.WithValue(ctx, key, v)
+		}
+	}
+	return ctx
+}
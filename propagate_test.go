@@ -0,0 +1,59 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+type tenantKey struct{}
+
+func TestHTTPPropagator(t *testing.T) {
+	prop := ContextHeaders(map[string]interface{}{"x-tenant": tenantKey{}})
+	var got interface{}
+	g := newGroup("TestHTTPPropagator-group", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		got = ctx.Value(tenantKey{})
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, Propagator: prop}})
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, propagator: prop}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	if err := peer.Get(ctx, req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if got != "acme" {
+		t.Errorf("Getter saw tenant %v; want %q", got, "acme")
+	}
+
+	// Loads without the metadata carry none.
+	req.Key = proto.String("other")
+	if err := peer.Get(context.Background(), req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("Getter saw tenant %v; want none", got)
+	}
+}
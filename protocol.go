@@ -0,0 +1,80 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// protocol.go negotiates the version of the peer HTTP protocol.
+
+package groupcache
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ProtocolVersion is the newest version of the peer HTTP protocol
+// that HTTPPool speaks. Each request carries the newest version its
+// sender speaks, and is answered in the newest version both sides
+// speak, so that peers running different releases can serve each
+// other during a rolling upgrade.
+//
+// Version 1 is the protocol of releases that predate versioning:
+// protobuf GetResponse bodies, optionally compressed or streamed as
+// negotiated by the Accept-Encoding and Accept headers. Version 2 adds
+// batch requests for several keys of a group.
+const ProtocolVersion = 2
+
+// batchProtocolVersion is the first version with batch requests.
+const batchProtocolVersion = 2
+
+// minProtocolVersion is the oldest version HTTPPool still speaks.
+const minProtocolVersion = 1
+
+// versionHeader carries the protocol version of a request or response.
+const versionHeader = "X-Groupcache-Version"
+
+// negotiateVersion returns the version to answer a request with the
+// given headers in. Requests without a version come from peers that
+// predate versioning, which speak version 1.
+func negotiateVersion(h http.Header) (int, error) {
+	s := h.Get(versionHeader)
+	if s == "" {
+		return 1, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("bad protocol version %q", s)
+	}
+	if v < minProtocolVersion {
+		return 0, fmt.Errorf("protocol version %d is no longer supported", v)
+	}
+	if v > ProtocolVersion {
+		v = ProtocolVersion
+	}
+	return v, nil
+}
+
+// checkVersion checks that a peer answered in a version this package
+// speaks, and returns it.
+func checkVersion(res *http.Response) (int, error) {
+	v, err := negotiateVersion(res.Header)
+	if err != nil {
+		return 0, err
+	}
+	if s := res.Header.Get(versionHeader); s != "" && s != strconv.Itoa(v) {
+		return 0, fmt.Errorf("peer answered in unsupported protocol version %s", s)
+	}
+	return v, nil
+}
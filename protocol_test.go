@@ -0,0 +1,80 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+		ok     bool
+	}{
+		{"", 1, true},
+		{"1", 1, true},
+		{strconv.Itoa(ProtocolVersion + 5), ProtocolVersion, true},
+		{"0", 0, false},
+		{"x", 0, false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set(versionHeader, tt.header)
+		}
+		v, err := negotiateVersion(h)
+		if v != tt.want || (err == nil) != tt.ok {
+			t.Errorf("negotiateVersion(%q) = %d, %v; want %d, ok %v", tt.header, v, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHTTPProtocolVersion(t *testing.T) {
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+defaultBasePath+healthPath, nil)
+	req.Header.Set(versionHeader, strconv.Itoa(ProtocolVersion+1))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := res.Header.Get(versionHeader); got != strconv.Itoa(ProtocolVersion) {
+		t.Errorf("answered in version %q; want %d", got, ProtocolVersion)
+	}
+
+	req.Header.Set(versionHeader, "bogus")
+	if res, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad version answered with %d; want %d", res.StatusCode, http.StatusBadRequest)
+	}
+
+	// Answers in versions from the future are refused.
+	res = &http.Response{Header: http.Header{}}
+	res.Header.Set(versionHeader, strconv.Itoa(ProtocolVersion+1))
+	if _, err := checkVersion(res); err == nil {
+		t.Error("checkVersion accepted an unknown version")
+	}
+}
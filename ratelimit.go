@@ -0,0 +1,180 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// ratelimit.go limits the peer requests an HTTPPool serves.
+
+package groupcache
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// limit is the state of one rate and concurrency limit.
+type limit struct {
+	tokens float64   // requests that may start now
+	last   time.Time // when tokens was last refilled
+	active int       // requests being served
+}
+
+// requestLimiter enforces the request limits of an HTTPPool, both
+// over all requests and for each peer, which is told apart by its
+// address.
+type requestLimiter struct {
+	rate, peerRate     float64 // requests per second, if positive
+	burst, peerBurst   float64
+	maxActive, maxPeer int // concurrent requests, if positive
+	now                func() time.Time
+
+	mu    sync.Mutex
+	all   limit
+	peers map[string]*limit // idle peers with full buckets are dropped
+	swept time.Time         // when peers was last swept
+}
+
+// newRequestLimiter returns the limiter configured by o, or nil if o
+// sets no limits.
+func newRequestLimiter(o *HTTPPoolOptions) *requestLimiter {
+	if o.RequestRate <= 0 && o.PeerRequestRate <= 0 && o.MaxConcurrentRequests <= 0 && o.MaxPeerConcurrentRequests <= 0 {
+		return nil
+	}
+	l := &requestLimiter{
+		rate:      o.RequestRate,
+		peerRate:  o.PeerRequestRate,
+		burst:     float64(o.RequestBurst),
+		peerBurst: float64(o.RequestBurst),
+		maxActive: o.MaxConcurrentRequests,
+		maxPeer:   o.MaxPeerConcurrentRequests,
+		now:       time.Now,
+		peers:     make(map[string]*limit),
+	}
+	if l.burst < 1 {
+		l.burst = maxFloat(l.rate, 1)
+		l.peerBurst = maxFloat(l.peerRate, 1)
+	}
+	l.all.tokens = l.burst
+	return l
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// refill adds the tokens earned since the last refill to lim.
+func refill(lim *limit, rate, burst float64, now time.Time) {
+	if rate <= 0 {
+		return
+	}
+	if !lim.last.IsZero() {
+		lim.tokens += rate * now.Sub(lim.last).Seconds()
+		if lim.tokens > burst {
+			lim.tokens = burst
+		}
+	}
+	lim.last = now
+}
+
+// admit reports whether a request from peer may be served within the
+// limits. A true result must be followed by a call to done.
+func (l *requestLimiter) admit(peer string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	pl, ok := l.peers[peer]
+	if !ok {
+		pl = &limit{tokens: l.peerBurst}
+		l.sweepLocked(now)
+	}
+	refill(&l.all, l.rate, l.burst, now)
+	refill(pl, l.peerRate, l.peerBurst, now)
+	switch {
+	case l.maxActive > 0 && l.all.active >= l.maxActive,
+		l.maxPeer > 0 && pl.active >= l.maxPeer,
+		l.rate > 0 && l.all.tokens < 1,
+		l.peerRate > 0 && pl.tokens < 1:
+		return false
+	}
+	if l.rate > 0 {
+		l.all.tokens--
+	}
+	if l.peerRate > 0 {
+		pl.tokens--
+	}
+	l.all.active++
+	pl.active++
+	l.peers[peer] = pl
+	return true
+}
+
+// done records the end of a request admitted for peer.
+func (l *requestLimiter) done(peer string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.all.active--
+	pl := l.peers[peer]
+	pl.active--
+	if l.idleLocked(pl, l.now()) {
+		delete(l.peers, peer)
+	}
+}
+
+// idleLocked reports whether pl may be dropped: it has no requests
+// being served and its bucket has refilled.
+func (l *requestLimiter) idleLocked(pl *limit, now time.Time) bool {
+	return pl.active == 0 && (l.peerRate <= 0 || pl.tokens+l.peerRate*now.Sub(pl.last).Seconds() >= l.peerBurst)
+}
+
+// sweepLocked drops the idle peers, at most as often as a peer bucket
+// takes to refill, so that peers that stop sending requests are not
+// remembered forever.
+func (l *requestLimiter) sweepLocked(now time.Time) {
+	if l.peerRate <= 0 || now.Sub(l.swept).Seconds() < l.peerBurst/l.peerRate {
+		return
+	}
+	l.swept = now
+	for peer, pl := range l.peers {
+		if l.idleLocked(pl, now) {
+			delete(l.peers, peer)
+		}
+	}
+}
+
+// requestLimiter returns the pool's limiter, or nil if it has no
+// request limits.
+func (p *HTTPPool) requestLimiter() *requestLimiter {
+	p.limiterOnce.Do(func() { p.limiter = newRequestLimiter(&p.opts) })
+	return p.limiter
+}
+
+// requestPeer returns the address that identifies the peer sending r.
+func requestPeer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tooManyRequests answers a request refused by the pool's limits.
+func tooManyRequests(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "groupcache: too many requests", http.StatusTooManyRequests)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestRequestLimiterRate(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRequestLimiter(&HTTPPoolOptions{RequestRate: 10, PeerRequestRate: 2})
+	l.now = func() time.Time { return now }
+
+	serve := func(peer string) bool {
+		if !l.admit(peer) {
+			return false
+		}
+		l.done(peer)
+		return true
+	}
+	for i := 0; i < 2; i++ {
+		if !serve("a") {
+			t.Fatalf("request %d from a refused within its burst", i)
+		}
+	}
+	if serve("a") {
+		t.Error("request from a admitted over its rate")
+	}
+	for i := 0; i < 2; i++ {
+		if !serve("b") {
+			t.Fatalf("request %d from b refused; peer limits must be separate", i)
+		}
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !serve("a") {
+		t.Error("request from a refused after its bucket refilled")
+	}
+
+	// Of the global burst of 10, 4 were used before the refill capped
+	// the bucket and 1 after.
+	for i := 0; i < 9; i++ {
+		if !serve(string(rune('c' + i))) {
+			t.Fatalf("request %d refused within the global burst", i)
+		}
+	}
+	if serve("z") {
+		t.Error("request admitted over the global rate")
+	}
+
+	// Peers that stop sending requests are forgotten once their
+	// buckets refill.
+	now = now.Add(time.Second)
+	serve("new")
+	if n := len(l.peers); n != 1 {
+		t.Errorf("limiter holds %d peers; want only the new one", n)
+	}
+
+	if l := newRequestLimiter(&HTTPPoolOptions{}); l != nil {
+		t.Error("limiter built without limits")
+	}
+}
+
+func TestRequestLimiterConcurrency(t *testing.T) {
+	l := newRequestLimiter(&HTTPPoolOptions{MaxConcurrentRequests: 3, MaxPeerConcurrentRequests: 2})
+	if !l.admit("a") || !l.admit("a") {
+		t.Fatal("requests refused under the limits")
+	}
+	if l.admit("a") {
+		t.Error("third request from a admitted over the peer limit")
+	}
+	if !l.admit("b") {
+		t.Fatal("request from b refused under the limits")
+	}
+	if l.admit("c") {
+		t.Error("fourth request admitted over the global limit")
+	}
+	l.done("a")
+	if !l.admit("c") {
+		t.Error("request refused after another completed")
+	}
+}
+
+func TestHTTPPoolRateLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	g := newGroup("TestHTTPPoolRateLimit-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "slow" {
+			close(started)
+			<-release
+		}
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	p := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, MaxConcurrentRequests: 1}}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	slowDone := make(chan error)
+	go func() {
+		res, err := http.Get(srv.URL + defaultBasePath + g.Name() + "/slow")
+		if err == nil {
+			res.Body.Close()
+		}
+		slowDone <- err
+	}()
+	<-started
+
+	res, err := http.Get(srv.URL + defaultBasePath + healthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("health check at the limit = %d; want %d", res.StatusCode, http.StatusOK)
+	}
+
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	err = peer.Get(dummyCtx, req, &pb.GetResponse{})
+	if err == nil {
+		t.Fatal("request over the limit succeeded")
+	}
+	if c := ClassifyPeerError(err); c != PeerThrottled {
+		t.Errorf("refused request classed %v; want PeerThrottled", c)
+	}
+	if _, ok := err.(*NoFallbackError); !ok {
+		t.Errorf("refused request = %v; want a NoFallbackError", err)
+	}
+
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Get(dummyCtx, req, &pb.GetResponse{}); err != nil {
+		t.Errorf("request after the limit cleared = %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rendezvous provides an implementation of rendezvous, or
+// highest random weight, hashing with the interface of
+// consistenthash.Map. Each key goes to the node that scores highest
+// for it, which balances keys well even over few nodes and needs no
+// virtual replicas, at the cost of scoring every node on each Get.
+package rendezvous
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Hash is the hash function that scores nodes for keys.
+type Hash func(data []byte) uint64
+
+type node struct {
+	name   string
+	weight float64
+}
+
+// Map maps keys to nodes. It is not safe for concurrent use.
+type Map struct {
+	hash  Hash
+	nodes []node // sorted by name
+}
+
+// New returns an empty Map that scores nodes with fn. If fn is nil, it
+// defaults to 64-bit FNV-1a.
+func New(fn Hash) *Map {
+	m := &Map{hash: fn}
+	if m.hash == nil {
+		m.hash = fnv64a
+	}
+	return m
+}
+
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// IsEmpty returns true if there are no nodes.
+func (m *Map) IsEmpty() bool {
+	return len(m.nodes) == 0
+}
+
+// Add adds nodes with a weight of 1.
+func (m *Map) Add(nodes ...string) {
+	for _, n := range nodes {
+		m.AddWeighted(n, 1)
+	}
+}
+
+// AddWeighted adds node, or changes its weight if it is already
+// there, so that it owns about weight times as many keys as a node
+// with a weight of 1. A node with a weight below 1 is removed.
+func (m *Map) AddWeighted(name string, weight int) {
+	if weight < 1 {
+		m.Remove(name)
+		return
+	}
+	i := m.index(name)
+	if i < len(m.nodes) && m.nodes[i].name == name {
+		m.nodes[i].weight = float64(weight)
+		return
+	}
+	m.nodes = append(m.nodes, node{})
+	copy(m.nodes[i+1:], m.nodes[i:])
+	m.nodes[i] = node{name: name, weight: float64(weight)}
+}
+
+// Weight returns the weight of node, or 0 if it is not in the Map.
+func (m *Map) Weight(name string) int {
+	if i := m.index(name); i < len(m.nodes) && m.nodes[i].name == name {
+		return int(m.nodes[i].weight)
+	}
+	return 0
+}
+
+// Remove removes nodes. Only their keys move, each to the node that
+// scored next highest for it.
+func (m *Map) Remove(nodes ...string) {
+	for _, name := range nodes {
+		if i := m.index(name); i < len(m.nodes) && m.nodes[i].name == name {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+		}
+	}
+}
+
+// Set updates the Map to hold exactly nodes. Nodes already there keep
+// their weight.
+func (m *Map) Set(nodes ...string) {
+	want := make(map[string]bool, len(nodes))
+	for _, name := range nodes {
+		want[name] = true
+	}
+	kept := m.nodes[:0]
+	for _, n := range m.nodes {
+		if want[n.name] {
+			kept = append(kept, n)
+			delete(want, n.name)
+		}
+	}
+	m.nodes = kept
+	for _, name := range nodes {
+		if want[name] {
+			m.AddWeighted(name, 1)
+			delete(want, name)
+		}
+	}
+}
+
+// Get returns the node that scores highest for key, or "" if the Map
+// is empty.
+func (m *Map) Get(key string) string {
+	var best string
+	bestScore := math.Inf(-1)
+	for _, n := range m.nodes {
+		if s := m.score(n, key); s > bestScore {
+			best, bestScore = n.name, s
+		}
+	}
+	return best
+}
+
+// GetN returns the n nodes that score highest for key, highest first,
+// or all of them if there are fewer than n.
+func (m *Map) GetN(key string, n int) []string {
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+	scores := make([]float64, len(m.nodes))
+	order := make([]int, len(m.nodes))
+	for i, nd := range m.nodes {
+		scores[i] = m.score(nd, key)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = m.nodes[order[i]].name
+	}
+	return nodes
+}
+
+// score is the weight of node n for key: -weight/ln(h), with h the
+// mixed hash of the node and key mapped into (0, 1), so that a node's chance of
+// scoring highest is proportional to its weight.
+func (m *Map) score(n node, key string) float64 {
+	buf := make([]byte, 0, len(n.name)+1+len(key))
+	buf = append(buf, n.name...)
+	buf = append(buf, 0)
+	buf = append(buf, key...)
+	h := (float64(mix(m.hash(buf))>>11) + 0.5) / (1 << 53)
+	return -n.weight / math.Log(h)
+}
+
+// mix is the finalizer of MurmurHash3. It spreads the bits of hashes
+// like FNV's, whose high bits barely depend on the last bytes hashed,
+// over all 64 bits.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func (m *Map) index(name string) int {
+	return sort.Search(len(m.nodes), func(i int) bool { return m.nodes[i].name >= name })
+}
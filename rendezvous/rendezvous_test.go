@@ -0,0 +1,129 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rendezvous
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestBalance(t *testing.T) {
+	m := New(nil)
+	m.Add("a", "b", "c")
+	counts := make(map[string]int)
+	for i := 0; i < 30000; i++ {
+		counts[m.Get(strconv.Itoa(i))]++
+	}
+	for _, n := range []string{"a", "b", "c"} {
+		if c := counts[n]; c < 9000 || c > 11000 {
+			t.Errorf("node %s owns %d of 30000 keys; want about 10000", n, c)
+		}
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	m1, m2 := New(nil), New(nil)
+	m1.Add("Bill", "Bob", "Bonny")
+	m2.Add("Bonny", "Bill", "Bob")
+	for i := 0; i < 100; i++ {
+		if k := strconv.Itoa(i); m1.Get(k) != m2.Get(k) {
+			t.Fatalf("Get(%s) depends on the order nodes were added", k)
+		}
+	}
+
+	// Removing a node moves only its keys.
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		before[k] = m1.Get(k)
+	}
+	m1.Remove("Bob")
+	for k, owner := range before {
+		if got := m1.Get(k); got == "Bob" || owner != "Bob" && got != owner {
+			t.Fatalf("after removing Bob, Get(%s) = %s; was %s", k, got, owner)
+		}
+	}
+}
+
+func TestWeightsAndSet(t *testing.T) {
+	m := New(nil)
+	m.Add("small")
+	m.AddWeighted("large", 3)
+	counts := make(map[string]int)
+	for i := 0; i < 20000; i++ {
+		counts[m.Get(strconv.Itoa(i))]++
+	}
+	if r := float64(counts["large"]) / float64(counts["small"]); r < 2.5 || r > 3.5 {
+		t.Errorf("large owns %.2f times the keys of small; want about 3", r)
+	}
+
+	m.Set("large", "new")
+	if m.Weight("small") != 0 || m.Weight("large") != 3 || m.Weight("new") != 1 {
+		t.Errorf("weights after Set = %d, %d, %d; want 0, 3, 1", m.Weight("small"), m.Weight("large"), m.Weight("new"))
+	}
+	m.Set()
+	if !m.IsEmpty() || m.Get("k") != "" {
+		t.Error("Map not empty after Set()")
+	}
+}
+
+func BenchmarkGet8(b *testing.B)  { benchmarkGet(b, 8) }
+func BenchmarkGet32(b *testing.B) { benchmarkGet(b, 32) }
+
+func benchmarkGet(b *testing.B, shards int) {
+	m := New(nil)
+	var buckets []string
+	for i := 0; i < shards; i++ {
+		buckets = append(buckets, fmt.Sprintf("shard-%d", i))
+	}
+	m.Add(buckets...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(buckets[i&(shards-1)])
+	}
+}
+
+func TestGetN(t *testing.T) {
+	m := New(nil)
+	m.Add("a", "b", "c", "d")
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		nodes := m.GetN(k, 3)
+		if len(nodes) != 3 || nodes[0] != m.Get(k) {
+			t.Fatalf("GetN(%s, 3) = %v; want 3 nodes starting with %s", k, nodes, m.Get(k))
+		}
+		seen := make(map[string]bool)
+		for _, n := range nodes {
+			if seen[n] {
+				t.Fatalf("GetN(%s, 3) = %v repeats %s", k, nodes, n)
+			}
+			seen[n] = true
+		}
+
+		// The n'th node is the owner once the nodes before it are gone.
+		m2 := New(nil)
+		m2.Add("a", "b", "c", "d")
+		m2.Remove(nodes[0])
+		if got := m2.Get(k); got != nodes[1] {
+			t.Fatalf("without %s, Get(%s) = %s; want %s", nodes[0], k, got, nodes[1])
+		}
+	}
+	if got := m.GetN("k", 10); len(got) != 4 {
+		t.Errorf("GetN(k, 10) = %v; want all 4 nodes", got)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// replica.go gives keys several owners, so that a key stays cached
+// while its primary owner is down.
+
+package groupcache
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+// replicateTimeout bounds how long replicate waits for a replica to
+// store a value.
+const replicateTimeout = 10 * time.Second
+
+// getFromReplicas fetches the value for key from its replicas, in
+// order, after its primary owner failed. ok is false if no replica had
+// it.
+func (g *Group) getFromReplicas(ctx context.Context, key string, opts GetOptions) (value ByteView, ok bool) {
+	rp, isRP := g.peers.(ReplicaPicker)
+	if !isRP {
+		return ByteView{}, false
+	}
+	for _, peer := range rp.PickReplicas(key) {
+		if ctx.Err() != nil {
+			return ByteView{}, false
+		}
+		var err error
+		if opts.SkipHotCache {
+			value, err = g.fetchFromPeer(ctx, peer, key, opts.namespace)
+		} else {
+			value, err = g.getFromPeer(ctx, peer, key, opts.namespace)
+		}
+		g.countPeerLoads(peer, 1, err)
+		if err == nil {
+			g.Stats.ReplicaLoads.Add(1)
+			return value, true
+		}
+	}
+	return ByteView{}, false
+}
+
+// replicate copies value, just loaded by the key's primary owner, to
+// the key's replicas in the background. key is in namespace ns.
+// Failures count as errors of the replicas in StatsSnapshot.Peers.
+// Replicas that are not Setters are skipped.
+func (g *Group) replicate(key, ns string, value ByteView) {
+	rp, ok := g.peers.(ReplicaPicker)
+	if !ok {
+		return
+	}
+	replicas := rp.PickReplicas(key)
+	if len(replicas) == 0 {
+		return
+	}
+	req := &pb.SetRequest{
+		Group: &g.name,
+		Key:   &key,
+		Value: value.ByteSlice(),
+	}
+	if !value.e.IsZero() {
+		req.Expire = proto.Int64(value.e.UnixNano())
+	}
+	if ns != "" {
+		req.Namespace = &ns
+	}
+	for _, peer := range replicas {
+		s, ok := peer.(Setter)
+		if !ok {
+			continue
+		}
+		go func(peer ProtoGetter, s Setter) {
+			ctx, cancel := context.WithTimeout(context.Background(), replicateTimeout)
+			defer cancel()
+			if err := s.Set(ctx, req); err != nil {
+				g.countPeerLoads(peer, 0, err)
+			}
+		}(peer, s)
+	}
+}
+
+// PickReplicas returns the getters of the replicas of key, other than
+// p itself, when the pool's Owners option is above one. The replicas
+// are the peers that follow the key's primary owner on the ring,
+// leaving out ejected peers; those in the pool's Zone come first. If
+// PickPeer returned a replica in the pool's Zone instead of the
+// primary owner, the primary takes its place after the other replicas
+// in the zone.
+func (p *HTTPPool) PickReplicas(key string) []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.opts.Owners <= 1 || p.peers.IsEmpty() {
+		return nil
+	}
+	primary := p.ownerLocked(key)
+	peers := p.replicasLocked(key, primary)
+	if sub := p.zoneReplicaLocked(key, primary); sub != "" {
+		// PickPeer returned sub in place of the primary, which
+		// becomes a replica after the others in p's zone.
+		var rest []string
+		for _, peer := range peers {
+			if peer == sub {
+				continue
+			}
+			if primary != "" && p.zones[peer] != p.opts.Zone {
+				rest = append(rest, primary)
+				primary = ""
+			}
+			rest = append(rest, peer)
+		}
+		if primary != "" {
+			rest = append(rest, primary)
+		}
+		peers = rest
+	}
+	var replicas []ProtoGetter
+	for _, peer := range peers {
+		if peer != p.self {
+			replicas = append(replicas, p.httpGetters[peer])
+		}
+	}
+	return replicas
+}
+
+// replicasLocked returns the replicas of key, whose primary owner is
+// primary, with those in p's zone first: the peers after primary on
+// the ring if it is a MultiRing, or else those that rank highest for
+// key by rendezvous hashing. p.mu must be held.
+func (p *HTTPPool) replicasLocked(key, primary string) []string {
+	n := p.opts.Owners - 1
+	var replicas []string
+	if mr, ok := p.peers.(MultiRing); ok {
+		for _, peer := range mr.GetN(key, n+1) {
+			if peer != primary && len(replicas) < n {
+				replicas = append(replicas, peer)
+			}
+		}
+	} else {
+		replicas = p.rankReplicasLocked(key, primary, n)
+	}
+	if p.opts.Zone != "" {
+		sort.SliceStable(replicas, func(i, j int) bool {
+			return p.zones[replicas[i]] == p.opts.Zone && p.zones[replicas[j]] != p.opts.Zone
+		})
+	}
+	return replicas
+}
+
+// rankReplicasLocked returns the n peers other than primary and
+// ejected peers that rank highest for key by rendezvous hashing. p.mu
+// must be held.
+func (p *HTTPPool) rankReplicasLocked(key, primary string, n int) []string {
+	type ranked struct {
+		peer  string
+		score uint64
+	}
+	var candidates []ranked
+	for _, peer := range p.peerList {
+		if h := p.health[peer]; peer == primary || h != nil && h.ejected {
+			continue
+		}
+		candidates = append(candidates, ranked{peer, replicaScore(peer, key)})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	replicas := make([]string, len(candidates))
+	for i, c := range candidates {
+		replicas[i] = c.peer
+	}
+	return replicas
+}
+
+// replicaScore is the rendezvous hashing weight of peer for key.
+func replicaScore(peer, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(peer))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64()
+}
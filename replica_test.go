@@ -0,0 +1,192 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// replicaPeers is a PeerPicker with a fixed primary, nil for the
+// current peer, and replicas.
+type replicaPeers struct {
+	primary  ProtoGetter
+	replicas []ProtoGetter
+}
+
+func (p replicaPeers) PickPeer(key string) (ProtoGetter, bool) { return p.primary, p.primary != nil }
+
+func (p replicaPeers) PickReplicas(key string) []ProtoGetter { return p.replicas }
+
+// setRecorder is a peer that passes the requests to Set to a channel.
+type setRecorder struct {
+	fakePeer
+	sets chan *pb.SetRequest
+}
+
+func (p *setRecorder) Set(_ context.Context, in *pb.SetRequest) error {
+	p.sets <- in
+	return nil
+}
+
+func TestReplicaReads(t *testing.T) {
+	primary := &fakePeer{fail: true}
+	replica := &fakePeer{}
+	var loads int
+	g := newGroup("TestReplicaReads-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("local")
+	}), replicaPeers{primary: primary, replicas: []ProtoGetter{&fakePeer{fail: true}, replica}}, nil)
+
+	var s string
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:key" || loads != 0 {
+		t.Errorf("Get = %q after %d local loads; want the replica's value", s, loads)
+	}
+	if n := g.Stats.ReplicaLoads.Get(); n != 1 {
+		t.Errorf("ReplicaLoads = %d; want 1", n)
+	}
+	if n := g.StatsSnapshot().ReplicaLoads; n != 1 {
+		t.Errorf("snapshot ReplicaLoads = %d; want 1", n)
+	}
+
+	// Without a working replica the key is loaded locally.
+	replica.fail = true
+	if err := g.Get(dummyCtx, "other", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "local" || loads != 1 {
+		t.Errorf("Get = %q after %d local loads; want a local load", s, loads)
+	}
+}
+
+func TestReplicaPopulation(t *testing.T) {
+	replica := &setRecorder{sets: make(chan *pb.SetRequest, 1)}
+	g := newGroup("TestReplicaPopulation-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), replicaPeers{replicas: []ProtoGetter{replica}}, nil)
+
+	var s string
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-replica.sets:
+		if req.GetKey() != "key" || string(req.Value) != "value" {
+			t.Errorf("replica got Set(%q, %q); want Set(%q, %q)", req.GetKey(), req.Value, "key", "value")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("value was not copied to the replica")
+	}
+
+	// Local-only loads are not the owner's, and are not copied.
+	if err := g.GetWithOptions(dummyCtx, "local-only", StringSink(&s), GetOptions{LocalOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-replica.sets:
+		t.Errorf("local-only load was copied to a replica: %v", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// failingReplica is a peer whose Set fails, reporting whether it was
+// given a deadline.
+type failingReplica struct {
+	fakePeer
+	deadline chan bool
+}
+
+func (p *failingReplica) Set(ctx context.Context, in *pb.SetRequest) error {
+	_, ok := ctx.Deadline()
+	p.deadline <- ok
+	return errors.New("simulated error from replica")
+}
+
+func TestReplicaPopulationFailure(t *testing.T) {
+	replica := &failingReplica{deadline: make(chan bool, 1)}
+	g := newGroup("TestReplicaPopulationFailure-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), replicaPeers{replicas: []ProtoGetter{replica}}, nil)
+
+	var s string
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ok := <-replica.deadline:
+		if !ok {
+			t.Error("replica Set has no deadline")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("value was not copied to the replica")
+	}
+	for start := time.Now(); g.Stats.PeerErrors.Get() == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("failed replica Set was not counted")
+		}
+	}
+	if ps := g.StatsSnapshot().Peers[peerName(replica)]; ps.Errors != 1 {
+		t.Errorf("replica stats = %+v; want 1 error", ps)
+	}
+}
+
+func TestHTTPPoolPickReplicas(t *testing.T) {
+	peers := []string{"http://a", "http://b", "http://c", "http://d", "http://e"}
+	p := &HTTPPool{self: "http://z", opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas, Owners: 3}}
+	p.Set(peers...)
+	getterPeer := make(map[ProtoGetter]string)
+	for peer, g := range p.httpGetters {
+		getterPeer[g] = peer
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		primary, _ := p.PickPeer(key)
+		replicas := p.PickReplicas(key)
+		if len(replicas) != 2 {
+			t.Fatalf("PickReplicas(%q) returned %d replicas; want 2", key, len(replicas))
+		}
+		if replicas[0] == primary || replicas[1] == primary || replicas[0] == replicas[1] {
+			t.Errorf("PickReplicas(%q) = %v, %v with primary %v", key, getterPeer[replicas[0]], getterPeer[replicas[1]], getterPeer[primary])
+		}
+	}
+
+	// Ejected peers are not replicas.
+	p.mu.Lock()
+	p.ejectLocked("http://a", p.health["http://a"])
+	p.mu.Unlock()
+	defer p.health["http://a"].readmit.Stop()
+	for i := 0; i < 100; i++ {
+		for _, r := range p.PickReplicas(fmt.Sprintf("key-%d", i)) {
+			if getterPeer[r] == "http://a" {
+				t.Fatal("ejected peer picked as a replica")
+			}
+		}
+	}
+
+	p.opts.Owners = 0
+	if r := p.PickReplicas("key"); r != nil {
+		t.Errorf("PickReplicas without Owners = %v; want none", r)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// retry.go retries failed requests to peers.
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// A PeerErrorClass is a set of kinds of failed peer requests.
+type PeerErrorClass int
+
+const (
+	// PeerConnError is a failure to reach the peer or to get a reply
+	// from it, such as a refused or reset connection.
+	PeerConnError PeerErrorClass = 1 << iota
+
+	// PeerTimeout is a request that timed out.
+	PeerTimeout
+
+	// PeerServerError is a 5xx reply from the peer.
+	PeerServerError
+
+	// PeerOtherError is any other failure, such as a 4xx reply.
+	PeerOtherError
+
+	// PeerThrottled is a 429 reply from a peer that is shedding
+	// load, such as one over its HTTPPoolOptions.RequestRate.
+	PeerThrottled
+)
+
+// statusError is returned for a peer reply with a status other than 200.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "server returned: " + e.status
+}
+
+// ClassifyPeerError returns the class of err, an error returned by a
+// peer request.
+func ClassifyPeerError(err error) PeerErrorClass {
+	var se *statusError
+	if errors.As(err, &se) {
+		switch {
+		case se.code >= 500:
+			return PeerServerError
+		case se.code == http.StatusTooManyRequests:
+			return PeerThrottled
+		}
+		return PeerOtherError
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return PeerTimeout
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		if ne.Timeout() {
+			return PeerTimeout
+		}
+		return PeerConnError
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return PeerConnError
+	}
+	return PeerOtherError
+}
+
+// RetryPolicy configures how an HTTPPool handles failed peer requests.
+type RetryPolicy struct {
+	// Retries specifies how many times a failed request is retried
+	// against the same peer. If blank, requests are not retried.
+	Retries int
+
+	// Backoff specifies the delay before the first retry; each
+	// further retry waits twice as long as the one before.
+	// If blank, requests are retried immediately.
+	Backoff time.Duration
+
+	// RetryOn specifies the classes of errors that are retried.
+	// If blank, it defaults to PeerConnError|PeerTimeout|PeerServerError.
+	RetryOn PeerErrorClass
+
+	// FailFastOn specifies the classes of errors that, once retries
+	// are exhausted, are returned by Get instead of loading the key
+	// locally. If blank, it defaults to PeerThrottled, so that a
+	// peer shedding load does not pass that load on to the backend.
+	FailFastOn PeerErrorClass
+}
+
+const (
+	defaultRetryOn    = PeerConnError | PeerTimeout | PeerServerError
+	defaultFailFastOn = PeerThrottled
+)
+
+// retry reports whether a request that failed with err on the given
+// attempt, counting from zero, should be tried again, and waits for
+// the backoff if so.
+func (r *RetryPolicy) retry(ctx context.Context, attempt int, err error) bool {
+	if attempt >= r.Retries {
+		return false
+	}
+	on := r.RetryOn
+	if on == 0 {
+		on = defaultRetryOn
+	}
+	if ctx != nil && ctx.Err() != nil || ClassifyPeerError(err)&on == 0 {
+		return false
+	}
+	if r.Backoff <= 0 {
+		return true
+	}
+	t := time.NewTimer(r.Backoff << uint(attempt))
+	defer t.Stop()
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-t.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// failed returns the error to report for a request that failed with
+// err after its retries.
+func (r *RetryPolicy) failed(err error) error {
+	on := r.FailFastOn
+	if on == 0 {
+		on = defaultFailFastOn
+	}
+	if ClassifyPeerError(err)&on != 0 {
+		return &NoFallbackError{Err: err}
+	}
+	return err
+}
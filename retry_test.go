@@ -0,0 +1,149 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+func TestClassifyPeerError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, refused := net.Dial("tcp", addr)
+
+	tests := []struct {
+		err  error
+		want PeerErrorClass
+	}{
+		{refused, PeerConnError},
+		{io.ErrUnexpectedEOF, PeerConnError},
+		{context.DeadlineExceeded, PeerTimeout},
+		{&statusError{code: 503, status: "503 Service Unavailable"}, PeerServerError},
+		{&statusError{code: 404, status: "404 Not Found"}, PeerOtherError},
+		{&statusError{code: 429, status: "429 Too Many Requests"}, PeerThrottled},
+		{errors.New("bad proto"), PeerOtherError},
+	}
+	for _, tt := range tests {
+		if got := ClassifyPeerError(tt.err); got != tt.want {
+			t.Errorf("ClassifyPeerError(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// flakyServer fails the first n requests with a 503 and then serves
+// the pool.
+func flakyServer(n int32) (*httptest.Server, *int32) {
+	var reqs int32
+	pool := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&reqs, 1) <= n {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		pool.ServeHTTP(w, r)
+	}))
+	return srv, &reqs
+}
+
+func TestHTTPRetry(t *testing.T) {
+	g := newGroup("TestHTTPRetry-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+
+	srv, reqs := flakyServer(1)
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, retry: RetryPolicy{Retries: 1, Backoff: time.Millisecond}}
+	if err := peer.Get(context.TODO(), req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if *reqs != 2 {
+		t.Errorf("requests = %d; want 2", *reqs)
+	}
+
+	// Errors outside RetryOn are not retried.
+	srv2, reqs2 := flakyServer(1)
+	defer srv2.Close()
+	peer = &httpGetter{baseURL: srv2.URL + defaultBasePath, retry: RetryPolicy{Retries: 1, RetryOn: PeerConnError}}
+	if err := peer.Get(context.TODO(), req, &pb.GetResponse{}); ClassifyPeerError(err) != PeerServerError {
+		t.Errorf("Get = %v; want a server error", err)
+	}
+	if *reqs2 != 1 {
+		t.Errorf("requests = %d; want 1", *reqs2)
+	}
+}
+
+func TestHTTPRetryFailFast(t *testing.T) {
+	srv, _ := flakyServer(1 << 30)
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, retry: RetryPolicy{FailFastOn: PeerServerError}}
+	var loads int
+	g := newGroup("TestHTTPRetryFailFast-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("value")
+	}), fakePeers([]ProtoGetter{peer}), nil)
+
+	var s string
+	err := g.Get(context.TODO(), "key", StringSink(&s))
+	if _, ok := err.(*NoFallbackError); !ok {
+		t.Fatalf("Get = %v; want a *NoFallbackError", err)
+	}
+	if loads != 0 {
+		t.Errorf("loads = %d; want 0", loads)
+	}
+
+	// Other errors still fall back to loading locally.
+	peer.retry.FailFastOn = PeerConnError
+	if err := g.Get(context.TODO(), "key", StringSink(&s)); err != nil || s != "value" {
+		t.Errorf("Get = %q, %v; want %q", s, err, "value")
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d; want 1", loads)
+	}
+}
+
+func TestRetryBackoffContext(t *testing.T) {
+	r := &RetryPolicy{Retries: 3, Backoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	if r.retry(ctx, 0, &statusError{code: 500, status: "500"}) {
+		t.Error("retry waited out its backoff despite the canceled context")
+	}
+	r.Backoff = 0
+	for i, want := range []bool{true, true, true, false} {
+		if got := r.retry(context.Background(), i, fmt.Errorf("%w", io.EOF)); got != want {
+			t.Errorf("retry attempt %d = %v; want %v", i, got, want)
+		}
+	}
+}
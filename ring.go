@@ -0,0 +1,105 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// ring.go defines how an HTTPPool maps keys to peers.
+
+package groupcache
+
+import "github.com/golang/groupcache/consistenthash"
+
+// Ring is the interface that must be implemented to map the keys of an
+// HTTPPool to its peers. consistenthash.Map and rendezvous.Map
+// implement it. The pool calls it with its lock held.
+type Ring interface {
+	// IsEmpty returns true if there are no peers.
+	IsEmpty() bool
+
+	// Get returns the peer that owns key.
+	Get(key string) string
+
+	// Set updates the ring to hold exactly peers, moving only the
+	// keys of the peers that joined or left.
+	Set(peers ...string)
+}
+
+// WeightedRing is implemented by Rings that can give peers weights,
+// for HTTPPool.SetWeights.
+type WeightedRing interface {
+	// AddWeighted adds peer, or changes its weight, so that it
+	// owns about weight times as many keys as a peer of weight 1.
+	AddWeighted(peer string, weight int)
+
+	// Weight returns the weight of peer, or 0 if it is not in the
+	// ring.
+	Weight(peer string) int
+}
+
+// BoundedRing is implemented by Rings that can bound the load of each
+// peer, for HTTPPoolOptions.LoadFactor.
+type BoundedRing interface {
+	// GetBounded is like Get, but passes over peers whose load
+	// would exceed factor times the average.
+	GetBounded(key string, factor float64) string
+
+	// Inc and Done add one to and subtract one from the load of
+	// peer.
+	Inc(peer string)
+	Done(peer string)
+}
+
+// MultiRing is implemented by Rings that can list several owners of a
+// key, for the replicas of HTTPPoolOptions.Owners. Rings that do not
+// implement it get replicas by rendezvous hashing.
+type MultiRing interface {
+	// GetN returns up to n distinct peers for key, starting with
+	// the one Get returns.
+	GetN(key string, n int) []string
+}
+
+// newRing returns an empty ring for p's peers.
+func (p *HTTPPool) newRing() Ring {
+	if p.opts.NewRing != nil {
+		return p.opts.NewRing()
+	}
+	var m *consistenthash.Map
+	if p.opts.HashFn64 != nil {
+		m = consistenthash.New64(p.opts.Replicas, p.opts.HashFn64)
+	} else {
+		m = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	}
+	m.SetKeyHash(p.opts.KeyHashFn)
+	m.SetLabels(p.opts.Labels)
+	if p.opts.MigrateLabels != 0 {
+		m.Migrate(p.opts.MigrateLabels, p.migrated)
+	}
+	return m
+}
+
+// SetLabelMigration moves fraction of the keys of a pool with the
+// MigrateLabels option from their owners under MigrateLabels to their
+// owners under Labels. The fraction starts at 0, where the pool agrees
+// with peers still using MigrateLabels; once every peer runs with the
+// option, raising the fraction on all of them in steps up to 1 moves
+// the keyspace a slice at a time. It has no effect on rings given by
+// NewRing.
+func (p *HTTPPool) SetLabelMigration(fraction float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.migrated = fraction
+	if m, ok := p.peers.(*consistenthash.Map); ok && p.opts.NewRing == nil && p.opts.MigrateLabels != 0 {
+		m.Migrate(p.opts.MigrateLabels, fraction)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"testing"
+
+	"github.com/golang/groupcache/consistenthash"
+	"github.com/golang/groupcache/jump"
+	"github.com/golang/groupcache/rendezvous"
+)
+
+var (
+	_ WeightedRing = (*consistenthash.Map)(nil)
+	_ BoundedRing  = (*consistenthash.Map)(nil)
+	_ WeightedRing = (*rendezvous.Map)(nil)
+)
+
+func TestHTTPPoolRendezvousRing(t *testing.T) {
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{
+		BasePath: defaultBasePath,
+		NewRing:  func() Ring { return rendezvous.New(nil) },
+	}}
+	p.Set(self, "http://a", "http://b")
+	if _, ok := p.peers.(*rendezvous.Map); !ok {
+		t.Fatalf("pool ring is a %T; want the rendezvous.Map from NewRing", p.peers)
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		peer, ok := p.PickPeer(strconv.Itoa(i))
+		if !ok {
+			counts[self]++
+			continue
+		}
+		counts[peer.(*httpGetter).baseURL]++
+	}
+	for _, peer := range []string{self, "http://a" + defaultBasePath, "http://b" + defaultBasePath} {
+		if c := counts[peer]; c < 800 || c > 1200 {
+			t.Errorf("%s owns %d of 3000 keys; want about 1000", peer, c)
+		}
+	}
+
+	// Weights apply to any WeightedRing.
+	p.SetWeights(map[string]int{"http://a": 3})
+	if w := p.peers.(WeightedRing).Weight("http://a"); w != 3 {
+		t.Errorf("weight of a = %d; want 3", w)
+	}
+}
+
+func TestHTTPPoolJumpRing(t *testing.T) {
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{
+		BasePath: defaultBasePath,
+		NewRing:  func() Ring { return jump.New(nil) },
+	}}
+	p.Set(self, "http://a")
+	remote := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := p.PickPeer(strconv.Itoa(i)); ok {
+			remote++
+		}
+	}
+	if remote < 400 || remote > 600 {
+		t.Errorf("%d of 1000 keys owned by the other peer; want about 500", remote)
+	}
+}
+
+func TestHTTPPoolJumpRingEjection(t *testing.T) {
+	const self = "http://self"
+	peers := []string{self, "http://a", "http://b", "http://c", "http://d"}
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{
+		BasePath:    defaultBasePath,
+		MaxFailures: 1,
+		NewRing:     func() Ring { return jump.New(nil) },
+	}}
+	p.Set(peers...)
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		owners[k] = p.peers.Get(k)
+	}
+
+	// Ejecting a peer in the middle of the list moves only its keys.
+	p.recordResult("http://b", errors.New("down"))
+	moved := 0
+	for k, owner := range owners {
+		p.mu.Lock()
+		got := p.ownerLocked(k)
+		p.mu.Unlock()
+		switch {
+		case owner == "http://b":
+			moved++
+			if got == "http://b" {
+				t.Fatalf("key %s is still owned by the ejected peer", k)
+			}
+		case got != owner:
+			t.Fatalf("ejecting b moved key %s from %s to %s", k, owner, got)
+		}
+	}
+	if moved == 0 {
+		t.Fatal("b owned no keys")
+	}
+
+	p.recordResult("http://b", nil)
+	for k, owner := range owners {
+		p.mu.Lock()
+		got := p.ownerLocked(k)
+		p.mu.Unlock()
+		if got != owner {
+			t.Fatalf("after b is re-admitted, key %s is owned by %s; want %s", k, got, owner)
+		}
+	}
+}
+
+func TestHTTPPoolHashFns(t *testing.T) {
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{
+		BasePath: defaultBasePath,
+		Replicas: defaultReplicas,
+		HashFn64: func(data []byte) uint64 {
+			h := fnv.New64a()
+			h.Write(data)
+			return h.Sum64()
+		},
+		KeyHashFn: func(key []byte) uint64 { return 0 },
+	}}
+	p.Set(self, "http://a", "http://b")
+	owner := p.peers.Get("key")
+	for i := 0; i < 100; i++ {
+		if got := p.peers.Get(strconv.Itoa(i)); got != owner {
+			t.Fatalf("with every key hashed to 0, %d is owned by %s and key by %s", i, got, owner)
+		}
+	}
+	var total float64
+	for _, f := range p.peers.(*consistenthash.Map).Distribution() {
+		total += f
+	}
+	if total < 0.999 || total > 1.001 {
+		t.Errorf("64-bit ring distribution sums to %g; want 1", total)
+	}
+}
+
+func TestHTTPPoolLabelMigration(t *testing.T) {
+	const self = "http://self"
+	peers := []string{self, "http://a", "http://b"}
+	newPool := func(labels, migrate consistenthash.Labels) *HTTPPool {
+		p := &HTTPPool{self: self, opts: HTTPPoolOptions{
+			BasePath:      defaultBasePath,
+			Replicas:      defaultReplicas,
+			Labels:        labels,
+			MigrateLabels: migrate,
+		}}
+		p.Set(peers...)
+		return p
+	}
+	legacy := newPool(0, 0)
+	v1 := newPool(consistenthash.LabelsV1, 0)
+	p := newPool(consistenthash.LabelsV1, consistenthash.LabelsLegacy)
+
+	differ := 0
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		if got, want := p.peers.Get(k), legacy.peers.Get(k); got != want {
+			t.Fatalf("migrating pool gives %s to %s; want the legacy owner %s", k, got, want)
+		}
+		if legacy.peers.Get(k) != v1.peers.Get(k) {
+			differ++
+		}
+	}
+	if differ == 0 {
+		t.Fatal("legacy and v1 labels give every key the same owner")
+	}
+
+	p.SetLabelMigration(1)
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		if got, want := p.peers.Get(k), v1.peers.Get(k); got != want {
+			t.Fatalf("migrated pool gives %s to %s; want the v1 owner %s", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// server.go implements the server side of the peer protocol, for
+// transports other than HTTPPool.
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/groupcache/singleflight"
+	"github.com/golang/protobuf/proto"
+)
+
+// LocalPeer returns a ProtoGetter that answers peer requests from this
+// process's groups, as HTTPPool's handler does. Transports other than
+// HTTPPool use it to serve their peers. It also implements
+// Remover, Setter, StreamGetter, BatchGetter and GenerationSetter.
+func LocalPeer() ProtoGetter {
+	return localPeer{}
+}
+
+type localPeer struct{}
+
+// group returns the named group, counting a server request in it.
+func (localPeer) group(name string) (*Group, error) {
+	g := GetGroup(name)
+	if g == nil {
+		return nil, fmt.Errorf("no such group: %s", name)
+	}
+	g.Stats.ServerRequests.Add(1)
+	return g, nil
+}
+
+func (p localPeer) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	g, err := p.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	opts, err := requestOptions(in)
+	if err != nil {
+		return err
+	}
+	var value ByteView
+	if err := g.get(ctx, in.GetKey(), ByteViewSink(&value), opts); err != nil {
+		return peerError(err)
+	}
+	out.Value = value.ByteSlice()
+	if e := value.Expire(); !e.IsZero() {
+		out.Expire = proto.Int64(e.UnixNano())
+	}
+	return nil
+}
+
+// Remove implements Remover.
+func (p localPeer) Remove(ctx context.Context, in *pb.GetRequest) error {
+	g, err := p.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	g.localRemove(in.GetKey())
+	return nil
+}
+
+// Set implements Setter.
+func (p localPeer) Set(ctx context.Context, in *pb.SetRequest) error {
+	g, err := p.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	return g.setRequest(in)
+}
+
+// GetStream implements StreamGetter.
+func (p localPeer) GetStream(ctx context.Context, in *pb.GetRequest, w io.Writer) (expire time.Time, err error) {
+	g, err := p.group(in.GetGroup())
+	if err != nil {
+		return time.Time{}, err
+	}
+	opts, err := requestOptions(in)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sink := &writerSink{w: w}
+	if err := g.get(ctx, in.GetKey(), sink, opts); err != nil {
+		return time.Time{}, peerError(err)
+	}
+	return sink.v.Expire(), nil
+}
+
+// GetMulti implements BatchGetter. Keys that fail to load are returned
+// with their error rather than failing the whole request.
+func (p localPeer) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	g, err := p.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	return g.multiResponse(ctx, in.GetKey(), out)
+}
+
+// requestOptions returns the options of the load a peer requests.
+func requestOptions(in *pb.GetRequest) (GetOptions, error) {
+	if !validKey(in.GetNamespace(), in.GetKey()) {
+		return GetOptions{}, errKeyNamespace
+	}
+	return GetOptions{namespace: in.GetNamespace()}, nil
+}
+
+// setRequest stores the value of a peer's SetRequest in g's main
+// cache.
+func (g *Group) setRequest(in *pb.SetRequest) error {
+	if !validKey(in.GetNamespace(), in.GetKey()) {
+		return errKeyNamespace
+	}
+	var expire time.Time
+	if in.Expire != nil {
+		expire = time.Unix(0, in.GetExpire())
+	}
+	g.localSet(in.GetKey(), in.GetNamespace(), in.GetValue(), expire, &g.mainCache)
+	return nil
+}
+
+// errInternalLoad is sent to peers in place of the error of a load
+// whose Getter panicked.
+var errInternalLoad = errors.New("groupcache: internal error loading value")
+
+// peerError returns err, an error loading a value, as it is sent to a
+// peer: the details of a panicking Getter stay in this process.
+func peerError(err error) error {
+	var pe *singleflight.PanicError
+	if errors.As(err, &pe) {
+		return errInternalLoad
+	}
+	return err
+}
+
+// multiResponse gets keys from g and adds a value or an error for each
+// of them to out. It fails if there are more than maxBatchKeys keys.
+func (g *Group) multiResponse(ctx context.Context, keys []string, out *pb.GetMultiResponse) error {
+	if len(keys) > maxBatchKeys {
+		return errTooManyKeys
+	}
+	values := make(map[string]ByteView)
+	errs := make(map[string]error)
+	var valid []string
+	for _, key := range keys {
+		if validKey("", key) {
+			valid = append(valid, key)
+		} else {
+			errs[key] = errKeyNamespace
+		}
+	}
+	g.getMulti(ctx, valid, MapBatchSink(values, errs))
+	for _, key := range keys {
+		kv := &pb.KeyValue{Key: proto.String(key)}
+		if value, ok := values[key]; ok {
+			delete(values, key)
+			kv.Value = value.ByteSlice()
+			if e := value.Expire(); !e.IsZero() {
+				kv.Expire = proto.Int64(e.UnixNano())
+			}
+		} else if err, ok := errs[key]; ok {
+			delete(errs, key)
+			kv.Error = proto.String(peerError(err).Error())
+		} else {
+			continue // a duplicate key
+		}
+		out.Values = append(out.Values, kv)
+	}
+	return nil
+}
+
+// SetGeneration implements GenerationSetter.
+func (p localPeer) SetGeneration(ctx context.Context, in *pb.GenerationRequest) error {
+	g, err := p.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	g.localSetGeneration(in.GetGeneration())
+	return nil
+}
@@ -18,7 +18,14 @@ limitations under the License.
 // mechanism.
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
 
 // call is an in-flight or completed Do call
 type call struct {
@@ -27,42 +34,297 @@ type call struct {
 	// val和err是要调用的函数的返回值
 	val interface{}
 	err error
+	// 通过DoChan等待结果的channel
+	chans []chan<- Result
+	// 共享结果的重复调用次数
+	dups  int
+	// 仍在等待结果的调用者个数, 以及取消DoContext中fn的context的函数
+	waiters int
+	cancel  context.CancelFunc
+	// 调用是否已完成, 以及完成后的结果在何时过期
+	done    bool
+	expires time.Time
 }
 
+// Result holds the results of Do, so they can be passed on a channel.
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // whether Val was given to more than one caller
+}
+
+// PanicError is the error that the callers sharing a call get when its
+// function panicked. The caller of Do that ran the function panics
+// with it instead. Its message leaves out Stack, so that it can be
+// shown without revealing the program's internals.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // the stack of the goroutine that panicked
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic in call: %v", e.Value)
+}
+
+// ErrGoexit is the error that the callers sharing a call get when its
+// function called runtime.Goexit.
+var ErrGoexit = errors.New("singleflight: runtime.Goexit was called")
+
 // Group represents a class of work and forms a namespace in which
 // units of work can be executed with duplicate suppression.
 type Group struct {
+	// ResultTTL optionally keeps the results of a call that returned
+	// for this long after it completes, typically 10 to 100
+	// milliseconds, so that calls for the key arriving just after it
+	// get them too instead of calling their function again. It must
+	// be set before the Group is used.
+	ResultTTL time.Duration
+
 	mu sync.Mutex       // protects m
 	m  map[string]*call // lazily initialized
 }
 
+// lookupLocked returns the call for key, in flight or with results
+// kept by ResultTTL. g.mu must be held.
+func (g *Group) lookupLocked(key string) (*call, bool) {
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if ok && c.done && !time.Now().Before(c.expires) {
+		delete(g.m, key)
+		return nil, false
+	}
+	return c, ok
+}
+
 // Do executes and returns the results of the given function, making
 // sure that only one execution is in-flight for a given key at a
 // time. If a duplicate comes in, the duplicate caller waits for the
-// original to complete and receives the same results.
+// original to complete and receives the same results. If the function
+// panics, the duplicates receive a *PanicError and the original caller
+// panics with it.
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
 	g.mu.Lock()
-	if g.m == nil {
-		g.m = make(map[string]*call)
-	}
 	// 如果key对应的call已经在处理，处理完后返回对应的结果就可以了
-	if c, ok := g.m[key]; ok {
+	if c, ok := g.lookupLocked(key); ok {
+		c.dups++
+		c.waiters++
 		g.mu.Unlock()
 		c.wg.Wait()
 		return c.val, c.err
 	}
 	// 如果不存在对应的call，创建一个，并添加到g.m中，供后续调用使用
-	c := new(call)
+	c := &call{waiters: 1}
 	c.wg.Add(1)
 	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	g.doCall(c, key, fn)
+	if pe, ok := c.err.(*PanicError); ok {
+		panic(pe)
+	}
+	return c.val, c.err
+}
+
+// DoChan is like Do but returns a channel that will receive the
+// results when they are ready, so that the caller can select on it
+// along with its own context or deadline. The channel is buffered:
+// a caller that gives up need not receive from it.
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if c, ok := g.lookupLocked(key); ok {
+		c.dups++
+		c.waiters++
+		c.join(ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{chans: []chan<- Result{ch}, waiters: 1}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// doCall runs fn for the call c and hands its results to the callers
+// waiting for them. If fn panics or calls runtime.Goexit, they get a
+// *PanicError or ErrGoexit instead of waiting forever.
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	normalReturn, recovered := false, false
+	defer func() {
+		if !normalReturn && !recovered {
+			c.val, c.err = nil, ErrGoexit
+		}
+		if c.cancel != nil {
+			c.cancel()
+		}
+		c.wg.Done()
+
+		g.mu.Lock()
+		c.done = true
+		if g.m[key] == c {
+			if ttl := g.ResultTTL; ttl > 0 && normalReturn {
+				c.expires = time.Now().Add(ttl)
+				time.AfterFunc(ttl, func() { g.forgetCall(key, c) })
+			} else {
+				delete(g.m, key)
+			}
+		}
+		for _, ch := range c.chans {
+			ch <- Result{Val: c.val, Err: c.err, Shared: c.dups > 0}
+		}
+		g.mu.Unlock()
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				// recover returns nil if fn called Goexit.
+				if r := recover(); r != nil {
+					c.val, c.err = nil, &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+	recovered = !normalReturn
+}
+
+// join makes ch receive the results of c, at once if it is done. g.mu
+// must be held.
+func (c *call) join(ch chan<- Result) {
+	if c.done {
+		ch <- Result{Val: c.val, Err: c.err, Shared: true}
+		return
+	}
+	c.chans = append(c.chans, ch)
+}
 
+// forgetCall removes c from g if it is still the call for key.
+func (g *Group) forgetCall(key string, c *call) {
+	g.mu.Lock()
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+}
+
+// DoContext is like Do, but each caller stops waiting as soon as its
+// own ctx is done, returning ctx.Err(), without affecting the other
+// callers. fn runs with a context of its own, which carries the values
+// of the ctx of the caller that started the call but not its deadline
+// or cancellation: it is canceled only once every caller has given
+// up, and the call is then forgotten so that later callers start over.
+func (g *Group) DoContext(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	c, ok := g.lookupLocked(key)
+	if ok {
+		c.dups++
+		c.waiters++
+		c.join(ch)
+		g.mu.Unlock()
+	} else {
+		fctx, cancel := context.WithCancel(detachedContext{ctx})
+		c = &call{chans: []chan<- Result{ch}, waiters: 1, cancel: cancel}
+		c.wg.Add(1)
+		g.m[key] = c
+		g.mu.Unlock()
+		go g.doCall(c, key, func() (interface{}, error) { return fn(fctx) })
+	}
+
+	select {
+	case r := <-ch:
+		return r.Val, r.Err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && c.cancel != nil && !c.done {
+			c.cancel()
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// detachedContext carries the values of a Context but is never done.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// Forget tells the group to forget about key, such as once the
+// results of a call in flight are known to be stale: later calls for
+// key run their function instead of waiting for that call. Callers
+// already waiting still receive its results.
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
+}
 
-	return c.val, c.err
+// ShardedGroup is like Group, but spreads keys over several Groups by
+// hash, so that concurrent calls for different keys rarely contend for
+// the same mutex.
+type ShardedGroup struct {
+	shards []Group
+}
+
+// NewShardedGroup returns a ShardedGroup with n shards. n must be
+// positive.
+func NewShardedGroup(n int) *ShardedGroup {
+	if n <= 0 {
+		panic("singleflight: NewShardedGroup shards must be positive")
+	}
+	return &ShardedGroup{shards: make([]Group, n)}
+}
+
+// Do is like Group.Do.
+func (g *ShardedGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.shards[fnv32a(key)%uint32(len(g.shards))].Do(key, fn)
+}
+
+// DoChan is like Group.DoChan.
+func (g *ShardedGroup) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	return g.shards[fnv32a(key)%uint32(len(g.shards))].DoChan(key, fn)
+}
+
+// DoContext is like Group.DoContext.
+func (g *ShardedGroup) DoContext(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	return g.shards[fnv32a(key)%uint32(len(g.shards))].DoContext(ctx, key, fn)
+}
+
+// Forget is like Group.Forget.
+func (g *ShardedGroup) Forget(key string) {
+	g.shards[fnv32a(key)%uint32(len(g.shards))].Forget(key)
+}
+
+// SetResultTTL sets the ResultTTL of every shard. It must be called
+// before g is used.
+func (g *ShardedGroup) SetResultTTL(d time.Duration) {
+	for i := range g.shards {
+		g.shards[i].ResultTTL = d
+	}
+}
+
+// fnv32a is the 32-bit FNV-1a hash of s.
+func fnv32a(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
 }
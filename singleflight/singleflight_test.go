@@ -17,8 +17,10 @@ limitations under the License.
 package singleflight
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -83,3 +85,287 @@ func TestDoDupSuppress(t *testing.T) {
 		t.Errorf("number of calls = %d; want 1", got)
 	}
 }
+
+func TestShardedDoDupSuppress(t *testing.T) {
+	g := NewShardedGroup(8)
+	c := make(chan string)
+	var calls int32
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return <-c, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			v, err := g.Do("key", fn)
+			if err != nil {
+				t.Errorf("Do error: %v", err)
+			}
+			if v.(string) != "bar" {
+				t.Errorf("got %q; want %q", v, "bar")
+			}
+			wg.Done()
+		}()
+	}
+	time.Sleep(100 * time.Millisecond) // let goroutines above block
+	c <- "bar"
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of calls = %d; want 1", got)
+	}
+
+	v, err := g.Do("other", func() (interface{}, error) { return "baz", nil })
+	if v != "baz" || err != nil {
+		t.Errorf("Do(other) = %v, %v; want baz, nil", v, err)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	c := make(chan string)
+	var calls int32
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return <-c, nil
+	}
+
+	ch1 := g.DoChan("key", fn)
+	ch2 := g.DoChan("key", fn)
+	done := make(chan error, 1)
+	go func() {
+		v, err := g.Do("key", fn)
+		if err == nil && v != "bar" {
+			err = fmt.Errorf("Do = %v; want bar", v)
+		}
+		done <- err
+	}()
+	select {
+	case r := <-ch1:
+		t.Fatalf("DoChan delivered %v before fn returned", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	c <- "bar"
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		r := <-ch
+		if r.Val != "bar" || r.Err != nil || !r.Shared {
+			t.Errorf("DoChan result = %+v; want shared bar", r)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of calls = %d; want 1", got)
+	}
+
+	r := <-g.DoChan("key", func() (interface{}, error) { return nil, errors.New("boom") })
+	if r.Err == nil || r.Shared {
+		t.Errorf("unshared DoChan result = %+v; want its error, unshared", r)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	g.Forget("key")
+	v, err := g.Do("key", func() (interface{}, error) { return 2, nil })
+	if v != 2 || err != nil {
+		t.Errorf("Do after Forget = %v, %v; want 2, nil", v, err)
+	}
+
+	// A call started after Forget is not dropped when the forgotten
+	// call completes.
+	ch3 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 3, nil
+	})
+	ch4 := g.DoChan("key", func() (interface{}, error) { return 4, nil })
+	close(release)
+	if r := <-ch1; r.Val != 1 {
+		t.Errorf("forgotten call = %v; want 1", r.Val)
+	}
+	if r3, r4 := <-ch3, <-ch4; r3.Val != 3 || r4.Val != 3 {
+		t.Errorf("calls after Forget = %v, %v; want 3, 3", r3.Val, r4.Val)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	type ctxKey struct{}
+	var g Group
+	release := make(chan struct{})
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return ctx.Value(ctxKey{}), nil
+	}
+
+	// The caller that started the call gives up; the other still
+	// gets the result, loaded with the first caller's values.
+	ctx1, cancel1 := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v1"))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.DoContext(ctx1, "key", fn)
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let the call above start
+	done := make(chan Result, 1)
+	go func() {
+		v, err := g.DoContext(context.Background(), "key", fn)
+		done <- Result{Val: v, Err: err}
+	}()
+	time.Sleep(50 * time.Millisecond) // let the call above join
+	cancel1()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("canceled DoContext = %v; want context.Canceled", err)
+	}
+	close(release)
+	if r := <-done; r.Val != "v1" || r.Err != nil {
+		t.Errorf("remaining DoContext = %v, %v; want v1, nil", r.Val, r.Err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of calls = %d; want 1", got)
+	}
+
+	// Once every caller gives up, fn's context is canceled and the
+	// next caller starts over.
+	canceled := make(chan error, 1)
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	go func() {
+		g.DoContext(ctx2, "other", func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return nil, ctx.Err()
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel2()
+	if err := <-canceled; err != context.Canceled {
+		t.Errorf("abandoned fn context error = %v; want context.Canceled", err)
+	}
+	v, err := g.DoContext(context.Background(), "other", func(context.Context) (interface{}, error) { return "fresh", nil })
+	if v != "fresh" || err != nil {
+		t.Errorf("DoContext after all gave up = %v, %v; want fresh, nil", v, err)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+
+	waiter := make(chan error, 1)
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		g.Do("key", fn)
+	}()
+	time.Sleep(50 * time.Millisecond) // let the call above start
+	go func() {
+		_, err := g.Do("key", fn)
+		waiter <- err
+	}()
+	ch := g.DoChan("key", fn)
+	time.Sleep(50 * time.Millisecond) // let the calls above join
+	close(release)
+
+	if pe, ok := (<-panicked).(*PanicError); !ok || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Errorf("caller that ran fn panicked with %v; want a *PanicError for boom", pe)
+	}
+	if pe, ok := (<-waiter).(*PanicError); !ok || pe.Value != "boom" || pe.Error() != "singleflight: panic in call: boom" {
+		t.Errorf("Do waiter error = %v; want a *PanicError for boom", pe)
+	}
+	if pe, ok := (<-ch).Err.(*PanicError); !ok || pe.Value != "boom" {
+		t.Errorf("DoChan waiter error = %v; want a *PanicError for boom", pe)
+	}
+
+	// The group is usable after the panic.
+	if v, err := g.Do("key", func() (interface{}, error) { return 1, nil }); v != 1 || err != nil {
+		t.Errorf("Do after panic = %v, %v; want 1, nil", v, err)
+	}
+}
+
+func TestGoexit(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	exited := make(chan bool)
+	go func() {
+		defer close(exited)
+		g.Do("key", func() (interface{}, error) {
+			<-release
+			runtime.Goexit()
+			return nil, nil
+		})
+	}()
+	time.Sleep(50 * time.Millisecond) // let the call above start
+	ch := g.DoChan("key", func() (interface{}, error) { return nil, nil })
+	close(release)
+	<-exited
+	if r := <-ch; r.Err != ErrGoexit {
+		t.Errorf("waiter error after Goexit = %v; want ErrGoexit", r.Err)
+	}
+
+	// DoContext runs fn in a goroutine of its own; its caller gets
+	// the Goexit as an error.
+	_, err := g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) {
+		runtime.Goexit()
+		return nil, nil
+	})
+	if err != ErrGoexit {
+		t.Errorf("DoContext error after Goexit = %v; want ErrGoexit", err)
+	}
+}
+
+func TestResultTTL(t *testing.T) {
+	g := Group{ResultTTL: 50 * time.Millisecond}
+	var calls int32
+	fn := func() (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	if v, _ := g.Do("key", fn); v != int32(1) {
+		t.Fatalf("first Do = %v; want 1", v)
+	}
+
+	// Calls just after the first completed share its result.
+	if v, _ := g.Do("key", fn); v != int32(1) {
+		t.Errorf("Do within ResultTTL = %v; want the kept result 1", v)
+	}
+	if r := <-g.DoChan("key", fn); r.Val != int32(1) || !r.Shared {
+		t.Errorf("DoChan within ResultTTL = %+v; want the kept result 1, shared", r)
+	}
+	if v, _ := g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) { return fn() }); v != int32(1) {
+		t.Errorf("DoContext within ResultTTL = %v; want the kept result 1", v)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := g.Do("key", fn); v != int32(2) {
+		t.Errorf("Do after ResultTTL = %v; want a new call's 2", v)
+	}
+	g.Forget("key")
+	if v, _ := g.Do("key", fn); v != int32(3) {
+		t.Errorf("Do after Forget = %v; want a new call's 3", v)
+	}
+
+	// Panics are not kept.
+	func() {
+		defer func() { recover() }()
+		g.Do("panic", func() (interface{}, error) { panic("boom") })
+	}()
+	if v, err := g.Do("panic", fn); err != nil || v != int32(4) {
+		t.Errorf("Do after a panic = %v, %v; want a new call's 4", v, err)
+	}
+}
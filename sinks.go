@@ -17,7 +17,14 @@ limitations under the License.
 package groupcache
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -25,7 +32,8 @@ import (
 // A Sink receives data from a Get call.
 //
 // Implementation of Getter must call exactly one of the Set methods
-// on success.
+// on success. A Getter may also call SetExpire, before or after the
+// Set method, to limit how long the value is cached.
 type Sink interface {
 	// SetString sets the value to s.
 	SetString(s string) error
@@ -38,6 +46,16 @@ type Sink interface {
 	// The caller retains ownership of m.
 	SetProto(m proto.Message) error
 
+	// SetReader sets the value to the contents of r, read until
+	// EOF. Sinks that write their value somewhere, like
+	// WriterSink, receive the data as it is read.
+	SetReader(r io.Reader) error
+
+	// SetExpire sets the time at which the value expires. Caches,
+	// including those of peers, stop serving the value at e. The
+	// zero time, the default, means the value never expires.
+	SetExpire(e time.Time)
+
 	// view returns a frozen view of the bytes for caching.
 	view() (ByteView, error)
 }
@@ -59,6 +77,9 @@ func setSinkView(s Sink, v ByteView) error {
 	if vs, ok := s.(viewSetter); ok {
 		return vs.setView(v)
 	}
+	if !v.e.IsZero() {
+		s.SetExpire(v.e)
+	}
 	if v.b != nil {
 		return s.SetBytes(v.b)
 	}
@@ -81,6 +102,21 @@ func (s *stringSink) view() (ByteView, error) {
 	return s.v, nil
 }
 
+func (s *stringSink) SetReader(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.v.b = nil
+	s.v.s = string(b)
+	*s.sp = s.v.s
+	return nil
+}
+
+func (s *stringSink) SetExpire(e time.Time) {
+	s.v.e = e
+}
+
 func (s *stringSink) SetString(v string) error {
 	s.v.b = nil
 	s.v.s = v
@@ -112,6 +148,7 @@ func ByteViewSink(dst *ByteView) Sink {
 
 type byteViewSink struct {
 	dst *ByteView
+	e   time.Time
 
 	// if this code ever ends up tracking that at least one set*
 	// method was called, don't make it an error to call set
@@ -125,9 +162,24 @@ type byteViewSink struct {
 
 func (s *byteViewSink) setView(v ByteView) error {
 	*s.dst = v
+	s.e = v.e
 	return nil
 }
 
+func (s *byteViewSink) SetReader(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	*s.dst = ByteView{b: b, e: s.e}
+	return nil
+}
+
+func (s *byteViewSink) SetExpire(e time.Time) {
+	s.e = e
+	s.dst.e = e
+}
+
 func (s *byteViewSink) view() (ByteView, error) {
 	return *s.dst, nil
 }
@@ -137,17 +189,17 @@ func (s *byteViewSink) SetProto(m proto.Message) error {
 	if err != nil {
 		return err
 	}
-	*s.dst = ByteView{b: b}
+	*s.dst = ByteView{b: b, e: s.e}
 	return nil
 }
 
 func (s *byteViewSink) SetBytes(b []byte) error {
-	*s.dst = ByteView{b: cloneBytes(b)}
+	*s.dst = ByteView{b: cloneBytes(b), e: s.e}
 	return nil
 }
 
 func (s *byteViewSink) SetString(v string) error {
-	*s.dst = ByteView{s: v}
+	*s.dst = ByteView{s: v, e: s.e}
 	return nil
 }
 
@@ -169,6 +221,23 @@ func (s *protoSink) view() (ByteView, error) {
 	return s.v, nil
 }
 
+func (s *protoSink) SetReader(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(b, s.dst); err != nil {
+		return err
+	}
+	s.v.b = b
+	s.v.s = ""
+	return nil
+}
+
+func (s *protoSink) SetExpire(e time.Time) {
+	s.v.e = e
+}
+
 func (s *protoSink) SetBytes(b []byte) error {
 	err := proto.Unmarshal(b, s.dst)
 	if err != nil {
@@ -208,6 +277,109 @@ func (s *protoSink) SetProto(m proto.Message) error {
 	return nil
 }
 
+// A Codec converts values to and from the bytes stored in a group,
+// for applications whose values aren't protocol buffers. JSONCodec
+// and GobCodec are provided; wrappers for msgpack, flatbuffers and
+// the like only need to supply the two methods.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	// JSONCodec encodes values with encoding/json.
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec encodes values with encoding/gob.
+	GobCodec Codec = gobCodec{}
+)
+
+// SetCodec encodes v with c and sets it as dest's value. It lets a
+// Getter fill a CodecSink without encoding the value by hand.
+func SetCodec(dest Sink, c Codec, v interface{}) error {
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return dest.SetBytes(b)
+}
+
+// CodecSink returns a sink that decodes values into dst with c.
+// dst must be a pointer, as for c.Unmarshal.
+func CodecSink(c Codec, dst interface{}) Sink {
+	return &codecSink{
+		c:   c,
+		dst: dst,
+	}
+}
+
+type codecSink struct {
+	c   Codec
+	dst interface{}
+
+	v ByteView // encoded
+}
+
+func (s *codecSink) view() (ByteView, error) {
+	return s.v, nil
+}
+
+func (s *codecSink) SetReader(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.setBytesOwned(b)
+}
+
+func (s *codecSink) SetExpire(e time.Time) {
+	s.v.e = e
+}
+
+func (s *codecSink) SetBytes(b []byte) error {
+	return s.setBytesOwned(cloneBytes(b))
+}
+
+func (s *codecSink) setBytesOwned(b []byte) error {
+	if err := s.c.Unmarshal(b, s.dst); err != nil {
+		return err
+	}
+	s.v.b = b
+	s.v.s = ""
+	return nil
+}
+
+func (s *codecSink) SetString(v string) error {
+	return s.setBytesOwned([]byte(v))
+}
+
+func (s *codecSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.setBytesOwned(b)
+}
+
 // AllocatingByteSliceSink returns a Sink that allocates
 // a byte slice to hold the received value and assigns
 // it to *dst. The memory is not retained by groupcache.
@@ -234,6 +406,18 @@ func (s *allocBytesSink) setView(v ByteView) error {
 	return nil
 }
 
+func (s *allocBytesSink) SetReader(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.setBytesOwned(b)
+}
+
+func (s *allocBytesSink) SetExpire(e time.Time) {
+	s.v.e = e
+}
+
 func (s *allocBytesSink) SetProto(m proto.Message) error {
 	b, err := proto.Marshal(m)
 	if err != nil {
@@ -283,6 +467,18 @@ func (s *truncBytesSink) view() (ByteView, error) {
 	return s.v, nil
 }
 
+func (s *truncBytesSink) SetReader(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.setBytesOwned(b)
+}
+
+func (s *truncBytesSink) SetExpire(e time.Time) {
+	s.v.e = e
+}
+
 func (s *truncBytesSink) SetProto(m proto.Message) error {
 	b, err := proto.Marshal(m)
 	if err != nil {
@@ -320,3 +516,140 @@ func (s *truncBytesSink) SetString(v string) error {
 	s.v.s = v
 	return nil
 }
+
+// WriterSink returns a Sink that writes the value to w as it arrives.
+// When the value is loaded with SetReader, or streamed from a peer
+// that implements StreamGetter, it is copied to w in chunks instead
+// of being held in memory as a whole first.
+//
+// A value may be partially written to w when Get returns an error.
+func WriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+type writerSink struct {
+	w io.Writer
+	v ByteView
+
+	// maxBuffer, if positive, is the most SetReader keeps of the
+	// value. Past it, oversize is set and the value is only
+	// written to w.
+	maxBuffer int64
+	oversize  bool
+}
+
+func (s *writerSink) view() (ByteView, error) {
+	return s.v, nil
+}
+
+func (s *writerSink) setView(v ByteView) error {
+	s.v = v
+	_, err := v.WriteTo(s.w)
+	return err
+}
+
+func (s *writerSink) SetExpire(e time.Time) {
+	s.v.e = e
+}
+
+func (s *writerSink) SetString(v string) error {
+	s.v.b = nil
+	s.v.s = v
+	_, err := io.WriteString(s.w, v)
+	return err
+}
+
+func (s *writerSink) SetBytes(b []byte) error {
+	s.v.b = cloneBytes(b)
+	s.v.s = ""
+	_, err := s.w.Write(b)
+	return err
+}
+
+func (s *writerSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	s.v.b = b
+	s.v.s = ""
+	_, err = s.w.Write(b)
+	return err
+}
+
+// SetReader copies r to the sink's writer, keeping a copy of the
+// value for the cache.
+func (s *writerSink) SetReader(r io.Reader) error {
+	buf := &cappedBuffer{max: s.maxBuffer}
+	if _, err := io.Copy(io.MultiWriter(s.w, buf), r); err != nil {
+		return err
+	}
+	s.oversize = buf.over
+	s.v.b = buf.buf.Bytes()
+	s.v.s = ""
+	return nil
+}
+
+// cappedBuffer buffers what is written to it, but if max is positive,
+// it drops its contents and ignores further writes once they exceed
+// max bytes.
+type cappedBuffer struct {
+	buf  bytes.Buffer
+	max  int64
+	over bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.over {
+		return len(p), nil
+	}
+	if b.max > 0 && int64(b.buf.Len()+len(p)) > b.max {
+		b.over = true
+		b.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// callerWriter writes a load's value to the writer of the caller that
+// started the load, until that caller stops waiting for it. Writes
+// after that, or after the writer fails, are dropped, so that a load
+// that outlives its caller never uses the caller's writer again.
+type callerWriter struct {
+	mu      sync.Mutex
+	w       io.Writer // nil once detached or failed
+	err     error     // from w
+	written bool      // v was written to w in full
+	v       ByteView
+}
+
+func (c *callerWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.w == nil {
+		return len(p), nil
+	}
+	if _, err := c.w.Write(p); err != nil {
+		c.w, c.err = nil, err
+	}
+	return len(p), nil
+}
+
+// done records that v, the loaded value, was written to the caller's
+// writer in full, unless the caller has already detached.
+func (c *callerWriter) done(v ByteView) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.w != nil {
+		c.written, c.v = true, v
+	}
+}
+
+// detach stops writes to the caller's writer. It returns the value
+// recorded by done, if any, and the error of the writer.
+func (c *callerWriter) detach() (v ByteView, written bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w = nil
+	return c.v, c.written, c.err
+}
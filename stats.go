@@ -0,0 +1,176 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// StatsSnapshot is a copy of a group's statistics at one point in
+// time, returned by Group.StatsSnapshot.
+type StatsSnapshot struct {
+	Gets           int64
+	CacheHits      int64
+	PeerLoads      int64
+	PeerErrors     int64
+	Loads          int64
+	LoadsDeduped   int64 // after singleflight
+	LocalLoads     int64
+	LocalLoadErrs  int64
+	ServerRequests int64
+	Refreshes      int64
+	NegativeHits   int64
+	LoadsShed      int64
+	OversizeLoads  int64
+	NotAdmitted    int64
+	HedgedLoads    int64
+	HedgeWins      int64
+	ReplicaLoads   int64
+
+	// DedupRate is the fraction of loads that shared the result of
+	// a concurrent load of the same key instead of running their
+	// own.
+	DedupRate float64
+
+	// MainCache and HotCache hold the hits, size, entries and
+	// evictions of each cache tier.
+	MainCache CacheStats
+	HotCache  CacheStats
+
+	// Peers holds the loads from each peer the group has fetched
+	// from, keyed by the peer's String method if it has one.
+	Peers map[string]PeerStats
+
+	// HotKeys holds the group's most requested keys, up to
+	// snapshotHotKeys of them, if GroupOptions.HotKeyCapacity is
+	// set. See Group.HotKeys.
+	HotKeys []HotKey `json:",omitempty"`
+}
+
+// snapshotHotKeys is the number of hot keys in a StatsSnapshot.
+const snapshotHotKeys = 10
+
+// PeerStats are the statistics of a group's fetches from one peer.
+type PeerStats struct {
+	Loads  int64 // values fetched successfully
+	Errors int64 // failed requests
+}
+
+type peerCounters struct {
+	loads, errors AtomicInt
+}
+
+// StatsSnapshot returns a snapshot of the group's statistics.
+func (g *Group) StatsSnapshot() StatsSnapshot {
+	s := StatsSnapshot{
+		Gets:           g.Stats.Gets.Get(),
+		CacheHits:      g.Stats.CacheHits.Get(),
+		PeerLoads:      g.Stats.PeerLoads.Get(),
+		PeerErrors:     g.Stats.PeerErrors.Get(),
+		Loads:          g.Stats.Loads.Get(),
+		LoadsDeduped:   g.Stats.LoadsDeduped.Get(),
+		LocalLoads:     g.Stats.LocalLoads.Get(),
+		LocalLoadErrs:  g.Stats.LocalLoadErrs.Get(),
+		ServerRequests: g.Stats.ServerRequests.Get(),
+		Refreshes:      g.Stats.Refreshes.Get(),
+		NegativeHits:   g.Stats.NegativeHits.Get(),
+		LoadsShed:      g.Stats.LoadsShed.Get(),
+		OversizeLoads:  g.Stats.OversizeLoads.Get(),
+		NotAdmitted:    g.Stats.NotAdmitted.Get(),
+		HedgedLoads:    g.Stats.HedgedLoads.Get(),
+		HedgeWins:      g.Stats.HedgeWins.Get(),
+		ReplicaLoads:   g.Stats.ReplicaLoads.Get(),
+		MainCache:      g.CacheStats(MainCache),
+		HotCache:       g.CacheStats(HotCache),
+		HotKeys:        g.HotKeys(snapshotHotKeys),
+	}
+	if s.Loads > 0 && s.LoadsDeduped <= s.Loads {
+		s.DedupRate = 1 - float64(s.LoadsDeduped)/float64(s.Loads)
+	}
+	g.peerStatsMu.Lock()
+	defer g.peerStatsMu.Unlock()
+	if len(g.peerStats) > 0 {
+		s.Peers = make(map[string]PeerStats, len(g.peerStats))
+		for name, c := range g.peerStats {
+			s.Peers[name] = PeerStats{Loads: c.loads.Get(), Errors: c.errors.Get()}
+		}
+	}
+	return s
+}
+
+// countPeerLoads records that n values were fetched from peer, or
+// that fetching from it failed with err.
+func (g *Group) countPeerLoads(peer interface{}, n int64, err error) {
+	name := peerName(peer)
+	g.peerStatsMu.Lock()
+	c := g.peerStats[name]
+	if c == nil {
+		c = new(peerCounters)
+		if g.peerStats == nil {
+			g.peerStats = make(map[string]*peerCounters)
+		}
+		g.peerStats[name] = c
+	}
+	g.peerStatsMu.Unlock()
+	if err != nil {
+		g.Stats.PeerErrors.Add(1)
+		c.errors.Add(1)
+		return
+	}
+	g.Stats.PeerLoads.Add(n)
+	c.loads.Add(n)
+}
+
+// peerName returns the name a peer is reported under in
+// StatsSnapshot.Peers.
+func peerName(peer interface{}) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T(%p)", peer, peer)
+}
+
+// StatsHandler returns a handler that serves the StatsSnapshot of
+// every group as a JSON object keyed by group name. If the request has
+// a "group" query parameter, only that group is served.
+func StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var gs []*Group
+		if name := r.URL.Query().Get("group"); name != "" {
+			g := GetGroup(name)
+			if g == nil {
+				http.Error(w, "no such group: "+name, http.StatusNotFound)
+				return
+			}
+			gs = append(gs, g)
+		} else {
+			mu.RLock()
+			for _, g := range groups {
+				gs = append(gs, g)
+			}
+			mu.RUnlock()
+		}
+		snapshots := make(map[string]StatsSnapshot, len(gs))
+		for _, g := range gs {
+			snapshots[g.Name()] = g.StatsSnapshot()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshots)
+	})
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type namedPeer struct {
+	fakePeer
+	name string
+}
+
+func (p *namedPeer) String() string { return p.name }
+
+func TestStatsSnapshot(t *testing.T) {
+	good := &namedPeer{name: "good"}
+	bad := &namedPeer{name: "bad", fakePeer: fakePeer{fail: true}}
+	g := newGroup("stats-snapshot-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), fakePeers{good, bad, nil}, &GroupOptions{DisableHotCache: true})
+
+	var s string
+	for i := 0; i < 20; i++ {
+		if err := g.Get(dummyCtx, fmt.Sprint("k", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if good.hits == 0 || bad.hits == 0 {
+		t.Fatalf("keys didn't reach both peers: good %d, bad %d", good.hits, bad.hits)
+	}
+	snap := g.StatsSnapshot()
+	if snap.Gets != 20 {
+		t.Errorf("Gets = %d; want 20", snap.Gets)
+	}
+	if got, want := snap.PeerLoads, int64(good.hits); got != want {
+		t.Errorf("PeerLoads = %d; want %d", got, want)
+	}
+	if got, want := snap.Peers["good"], (PeerStats{Loads: int64(good.hits)}); got != want {
+		t.Errorf("Peers[good] = %+v; want %+v", got, want)
+	}
+	if got, want := snap.Peers["bad"], (PeerStats{Errors: int64(bad.hits)}); got != want {
+		t.Errorf("Peers[bad] = %+v; want %+v", got, want)
+	}
+	if snap.PeerErrors != int64(bad.hits) {
+		t.Errorf("PeerErrors = %d; want %d", snap.PeerErrors, bad.hits)
+	}
+	if snap.MainCache.Items != snap.LocalLoads {
+		t.Errorf("MainCache.Items = %d; want LocalLoads %d", snap.MainCache.Items, snap.LocalLoads)
+	}
+	if snap.DedupRate != 0 {
+		t.Errorf("DedupRate = %v; want 0 for serial loads", snap.DedupRate)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	g := newGroup("stats-handler-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, &GroupOptions{HotKeyCapacity: 10})
+	var s string
+	for _, key := range []string{"hot", "cold", "hot", "hot"} {
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hot := g.StatsSnapshot().HotKeys; len(hot) != 2 || hot[0].Key != "hot" || hot[0].Gets != 3 {
+		t.Errorf("snapshot HotKeys = %+v; want hot with 3 gets, then cold", hot)
+	}
+
+	srv := httptest.NewServer(StatsHandler())
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "?group=" + g.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var snapshots map[string]StatsSnapshot
+	if err := json.NewDecoder(res.Body).Decode(&snapshots); err != nil {
+		t.Fatal(err)
+	}
+	snap, ok := snapshots[g.Name()]
+	if len(snapshots) != 1 || !ok {
+		t.Fatalf("served snapshots of %d groups, group present %v; want only %s", len(snapshots), ok, g.Name())
+	}
+	if snap.Gets != 4 || len(snap.HotKeys) == 0 || snap.HotKeys[0].Key != "hot" {
+		t.Errorf("served snapshot = %+v; want 4 gets with hot key first", snap)
+	}
+
+	res, err = http.Get(srv.URL + "?group=no-such-group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("status for unknown group = %d; want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
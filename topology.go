@@ -0,0 +1,123 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// topology.go keeps peer requests within a zone where it can.
+
+package groupcache
+
+import (
+	"io"
+	"sync"
+)
+
+// ZoneStats are the statistics of the requests an HTTPPool sent to the
+// peers of one zone.
+type ZoneStats struct {
+	Requests int64 // requests that got a response
+	Errors   int64 // requests that could not reach the peer
+	Bytes    int64 // response body bytes, as sent over the network
+}
+
+type zoneCounters struct {
+	requests, errors, bytes AtomicInt
+}
+
+// SetZones labels peers, keyed by the base URLs passed to Set, with
+// the zones they run in. Peers left out are in no zone. The labels are
+// kept across calls to Set.
+func (p *HTTPPool) SetZones(zones map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.zones = make(map[string]string, len(zones))
+	for peer, zone := range zones {
+		p.zones[peer] = zone
+	}
+}
+
+// zoneReplicaLocked returns the peer to fetch key from instead of
+// primary, its primary owner, or "" to fetch it from primary: the
+// first replica of key in p's zone if primary is in another zone. All
+// peers of the zone agree on that replica, which itself fetches the
+// key from the primary. p.mu must be held.
+func (p *HTTPPool) zoneReplicaLocked(key, primary string) string {
+	zone := p.opts.Zone
+	if zone == "" || p.opts.Owners <= 1 || p.zones[primary] == zone || primary == p.self {
+		return ""
+	}
+	replicas := p.replicasLocked(key, primary)
+	if len(replicas) == 0 || p.zones[replicas[0]] != zone || replicas[0] == p.self {
+		return ""
+	}
+	return replicas[0]
+}
+
+// countZone records a request to peer that got n response body bytes,
+// or failed with err.
+func (p *HTTPPool) countZone(peer string, n int64, err error) {
+	p.mu.Lock()
+	zone := p.zones[peer]
+	c := p.zoneTraffic[zone]
+	if c == nil {
+		c = new(zoneCounters)
+		if p.zoneTraffic == nil {
+			p.zoneTraffic = make(map[string]*zoneCounters)
+		}
+		p.zoneTraffic[zone] = c
+	}
+	p.mu.Unlock()
+	if err != nil {
+		c.errors.Add(1)
+		return
+	}
+	c.requests.Add(1)
+	c.bytes.Add(n)
+}
+
+// ZoneStats returns the statistics of the requests sent to each zone,
+// keyed by zone. Requests to peers in no zone are under "".
+func (p *HTTPPool) ZoneStats() map[string]ZoneStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]ZoneStats, len(p.zoneTraffic))
+	for zone, c := range p.zoneTraffic {
+		stats[zone] = ZoneStats{
+			Requests: c.requests.Get(),
+			Errors:   c.errors.Get(),
+			Bytes:    c.bytes.Get(),
+		}
+	}
+	return stats
+}
+
+// trafficBody counts the bytes read from a response body, and passes
+// the count to done when the body is closed.
+type trafficBody struct {
+	io.ReadCloser
+	n    int64
+	done func(n int64, err error)
+	once sync.Once
+}
+
+func (b *trafficBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *trafficBody) Close() error {
+	b.once.Do(func() { b.done(b.n, nil) })
+	return b.ReadCloser.Close()
+}
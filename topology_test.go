@@ -0,0 +1,110 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestHTTPPoolZones(t *testing.T) {
+	const self = "http://self"
+	peers := []string{self, "http://b1", "http://a1", "http://b2"}
+	zones := map[string]string{self: "a", "http://a1": "a", "http://b1": "b", "http://b2": "b"}
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas, Owners: 4, Zone: "a"}}
+	p.Set(peers...)
+	p.SetZones(zones)
+	getterPeer := make(map[ProtoGetter]string)
+	for peer, g := range p.httpGetters {
+		getterPeer[g] = peer
+	}
+
+	// Every peer owns every key, so keys are fetched in zone a, from
+	// the zone's first replica, which fetches them from the primary.
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			continue
+		}
+		primary := p.peers.Get(key)
+		first := p.replicasLocked(key, primary)[0]
+		want := "http://a1"
+		if first == self {
+			want = primary
+		}
+		if got := getterPeer[peer]; got != want {
+			t.Fatalf("PickPeer(%q) = %s; want %s", key, got, want)
+		}
+		if want != "http://a1" {
+			continue
+		}
+		replicas := p.PickReplicas(key)
+		if len(replicas) != 2 {
+			t.Fatalf("PickReplicas(%q) returned %d replicas; want 2", key, len(replicas))
+		}
+		if primary != "http://a1" && getterPeer[replicas[0]] != primary {
+			t.Errorf("PickReplicas(%q) = %v, %v; want the primary %s first", key, getterPeer[replicas[0]], getterPeer[replicas[1]], primary)
+		}
+	}
+
+	// Without a Zone, the primary is used.
+	p.opts.Zone = ""
+	picked := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		if peer, ok := p.PickPeer(fmt.Sprintf("key-%d", i)); ok {
+			picked[getterPeer[peer]] = true
+		}
+	}
+	if !picked["http://b1"] || !picked["http://b2"] {
+		t.Errorf("picked %v; want peers in zone b too", picked)
+	}
+}
+
+func TestHTTPPoolZoneStats(t *testing.T) {
+	g := newGroup("TestHTTPPoolZoneStats-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	srv := httptest.NewServer(&HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}})
+	defer srv.Close()
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas}}
+	p.Set(srv.URL, down.URL)
+	p.SetZones(map[string]string{srv.URL: "a"})
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}
+	if err := p.httpGetters[srv.URL].Get(dummyCtx, req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.httpGetters[down.URL].Get(dummyCtx, req, &pb.GetResponse{}); err == nil {
+		t.Fatal("Get from a closed server succeeded")
+	}
+
+	stats := p.ZoneStats()
+	if s := stats["a"]; s.Requests != 1 || s.Errors != 0 || s.Bytes == 0 {
+		t.Errorf("zone a stats = %+v; want 1 request with bytes", s)
+	}
+	if s := stats[""]; s.Requests != 0 || s.Errors != 1 {
+		t.Errorf("unlabeled stats = %+v; want 1 error", s)
+	}
+}
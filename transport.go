@@ -0,0 +1,179 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// transport.go lets peers talk over RPC layers other than HTTP.
+
+package groupcache
+
+import (
+	"sync"
+
+	"github.com/golang/groupcache/consistenthash"
+)
+
+// Transport is the interface that must be implemented by an RPC layer
+// that carries requests between peers, such as Thrift, QUIC or calls
+// within one process. A TransportPool picks peers over any Transport;
+// HTTPPool implements Transport over HTTP.
+//
+// The server side of a Transport answers requests with LocalPeer.
+type Transport interface {
+	// NewPeer returns a ProtoGetter whose Get makes round trips to
+	// the peer at addr. The ProtoGetter may also implement Remover,
+	// Setter, StreamGetter, BatchGetter and GenerationSetter.
+	NewPeer(addr string) (ProtoGetter, error)
+
+	// ClosePeer releases what NewPeer holds for peer, once peer is
+	// no longer in the pool.
+	ClosePeer(peer ProtoGetter) error
+}
+
+// NewPeer implements Transport. addr is a base URL, as passed to Set.
+func (p *HTTPPool) NewPeer(addr string) (ProtoGetter, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.newGetterLocked(addr, p.transportLocked()), nil
+}
+
+// ClosePeer implements Transport. The connections of an HTTPPool are
+// shared by its peers, so there is nothing to release.
+func (p *HTTPPool) ClosePeer(peer ProtoGetter) error {
+	return nil
+}
+
+// TransportPool implements PeerPicker for a pool of peers reached over
+// a Transport. A peer's ProtoGetter is kept across calls to Set while
+// the peer stays in the pool.
+type TransportPool struct {
+	// this peer's address, as it appears in the list passed to Set
+	self string
+
+	transport Transport
+
+	// opts specifies the options.
+	opts TransportPoolOptions
+
+	mu      sync.Mutex // guards peers and getters
+	peers   *consistenthash.Map
+	getters map[string]ProtoGetter // keyed by address
+}
+
+// TransportPoolOptions are the configurations of a TransportPool.
+type TransportPoolOptions struct {
+	// Replicas specifies the number of key replicas on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+}
+
+// NewTransportPool initializes a pool of peers reached over t with
+// the given options, and registers it as the PeerPicker. The self
+// argument is the address of the current server, as it appears in the
+// list passed to Set.
+func NewTransportPool(self string, t Transport, o *TransportPoolOptions) *TransportPool {
+	p := newTransportPool(self, t, o)
+	RegisterPeerPicker(func() PeerPicker { return p })
+	return p
+}
+
+func newTransportPool(self string, t Transport, o *TransportPoolOptions) *TransportPool {
+	p := &TransportPool{
+		self:      self,
+		transport: t,
+		getters:   make(map[string]ProtoGetter),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	return p
+}
+
+// Set updates the pool's list of peers. Peers no longer in the list
+// are closed with the Transport's ClosePeer. A peer that NewPeer fails
+// for is left without a getter, and its keys are loaded locally until
+// the next Set.
+func (p *TransportPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers.Set(peers...)
+	getters := make(map[string]ProtoGetter, len(peers))
+	for _, peer := range peers {
+		if peer == p.self {
+			continue
+		}
+		if g, ok := p.getters[peer]; ok {
+			getters[peer] = g
+			delete(p.getters, peer)
+			continue
+		}
+		g, err := p.transport.NewPeer(peer)
+		if err != nil {
+			continue
+		}
+		getters[peer] = g
+	}
+	for _, g := range p.getters {
+		p.transport.ClosePeer(g)
+	}
+	p.getters = getters
+}
+
+// PickPeer implements PeerPicker.
+func (p *TransportPool) PickPeer(key string) (ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil, false
+	}
+	if g, ok := p.getters[p.peers.Get(key)]; ok {
+		return g, true
+	}
+	return nil, false
+}
+
+// AllPeers implements PeerLister.
+func (p *TransportPool) AllPeers() []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]ProtoGetter, 0, len(p.getters))
+	for _, g := range p.getters {
+		peers = append(peers, g)
+	}
+	return peers
+}
+
+// Close closes all peers and empties the pool. It returns the first
+// error from the Transport's ClosePeer.
+func (p *TransportPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for _, g := range p.getters {
+		if cerr := p.transport.ClosePeer(g); err == nil {
+			err = cerr
+		}
+	}
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.getters = make(map[string]ProtoGetter)
+	return err
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+var _ Transport = (*HTTPPool)(nil)
+
+// fakeTransport reaches in-process fakePeers by address.
+type fakeTransport struct {
+	peers  map[string]*fakePeer
+	opened map[string]int
+	closed []ProtoGetter
+}
+
+func (t *fakeTransport) NewPeer(addr string) (ProtoGetter, error) {
+	peer, ok := t.peers[addr]
+	if !ok {
+		return nil, errors.New("unreachable: " + addr)
+	}
+	t.opened[addr]++
+	return peer, nil
+}
+
+func (t *fakeTransport) ClosePeer(peer ProtoGetter) error {
+	t.closed = append(t.closed, peer)
+	return nil
+}
+
+func TestTransportPool(t *testing.T) {
+	a, b := &fakePeer{}, &fakePeer{}
+	tr := &fakeTransport{
+		peers:  map[string]*fakePeer{"a": a, "b": b},
+		opened: make(map[string]int),
+	}
+	p := newTransportPool("self", tr, nil)
+	p.Set("self", "a", "b", "down")
+
+	picked := map[ProtoGetter]bool{}
+	local := 0
+	for i := 0; i < 100; i++ {
+		peer, ok := p.PickPeer(string(rune('a' + i)))
+		if !ok {
+			local++
+			continue
+		}
+		picked[peer] = true
+	}
+	if !picked[a] || !picked[b] || len(picked) != 2 {
+		t.Errorf("picked %d peers; want a and b", len(picked))
+	}
+	if local == 0 {
+		t.Error("no keys owned by self or the unreachable peer")
+	}
+	if n := len(p.AllPeers()); n != 2 {
+		t.Errorf("AllPeers returned %d peers; want 2", n)
+	}
+
+	p.Set("self", "a")
+	if tr.opened["a"] != 1 {
+		t.Errorf("peer a opened %d times; want 1", tr.opened["a"])
+	}
+	if len(tr.closed) != 1 || tr.closed[0] != b {
+		t.Errorf("closed %v; want peer b", tr.closed)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.closed) != 2 || tr.closed[1] != a {
+		t.Errorf("Close closed %v; want peers b and a", tr.closed)
+	}
+	if _, ok := p.PickPeer("key"); ok {
+		t.Error("closed pool picked a peer")
+	}
+}
+
+func TestHTTPPoolNewPeer(t *testing.T) {
+	g := newGroup("TestHTTPPoolNewPeer-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+	p := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	peer, err := p.NewPeer(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.ClosePeer(peer)
+	var res pb.GetResponse
+	if err := peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.GetValue()); got != "value:key" {
+		t.Errorf("Get = %q; want %q", got, "value:key")
+	}
+}
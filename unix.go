@@ -0,0 +1,74 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// unix.go carries peer requests over UNIX domain sockets, for peers on
+// the same host.
+
+package groupcache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const unixScheme = "unix://"
+
+// unixSocket returns the socket path of a peer URL like
+// "unix:///var/run/groupcache.sock", or "" if peer is not such a URL.
+func unixSocket(peer string) string {
+	if !strings.HasPrefix(peer, unixScheme) {
+		return ""
+	}
+	return peer[len(unixScheme):]
+}
+
+// unixTransportLocked returns the transport for requests to the peer
+// on the UNIX domain socket at socket. Requests to such peers are sent
+// in plain HTTP, as they never leave the host. p.mu must be held.
+func (p *HTTPPool) unixTransportLocked(socket string) func(context.Context) http.RoundTripper {
+	tr, ok := p.unixTransports[socket]
+	if !ok {
+		if p.unixTransports == nil {
+			p.unixTransports = make(map[string]http.RoundTripper)
+		}
+		tr = newClientTransport(&p.opts, socket)
+		p.unixTransports[socket] = tr
+	}
+	return func(context.Context) http.RoundTripper { return tr }
+}
+
+// listenUnix listens on the UNIX domain socket at socket, replacing a
+// socket file left behind by a process that exited without closing it.
+func listenUnix(socket string) (net.Listener, error) {
+	l, err := net.Listen("unix", socket)
+	if err == nil {
+		return l, nil
+	}
+	fi, serr := os.Stat(socket)
+	if serr != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil, err
+	}
+	if c, derr := net.Dial("unix", socket); derr == nil {
+		// Another server is listening on it.
+		c.Close()
+		return nil, err
+	}
+	os.Remove(socket)
+	return net.Listen("unix", socket)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestUnixSocket(t *testing.T) {
+	for peer, want := range map[string]string{
+		"unix:///var/run/groupcache.sock": "/var/run/groupcache.sock",
+		"http://example.net:8000":         "",
+		"unix":                            "",
+	} {
+		if got := unixSocket(peer); got != want {
+			t.Errorf("unixSocket(%q) = %q; want %q", peer, got, want)
+		}
+	}
+}
+
+func TestHTTPPoolUnixPeer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groupcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "peer.sock")
+
+	g := newGroup("TestHTTPPoolUnixPeer-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+	server := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	l, err := listenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, server)
+
+	client := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath, Replicas: defaultReplicas}}
+	client.Set("unix://" + socket)
+	peer, ok := client.PickPeer("key")
+	if !ok {
+		t.Fatal("no peer picked")
+	}
+	var res pb.GetResponse
+	if err := peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("key")}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.GetValue()); got != "value:key" {
+		t.Errorf("Get = %q; want %q", got, "value:key")
+	}
+}
+
+func TestListenUnixStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groupcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "peer.sock")
+
+	// Leave a socket file behind, as a crashed server would.
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = listenUnix(socket)
+	if err != nil {
+		t.Fatalf("listenUnix over a stale socket: %v", err)
+	}
+	defer l.Close()
+	if _, err := listenUnix(socket); err == nil {
+		t.Error("listenUnix replaced a live socket")
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WarmOptions control how Group.Warm loads keys.
+type WarmOptions struct {
+	// Concurrency is the maximum number of keys loaded at once.
+	// If zero, keys are loaded one at a time.
+	Concurrency int
+
+	// Rate, if positive, is the maximum number of keys started per
+	// second.
+	Rate float64
+
+	// OnError, if non-nil, is called with each key that fails to
+	// load. It may be called concurrently.
+	OnError func(key string, err error)
+}
+
+// Warm loads keys into the group's caches, as if each were passed to
+// Get, so that a freshly started process doesn't send all of its first
+// requests to the backends. Keys owned by a peer are fetched from it,
+// which also fills that peer's cache. Warm tries every key even after
+// a failure, and returns the first error, or ctx.Err() if ctx is done
+// before all keys are started.
+func (g *Group) Warm(ctx context.Context, keys []string, opts WarmOptions) error {
+	n := opts.Concurrency
+	if n <= 0 {
+		n = 1
+	}
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	sem := make(chan struct{}, n)
+	next := time.Now()
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			wg.Wait()
+			return err
+		}
+		if interval > 0 {
+			if wait := time.Until(next); wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					wg.Wait()
+					return ctx.Err()
+				}
+			}
+			next = next.Add(interval)
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var v ByteView
+			if err := g.Get(ctx, key, ByteViewSink(&v)); err != nil {
+				setErr(err)
+				if opts.OnError != nil {
+					opts.OnError(key, err)
+				}
+			}
+		}(key)
+	}
+	wg.Wait()
+	return firstErr
+}
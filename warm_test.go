@@ -0,0 +1,86 @@
+/*
+Copyright 2012 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarm(t *testing.T) {
+	var running, maxRunning int32
+	errBad := errors.New("bad key")
+	g := NewGroup("warm-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		if key == "bad" {
+			return errBad
+		}
+		return dest.SetString("v")
+	}))
+	keys := []string{"bad"}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprint("k", i))
+	}
+	var failed []string
+	err := g.Warm(dummyCtx, keys, WarmOptions{
+		Concurrency: 3,
+		OnError:     func(key string, err error) { failed = append(failed, key) },
+	})
+	if err != errBad {
+		t.Errorf("Warm = %v; want %v", err, errBad)
+	}
+	if len(failed) != 1 || failed[0] != "bad" {
+		t.Errorf("failed keys = %q; want [bad]", failed)
+	}
+	if n := atomic.LoadInt32(&maxRunning); n > 3 {
+		t.Errorf("%d concurrent loads; want at most 3", n)
+	}
+	if n := g.CacheStats(MainCache).Items; n != 20 {
+		t.Errorf("%d items cached; want 20", n)
+	}
+}
+
+func TestWarmRate(t *testing.T) {
+	g := NewGroup("warm-rate-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}))
+	start := time.Now()
+	if err := g.Warm(dummyCtx, []string{"a", "b", "c", "d", "e"}, WarmOptions{Concurrency: 5, Rate: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("warming 5 keys at 100/s took %v; want at least 40ms", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Warm(ctx, []string{"x", "y"}, WarmOptions{Rate: 1}); err != context.Canceled {
+		t.Errorf("Warm with canceled context = %v; want %v", err, context.Canceled)
+	}
+}